@@ -1,11 +1,15 @@
 package baseapp
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"os"
 	"sort"
+	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
 	abci "github.com/tendermint/tendermint/abci/types"
 
@@ -17,6 +21,10 @@ import (
 // InitChain implements the ABCI interface. It runs the initialization logic
 // directly on the CommitMultiStore.
 func (app *BaseApp) InitChain(req abci.RequestInitChain) (res abci.ResponseInitChain) {
+	if err := app.errForensicMode("InitChain"); err != nil {
+		panic(err)
+	}
+
 	// stash the consensus params in the cms main store and memoize
 	if req.ConsensusParams != nil {
 		app.setConsensusParams(req.ConsensusParams)
@@ -29,14 +37,22 @@ func (app *BaseApp) InitChain(req abci.RequestInitChain) (res abci.ResponseInitC
 	app.setDeliverState(initHeader)
 	app.setCheckState(initHeader)
 
-	if app.initChainer == nil {
-		return
-	}
+	switch {
+	case app.genesisChunkHandler != nil:
+		res = app.runStreamingGenesis(req)
+
+	case app.upgradeInitChainer != nil && isUpgradeGenesis(req.AppStateBytes):
+		res = app.runUpgradeInitChainer(req)
 
-	// add block gas meter for any genesis transactions (allow infinite gas)
-	app.deliverState.ctx = app.deliverState.ctx.WithBlockGasMeter(sdk.NewInfiniteGasMeter())
+	case app.initChainer != nil:
+		// add block gas meter for any genesis transactions (allow infinite gas)
+		app.deliverState.ctx = app.deliverState.ctx.WithBlockGasMeter(sdk.NewInfiniteGasMeter())
 
-	res = app.initChainer(app.deliverState.ctx, req)
+		res = app.initChainer(app.deliverState.ctx, req)
+
+	default:
+		return
+	}
 
 	// sanity check
 	if len(req.Validators) > 0 {
@@ -75,12 +91,6 @@ func (app *BaseApp) Info(req abci.RequestInfo) abci.ResponseInfo {
 	}
 }
 
-// SetOption implements the ABCI interface.
-func (app *BaseApp) SetOption(req abci.RequestSetOption) (res abci.ResponseSetOption) {
-	// TODO: Implement!
-	return
-}
-
 // FilterPeerByAddrPort filters peers by address/port.
 func (app *BaseApp) FilterPeerByAddrPort(info string) abci.ResponseQuery {
 	if app.addrPeerFilter != nil {
@@ -99,6 +109,13 @@ func (app *BaseApp) FilterPeerByID(info string) abci.ResponseQuery {
 
 // BeginBlock implements the ABCI application interface.
 func (app *BaseApp) BeginBlock(req abci.RequestBeginBlock) (res abci.ResponseBeginBlock) {
+	if err := app.errForensicMode("BeginBlock"); err != nil {
+		panic(err)
+	}
+
+	app.blockTimings = ABCITimings{}
+	defer app.startABCITimer(&app.blockTimings.BeginBlock)()
+
 	if app.cms.TracingEnabled() {
 		app.cms.SetTracingContext(sdk.TraceContext(
 			map[string]interface{}{"blockHeight": req.Header.Height},
@@ -106,9 +123,24 @@ func (app *BaseApp) BeginBlock(req abci.RequestBeginBlock) (res abci.ResponseBeg
 	}
 
 	if err := app.validateHeight(req); err != nil {
-		panic(err)
+		app.rejectHeight(req, err)
+		return res
 	}
+	app.lastHeightErr = nil
+
+	app.recordBeginBlock(req)
+	app.blockSummary = blockSummary{}
+
+	res = app.beginBlock(req)
+
+	// set the signed validators for addition to context in deliverTx
+	app.voteInfos = req.LastCommitInfo.GetVotes()
+	return res
+}
 
+// beginBlock sets up the deliverState for the block and runs the
+// BeginBlocker. It leaves the block bookkeeping of the BaseApp untouched.
+func (app *BaseApp) beginBlock(req abci.RequestBeginBlock) (res abci.ResponseBeginBlock) {
 	// Initialize the DeliverTx state. If this is the first block, it should
 	// already be initialized in InitChain. Otherwise app.deliverState will be
 	// nil, since it is reset on Commit.
@@ -123,35 +155,60 @@ func (app *BaseApp) BeginBlock(req abci.RequestBeginBlock) (res abci.ResponseBeg
 	}
 
 	// add block gas meter
-	var gasMeter sdk.GasMeter
-	if maxGas := app.getMaximumBlockGas(); maxGas > 0 {
-		gasMeter = sdk.NewGasMeter(maxGas)
-	} else {
-		gasMeter = sdk.NewInfiniteGasMeter()
-	}
+	app.deliverState.ctx = app.deliverState.ctx.WithBlockGasMeter(app.newGasMeter(app.getMaximumBlockGas()))
 
-	app.deliverState.ctx = app.deliverState.ctx.WithBlockGasMeter(gasMeter)
+	if app.randomnessSeeder != nil {
+		app.deliverState.ctx = app.deliverState.ctx.WithValue(blockRandomnessSeedKey{}, app.randomnessSeeder(req))
+	}
 
 	if app.beginBlocker != nil {
-		res = app.beginBlocker(app.deliverState.ctx, req)
+		app.runBlocker("BeginBlocker", func(ctx sdk.Context) {
+			res = app.beginBlocker(ctx, req)
+		})
 	}
 
-	// set the signed validators for addition to context in deliverTx
-	app.voteInfos = req.LastCommitInfo.GetVotes()
 	return res
 }
 
 // EndBlock implements the ABCI interface.
 func (app *BaseApp) EndBlock(req abci.RequestEndBlock) (res abci.ResponseEndBlock) {
+	if err := app.errForensicMode("EndBlock"); err != nil {
+		panic(err)
+	}
+
+	if err := app.errRejectedBlock("EndBlock"); err != nil {
+		app.logger.Error("skipped EndBlock", "err", err)
+		return res
+	}
+
+	defer app.startABCITimer(&app.blockTimings.EndBlock)()
+
+	res = app.endBlock(req)
+
+	if app.validatorUpdateTransformer != nil {
+		res.ValidatorUpdates = app.validatorUpdateTransformer(app.deliverState.ctx, res.ValidatorUpdates)
+	}
+
+	res = app.appendBlockSummaryEvent(res)
+	app.recordEndBlock(req)
+
+	return
+}
+
+// endBlock runs the EndBlocker on the deliverState. It leaves the block
+// bookkeeping of the BaseApp untouched.
+func (app *BaseApp) endBlock(req abci.RequestEndBlock) (res abci.ResponseEndBlock) {
 	if app.deliverState.ms.TracingEnabled() {
 		app.deliverState.ms = app.deliverState.ms.SetTracingContext(nil).(sdk.CacheMultiStore)
 	}
 
 	if app.endBlocker != nil {
-		res = app.endBlocker(app.deliverState.ctx, req)
+		app.runBlocker("EndBlocker", func(ctx sdk.Context) {
+			res = app.endBlocker(ctx, req)
+		})
 	}
 
-	return
+	return res
 }
 
 // CheckTx implements the ABCI interface and executes a tx in CheckTx mode. In
@@ -161,8 +218,13 @@ func (app *BaseApp) EndBlock(req abci.RequestEndBlock) (res abci.ResponseEndBloc
 // will contain releveant error information. Regardless of tx execution outcome,
 // the ResponseCheckTx will contain relevant gas execution context.
 func (app *BaseApp) CheckTx(req abci.RequestCheckTx) abci.ResponseCheckTx {
-	tx, err := app.txDecoder(req.Tx)
+	if err := app.errForensicMode("CheckTx"); err != nil {
+		return sdkerrors.ResponseCheckTx(err, 0, 0)
+	}
+
+	tx, err := app.decodeTx(req.Tx)
 	if err != nil {
+		app.mempoolStats.recordDecodeFailed()
 		return sdkerrors.ResponseCheckTx(err, 0, 0)
 	}
 
@@ -179,9 +241,15 @@ func (app *BaseApp) CheckTx(req abci.RequestCheckTx) abci.ResponseCheckTx {
 		panic(fmt.Sprintf("unknown RequestCheckTx type: %s", req.Type))
 	}
 
-	gInfo, result, err := app.runTx(mode, req.Tx, tx)
+	gasBreakdown := app.newGasBreakdown()
+	gInfo, result, err := app.runTxWithGasBreakdown(
+		app.getContextForTx(mode, req.Tx), mode, req.Tx, tx, gasBreakdown,
+	)
+	app.mempoolStats.recordCheckTx(err)
 	if err != nil {
-		return sdkerrors.ResponseCheckTx(err, gInfo.GasWanted, gInfo.GasUsed)
+		res := sdkerrors.ResponseCheckTx(err, gInfo.GasWanted, gInfo.GasUsed)
+		res.Events = gasBreakdown.appendEvent(res.Events)
+		return res
 	}
 
 	return abci.ResponseCheckTx{
@@ -189,7 +257,7 @@ func (app *BaseApp) CheckTx(req abci.RequestCheckTx) abci.ResponseCheckTx {
 		GasUsed:   int64(gInfo.GasUsed),   // TODO: Should type accept unsigned ints?
 		Log:       result.Log,
 		Data:      result.Data,
-		Events:    result.Events,
+		Events:    gasBreakdown.appendEvent(result.Events),
 	}
 }
 
@@ -199,22 +267,50 @@ func (app *BaseApp) CheckTx(req abci.RequestCheckTx) abci.ResponseCheckTx {
 // Regardless of tx execution outcome, the ResponseDeliverTx will contain relevant
 // gas execution context.
 func (app *BaseApp) DeliverTx(req abci.RequestDeliverTx) abci.ResponseDeliverTx {
-	tx, err := app.txDecoder(req.Tx)
+	defer app.startABCITimer(&app.blockTimings.DeliverTx)()
+
+	if err := app.errForensicMode("DeliverTx"); err != nil {
+		return app.responseDeliverTx(err, 0, 0)
+	}
+
+	if err := app.errRejectedBlock("DeliverTx"); err != nil {
+		return app.responseDeliverTx(err, 0, 0)
+	}
+
+	app.recordDeliverTx(req)
+
+	tx, err := app.decodeDeliverTx(req.Tx)
 	if err != nil {
-		return sdkerrors.ResponseDeliverTx(err, 0, 0)
+		return app.responseDeliverTx(err, 0, 0)
 	}
 
-	gInfo, result, err := app.runTx(runTxModeDeliver, req.Tx, tx)
+	gasBreakdown := app.newGasBreakdown()
+	gInfo, result, err := app.runTxWithGasBreakdown(
+		app.getContextForTx(runTxModeDeliver, req.Tx), runTxModeDeliver, req.Tx, tx, gasBreakdown,
+	)
+
+	return app.deliverTxResponse(gInfo, result, err, gasBreakdown)
+}
+
+// deliverTxResponse returns the ResponseDeliverTx of a tx executed in
+// DeliverTx mode.
+func (app *BaseApp) deliverTxResponse(
+	gInfo sdk.GasInfo, result *sdk.Result, err error, gasBreakdown *GasBreakdown,
+) abci.ResponseDeliverTx {
 	if err != nil {
-		return sdkerrors.ResponseDeliverTx(err, gInfo.GasWanted, gInfo.GasUsed)
+		res := app.responseDeliverTx(err, gInfo.GasWanted, gInfo.GasUsed)
+		res.Events = gasBreakdown.appendEvent(res.Events)
+		return res
 	}
 
+	app.recordBlockSummaryTx(gInfo.GasUsed)
+
 	return abci.ResponseDeliverTx{
 		GasWanted: int64(gInfo.GasWanted), // TODO: Should type accept unsigned ints?
 		GasUsed:   int64(gInfo.GasUsed),   // TODO: Should type accept unsigned ints?
 		Log:       result.Log,
 		Data:      result.Data,
-		Events:    result.Events,
+		Events:    gasBreakdown.appendEvent(result.Events),
 	}
 }
 
@@ -226,40 +322,79 @@ func (app *BaseApp) DeliverTx(req abci.RequestDeliverTx) abci.ResponseDeliverTx
 // against that height and gracefully halt if it matches the latest committed
 // height.
 func (app *BaseApp) Commit() (res abci.ResponseCommit) {
+	if err := app.errForensicMode("Commit"); err != nil {
+		panic(err)
+	}
+
+	// nothing is committed for a rejected block
+	if err := app.errRejectedBlock("Commit"); err != nil {
+		app.logger.Error("skipped Commit", "err", err)
+		return abci.ResponseCommit{Data: app.cms.LastCommitID().Hash}
+	}
+
+	if app.deliverState == nil {
+		panic("Commit called without active deliver state; BeginBlock must precede Commit")
+	}
+
 	header := app.deliverState.ctx.BlockHeader()
+	defer app.startCommitTimer(header.Height)()
+
+	// Replay the block on a fresh cache if the determinism check is enabled.
+	app.checkDeterminism()
+
+	// Sample the CheckTx state before the block state is written.
+	checked := app.sampleCheckState()
+
+	app.runPreCommitHook(header.Height)
 
 	// Write the DeliverTx state which is cache-wrapped and commit the MultiStore.
 	// The write to the DeliverTx state writes all state transitions to the root
 	// MultiStore (app.cms) so when Commit() is called is persists those values.
 	app.deliverState.ms.Write()
-	commitID := app.cms.Commit()
+	commitID := app.commitStore()
 	app.logger.Debug("Commit synced", "commit", fmt.Sprintf("%X", commitID))
 
+	if app.postCommitBarrier != nil {
+		app.postCommitBarrier(commitID)
+	}
+
+	// The deliverState now reflects the committed state. Evaluate the halt
+	// predicate on a cache so it cannot write to it.
+	haltOnPredicate := app.evalHaltPredicate()
+
 	// Reset the Check state to the latest committed.
 	//
 	// NOTE: This is safe because Tendermint holds a lock on the mempool for
 	// Commit. Use the header from this latest block.
 	app.setCheckState(header)
+	app.checkStateConsistency(header.Height, checked)
 
 	// empty/reset the deliver state
 	app.deliverState = nil
 
-	var halt bool
+	var haltReason string
 
 	switch {
 	case app.haltHeight > 0 && uint64(header.Height) >= app.haltHeight:
-		halt = true
+		haltReason = HaltReasonHeight
 
 	case app.haltTime > 0 && header.Time.Unix() >= int64(app.haltTime):
-		halt = true
+		haltReason = HaltReasonTime
+
+	case haltOnPredicate:
+		haltReason = HaltReasonPredicate
 	}
 
-	if halt {
+	if haltReason != "" {
+		if app.haltNotifier != nil {
+			app.haltNotifier(haltReason, header.Height, header.Time.Unix())
+		}
+
 		// Halt the binary and allow Tendermint to receive the ResponseCommit
 		// response with the commit ID hash. This will allow the node to successfully
 		// restart and process blocks assuming the halt configuration has been
 		// reset or moved to a more distant value.
-		app.halt()
+		app.halt(header.Height, header.Time.Unix())
 	}
 
 	return abci.ResponseCommit{
@@ -267,20 +402,49 @@ func (app *BaseApp) Commit() (res abci.ResponseCommit) {
 	}
 }
 
+// evalHaltPredicate returns whether the halt predicate, if any, holds for the
+// state of the deliverState. It must be called after the deliverState has been
+// written and committed so the predicate sees the committed state.
+func (app *BaseApp) evalHaltPredicate() bool {
+	if app.haltPredicate == nil {
+		return false
+	}
+
+	ctx, _ := app.deliverState.ctx.CacheContext()
+	return app.haltPredicate(ctx)
+}
+
+// runPreCommitHook invokes the pre-commit hook, if any, on a cache of the
+// deliverState and panics if it fails, so that the block is not committed.
+func (app *BaseApp) runPreCommitHook(height int64) {
+	if app.preCommitHook == nil {
+		return
+	}
+
+	ctx, _ := app.deliverState.ctx.CacheContext()
+	if err := app.preCommitHook(ctx); err != nil {
+		panic(fmt.Sprintf("pre-commit hook failed at height %d: %v", height, err))
+	}
+}
+
 // halt attempts to gracefully shutdown the node via SIGINT and SIGTERM falling
-// back on os.Exit if both fail.
-func (app *BaseApp) halt() {
+// back on os.Exit if both fail. The pre-halt hook, if any, runs first.
+func (app *BaseApp) halt(height, blockTime int64) {
 	app.logger.Info("halting node per configuration", "height", app.haltHeight, "time", app.haltTime)
 
-	p, err := os.FindProcess(os.Getpid())
-	if err == nil {
-		// attempt cascading signals in case SIGINT fails (os dependent)
-		sigIntErr := p.Signal(syscall.SIGINT)
-		sigTermErr := p.Signal(syscall.SIGTERM)
+	app.runPreHaltHook(height, blockTime)
 
-		if sigIntErr == nil || sigTermErr == nil {
-			return
-		}
+	signalProcess := app.signalProcess
+	if signalProcess == nil {
+		signalProcess = signalSelf
+	}
+
+	// attempt cascading signals in case SIGINT fails (os dependent)
+	sigIntErr := signalProcess(syscall.SIGINT)
+	sigTermErr := signalProcess(syscall.SIGTERM)
+
+	if sigIntErr == nil || sigTermErr == nil {
+		return
 	}
 
 	// Resort to exiting immediately if the process could not be found or killed
@@ -289,6 +453,29 @@ func (app *BaseApp) halt() {
 	os.Exit(0)
 }
 
+// runPreHaltHook invokes the pre-halt hook, if any, unless it already ran. A
+// failing hook does not prevent the node from halting.
+func (app *BaseApp) runPreHaltHook(height, blockTime int64) {
+	if app.preHaltHook == nil || app.preHaltHookDone {
+		return
+	}
+
+	app.preHaltHookDone = true
+	if err := app.preHaltHook(height, blockTime); err != nil {
+		app.logger.Error("pre-halt hook failed", "height", height, "err", err)
+	}
+}
+
+// signalSelf sends sig to the current process.
+func signalSelf(sig os.Signal) error {
+	p, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		return err
+	}
+
+	return p.Signal(sig)
+}
+
 // Query implements the ABCI interface. It delegates to CommitMultiStore if it
 // implements Queryable.
 func (app *BaseApp) Query(req abci.RequestQuery) abci.ResponseQuery {
@@ -315,30 +502,99 @@ func (app *BaseApp) Query(req abci.RequestQuery) abci.ResponseQuery {
 	return sdkerrors.QueryResult(sdkerrors.Wrap(sdkerrors.ErrUnknownRequest, "unknown query path"))
 }
 
+// builtinAppQueries are the "/app" query paths handled by BaseApp itself which
+// may not be overridden via RegisterAppQueryHandler.
+var builtinAppQueries = map[string]bool{
+	"height-range":  true,
+	"last-panic":    true,
+	"max-block-gas": true,
+	"mempool-stats": true,
+	"msg-routes":    true,
+	"simulate":      true,
+	"trace-tx":      true,
+	"version":       true,
+}
+
+// HeightRange is the response of the "/app/height-range" query. It holds the
+// earliest and latest heights at which the node can serve state queries.
+type HeightRange struct {
+	Earliest int64 `json:"earliest"`
+	Latest   int64 `json:"latest"`
+}
+
+// MaxTxTraceBytes bounds the size of the store operation trace returned by the
+// "/app/trace-tx" query. Operations past the limit are dropped and the response
+// is marked as truncated.
+const MaxTxTraceBytes = 1 << 20
+
 func handleQueryApp(app *BaseApp, path []string, req abci.RequestQuery) abci.ResponseQuery {
 	if len(path) >= 2 {
 		switch path[1] {
 		case "simulate":
-			txBytes := req.Data
+			return handleQuerySimulate(app, req)
+
+		case "trace-tx":
+			return handleQueryTraceTx(app, req)
 
-			tx, err := app.txDecoder(txBytes)
+		case "height-range":
+			latest := app.LastBlockHeight()
+			bz, err := json.Marshal(HeightRange{Earliest: app.cms.EarliestVersion(), Latest: latest})
 			if err != nil {
-				return sdkerrors.QueryResult(sdkerrors.Wrap(err, "failed to decode tx"))
+				return sdkerrors.QueryResult(sdkerrors.Wrap(err, "failed to JSON encode height range"))
+			}
+
+			return abci.ResponseQuery{
+				Codespace: sdkerrors.RootCodespace,
+				Height:    latest,
+				Value:     bz,
+			}
+
+		case "last-panic":
+			p, ok := app.lastPanic.get()
+			if !ok {
+				return sdkerrors.QueryResult(sdkerrors.Wrap(sdkerrors.ErrKeyNotFound, ErrNoRecoveredPanic.Error()))
+			}
+
+			bz, err := json.Marshal(p)
+			if err != nil {
+				return sdkerrors.QueryResult(sdkerrors.Wrap(err, "failed to JSON encode recovered panic"))
+			}
+
+			return abci.ResponseQuery{
+				Codespace: sdkerrors.RootCodespace,
+				Height:    req.Height,
+				Value:     bz,
 			}
 
-			gInfo, res, err := app.Simulate(txBytes, tx)
+		case "max-block-gas":
+			// the maximum block gas is encoded in decimal; 0 means unlimited
+			return abci.ResponseQuery{
+				Codespace: sdkerrors.RootCodespace,
+				Height:    req.Height,
+				Value:     []byte(strconv.FormatUint(app.getMaximumBlockGas(), 10)),
+			}
+
+		case "msg-routes":
+			lister, ok := app.router.(RouteLister)
+			if !ok {
+				return sdkerrors.QueryResult(sdkerrors.Wrap(sdkerrors.ErrUnknownRequest, "router does not list its routes"))
+			}
+
+			bz, err := json.Marshal(lister.Routes())
 			if err != nil {
-				return sdkerrors.QueryResult(sdkerrors.Wrap(err, "failed to simulate tx"))
+				return sdkerrors.QueryResult(sdkerrors.Wrap(err, "failed to JSON encode msg routes"))
 			}
 
-			simRes := &sdk.SimulationResponse{
-				GasInfo: gInfo,
-				Result:  res,
+			return abci.ResponseQuery{
+				Codespace: sdkerrors.RootCodespace,
+				Height:    req.Height,
+				Value:     bz,
 			}
 
-			bz, err := codec.ProtoMarshalJSON(simRes)
+		case "mempool-stats":
+			bz, err := json.Marshal(app.GetMempoolStats())
 			if err != nil {
-				return sdkerrors.QueryResult(sdkerrors.Wrap(err, "failed to JSON encode simulation response"))
+				return sdkerrors.QueryResult(sdkerrors.Wrap(err, "failed to JSON encode mempool stats"))
 			}
 
 			return abci.ResponseQuery{
@@ -355,6 +611,10 @@ func handleQueryApp(app *BaseApp, path []string, req abci.RequestQuery) abci.Res
 			}
 
 		default:
+			if handler, ok := app.appQueries[path[1]]; ok {
+				return handler(app, req)
+			}
+
 			return sdkerrors.QueryResult(sdkerrors.Wrapf(sdkerrors.ErrUnknownRequest, "unknown query: %s", path))
 		}
 	}
@@ -367,6 +627,144 @@ func handleQueryApp(app *BaseApp, path []string, req abci.RequestQuery) abci.Res
 	)
 }
 
+// handleQuerySimulate simulates the tx provided in the request data. Unlike
+// DeliverTx, where a panic must halt consensus, simulation is served over the
+// public query interface, so any panic escaping tx decoding or execution is
+// converted into a query error instead of taking down the node.
+func handleQuerySimulate(app *BaseApp, req abci.RequestQuery) (res abci.ResponseQuery) {
+	defer func() {
+		if r := recover(); r != nil {
+			app.lastPanic.record(r)
+			res = sdkerrors.QueryResult(
+				sdkerrors.Wrapf(sdkerrors.ErrPanic, "failed to simulate tx; recovered: %v", r),
+			)
+		}
+	}()
+
+	txBytes := req.Data
+
+	tx, err := app.txDecoder(txBytes)
+	if err != nil {
+		return sdkerrors.QueryResult(sdkerrors.Wrap(err, "failed to decode tx"))
+	}
+
+	gInfo, result, err := app.Simulate(txBytes, tx)
+	if err != nil {
+		return sdkerrors.QueryResult(sdkerrors.Wrap(err, "failed to simulate tx"))
+	}
+
+	simRes := &sdk.SimulationResponse{
+		GasInfo: gInfo,
+		Result:  result,
+	}
+
+	bz, err := codec.ProtoMarshalJSON(simRes)
+	if err != nil {
+		return sdkerrors.QueryResult(sdkerrors.Wrap(err, "failed to JSON encode simulation response"))
+	}
+
+	return abci.ResponseQuery{
+		Codespace: sdkerrors.RootCodespace,
+		Height:    req.Height,
+		Value:     bz,
+	}
+}
+
+// handleQueryTraceTx executes the tx provided in the request data like a
+// simulation on top of the latest check state and returns the store operations
+// it performed along with its gas and result. The execution happens on a
+// discarded cache, hence no state is ever written.
+func handleQueryTraceTx(app *BaseApp, req abci.RequestQuery) (res abci.ResponseQuery) {
+	defer func() {
+		if r := recover(); r != nil {
+			app.lastPanic.record(r)
+			res = sdkerrors.QueryResult(
+				sdkerrors.Wrapf(sdkerrors.ErrPanic, "failed to trace tx; recovered: %v", r),
+			)
+		}
+	}()
+
+	txBytes := req.Data
+
+	tx, err := app.txDecoder(txBytes)
+	if err != nil {
+		return sdkerrors.QueryResult(sdkerrors.Wrap(err, "failed to decode tx"))
+	}
+
+	// Every cache layer created by the tx on top of the traced store records the
+	// operations that reach it, i.e. reads that miss the cache and cached writes
+	// once they are flushed.
+	tracer := &boundedTraceWriter{limit: MaxTxTraceBytes}
+	ms := app.checkState.ms.CacheMultiStore().
+		SetTracer(tracer).
+		SetTracingContext(sdk.TraceContext{}).(sdk.CacheMultiStore)
+	ctx := app.getContextForTx(runTxModeTrace, txBytes).WithMultiStore(ms)
+
+	gInfo, result, err := app.runTxWithContext(ctx, runTxModeTrace, txBytes, tx)
+
+	traceRes := sdk.TxTraceResponse{
+		GasInfo:   gInfo,
+		Result:    result,
+		Trace:     tracer.operations(),
+		Truncated: tracer.truncated,
+	}
+	if err != nil {
+		traceRes.Error = err.Error()
+	}
+
+	bz, err := json.Marshal(traceRes)
+	if err != nil {
+		return sdkerrors.QueryResult(sdkerrors.Wrap(err, "failed to JSON encode trace response"))
+	}
+
+	return abci.ResponseQuery{
+		Codespace: sdkerrors.RootCodespace,
+		Height:    req.Height,
+		Value:     bz,
+	}
+}
+
+// boundedTraceWriter buffers trace operations up to a limit in bytes. Once the
+// limit is reached all further operations are dropped.
+type boundedTraceWriter struct {
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (w *boundedTraceWriter) Write(p []byte) (int, error) {
+	if w.truncated || w.buf.Len()+len(p) > w.limit {
+		w.truncated = true
+		return len(p), nil
+	}
+
+	return w.buf.Write(p)
+}
+
+// operations returns the buffered trace operations, one per line.
+func (w *boundedTraceWriter) operations() []json.RawMessage {
+	ops := []json.RawMessage{}
+	for _, line := range bytes.Split(w.buf.Bytes(), []byte("\n")) {
+		if len(line) > 0 {
+			ops = append(ops, json.RawMessage(line))
+		}
+	}
+
+	return ops
+}
+
+// checkQueryResponseSize returns an error if the query result value exceeds
+// the configured maximum query response size.
+func (app *BaseApp) checkQueryResponseSize(value []byte) error {
+	if app.maxQueryResponseBytes > 0 && len(value) > app.maxQueryResponseBytes {
+		return sdkerrors.Wrapf(
+			sdkerrors.ErrInvalidRequest, "response too large: %d > %d bytes", len(value), app.maxQueryResponseBytes,
+		)
+	}
+
+	return nil
+}
+
 func handleQueryStore(app *BaseApp, path []string, req abci.RequestQuery) abci.ResponseQuery {
 	// "/store" prefix for store queries
 	queryable, ok := app.cms.(sdk.Queryable)
@@ -391,6 +789,9 @@ func handleQueryStore(app *BaseApp, path []string, req abci.RequestQuery) abci.R
 	}
 
 	resp := queryable.Query(req)
+	if err := app.checkQueryResponseSize(resp.Value); err != nil {
+		return sdkerrors.QueryResult(err)
+	}
 	resp.Height = req.Height
 
 	return resp
@@ -470,7 +871,11 @@ func handleQueryCustom(app *BaseApp, path []string, req abci.RequestQuery) abci.
 	//
 	// For example, in the path "custom/gov/proposal/test", the gov querier gets
 	// []string{"proposal", "test"} as the path.
+	start := time.Now()
 	resBytes, err := querier(ctx, path[2:], req)
+	if app.queryLatencyObserver != nil {
+		app.queryLatencyObserver(path[1], time.Since(start), err)
+	}
 	if err != nil {
 		space, code, log := sdkerrors.ABCIInfo(err, false)
 		return abci.ResponseQuery{
@@ -481,6 +886,10 @@ func handleQueryCustom(app *BaseApp, path []string, req abci.RequestQuery) abci.
 		}
 	}
 
+	if err := app.checkQueryResponseSize(resBytes); err != nil {
+		return sdkerrors.QueryResult(err)
+	}
+
 	return abci.ResponseQuery{
 		Height: req.Height,
 		Value:  resBytes,
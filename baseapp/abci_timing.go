@@ -0,0 +1,50 @@
+package baseapp
+
+import (
+	"time"
+)
+
+// ABCITimings holds the time spent in each ABCI phase of a block. DeliverTx is
+// the aggregate over all the txs of the block.
+type ABCITimings struct {
+	BeginBlock time.Duration
+	DeliverTx  time.Duration
+	EndBlock   time.Duration
+	Commit     time.Duration
+}
+
+// ABCITimingObserver is called at the end of Commit with the height of the
+// committed block and the time spent in each of its ABCI phases.
+type ABCITimingObserver func(height int64, timings ABCITimings)
+
+// startABCITimer starts timing an ABCI phase. The returned function adds the
+// time elapsed since to d. Nothing is timed if no observer is set.
+func (app *BaseApp) startABCITimer(d *time.Duration) func() {
+	if app.abciTimingObserver == nil {
+		return func() {}
+	}
+
+	start := time.Now()
+	return func() { *d += time.Since(start) }
+}
+
+// startCommitTimer starts timing Commit. The returned function reports the
+// timings of the block at height to the observer and resets them.
+func (app *BaseApp) startCommitTimer(height int64) func() {
+	if app.abciTimingObserver == nil {
+		return func() {}
+	}
+
+	start := time.Now()
+	return func() {
+		timings := app.blockTimings
+		timings.Commit = time.Since(start)
+		app.blockTimings = ABCITimings{}
+
+		app.abciTimingObserver(height, timings)
+	}
+}
+
+// QueryLatencyObserver is called after each custom query with the route of the
+// querier, the time spent in it and the error it returned, if any.
+type QueryLatencyObserver func(route string, duration time.Duration, err error)
@@ -3,11 +3,14 @@ package baseapp
 import (
 	"errors"
 	"fmt"
+	"os"
 	"reflect"
 	"runtime/debug"
 	"strings"
+	"time"
 
 	"github.com/gogo/protobuf/proto"
+	lru "github.com/hashicorp/golang-lru"
 	abci "github.com/tendermint/tendermint/abci/types"
 	"github.com/tendermint/tendermint/crypto/tmhash"
 	"github.com/tendermint/tendermint/libs/log"
@@ -23,9 +26,16 @@ const (
 	runTxModeReCheck                   // Recheck a (pending) transaction after a commit
 	runTxModeSimulate                  // Simulate a transaction
 	runTxModeDeliver                   // Deliver a transaction
+	runTxModeTrace                     // Simulate a transaction, flushing its writes to a traced store
 
 	// MainStoreKey is the string representation of the main store
 	MainStoreKey = "main"
+
+	// HaltReasonHeight, HaltReasonTime and HaltReasonPredicate describe which
+	// configured halt condition caused the node to halt.
+	HaltReasonHeight    = "halt-height"
+	HaltReasonTime      = "halt-time"
+	HaltReasonPredicate = "halt-predicate"
 )
 
 var (
@@ -45,6 +55,9 @@ type (
 	// an older version of the software. In particular, if a module changed the substore key name
 	// (or removed a substore) between two versions of the software.
 	StoreLoader func(ms sdk.CommitMultiStore) error
+
+	// AppQueryHandler defines a handler for a custom "/app/<name>" query path.
+	AppQueryHandler func(app *BaseApp, req abci.RequestQuery) abci.ResponseQuery
 )
 
 // BaseApp reflects the ABCI application implementation.
@@ -54,11 +67,15 @@ type BaseApp struct { // nolint: maligned
 	name        string               // application name from abci.Info
 	db          dbm.DB               // common DB backend
 	cms         sdk.CommitMultiStore // Main (uncached) state
+	storeKeys   []sdk.StoreKey       // keys of all stores mounted on cms
 	storeLoader StoreLoader          // function to handle store loading, may be overridden with SetStoreLoader()
 	router      sdk.Router           // handle any kind of message
 	queryRouter sdk.QueryRouter      // router for redirecting query calls
 	txDecoder   sdk.TxDecoder        // unmarshal []byte into sdk.Tx
 
+	// handlers for custom "/app" query paths
+	appQueries map[string]AppQueryHandler
+
 	// set upon LoadVersion or LoadLatestVersion.
 	baseKey *sdk.KVStoreKey // Main KVStore in cms
 
@@ -91,6 +108,65 @@ type BaseApp struct { // nolint: maligned
 	// transaction. This is mainly used for DoS and spam prevention.
 	minGasPrices sdk.DecCoins
 
+	// optional source of the minimum gas prices enforced on recheck, replacing
+	// minGasPrices for txs already in the mempool
+	recheckMinGasPrices func(ctx sdk.Context) sdk.DecCoins
+
+	// handlers of the options set through the ABCI SetOption method, by key
+	optionHandlers map[string]SetOptionHandler
+
+	// maximum number of messages allowed in a single tx; 0 means unlimited
+	maxMsgsPerTx int
+
+	// maximum size of the value returned by custom and store queries; 0 means
+	// unlimited
+	maxQueryResponseBytes int
+
+	// fee denoms accepted by CheckTx; empty means all denoms are accepted
+	acceptedFeeDenoms map[string]bool
+
+	// optional predicate exempting the txs it approves from the minimum gas
+	// prices in CheckTx
+	zeroGasTxPredicate func(tx sdk.Tx) bool
+
+	// report the gas used by the AnteHandler and by message execution in the
+	// events of CheckTx and DeliverTx responses
+	gasOverheadTracking bool
+
+	// optional LRU cache of the txs decoded by CheckTx, keyed by the SHA-256
+	// hash of the tx bytes
+	txCache *lru.Cache
+
+	// return structured error details in the Data of failed DeliverTx responses
+	structuredErrors bool
+
+	// add a block_summary event to EndBlock responses, and the summary of the
+	// current block
+	blockSummaryEvent bool
+	blockSummary      blockSummary
+
+	// maximum number of bytes a begin or end blocker may write; 0 means unlimited
+	blockerWriteLimit uint64
+
+	// CheckTx admission statistics
+	mempoolStats *mempoolCounters
+
+	// last panic recovered from a handler
+	lastPanic *panicRecorder
+
+	// initChainer run instead of initChainer for genesis files flagged as an
+	// upgrade
+	upgradeInitChainer sdk.InitChainer
+
+	// if set, InitChain streams the genesis app state from the opener to the
+	// chunk handler
+	genesisOpener       GenesisOpener
+	genesisChunkHandler GenesisChunkHandler
+
+	// optional seeder of the per-block randomness seed provided to the
+	// deliverState context
+	randomnessSeeder BlockRandomnessSeeder
+
 	// flag for sealing options and parameters to a BaseApp
 	sealed bool
 
@@ -100,6 +176,72 @@ type BaseApp struct { // nolint: maligned
 	// minimum block time (in Unix seconds) at which to halt the chain and gracefully shutdown
 	haltTime uint64
 
+	// optional callback invoked right before the node halts
+	haltNotifier func(reason string, height int64, time int64)
+
+	// optional hook invoked once when the node halts, before it is signaled,
+	// and whether it already ran
+	preHaltHook     func(height int64, time int64) error
+	preHaltHookDone bool
+
+	// sends a signal to the node process on halt; nil signals the current
+	// process
+	signalProcess func(sig os.Signal) error
+
+	// optional hook invoked in Commit before the block state is written; the
+	// node halts without committing when it returns an error
+	preCommitHook func(ctx sdk.Context) error
+
+	// optional callback invoked in Commit once the store is fully committed
+	postCommitBarrier func(commitID sdk.CommitID)
+
+	// number of retries of a store commit failing with a retriable error, and
+	// the delay between them
+	commitRetries      int
+	commitRetryBackoff time.Duration
+
+	// keys sampled on Commit to detect checkState diverging from the committed
+	// state
+	consistencyCheckKeys map[sdk.StoreKey][][]byte
+
+	// height the app is pinned to for forensic analysis; 0 if not pinned
+	forensicHeight int64
+
+	// how BeginBlock handles an unexpected block height, and the last height
+	// error in recovery mode
+	heightValidationMode HeightValidationMode
+	lastHeightErr        error
+
+	// optional transformer of the validator updates returned by EndBlock
+	validatorUpdateTransformer ValidatorUpdateTransformer
+
+	// if set, DeliverTxBatch executes non-conflicting txs concurrently
+	txConflictFn TxConflictFunc
+
+	// optional observer of the time spent in each ABCI phase of a block, and
+	// the timings of the current block
+	abciTimingObserver ABCITimingObserver
+	blockTimings       ABCITimings
+
+	// optional factory of the block and tx gas meters
+	gasMeterFactory GasMeterFactory
+
+	// optional observer of the time spent in the custom queriers
+	queryLatencyObserver QueryLatencyObserver
+
+	// optional auditor of the committed writes to the audited stores
+	storeWriteAuditor StoreWriteAuditor
+	auditedStores     map[string]bool
+
+	// optional predicate evaluated against the committed state in Commit; the
+	// node halts when it returns true
+	haltPredicate func(ctx sdk.Context) bool
+
+	// if true, every block is re-executed on a fresh cache before it is
+	// committed to detect non-deterministic state transitions (dev-only)
+	determinismCheck bool
+	determinismBlock *blockRecord
+
 	// application's version string
 	appVersion string
 }
@@ -121,6 +263,9 @@ func NewBaseApp(
 		storeLoader:    DefaultStoreLoader,
 		router:         NewRouter(),
 		queryRouter:    NewQueryRouter(),
+		appQueries:     make(map[string]AppQueryHandler),
+		mempoolStats:   &mempoolCounters{},
+		lastPanic:      &panicRecorder{},
 		txDecoder:      txDecoder,
 		fauxMerkleMode: false,
 	}
@@ -199,12 +344,14 @@ func (app *BaseApp) MountTransientStores(keys map[string]*sdk.TransientStoreKey)
 // multistore, using a specified DB.
 func (app *BaseApp) MountStoreWithDB(key sdk.StoreKey, typ sdk.StoreType, db dbm.DB) {
 	app.cms.MountStoreWithDB(key, typ, db)
+	app.storeKeys = append(app.storeKeys, key)
 }
 
 // MountStore mounts a store to the provided key in the BaseApp multistore,
 // using the default DB.
 func (app *BaseApp) MountStore(key sdk.StoreKey, typ sdk.StoreType) {
 	app.cms.MountStoreWithDB(key, typ, nil)
+	app.storeKeys = append(app.storeKeys, key)
 }
 
 // LoadLatestVersion loads the latest application version. It will panic if
@@ -282,6 +429,49 @@ func (app *BaseApp) setMinGasPrices(gasPrices sdk.DecCoins) {
 	app.minGasPrices = gasPrices
 }
 
+func (app *BaseApp) setRecheckMinGasPrices(fn func(ctx sdk.Context) sdk.DecCoins) {
+	app.recheckMinGasPrices = fn
+}
+
+func (app *BaseApp) setMaxMsgsPerTx(maxMsgs int) {
+	app.maxMsgsPerTx = maxMsgs
+}
+
+func (app *BaseApp) setMaxQueryResponseBytes(n int) {
+	app.maxQueryResponseBytes = n
+}
+
+func (app *BaseApp) setAcceptedFeeDenoms(denoms []string) {
+	app.acceptedFeeDenoms = make(map[string]bool, len(denoms))
+	for _, denom := range denoms {
+		app.acceptedFeeDenoms[denom] = true
+	}
+}
+
+func (app *BaseApp) setZeroGasTxPredicate(fn func(tx sdk.Tx) bool) {
+	app.zeroGasTxPredicate = fn
+}
+
+func (app *BaseApp) setParallelExecution(conflictFn TxConflictFunc) {
+	app.txConflictFn = conflictFn
+}
+
+func (app *BaseApp) setGasOverheadTracking(enabled bool) {
+	app.gasOverheadTracking = enabled
+}
+
+func (app *BaseApp) setStructuredErrors(enabled bool) {
+	app.structuredErrors = enabled
+}
+
+func (app *BaseApp) setBlockSummaryEvent(enabled bool) {
+	app.blockSummaryEvent = enabled
+}
+
+func (app *BaseApp) setBlockerStateWriteLimit(limit uint64) {
+	app.blockerWriteLimit = limit
+}
+
 func (app *BaseApp) setHaltHeight(haltHeight uint64) {
 	app.haltHeight = haltHeight
 }
@@ -290,6 +480,10 @@ func (app *BaseApp) setHaltTime(haltTime uint64) {
 	app.haltTime = haltTime
 }
 
+func (app *BaseApp) setDeterminismCheck(enabled bool) {
+	app.determinismCheck = enabled
+}
+
 func (app *BaseApp) setInterBlockCache(cache sdk.MultiStorePersistentCache) {
 	app.interBlockCache = cache
 }
@@ -330,7 +524,13 @@ func (app *BaseApp) setCheckState(header abci.Header) {
 // and provided header. It is set on InitChain and BeginBlock and set to nil on
 // Commit.
 func (app *BaseApp) setDeliverState(header abci.Header) {
-	ms := app.cms.CacheMultiStore()
+	var ms sdk.CacheMultiStore
+	if app.storeWriteAuditor != nil {
+		ms = app.auditedCacheMultiStore()
+	} else {
+		ms = app.cms.CacheMultiStore()
+	}
+
 	app.deliverState = &state{
 		ms:  ms,
 		ctx: sdk.NewContext(ms, header, false, app.logger),
@@ -380,7 +580,7 @@ func (app *BaseApp) validateHeight(req abci.RequestBeginBlock) error {
 
 	prevHeight := app.LastBlockHeight()
 	if req.Header.Height != prevHeight+1 {
-		return fmt.Errorf("invalid height: %d; expected: %d", req.Header.Height, prevHeight+1)
+		return newHeightMismatchError(prevHeight+1, req.Header.Height)
 	}
 
 	return nil
@@ -421,6 +621,9 @@ func (app *BaseApp) getContextForTx(mode runTxMode, txBytes []byte) sdk.Context
 
 	if mode == runTxModeReCheck {
 		ctx = ctx.WithIsReCheckTx(true)
+		if app.recheckMinGasPrices != nil {
+			ctx = ctx.WithMinGasPrices(app.recheckMinGasPrices(ctx))
+		}
 	}
 	if mode == runTxModeSimulate {
 		ctx, _ = ctx.CacheContext()
@@ -456,12 +659,32 @@ func (app *BaseApp) cacheTxContext(ctx sdk.Context, txBytes []byte) (sdk.Context
 // returned if the tx does not run out of gas and if all the messages are valid
 // and execute successfully. An error is returned otherwise.
 func (app *BaseApp) runTx(mode runTxMode, txBytes []byte, tx sdk.Tx) (gInfo sdk.GasInfo, result *sdk.Result, err error) {
+	return app.runTxWithContext(app.getContextForTx(mode, txBytes), mode, txBytes, tx)
+}
+
+// runTxWithContext processes a transaction like runTx on top of the provided
+// Context instead of the one derived from the execution mode.
+func (app *BaseApp) runTxWithContext(
+	ctx sdk.Context, mode runTxMode, txBytes []byte, tx sdk.Tx,
+) (gInfo sdk.GasInfo, result *sdk.Result, err error) {
+	return app.runTxWithGasBreakdown(ctx, mode, txBytes, tx, nil)
+}
+
+// runTxWithGasBreakdown processes a transaction like runTxWithContext and, if
+// gasBreakdown is not nil, fills it in with the split of the gas used between
+// the AnteHandler and message execution.
+func (app *BaseApp) runTxWithGasBreakdown(
+	ctx sdk.Context, mode runTxMode, txBytes []byte, tx sdk.Tx, gasBreakdown *GasBreakdown,
+) (gInfo sdk.GasInfo, result *sdk.Result, err error) {
 	// NOTE: GasWanted should be returned by the AnteHandler. GasUsed is
 	// determined by the GasMeter. We need access to the context to get the gas
 	// meter so we initialize upfront.
 	var gasWanted uint64
 
-	ctx := app.getContextForTx(mode, txBytes)
+	// gas consumed once the AnteHandler returns, used by the gas breakdown
+	var anteGas uint64
+	var msgsExecuted bool
+
 	ms := ctx.MultiStore()
 
 	// only run the tx if there is block gas remaining
@@ -489,6 +712,7 @@ func (app *BaseApp) runTx(mode runTxMode, txBytes []byte, tx sdk.Tx) (gInfo sdk.
 				)
 
 			default:
+				app.lastPanic.record(r)
 				err = sdkerrors.Wrap(
 					sdkerrors.ErrPanic, fmt.Sprintf(
 						"recovered: %v\nstack:\n%v", r, string(debug.Stack()),
@@ -500,6 +724,7 @@ func (app *BaseApp) runTx(mode runTxMode, txBytes []byte, tx sdk.Tx) (gInfo sdk.
 		}
 
 		gInfo = sdk.GasInfo{GasWanted: gasWanted, GasUsed: ctx.GasMeter().GasConsumed()}
+		gasBreakdown.set(gInfo.GasUsed, anteGas, msgsExecuted)
 	}()
 
 	// If BlockGasMeter() panics it will be caught by the above recover and will
@@ -520,10 +745,28 @@ func (app *BaseApp) runTx(mode runTxMode, txBytes []byte, tx sdk.Tx) (gInfo sdk.
 	}()
 
 	msgs := tx.GetMsgs()
+	if app.maxMsgsPerTx > 0 && len(msgs) > app.maxMsgsPerTx {
+		return sdk.GasInfo{}, nil, sdkerrors.Wrapf(
+			sdkerrors.ErrInvalidRequest, "too many messages in tx: %d > %d", len(msgs), app.maxMsgsPerTx,
+		)
+	}
+
 	if err := validateBasicTxMsgs(msgs); err != nil {
 		return sdk.GasInfo{}, nil, err
 	}
 
+	if mode == runTxModeCheck || mode == runTxModeReCheck {
+		if err := app.validateFeeDenoms(tx); err != nil {
+			return sdk.GasInfo{}, nil, err
+		}
+
+		// txs approved by the predicate are checked without minimum gas prices,
+		// letting the AnteHandler accept them with a zero fee
+		if app.zeroGasTxPredicate != nil && app.zeroGasTxPredicate(tx) {
+			ctx = ctx.WithMinGasPrices(sdk.DecCoins{})
+		}
+	}
+
 	if app.anteHandler != nil {
 		var anteCtx sdk.Context
 		var msCache sdk.CacheMultiStore
@@ -537,7 +780,7 @@ func (app *BaseApp) runTx(mode runTxMode, txBytes []byte, tx sdk.Tx) (gInfo sdk.
 		// performance benefits, but it'll be more difficult to get right.
 		anteCtx, msCache = app.cacheTxContext(ctx, txBytes)
 
-		newCtx, err := app.anteHandler(anteCtx, tx, mode == runTxModeSimulate)
+		newCtx, err := app.anteHandler(anteCtx, tx, mode == runTxModeSimulate || mode == runTxModeTrace)
 		if !newCtx.IsZero() {
 			// At this point, newCtx.MultiStore() is cache-wrapped, or something else
 			// replaced by the AnteHandler. We want the original multistore, not one
@@ -559,16 +802,22 @@ func (app *BaseApp) runTx(mode runTxMode, txBytes []byte, tx sdk.Tx) (gInfo sdk.
 		msCache.Write()
 	}
 
+	ctx = app.withFactoryGasMeter(ctx)
+
 	// Create a new Context based off of the existing Context with a cache-wrapped
 	// MultiStore in case message processing fails. At this point, the MultiStore
 	// is doubly cached-wrapped.
 	runMsgCtx, msCache := app.cacheTxContext(ctx, txBytes)
+	anteGas, msgsExecuted = ctx.GasMeter().GasConsumed(), true
 
 	// Attempt to execute all messages and only update state if all messages pass
 	// and we're in DeliverTx. Note, runMsgs will never return a reference to a
 	// Result if any single message fails or does not have a registered Handler.
+	//
+	// In trace mode the state is discarded by the caller, but it is written so
+	// that the message writes reach the traced store.
 	result, err = app.runMsgs(runMsgCtx, msgs, mode)
-	if err == nil && mode == runTxModeDeliver {
+	if err == nil && (mode == runTxModeDeliver || mode == runTxModeTrace) {
 		msCache.Write()
 	}
 
@@ -595,12 +844,14 @@ func (app *BaseApp) runMsgs(ctx sdk.Context, msgs []sdk.Msg, mode runTxMode) (*s
 		msgRoute := msg.Route()
 		handler := app.router.Route(ctx, msgRoute)
 		if handler == nil {
-			return nil, sdkerrors.Wrapf(sdkerrors.ErrUnknownRequest, "unrecognized message route: %s; message index: %d", msgRoute, i)
+			err := sdkerrors.Wrapf(sdkerrors.ErrUnknownRequest, "unrecognized message route: %s; message index: %d", msgRoute, i)
+			return nil, app.wrapMsgError(err, i, msgRoute)
 		}
 
 		msgResult, err := handler(ctx, msg)
 		if err != nil {
-			return nil, sdkerrors.Wrapf(err, "failed to execute message; message index: %d", i)
+			err = sdkerrors.Wrapf(err, "failed to execute message; message index: %d", i)
+			return nil, app.wrapMsgError(err, i, msgRoute)
 		}
 
 		msgEvents := sdk.Events{
@@ -3,11 +3,19 @@ package baseapp
 import (
 	"bytes"
 	"encoding/binary"
+	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
+	"os/signal"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"testing"
+	"time"
 
 	"github.com/gogo/protobuf/jsonpb"
 	"github.com/stretchr/testify/assert"
@@ -18,6 +26,7 @@ import (
 	dbm "github.com/tendermint/tm-db"
 
 	"github.com/cosmos/cosmos-sdk/codec"
+	"github.com/cosmos/cosmos-sdk/store/cache"
 	"github.com/cosmos/cosmos-sdk/store/rootmulti"
 	store "github.com/cosmos/cosmos-sdk/store/types"
 	sdk "github.com/cosmos/cosmos-sdk/types"
@@ -278,6 +287,56 @@ func TestLoadVersionInvalid(t *testing.T) {
 	require.Error(t, err)
 }
 
+func TestForensicHeight(t *testing.T) {
+	logger := log.NewNopLogger()
+	pruningOpt := SetPruning(store.PruneNothing)
+	db := dbm.NewMemDB()
+	name := t.Name()
+
+	capKey := sdk.NewKVStoreKey(MainStoreKey)
+	key := []byte("height")
+	blockerOpt := func(bapp *BaseApp) {
+		bapp.SetBeginBlocker(func(ctx sdk.Context, req abci.RequestBeginBlock) abci.ResponseBeginBlock {
+			ctx.KVStore(capKey).Set(key, []byte(fmt.Sprintf("%d", req.Header.Height)))
+			return abci.ResponseBeginBlock{}
+		})
+	}
+
+	app := NewBaseApp(name, logger, db, nil, pruningOpt, blockerOpt)
+	app.MountStores(capKey)
+	require.NoError(t, app.LoadLatestVersion(capKey))
+
+	for height := int64(1); height <= 3; height++ {
+		app.BeginBlock(abci.RequestBeginBlock{Header: abci.Header{Height: height}})
+		app.Commit()
+	}
+
+	// unavailable heights are refused on startup
+	app = NewBaseApp(name, logger, db, nil, pruningOpt, SetForensicHeight(4))
+	app.MountStores(capKey)
+	require.Error(t, app.LoadLatestVersion(capKey))
+
+	app = NewBaseApp(name, logger, db, nil, pruningOpt, blockerOpt, SetForensicHeight(2))
+	app.MountStores(capKey)
+	require.NoError(t, app.LoadLatestVersion(capKey))
+	require.Equal(t, int64(2), app.LastBlockHeight())
+
+	// queries serve the pinned height as the latest
+	res := app.Query(abci.RequestQuery{Path: "/store/main/key", Data: key})
+	require.True(t, res.IsOK(), res.Log)
+	require.Equal(t, int64(2), res.Height)
+	require.Equal(t, "2", string(res.Value))
+
+	// consensus operations are refused
+	resTx := app.DeliverTx(abci.RequestDeliverTx{Tx: []byte("tx")})
+	require.False(t, resTx.IsOK())
+	require.Contains(t, resTx.Log, "forensic height 2")
+	require.Panics(t, func() {
+		app.BeginBlock(abci.RequestBeginBlock{Header: abci.Header{Height: 3}})
+	})
+	require.Panics(t, func() { app.Commit() })
+}
+
 func TestLoadVersionPruning(t *testing.T) {
 	logger := log.NewNopLogger()
 	pruningOptions := store.PruningOptions{
@@ -534,6 +593,131 @@ func TestInitChainer(t *testing.T) {
 	require.Equal(t, value, res.Value)
 }
 
+func TestUpgradeInitChainer(t *testing.T) {
+	var ran string
+	var gasLimit uint64
+
+	opt := func(bapp *BaseApp) {
+		bapp.SetInitChainer(func(ctx sdk.Context, req abci.RequestInitChain) abci.ResponseInitChain {
+			ran = "fresh"
+			return abci.ResponseInitChain{}
+		})
+		bapp.SetUpgradeInitChainer(func(ctx sdk.Context, req abci.RequestInitChain) abci.ResponseInitChain {
+			ran = "upgrade"
+			gasLimit = ctx.GasMeter().Limit()
+			ctx.GasMeter().ConsumeGas(1<<40, "migration")
+			ctx.KVStore(capKey1).Set([]byte("migrated"), []byte("true"))
+			return abci.ResponseInitChain{}
+		})
+	}
+
+	testCases := []struct {
+		appState string
+		expected string
+	}{
+		{`{}`, "fresh"},
+		{`{"upgrade_genesis": false}`, "fresh"},
+		{`{"upgrade_genesis": {}}`, "fresh"},
+		{`{"upgrade_genesis": true}`, "upgrade"},
+	}
+
+	for _, tc := range testCases {
+		ran = ""
+		app := setupBaseApp(t, opt)
+		app.InitChain(abci.RequestInitChain{AppStateBytes: []byte(tc.appState)})
+		require.Equal(t, tc.expected, ran, tc.appState)
+
+		migrated := app.deliverState.ctx.KVStore(capKey1).Get([]byte("migrated"))
+		if tc.expected == "upgrade" {
+			require.Equal(t, []byte("true"), migrated)
+			require.Equal(t, uint64(0), gasLimit) // infinite gas meter
+
+			// the migration gas meter is not kept for the first block
+			require.Less(t, app.deliverState.ctx.GasMeter().GasConsumed(), uint64(1<<40))
+		} else {
+			require.Nil(t, migrated)
+		}
+	}
+}
+
+func TestStreamingGenesis(t *testing.T) {
+	// a synthetic genesis of a few modules holding many entries each
+	genesis := make(map[string]map[string]string)
+	for m := 0; m < 4; m++ {
+		module := fmt.Sprintf("module%d", m)
+		genesis[module] = make(map[string]string)
+		for i := 0; i < 5000; i++ {
+			genesis[module][fmt.Sprintf("key%d", i)] = strings.Repeat(fmt.Sprintf("%d", i), 10)
+		}
+	}
+	appState, err := json.Marshal(genesis)
+	require.NoError(t, err)
+
+	initModule := func(ctx sdk.Context, module string, state map[string]string) {
+		for k, v := range state {
+			ctx.KVStore(capKey1).Set([]byte(module+"/"+k), []byte(v))
+		}
+	}
+	validators := []abci.ValidatorUpdate{{PubKey: abci.PubKey{Type: "ed25519", Data: []byte("pubkey")}, Power: 10}}
+
+	commitGenesis := func(app *BaseApp, appState []byte) []byte {
+		res := app.InitChain(abci.RequestInitChain{AppStateBytes: appState, Validators: validators})
+		require.Len(t, res.Validators, 1)
+
+		app.BeginBlock(abci.RequestBeginBlock{Header: abci.Header{Height: 1}})
+		app.EndBlock(abci.RequestEndBlock{Height: 1})
+		return app.Commit().Data
+	}
+
+	// regular InitChainer parsing the whole app state
+	app := setupBaseApp(t, func(bapp *BaseApp) {
+		bapp.SetInitChainer(func(ctx sdk.Context, req abci.RequestInitChain) abci.ResponseInitChain {
+			var state map[string]map[string]string
+			require.NoError(t, json.Unmarshal(req.AppStateBytes, &state))
+			for module, moduleState := range state {
+				initModule(ctx, module, moduleState)
+			}
+			return abci.ResponseInitChain{Validators: validators}
+		})
+	})
+	expectedHash := commitGenesis(app, appState)
+
+	// streaming genesis
+	var modules []string
+	app = setupBaseApp(t, func(bapp *BaseApp) {
+		bapp.SetStreamingGenesis(
+			func() (io.ReadCloser, error) { return ioutil.NopCloser(bytes.NewReader(appState)), nil },
+			func(ctx sdk.Context, module string, state json.RawMessage) error {
+				var moduleState map[string]string
+				if err := json.Unmarshal(state, &moduleState); err != nil {
+					return err
+				}
+				modules = append(modules, module)
+				initModule(ctx, module, moduleState)
+				return nil
+			},
+		)
+		bapp.SetInitChainer(func(ctx sdk.Context, req abci.RequestInitChain) abci.ResponseInitChain {
+			// the app state is empty but still decodes as a genesis state
+			var state map[string]json.RawMessage
+			require.NoError(t, json.Unmarshal(req.AppStateBytes, &state))
+			require.Empty(t, state)
+			return abci.ResponseInitChain{Validators: validators}
+		})
+	})
+	require.Equal(t, expectedHash, commitGenesis(app, nil))
+	require.Equal(t, []string{"module0", "module1", "module2", "module3"}, modules)
+
+	// malformed app state
+	app = setupBaseApp(t, func(bapp *BaseApp) {
+		bapp.SetStreamingGenesis(
+			func() (io.ReadCloser, error) { return ioutil.NopCloser(strings.NewReader(`{"module0": {`)), nil },
+			func(ctx sdk.Context, module string, state json.RawMessage) error { return nil },
+		)
+	})
+	require.Panics(t, func() { app.InitChain(abci.RequestInitChain{}) })
+}
+
 // Simple tx with a list of Msgs.
 type txTest struct {
 	Msgs       []sdk.Msg
@@ -801,673 +985,2703 @@ func TestDeliverTx(t *testing.T) {
 	}
 }
 
-// Number of messages doesn't matter to CheckTx.
-func TestMultiMsgCheckTx(t *testing.T) {
-	// TODO: ensure we get the same results
-	// with one message or many
-}
-
-// One call to DeliverTx should process all the messages, in order.
-func TestMultiMsgDeliverTx(t *testing.T) {
-	// increment the tx counter
-	anteKey := []byte("ante-key")
-	anteOpt := func(bapp *BaseApp) { bapp.SetAnteHandler(anteHandlerTxTest(t, capKey1, anteKey)) }
-
-	// increment the msg counter
-	deliverKey := []byte("deliver-key")
-	deliverKey2 := []byte("deliver-key2")
-	routerOpt := func(bapp *BaseApp) {
-		bapp.Router().AddRoute(routeMsgCounter, handlerMsgCounter(t, capKey1, deliverKey))
-		bapp.Router().AddRoute(routeMsgCounter2, handlerMsgCounter(t, capKey1, deliverKey2))
+func TestBlockSummaryEvent(t *testing.T) {
+	opts := func(bapp *BaseApp) {
+		bapp.SetAnteHandler(func(ctx sdk.Context, tx sdk.Tx, simulate bool) (sdk.Context, error) {
+			ctx.GasMeter().ConsumeGas(10, "ante")
+			return ctx, nil
+		})
+		bapp.Router().AddRoute(routeMsgCounter, func(ctx sdk.Context, msg sdk.Msg) (*sdk.Result, error) {
+			if msg.(*msgCounter).FailOnHandler {
+				return nil, sdkerrors.ErrInvalidRequest
+			}
+			return &sdk.Result{}, nil
+		})
+		bapp.SetEndBlocker(func(ctx sdk.Context, req abci.RequestEndBlock) abci.ResponseEndBlock {
+			return abci.ResponseEndBlock{ValidatorUpdates: []abci.ValidatorUpdate{{Power: 1}}}
+		})
 	}
 
-	app := setupBaseApp(t, anteOpt, routerOpt)
+	app := setupBaseApp(t, opts, SetBlockSummaryEvent(true))
+	app.InitChain(abci.RequestInitChain{})
 
-	// Create same codec used in txDecoder
 	codec := codec.New()
 	registerTestCodec(codec)
 
-	// run a multi-msg tx
-	// with all msgs the same route
+	summary := func(res abci.ResponseEndBlock) map[string]string {
+		for _, event := range res.Events {
+			if event.Type != EventTypeBlockSummary {
+				continue
+			}
 
-	header := abci.Header{Height: 1}
-	app.BeginBlock(abci.RequestBeginBlock{Header: header})
-	tx := newTxCounter(0, 0, 1, 2)
-	txBytes, err := codec.MarshalBinaryBare(tx)
-	require.NoError(t, err)
-	res := app.DeliverTx(abci.RequestDeliverTx{Tx: txBytes})
-	require.True(t, res.IsOK(), fmt.Sprintf("%v", res))
+			attrs := make(map[string]string)
+			for _, attr := range event.Attributes {
+				attrs[string(attr.Key)] = string(attr.Value)
+			}
+			return attrs
+		}
 
-	store := app.deliverState.ctx.KVStore(capKey1)
+		t.Fatal("missing block summary event")
+		return nil
+	}
 
-	// tx counter only incremented once
-	txCounter := getIntFromStore(store, anteKey)
-	require.Equal(t, int64(1), txCounter)
+	app.BeginBlock(abci.RequestBeginBlock{Header: abci.Header{Height: 1}})
 
-	// msg counter incremented three times
-	msgCounter := getIntFromStore(store, deliverKey)
-	require.Equal(t, int64(3), msgCounter)
+	var gasUsed int64
+	for i, fail := range []bool{false, false, true} {
+		tx := newTxCounter(int64(i), int64(i))
+		tx.setFailOnHandler(fail)
+		txBytes, err := codec.MarshalBinaryBare(tx)
+		require.NoError(t, err)
 
-	// replace the second message with a msgCounter2
+		res := app.DeliverTx(abci.RequestDeliverTx{Tx: txBytes})
+		require.Equal(t, !fail, res.IsOK(), res.Log)
+		gasUsed += res.GasUsed
+	}
 
-	tx = newTxCounter(1, 3)
-	tx.Msgs = append(tx.Msgs, msgCounter2{0})
-	tx.Msgs = append(tx.Msgs, msgCounter2{1})
-	txBytes, err = codec.MarshalBinaryBare(tx)
+	// undecodable txs are delivered too
+	res := app.DeliverTx(abci.RequestDeliverTx{Tx: []byte("garbage")})
+	require.False(t, res.IsOK())
+
+	require.True(t, gasUsed >= 30)
+	require.Equal(t, map[string]string{
+		AttributeKeyTxCount:          "4",
+		AttributeKeyBlockGasUsed:     strconv.FormatInt(gasUsed, 10),
+		AttributeKeyValidatorUpdates: "1",
+	}, summary(app.EndBlock(abci.RequestEndBlock{Height: 1})))
+	app.Commit()
+
+	// the summary is reset for each block
+	app.BeginBlock(abci.RequestBeginBlock{Header: abci.Header{Height: 2}})
+	require.Equal(t, map[string]string{
+		AttributeKeyTxCount:          "0",
+		AttributeKeyBlockGasUsed:     "0",
+		AttributeKeyValidatorUpdates: "1",
+	}, summary(app.EndBlock(abci.RequestEndBlock{Height: 2})))
+	app.Commit()
+
+	// the event is opt-in
+	app = setupBaseApp(t, opts)
+	app.InitChain(abci.RequestInitChain{})
+	app.BeginBlock(abci.RequestBeginBlock{Header: abci.Header{Height: 1}})
+	require.Empty(t, app.EndBlock(abci.RequestEndBlock{Height: 1}).Events)
+}
+
+func TestSetOption(t *testing.T) {
+	var verbose string
+	app := setupBaseApp(t, func(bapp *BaseApp) {
+		bapp.RegisterOptionHandler("verbose", func(key, value string) (string, error) {
+			if value != "true" && value != "false" {
+				return "", sdkerrors.Wrapf(sdkerrors.ErrInvalidRequest, "invalid %s: %s", key, value)
+			}
+			verbose = value
+			return "ok", nil
+		})
+	})
+	app.InitChain(abci.RequestInitChain{})
+
+	res := app.SetOption(abci.RequestSetOption{Key: "verbose", Value: "true"})
+	require.Equal(t, abci.CodeTypeOK, res.Code, res.Log)
+	require.Equal(t, "ok", res.Info)
+	require.Equal(t, "true", verbose)
+
+	res = app.SetOption(abci.RequestSetOption{Key: "verbose", Value: "maybe"})
+	require.Equal(t, sdkerrors.ErrInvalidRequest.ABCICode(), res.Code)
+	require.Equal(t, "true", verbose)
+
+	res = app.SetOption(abci.RequestSetOption{Key: "unknown", Value: "true"})
+	require.Equal(t, sdkerrors.ErrUnknownRequest.ABCICode(), res.Code)
+	require.Contains(t, res.Log, "unknown option: unknown")
+
+	// built-in minimum gas prices option
+	res = app.SetOption(abci.RequestSetOption{Key: OptionKeyMinGasPrices, Value: "0.025stake"})
+	require.Equal(t, abci.CodeTypeOK, res.Code, res.Log)
+	expected, err := sdk.ParseDecCoins("0.025stake")
 	require.NoError(t, err)
-	res = app.DeliverTx(abci.RequestDeliverTx{Tx: txBytes})
-	require.True(t, res.IsOK(), fmt.Sprintf("%v", res))
+	require.Equal(t, expected, app.minGasPrices)
+	require.Equal(t, expected, app.checkState.ctx.MinGasPrices())
 
-	store = app.deliverState.ctx.KVStore(capKey1)
+	res = app.SetOption(abci.RequestSetOption{Key: OptionKeyMinGasPrices, Value: "invalid"})
+	require.Equal(t, sdkerrors.ErrInvalidRequest.ABCICode(), res.Code)
+	require.Equal(t, expected, app.minGasPrices)
 
-	// tx counter only incremented once
-	txCounter = getIntFromStore(store, anteKey)
-	require.Equal(t, int64(2), txCounter)
+	require.Panics(t, func() {
+		NewBaseApp("test", log.NewNopLogger(), dbm.NewMemDB(), nil).
+			RegisterOptionHandler(OptionKeyMinGasPrices, func(key, value string) (string, error) { return "", nil })
+	})
+}
 
-	// original counter increments by one
-	// new counter increments by two
-	msgCounter = getIntFromStore(store, deliverKey)
-	require.Equal(t, int64(4), msgCounter)
-	msgCounter2 := getIntFromStore(store, deliverKey2)
-	require.Equal(t, int64(2), msgCounter2)
+// recordingGasMeter is a gas meter recording the descriptors of the gas it
+// consumes.
+type recordingGasMeter struct {
+	sdk.GasMeter
+
+	descriptors []string
 }
 
-// Interleave calls to Check and Deliver and ensure
-// that there is no cross-talk. Check sees results of the previous Check calls
-// and Deliver sees that of the previous Deliver calls, but they don't see eachother.
-func TestConcurrentCheckDeliver(t *testing.T) {
-	// TODO
+func (m *recordingGasMeter) ConsumeGas(amount sdk.Gas, descriptor string) {
+	m.descriptors = append(m.descriptors, descriptor)
+	m.GasMeter.ConsumeGas(amount, descriptor)
 }
 
-// Simulate a transaction that uses gas to compute the gas.
-// Simulate() and Query("/app/simulate", txBytes) should give
-// the same results.
-func TestSimulateTx(t *testing.T) {
-	gasConsumed := uint64(5)
+func TestGasMeterFactory(t *testing.T) {
+	var meters []*recordingGasMeter
+	var limits []uint64
 
-	anteOpt := func(bapp *BaseApp) {
-		bapp.SetAnteHandler(func(ctx sdk.Context, tx sdk.Tx, simulate bool) (newCtx sdk.Context, err error) {
-			newCtx = ctx.WithGasMeter(sdk.NewGasMeter(gasConsumed))
-			return
+	opts := func(bapp *BaseApp) {
+		bapp.SetGasMeterFactory(func(limit uint64) sdk.GasMeter {
+			meter := &recordingGasMeter{GasMeter: sdk.NewInfiniteGasMeter()}
+			if limit > 0 {
+				meter.GasMeter = sdk.NewGasMeter(limit)
+			}
+			meters = append(meters, meter)
+			limits = append(limits, limit)
+			return meter
+		})
+		bapp.SetAnteHandler(func(ctx sdk.Context, tx sdk.Tx, simulate bool) (sdk.Context, error) {
+			ctx = ctx.WithGasMeter(sdk.NewGasMeter(100))
+			ctx.GasMeter().ConsumeGas(10, "ante")
+			return ctx, nil
+		})
+		bapp.Router().AddRoute(routeMsgCounter, func(ctx sdk.Context, msg sdk.Msg) (*sdk.Result, error) {
+			ctx.GasMeter().ConsumeGas(5, "message")
+			return &sdk.Result{}, nil
 		})
 	}
 
+	app := setupBaseApp(t, opts)
+	app.InitChain(abci.RequestInitChain{})
+
+	// the block gas meter is infinite in the absence of a block gas limit
+	app.BeginBlock(abci.RequestBeginBlock{Header: abci.Header{Height: 1}})
+	require.Equal(t, []uint64{0}, limits)
+	require.Equal(t, meters[0], app.deliverState.ctx.BlockGasMeter())
+
+	gInfo, _, err := app.Deliver(newTxCounter(0, 0))
+	require.NoError(t, err)
+	require.Equal(t, uint64(100), gInfo.GasWanted)
+	require.Equal(t, uint64(15), gInfo.GasUsed)
+
+	// messages are executed with a meter of the factory carrying over the
+	// AnteHandler gas limit and consumption
+	require.Equal(t, []uint64{0, 100}, limits)
+	require.Equal(t, []string{"gas consumed before message execution", "message"}, meters[1].descriptors)
+	require.Equal(t, uint64(15), meters[1].GasConsumed())
+	require.Equal(t, []string{"block gas meter"}, meters[0].descriptors)
+	require.Equal(t, uint64(15), meters[0].GasConsumed())
+}
+
+func TestMaxMsgsPerTx(t *testing.T) {
+	anteCalls := 0
+	anteOpt := func(bapp *BaseApp) {
+		bapp.SetAnteHandler(func(ctx sdk.Context, tx sdk.Tx, simulate bool) (sdk.Context, error) {
+			anteCalls++
+			return ctx, nil
+		})
+	}
 	routerOpt := func(bapp *BaseApp) {
 		bapp.Router().AddRoute(routeMsgCounter, func(ctx sdk.Context, msg sdk.Msg) (*sdk.Result, error) {
-			ctx.GasMeter().ConsumeGas(gasConsumed, "test")
 			return &sdk.Result{}, nil
 		})
 	}
 
-	app := setupBaseApp(t, anteOpt, routerOpt)
+	app := setupBaseApp(t, anteOpt, routerOpt, SetMaxMsgsPerTx(2))
+	app.InitChain(abci.RequestInitChain{})
+
+	cdc := codec.New()
+	registerTestCodec(cdc)
+
+	atLimit, err := cdc.MarshalBinaryBare(newTxCounter(0, 0, 1))
+	require.NoError(t, err)
+	overLimit, err := cdc.MarshalBinaryBare(newTxCounter(0, 0, 1, 2))
+	require.NoError(t, err)
+
+	checkRes := app.CheckTx(abci.RequestCheckTx{Tx: atLimit})
+	require.True(t, checkRes.IsOK(), checkRes.Log)
+	require.Equal(t, 1, anteCalls)
+
+	checkRes = app.CheckTx(abci.RequestCheckTx{Tx: overLimit})
+	require.Equal(t, sdkerrors.ErrInvalidRequest.ABCICode(), checkRes.Code)
+	require.Equal(t, 1, anteCalls)
+
+	app.BeginBlock(abci.RequestBeginBlock{Header: abci.Header{Height: 1}})
+
+	deliverRes := app.DeliverTx(abci.RequestDeliverTx{Tx: atLimit})
+	require.True(t, deliverRes.IsOK(), deliverRes.Log)
+	require.Equal(t, 2, anteCalls)
+
+	deliverRes = app.DeliverTx(abci.RequestDeliverTx{Tx: overLimit})
+	require.Equal(t, sdkerrors.ErrInvalidRequest.ABCICode(), deliverRes.Code)
+	require.Equal(t, 2, anteCalls)
+}
+
+func TestRecheckMinGasPrices(t *testing.T) {
+	// the tx counter is the gas price paid in stake
+	anteOpt := func(bapp *BaseApp) {
+		bapp.SetAnteHandler(func(ctx sdk.Context, tx sdk.Tx, simulate bool) (sdk.Context, error) {
+			paid := sdk.NewDec(tx.(txTest).Counter)
+			if paid.LT(ctx.MinGasPrices().AmountOf("stake")) {
+				return ctx, sdkerrors.Wrapf(sdkerrors.ErrInsufficientFee, "gas price %s too low", paid)
+			}
+			return ctx, nil
+		})
+	}
+
+	minPrice := int64(1)
+	recheckOpt := SetRecheckMinGasPrices(func(ctx sdk.Context) sdk.DecCoins {
+		require.True(t, ctx.IsReCheckTx())
+		return sdk.DecCoins{sdk.NewInt64DecCoin("stake", minPrice)}
+	})
 
+	app := setupBaseApp(t, anteOpt, recheckOpt, SetMinGasPrices("1.0stake"))
 	app.InitChain(abci.RequestInitChain{})
 
-	// Create same codec used in txDecoder
 	cdc := codec.New()
 	registerTestCodec(cdc)
 
-	nBlocks := 3
-	for blockN := 0; blockN < nBlocks; blockN++ {
-		count := int64(blockN + 1)
-		header := abci.Header{Height: count}
-		app.BeginBlock(abci.RequestBeginBlock{Header: header})
+	txBytes, err := cdc.MarshalBinaryBare(newTxCounter(2, 0))
+	require.NoError(t, err)
 
-		tx := newTxCounter(count, count)
-		txBytes, err := cdc.MarshalBinaryBare(tx)
-		require.Nil(t, err)
+	res := app.CheckTx(abci.RequestCheckTx{Tx: txBytes})
+	require.True(t, res.IsOK(), res.Log)
+	res = app.CheckTx(abci.RequestCheckTx{Tx: txBytes, Type: abci.CheckTxType_Recheck})
+	require.True(t, res.IsOK(), res.Log)
 
-		// simulate a message, check gas reported
-		gInfo, result, err := app.Simulate(txBytes, tx)
-		require.NoError(t, err)
-		require.NotNil(t, result)
-		require.Equal(t, gasConsumed, gInfo.GasUsed)
+	// the tx is evicted once the minimum gas price is raised above its price
+	minPrice = 3
+	res = app.CheckTx(abci.RequestCheckTx{Tx: txBytes, Type: abci.CheckTxType_Recheck})
+	require.Equal(t, sdkerrors.ErrInsufficientFee.ABCICode(), res.Code)
 
-		// simulate again, same result
-		gInfo, result, err = app.Simulate(txBytes, tx)
-		require.NoError(t, err)
-		require.NotNil(t, result)
-		require.Equal(t, gasConsumed, gInfo.GasUsed)
+	// new txs are still checked against the static minimum gas prices
+	res = app.CheckTx(abci.RequestCheckTx{Tx: txBytes})
+	require.True(t, res.IsOK(), res.Log)
+}
 
-		// simulate by calling Query with encoded tx
-		query := abci.RequestQuery{
-			Path: "/app/simulate",
-			Data: txBytes,
-		}
-		queryResult := app.Query(query)
-		require.True(t, queryResult.IsOK(), queryResult.Log)
+// feeTxTest is a tx paying the fee it is decoded from.
+type feeTxTest struct {
+	txTest
+	Fee sdk.Coins
+}
 
-		var simRes sdk.SimulationResponse
-		require.NoError(t, jsonpb.Unmarshal(strings.NewReader(string(queryResult.Value)), &simRes))
+func (tx feeTxTest) GetFee() sdk.Coins { return tx.Fee }
 
-		require.Equal(t, gInfo, simRes.GasInfo)
-		require.Equal(t, result.Log, simRes.Result.Log)
-		require.Equal(t, result.Events, simRes.Result.Events)
-		require.True(t, bytes.Equal(result.Data, simRes.Result.Data))
+func TestAcceptedFeeDenoms(t *testing.T) {
+	decoder := func(txBytes []byte) (sdk.Tx, error) {
+		fee, err := sdk.ParseCoins(string(txBytes))
+		if err != nil {
+			return nil, sdkerrors.Wrap(sdkerrors.ErrTxDecode, err.Error())
+		}
 
-		app.EndBlock(abci.RequestEndBlock{})
-		app.Commit()
+		return feeTxTest{txTest: *newTxCounter(0, 0), Fee: fee}, nil
 	}
-}
 
-func TestRunInvalidTransaction(t *testing.T) {
+	anteCalls := 0
 	anteOpt := func(bapp *BaseApp) {
-		bapp.SetAnteHandler(func(ctx sdk.Context, tx sdk.Tx, simulate bool) (newCtx sdk.Context, err error) {
-			return
-		})
-	}
-	routerOpt := func(bapp *BaseApp) {
-		bapp.Router().AddRoute(routeMsgCounter, func(ctx sdk.Context, msg sdk.Msg) (*sdk.Result, error) {
-			return &sdk.Result{}, nil
+		bapp.SetAnteHandler(func(ctx sdk.Context, tx sdk.Tx, simulate bool) (sdk.Context, error) {
+			anteCalls++
+			return ctx, nil
 		})
 	}
 
-	app := setupBaseApp(t, anteOpt, routerOpt)
+	app := NewBaseApp(t.Name(), defaultLogger(), dbm.NewMemDB(), decoder, anteOpt, SetAcceptedFeeDenoms([]string{"stake", "atom"}))
+	app.MountStores(capKey1)
+	require.NoError(t, app.LoadLatestVersion(capKey1))
 
-	header := abci.Header{Height: 1}
-	app.BeginBlock(abci.RequestBeginBlock{Header: header})
+	checkRes := app.CheckTx(abci.RequestCheckTx{Tx: []byte("10atom")})
+	require.True(t, checkRes.IsOK(), checkRes.Log)
+	require.Equal(t, 1, anteCalls)
 
-	// transaction with no messages
-	{
-		emptyTx := &txTest{}
-		_, result, err := app.Deliver(emptyTx)
-		require.Error(t, err)
-		require.Nil(t, result)
+	checkRes = app.CheckTx(abci.RequestCheckTx{Tx: []byte("10atom,5photon")})
+	require.Equal(t, sdkerrors.ErrInsufficientFee.ABCICode(), checkRes.Code)
+	require.Contains(t, checkRes.Log, "fee denom photon is not accepted")
+	require.Equal(t, 1, anteCalls)
 
-		space, code, _ := sdkerrors.ABCIInfo(err, false)
-		require.EqualValues(t, sdkerrors.ErrInvalidRequest.Codespace(), space, err)
-		require.EqualValues(t, sdkerrors.ErrInvalidRequest.ABCICode(), code, err)
+	// txs paying no fee are left to the AnteHandler
+	checkRes = app.CheckTx(abci.RequestCheckTx{Tx: []byte("")})
+	require.True(t, checkRes.IsOK(), checkRes.Log)
+	require.Equal(t, 2, anteCalls)
+
+	// all denoms are accepted by default
+	app = NewBaseApp(t.Name(), defaultLogger(), dbm.NewMemDB(), decoder, anteOpt)
+	app.MountStores(capKey1)
+	require.NoError(t, app.LoadLatestVersion(capKey1))
+
+	checkRes = app.CheckTx(abci.RequestCheckTx{Tx: []byte("5photon")})
+	require.True(t, checkRes.IsOK(), checkRes.Log)
+}
+
+func TestZeroGasTxPredicate(t *testing.T) {
+	// the tx counter is the gas price paid in stake
+	anteOpt := func(bapp *BaseApp) {
+		bapp.SetAnteHandler(func(ctx sdk.Context, tx sdk.Tx, simulate bool) (sdk.Context, error) {
+			paid := sdk.NewDec(tx.(txTest).Counter)
+			if paid.LT(ctx.MinGasPrices().AmountOf("stake")) {
+				return ctx, sdkerrors.Wrapf(sdkerrors.ErrInsufficientFee, "gas price %s too low", paid)
+			}
+			return ctx, nil
+		})
 	}
 
-	// transaction where ValidateBasic fails
-	{
-		testCases := []struct {
-			tx   *txTest
-			fail bool
-		}{
-			{newTxCounter(0, 0), false},
-			{newTxCounter(-1, 0), false},
-			{newTxCounter(100, 100), false},
-			{newTxCounter(100, 5, 4, 3, 2, 1), false},
+	// only txs with a failing message handler are system txs
+	predicateOpt := SetZeroGasTxPredicate(func(tx sdk.Tx) bool {
+		return tx.(txTest).Msgs[0].(*msgCounter).FailOnHandler
+	})
 
-			{newTxCounter(0, -1), true},
-			{newTxCounter(0, 1, -2), true},
-			{newTxCounter(0, 1, 2, -10, 5), true},
-		}
+	app := setupBaseApp(t, anteOpt, predicateOpt, SetMinGasPrices("1.0stake"))
+	app.InitChain(abci.RequestInitChain{})
 
-		for _, testCase := range testCases {
-			tx := testCase.tx
-			_, result, err := app.Deliver(tx)
+	cdc := codec.New()
+	registerTestCodec(cdc)
 
-			if testCase.fail {
-				require.Error(t, err)
+	systemTx := newTxCounter(0, 0)
+	systemTx.setFailOnHandler(true)
+	txBytes, err := cdc.MarshalBinaryBare(systemTx)
+	require.NoError(t, err)
 
-				space, code, _ := sdkerrors.ABCIInfo(err, false)
-				require.EqualValues(t, sdkerrors.ErrInvalidSequence.Codespace(), space, err)
-				require.EqualValues(t, sdkerrors.ErrInvalidSequence.ABCICode(), code, err)
-			} else {
-				require.NotNil(t, result)
-			}
-		}
-	}
+	res := app.CheckTx(abci.RequestCheckTx{Tx: txBytes})
+	require.True(t, res.IsOK(), res.Log)
 
-	// transaction with no known route
-	{
-		unknownRouteTx := txTest{[]sdk.Msg{msgNoRoute{}}, 0, false}
-		_, result, err := app.Deliver(unknownRouteTx)
-		require.Error(t, err)
-		require.Nil(t, result)
+	txBytes, err = cdc.MarshalBinaryBare(newTxCounter(0, 0))
+	require.NoError(t, err)
 
-		space, code, _ := sdkerrors.ABCIInfo(err, false)
-		require.EqualValues(t, sdkerrors.ErrUnknownRequest.Codespace(), space, err)
-		require.EqualValues(t, sdkerrors.ErrUnknownRequest.ABCICode(), code, err)
+	res = app.CheckTx(abci.RequestCheckTx{Tx: txBytes})
+	require.Equal(t, sdkerrors.ErrInsufficientFee.ABCICode(), res.Code)
 
-		unknownRouteTx = txTest{[]sdk.Msg{msgCounter{}, msgNoRoute{}}, 0, false}
-		_, result, err = app.Deliver(unknownRouteTx)
-		require.Error(t, err)
-		require.Nil(t, result)
+	// txs paying the minimum gas prices are unaffected
+	txBytes, err = cdc.MarshalBinaryBare(newTxCounter(1, 0))
+	require.NoError(t, err)
 
-		space, code, _ = sdkerrors.ABCIInfo(err, false)
-		require.EqualValues(t, sdkerrors.ErrUnknownRequest.Codespace(), space, err)
-		require.EqualValues(t, sdkerrors.ErrUnknownRequest.ABCICode(), code, err)
-	}
+	res = app.CheckTx(abci.RequestCheckTx{Tx: txBytes})
+	require.True(t, res.IsOK(), res.Log)
+}
 
-	// Transaction with an unregistered message
-	{
-		tx := newTxCounter(0, 0)
-		tx.Msgs = append(tx.Msgs, msgNoDecode{})
+func TestTxCache(t *testing.T) {
+	cdc := codec.New()
+	registerTestCodec(cdc)
 
-		// new codec so we can encode the tx, but we shouldn't be able to decode
-		newCdc := codec.New()
-		registerTestCodec(newCdc)
-		newCdc.RegisterConcrete(&msgNoDecode{}, "cosmos-sdk/baseapp/msgNoDecode", nil)
+	decodes := 0
+	decoder := func(txBytes []byte) (sdk.Tx, error) {
+		decodes++
+		return testTxDecoder(cdc)(txBytes)
+	}
 
-		txBytes, err := newCdc.MarshalBinaryBare(tx)
-		require.NoError(t, err)
+	newApp := func(cacheSize int) *BaseApp {
+		app := NewBaseApp(t.Name(), defaultLogger(), dbm.NewMemDB(), decoder, SetTxCacheSize(cacheSize))
+		app.MountStores(capKey1)
+		require.NoError(t, app.LoadLatestVersion(capKey1))
+		app.InitChain(abci.RequestInitChain{})
+		app.BeginBlock(abci.RequestBeginBlock{Header: abci.Header{Height: 1}})
+		return app
+	}
 
-		res := app.DeliverTx(abci.RequestDeliverTx{Tx: txBytes})
-		require.EqualValues(t, sdkerrors.ErrTxDecode.ABCICode(), res.Code)
-		require.EqualValues(t, sdkerrors.ErrTxDecode.Codespace(), res.Codespace)
+	txs := make([][]byte, 3)
+	for i := range txs {
+		txBytes, err := cdc.MarshalBinaryBare(newTxCounter(int64(i), 0))
+		require.NoError(t, err)
+		txs[i] = txBytes
 	}
+
+	app := newApp(2)
+
+	app.CheckTx(abci.RequestCheckTx{Tx: txs[0]})
+	app.CheckTx(abci.RequestCheckTx{Tx: txs[0], Type: abci.CheckTxType_Recheck})
+	require.Equal(t, 1, decodes)
+
+	// the least recently used tx is evicted once the cache is full
+	app.CheckTx(abci.RequestCheckTx{Tx: txs[1]})
+	app.CheckTx(abci.RequestCheckTx{Tx: txs[2]})
+	require.Equal(t, 3, decodes)
+	app.CheckTx(abci.RequestCheckTx{Tx: txs[0], Type: abci.CheckTxType_Recheck})
+	require.Equal(t, 4, decodes)
+
+	// delivered txs are evicted
+	app.DeliverTx(abci.RequestDeliverTx{Tx: txs[2]})
+	require.Equal(t, 4, decodes)
+	app.DeliverTx(abci.RequestDeliverTx{Tx: txs[2]})
+	require.Equal(t, 5, decodes)
+
+	// txs failing to decode are not cached
+	res := app.CheckTx(abci.RequestCheckTx{Tx: []byte{}})
+	require.Equal(t, sdkerrors.ErrTxDecode.ABCICode(), res.Code)
+	app.CheckTx(abci.RequestCheckTx{Tx: []byte{}})
+	require.Equal(t, 7, decodes)
+
+	// every tx is decoded when the cache is disabled
+	decodes = 0
+	app = newApp(0)
+	app.CheckTx(abci.RequestCheckTx{Tx: txs[0]})
+	app.CheckTx(abci.RequestCheckTx{Tx: txs[0], Type: abci.CheckTxType_Recheck})
+	app.DeliverTx(abci.RequestDeliverTx{Tx: txs[0]})
+	require.Equal(t, 3, decodes)
 }
 
-// Test that transactions exceeding gas limits fail
-func TestTxGasLimits(t *testing.T) {
-	gasGranted := uint64(10)
-	anteOpt := func(bapp *BaseApp) {
-		bapp.SetAnteHandler(func(ctx sdk.Context, tx sdk.Tx, simulate bool) (newCtx sdk.Context, err error) {
-			newCtx = ctx.WithGasMeter(sdk.NewGasMeter(gasGranted))
+func BenchmarkDecodeTx(b *testing.B) {
+	cdc := codec.New()
+	registerTestCodec(cdc)
 
-			// AnteHandlers must have their own defer/recover in order for the BaseApp
-			// to know how much gas was used! This is because the GasMeter is created in
-			// the AnteHandler, but if it panics the context won't be set properly in
-			// runTx's recover call.
-			defer func() {
-				if r := recover(); r != nil {
-					switch rType := r.(type) {
-					case sdk.ErrorOutOfGas:
-						err = sdkerrors.Wrapf(sdkerrors.ErrOutOfGas, "out of gas in location: %v", rType.Descriptor)
-					default:
-						panic(r)
-					}
-				}
-			}()
+	msgCounters := make([]int64, 100)
+	for i := range msgCounters {
+		msgCounters[i] = int64(i)
+	}
 
-			count := tx.(*txTest).Counter
-			newCtx.GasMeter().ConsumeGas(uint64(count), "counter-ante")
+	txBytes, err := cdc.MarshalBinaryBare(newTxCounter(0, msgCounters...))
+	require.NoError(b, err)
 
-			return newCtx, nil
-		})
+	for _, cacheSize := range []int{0, 1000} {
+		app := NewBaseApp(b.Name(), defaultLogger(), dbm.NewMemDB(), testTxDecoder(cdc), SetTxCacheSize(cacheSize))
 
+		b.Run(fmt.Sprintf("cache size %d", cacheSize), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := app.decodeTx(txBytes); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
 	}
+}
 
+func TestStructuredErrors(t *testing.T) {
+	anteOpt := func(bapp *BaseApp) {
+		bapp.SetAnteHandler(func(ctx sdk.Context, tx sdk.Tx, simulate bool) (sdk.Context, error) {
+			if tx.(txTest).FailOnAnte {
+				return ctx, sdkerrors.Wrap(sdkerrors.ErrUnauthorized, "ante handler failure")
+			}
+			return ctx, nil
+		})
+	}
 	routerOpt := func(bapp *BaseApp) {
 		bapp.Router().AddRoute(routeMsgCounter, func(ctx sdk.Context, msg sdk.Msg) (*sdk.Result, error) {
-			count := msg.(msgCounter).Counter
-			ctx.GasMeter().ConsumeGas(uint64(count), "counter-handler")
+			if msg.(*msgCounter).Counter == 1 {
+				return nil, sdkerrors.Wrap(sdkerrors.ErrInsufficientFunds, "message handler failure")
+			}
 			return &sdk.Result{}, nil
 		})
 	}
 
-	app := setupBaseApp(t, anteOpt, routerOpt)
-
-	header := abci.Header{Height: 1}
-	app.BeginBlock(abci.RequestBeginBlock{Header: header})
-
-	testCases := []struct {
-		tx      *txTest
-		gasUsed uint64
-		fail    bool
-	}{
-		{newTxCounter(0, 0), 0, false},
-		{newTxCounter(1, 1), 2, false},
-		{newTxCounter(9, 1), 10, false},
-		{newTxCounter(1, 9), 10, false},
-		{newTxCounter(10, 0), 10, false},
-		{newTxCounter(0, 10), 10, false},
-		{newTxCounter(0, 8, 2), 10, false},
-		{newTxCounter(0, 5, 1, 1, 1, 1, 1), 10, false},
-		{newTxCounter(0, 5, 1, 1, 1, 1), 9, false},
+	cdc := codec.New()
+	registerTestCodec(cdc)
 
-		{newTxCounter(9, 2), 11, true},
-		{newTxCounter(2, 9), 11, true},
-		{newTxCounter(9, 1, 1), 11, true},
-		{newTxCounter(1, 8, 1, 1), 11, true},
-		{newTxCounter(11, 0), 11, true},
-		{newTxCounter(0, 11), 11, true},
-		{newTxCounter(0, 5, 11), 16, true},
-	}
+	failOnMsg, err := cdc.MarshalBinaryBare(newTxCounter(0, 0, 1))
+	require.NoError(t, err)
 
-	for i, tc := range testCases {
-		tx := tc.tx
-		gInfo, result, err := app.Deliver(tx)
+	failOnAnteTx := newTxCounter(0, 0)
+	failOnAnteTx.setFailOnAnte(true)
+	failOnAnte, err := cdc.MarshalBinaryBare(failOnAnteTx)
+	require.NoError(t, err)
 
-		// check gas used and wanted
-		require.Equal(t, tc.gasUsed, gInfo.GasUsed, fmt.Sprintf("tc #%d; gas: %v, result: %v, err: %s", i, gInfo, result, err))
+	// disabled by default
+	app := setupBaseApp(t, anteOpt, routerOpt)
+	app.InitChain(abci.RequestInitChain{})
+	app.BeginBlock(abci.RequestBeginBlock{Header: abci.Header{Height: 1}})
 
-		// check for out of gas
-		if !tc.fail {
-			require.NotNil(t, result, fmt.Sprintf("%d: %v, %v", i, tc, err))
-		} else {
-			require.Error(t, err)
-			require.Nil(t, result)
+	res := app.DeliverTx(abci.RequestDeliverTx{Tx: failOnMsg})
+	require.Equal(t, sdkerrors.ErrInsufficientFunds.ABCICode(), res.Code)
+	require.Empty(t, res.Data)
+	flatLog := res.Log
 
-			space, code, _ := sdkerrors.ABCIInfo(err, false)
-			require.EqualValues(t, sdkerrors.ErrOutOfGas.Codespace(), space, err)
-			require.EqualValues(t, sdkerrors.ErrOutOfGas.ABCICode(), code, err)
-		}
-	}
+	app = setupBaseApp(t, anteOpt, routerOpt, SetStructuredErrors(true))
+	app.InitChain(abci.RequestInitChain{})
+	app.BeginBlock(abci.RequestBeginBlock{Header: abci.Header{Height: 1}})
+
+	// message failures report the failing message
+	res = app.DeliverTx(abci.RequestDeliverTx{Tx: failOnMsg})
+	require.Equal(t, sdkerrors.ErrInsufficientFunds.ABCICode(), res.Code)
+	require.Equal(t, flatLog, res.Log)
+
+	var details TxErrorDetails
+	require.NoError(t, json.Unmarshal(res.Data, &details))
+	require.Equal(t, sdkerrors.ErrInsufficientFunds.Codespace(), details.Codespace)
+	require.Equal(t, sdkerrors.ErrInsufficientFunds.ABCICode(), details.Code)
+	require.Equal(t, sdkerrors.ErrInsufficientFunds.Error(), details.Cause)
+	require.NotNil(t, details.MsgIndex)
+	require.Equal(t, 1, *details.MsgIndex)
+	require.Equal(t, routeMsgCounter, details.MsgRoute)
+
+	// ante handler failures are not attributed to a message
+	res = app.DeliverTx(abci.RequestDeliverTx{Tx: failOnAnte})
+	require.Equal(t, sdkerrors.ErrUnauthorized.ABCICode(), res.Code)
+
+	details = TxErrorDetails{}
+	require.NoError(t, json.Unmarshal(res.Data, &details))
+	require.Equal(t, sdkerrors.ErrUnauthorized.ABCICode(), details.Code)
+	require.Equal(t, sdkerrors.ErrUnauthorized.Error(), details.Cause)
+	require.Nil(t, details.MsgIndex)
+	require.Empty(t, details.MsgRoute)
+
+	// successful txs are unaffected
+	okTx, err := cdc.MarshalBinaryBare(newTxCounter(1, 0))
+	require.NoError(t, err)
+	res = app.DeliverTx(abci.RequestDeliverTx{Tx: okTx})
+	require.True(t, res.IsOK(), res.Log)
 }
 
-// Test that transactions exceeding gas limits fail
-func TestMaxBlockGasLimits(t *testing.T) {
-	gasGranted := uint64(10)
+func TestGasOverheadTracking(t *testing.T) {
 	anteOpt := func(bapp *BaseApp) {
-		bapp.SetAnteHandler(func(ctx sdk.Context, tx sdk.Tx, simulate bool) (newCtx sdk.Context, err error) {
-			newCtx = ctx.WithGasMeter(sdk.NewGasMeter(gasGranted))
-
-			defer func() {
-				if r := recover(); r != nil {
-					switch rType := r.(type) {
-					case sdk.ErrorOutOfGas:
-						err = sdkerrors.Wrapf(sdkerrors.ErrOutOfGas, "out of gas in location: %v", rType.Descriptor)
-					default:
-						panic(r)
-					}
-				}
-			}()
-
-			count := tx.(*txTest).Counter
-			newCtx.GasMeter().ConsumeGas(uint64(count), "counter-ante")
+		bapp.SetAnteHandler(func(ctx sdk.Context, tx sdk.Tx, simulate bool) (sdk.Context, error) {
+			newCtx := ctx.WithGasMeter(sdk.NewGasMeter(1000))
+			newCtx.GasMeter().ConsumeGas(10, "ante")
 
-			return
+			if tx.(txTest).FailOnAnte {
+				return newCtx, sdkerrors.Wrap(sdkerrors.ErrUnauthorized, "ante handler failure")
+			}
+			return newCtx, nil
 		})
-
 	}
-
 	routerOpt := func(bapp *BaseApp) {
 		bapp.Router().AddRoute(routeMsgCounter, func(ctx sdk.Context, msg sdk.Msg) (*sdk.Result, error) {
-			count := msg.(msgCounter).Counter
-			ctx.GasMeter().ConsumeGas(uint64(count), "counter-handler")
+			ctx.GasMeter().ConsumeGas(25, "msg")
 			return &sdk.Result{}, nil
 		})
 	}
 
-	app := setupBaseApp(t, anteOpt, routerOpt)
-	app.InitChain(abci.RequestInitChain{
-		ConsensusParams: &abci.ConsensusParams{
-			Block: &abci.BlockParams{
-				MaxGas: 100,
-			},
-		},
-	})
-
-	testCases := []struct {
-		tx                *txTest
-		numDelivers       int
-		gasUsedPerDeliver uint64
-		fail              bool
-		failAfterDeliver  int
-	}{
-		{newTxCounter(0, 0), 0, 0, false, 0},
-		{newTxCounter(9, 1), 2, 10, false, 0},
-		{newTxCounter(10, 0), 3, 10, false, 0},
-		{newTxCounter(10, 0), 10, 10, false, 0},
-		{newTxCounter(2, 7), 11, 9, false, 0},
-		{newTxCounter(10, 0), 10, 10, false, 0}, // hit the limit but pass
+	gasBreakdown := func(events []abci.Event) (overhead, execution string, found bool) {
+		for _, ev := range events {
+			if ev.Type != EventTypeGasBreakdown {
+				continue
+			}
 
-		{newTxCounter(10, 0), 11, 10, true, 10},
-		{newTxCounter(10, 0), 15, 10, true, 10},
-		{newTxCounter(9, 0), 12, 9, true, 11}, // fly past the limit
+			for _, attr := range ev.Attributes {
+				switch string(attr.Key) {
+				case AttributeKeyOverheadGas:
+					overhead = string(attr.Value)
+				case AttributeKeyExecutionGas:
+					execution = string(attr.Value)
+				}
+			}
+			return overhead, execution, true
+		}
+		return "", "", false
 	}
 
-	for i, tc := range testCases {
-		tx := tc.tx
+	cdc := codec.New()
+	registerTestCodec(cdc)
 
-		// reset the block gas
-		header := abci.Header{Height: app.LastBlockHeight() + 1}
-		app.BeginBlock(abci.RequestBeginBlock{Header: header})
+	txBytes, err := cdc.MarshalBinaryBare(newTxCounter(0, 0, 1))
+	require.NoError(t, err)
 
-		// execute the transaction multiple times
-		for j := 0; j < tc.numDelivers; j++ {
-			_, result, err := app.Deliver(tx)
+	failTx := newTxCounter(1, 0)
+	failTx.setFailOnAnte(true)
+	failTxBytes, err := cdc.MarshalBinaryBare(failTx)
+	require.NoError(t, err)
 
-			ctx := app.getState(runTxModeDeliver).ctx
+	// disabled by default
+	app := setupBaseApp(t, anteOpt, routerOpt)
+	app.InitChain(abci.RequestInitChain{})
+	app.BeginBlock(abci.RequestBeginBlock{Header: abci.Header{Height: 1}})
 
-			// check for failed transactions
-			if tc.fail && (j+1) > tc.failAfterDeliver {
-				require.Error(t, err, fmt.Sprintf("tc #%d; result: %v, err: %s", i, result, err))
-				require.Nil(t, result, fmt.Sprintf("tc #%d; result: %v, err: %s", i, result, err))
+	deliverRes := app.DeliverTx(abci.RequestDeliverTx{Tx: txBytes})
+	require.True(t, deliverRes.IsOK(), deliverRes.Log)
+	_, _, found := gasBreakdown(deliverRes.Events)
+	require.False(t, found)
 
-				space, code, _ := sdkerrors.ABCIInfo(err, false)
-				require.EqualValues(t, sdkerrors.ErrOutOfGas.Codespace(), space, err)
-				require.EqualValues(t, sdkerrors.ErrOutOfGas.ABCICode(), code, err)
-				require.True(t, ctx.BlockGasMeter().IsOutOfGas())
-			} else {
-				// check gas used and wanted
-				blockGasUsed := ctx.BlockGasMeter().GasConsumed()
-				expBlockGasUsed := tc.gasUsedPerDeliver * uint64(j+1)
-				require.Equal(
-					t, expBlockGasUsed, blockGasUsed,
-					fmt.Sprintf("%d,%d: %v, %v, %v, %v", i, j, tc, expBlockGasUsed, blockGasUsed, result),
-				)
+	app = setupBaseApp(t, anteOpt, routerOpt, SetGasOverheadTracking(true))
+	app.InitChain(abci.RequestInitChain{})
 
-				require.NotNil(t, result, fmt.Sprintf("tc #%d; currDeliver: %d, result: %v, err: %s", i, j, result, err))
-				require.False(t, ctx.BlockGasMeter().IsPastLimit())
+	// CheckTx does not execute messages
+	checkRes := app.CheckTx(abci.RequestCheckTx{Tx: txBytes})
+	require.True(t, checkRes.IsOK(), checkRes.Log)
+	overhead, execution, found := gasBreakdown(checkRes.Events)
+	require.True(t, found)
+	require.Equal(t, "10", overhead)
+	require.Equal(t, "0", execution)
+	require.Equal(t, int64(10), checkRes.GasUsed)
+
+	app.BeginBlock(abci.RequestBeginBlock{Header: abci.Header{Height: 1}})
+
+	deliverRes = app.DeliverTx(abci.RequestDeliverTx{Tx: txBytes})
+	require.True(t, deliverRes.IsOK(), deliverRes.Log)
+	overhead, execution, found = gasBreakdown(deliverRes.Events)
+	require.True(t, found)
+	require.Equal(t, "10", overhead)
+	require.Equal(t, "50", execution)
+	require.Equal(t, int64(60), deliverRes.GasUsed)
+
+	// gas used by a failing AnteHandler is overhead
+	deliverRes = app.DeliverTx(abci.RequestDeliverTx{Tx: failTxBytes})
+	require.Equal(t, sdkerrors.ErrUnauthorized.ABCICode(), deliverRes.Code)
+	overhead, execution, found = gasBreakdown(deliverRes.Events)
+	require.True(t, found)
+	require.Equal(t, "10", overhead)
+	require.Equal(t, "0", execution)
+	require.Equal(t, int64(10), deliverRes.GasUsed)
+}
+
+func TestDeliverTxBatch(t *testing.T) {
+	var inFlight, maxInFlight int64
+
+	anteOpt := func(bapp *BaseApp) {
+		bapp.SetAnteHandler(func(ctx sdk.Context, tx sdk.Tx, simulate bool) (sdk.Context, error) {
+			newCtx := ctx.WithGasMeter(sdk.NewGasMeter(100000))
+			if tx.(txTest).FailOnAnte {
+				return newCtx, sdkerrors.Wrap(sdkerrors.ErrUnauthorized, "ante handler failure")
+			}
+			return newCtx, nil
+		})
+	}
+	routerOpt := func(bapp *BaseApp) {
+		bapp.Router().AddRoute(routeMsgCounter, func(ctx sdk.Context, msg sdk.Msg) (*sdk.Result, error) {
+			n := atomic.AddInt64(&inFlight, 1)
+			defer atomic.AddInt64(&inFlight, -1)
+			for {
+				max := atomic.LoadInt64(&maxInFlight)
+				if n <= max || atomic.CompareAndSwapInt64(&maxInFlight, max, n) {
+					break
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+
+			m := msg.(*msgCounter)
+			if m.FailOnHandler {
+				return nil, sdkerrors.Wrap(sdkerrors.ErrInvalidRequest, "message handler failure")
+			}
+
+			// read-modify-write of a per-counter key
+			store := ctx.KVStore(capKey1)
+			key := []byte(fmt.Sprintf("counter-%d", m.Counter))
+			setIntOnStore(store, key, getIntFromStore(store, key)+1)
+
+			return &sdk.Result{Log: fmt.Sprintf("counter-%d", m.Counter)}, nil
+		})
+	}
+
+	// txs conflict if they share a counter
+	conflicts := 0
+	conflictFn := func(a, b sdk.Tx) bool {
+		for _, ma := range a.GetMsgs() {
+			for _, mb := range b.GetMsgs() {
+				if ma.(*msgCounter).Counter == mb.(*msgCounter).Counter {
+					conflicts++
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	cdc := codec.New()
+	registerTestCodec(cdc)
+
+	failOnHandler := newTxCounter(0, 3)
+	failOnHandler.setFailOnHandler(true)
+	failOnAnte := newTxCounter(0, 4)
+	failOnAnte.setFailOnAnte(true)
+
+	var reqs []abci.RequestDeliverTx
+	for _, tx := range []*txTest{
+		newTxCounter(0, 1),
+		newTxCounter(0, 2),
+		newTxCounter(0, 5, 6),
+		newTxCounter(0, 1), // conflicts with the first tx
+		failOnHandler,
+		newTxCounter(0, 2, 3), // conflicts with the second tx
+		failOnAnte,
+		newTxCounter(0, 4),
+	} {
+		txBytes, err := cdc.MarshalBinaryBare(tx)
+		require.NoError(t, err)
+		reqs = append(reqs, abci.RequestDeliverTx{Tx: txBytes})
+	}
+	// a tx which cannot be decoded
+	reqs = append(reqs, abci.RequestDeliverTx{Tx: []byte("garbage")})
+
+	deliverBlock := func(app *BaseApp) ([]abci.ResponseDeliverTx, []byte, []byte) {
+		app.InitChain(abci.RequestInitChain{})
+		app.BeginBlock(abci.RequestBeginBlock{Header: abci.Header{Height: 1}})
+		res := app.DeliverTxBatch(reqs)
+		app.EndBlock(abci.RequestEndBlock{Height: 1})
+
+		digest := storeDigest(app.deliverState.ms.GetKVStore(capKey1))
+		return res, digest, app.Commit().Data
+	}
+
+	seqRes, seqDigest, seqHash := deliverBlock(setupBaseApp(t, anteOpt, routerOpt))
+	require.Len(t, seqRes, len(reqs))
+	require.Equal(t, int64(1), maxInFlight)
+
+	parApp := setupBaseApp(t, anteOpt, routerOpt, SetParallelExecution(conflictFn))
+	parRes, parDigest, parHash := deliverBlock(parApp)
+
+	// the txs were executed concurrently and conflicts were detected
+	require.True(t, maxInFlight > 1, maxInFlight)
+	require.True(t, conflicts >= 2, conflicts)
+
+	// the results are identical to sequential execution
+	require.Equal(t, seqRes, parRes)
+	require.Equal(t, seqDigest, parDigest)
+	require.Equal(t, seqHash, parHash)
+
+	require.True(t, parRes[0].IsOK(), parRes[0].Log)
+	require.True(t, parRes[3].IsOK(), parRes[3].Log)
+	require.Equal(t, sdkerrors.ErrInvalidRequest.ABCICode(), parRes[4].Code)
+	require.True(t, parRes[5].IsOK(), parRes[5].Log)
+	require.Equal(t, sdkerrors.ErrUnauthorized.ABCICode(), parRes[6].Code)
+	require.False(t, parRes[8].IsOK())
+
+	// conflicting txs were applied in order
+	store := parApp.cms.GetKVStore(capKey1)
+	require.Equal(t, int64(2), getIntFromStore(store, []byte("counter-1")))
+	require.Equal(t, int64(2), getIntFromStore(store, []byte("counter-2")))
+	require.Equal(t, int64(1), getIntFromStore(store, []byte("counter-3")))
+	require.Equal(t, int64(1), getIntFromStore(store, []byte("counter-4")))
+
+	// a TxConflictFunc which misses the conflicts runs all the txs in a single
+	// batch, the conflicts are detected on merge and the conflicting txs are
+	// executed again
+	maxInFlight = 0
+	lyingApp := setupBaseApp(t, anteOpt, routerOpt, SetParallelExecution(func(a, b sdk.Tx) bool { return false }))
+	lyingRes, lyingDigest, lyingHash := deliverBlock(lyingApp)
+	require.True(t, maxInFlight > 1, maxInFlight)
+
+	require.Equal(t, seqRes, lyingRes)
+	require.Equal(t, seqDigest, lyingDigest)
+	require.Equal(t, seqHash, lyingHash)
+
+	store = lyingApp.cms.GetKVStore(capKey1)
+	require.Equal(t, int64(2), getIntFromStore(store, []byte("counter-1")))
+	require.Equal(t, int64(2), getIntFromStore(store, []byte("counter-2")))
+}
+
+func TestMempoolStats(t *testing.T) {
+	anteOpt := func(bapp *BaseApp) {
+		bapp.SetAnteHandler(func(ctx sdk.Context, tx sdk.Tx, simulate bool) (sdk.Context, error) {
+			txTest := tx.(txTest)
+			switch {
+			case txTest.FailOnAnte:
+				return ctx, sdkerrors.Wrap(sdkerrors.ErrUnauthorized, "ante handler failure")
+
+			case txTest.Counter > 100:
+				return ctx, sdkerrors.Wrap(sdkerrors.ErrTxTooLarge, "tx too large")
+			}
+
+			return ctx, nil
+		})
+	}
+
+	app := setupBaseApp(t, anteOpt)
+	app.InitChain(abci.RequestInitChain{})
+
+	cdc := codec.New()
+	registerTestCodec(cdc)
+
+	checkTx := func(tx *txTest) {
+		txBytes, err := cdc.MarshalBinaryBare(tx)
+		require.NoError(t, err)
+		app.CheckTx(abci.RequestCheckTx{Tx: txBytes})
+	}
+
+	failOnAnte := newTxCounter(0, 0)
+	failOnAnte.setFailOnAnte(true)
+
+	checkTx(newTxCounter(0, 0))
+	checkTx(newTxCounter(1, 1))
+	checkTx(failOnAnte)
+	checkTx(newTxCounter(101, 0))
+	app.CheckTx(abci.RequestCheckTx{Tx: []byte("invalid")})
+	app.CheckTx(abci.RequestCheckTx{})
+
+	expected := MempoolStats{Accepted: 2, AnteFailed: 1, DecodeFailed: 2, TooLarge: 1}
+	require.Equal(t, expected, app.GetMempoolStats())
+
+	res := app.Query(abci.RequestQuery{Path: "/app/mempool-stats"})
+	require.True(t, res.IsOK(), res.Log)
+
+	var stats MempoolStats
+	require.NoError(t, json.Unmarshal(res.Value, &stats))
+	require.Equal(t, expected, stats)
+}
+
+func TestHeightRangeQuery(t *testing.T) {
+	pruningOpt := SetPruning(store.PruningOptions{KeepEvery: 2, SnapshotEvery: 6})
+	app := setupBaseApp(t, pruningOpt)
+
+	queryHeightRange := func() HeightRange {
+		res := app.Query(abci.RequestQuery{Path: "/app/height-range"})
+		require.True(t, res.IsOK(), res.Log)
+
+		var heightRange HeightRange
+		require.NoError(t, json.Unmarshal(res.Value, &heightRange))
+		require.Equal(t, heightRange.Latest, res.Height)
+
+		return heightRange
+	}
+
+	require.Equal(t, HeightRange{}, queryHeightRange())
+
+	for height := int64(1); height <= 7; height++ {
+		app.BeginBlock(abci.RequestBeginBlock{Header: abci.Header{Height: height}})
+		app.Commit()
+	}
+
+	// versions 2 and 4 are pruned while the snapshot version 6 is kept
+	require.Equal(t, HeightRange{Earliest: 6, Latest: 7}, queryHeightRange())
+}
+
+// Number of messages doesn't matter to CheckTx.
+func TestMultiMsgCheckTx(t *testing.T) {
+	// TODO: ensure we get the same results
+	// with one message or many
+}
+
+// One call to DeliverTx should process all the messages, in order.
+func TestMultiMsgDeliverTx(t *testing.T) {
+	// increment the tx counter
+	anteKey := []byte("ante-key")
+	anteOpt := func(bapp *BaseApp) { bapp.SetAnteHandler(anteHandlerTxTest(t, capKey1, anteKey)) }
+
+	// increment the msg counter
+	deliverKey := []byte("deliver-key")
+	deliverKey2 := []byte("deliver-key2")
+	routerOpt := func(bapp *BaseApp) {
+		bapp.Router().AddRoute(routeMsgCounter, handlerMsgCounter(t, capKey1, deliverKey))
+		bapp.Router().AddRoute(routeMsgCounter2, handlerMsgCounter(t, capKey1, deliverKey2))
+	}
+
+	app := setupBaseApp(t, anteOpt, routerOpt)
+
+	// Create same codec used in txDecoder
+	codec := codec.New()
+	registerTestCodec(codec)
+
+	// run a multi-msg tx
+	// with all msgs the same route
+
+	header := abci.Header{Height: 1}
+	app.BeginBlock(abci.RequestBeginBlock{Header: header})
+	tx := newTxCounter(0, 0, 1, 2)
+	txBytes, err := codec.MarshalBinaryBare(tx)
+	require.NoError(t, err)
+	res := app.DeliverTx(abci.RequestDeliverTx{Tx: txBytes})
+	require.True(t, res.IsOK(), fmt.Sprintf("%v", res))
+
+	store := app.deliverState.ctx.KVStore(capKey1)
+
+	// tx counter only incremented once
+	txCounter := getIntFromStore(store, anteKey)
+	require.Equal(t, int64(1), txCounter)
+
+	// msg counter incremented three times
+	msgCounter := getIntFromStore(store, deliverKey)
+	require.Equal(t, int64(3), msgCounter)
+
+	// replace the second message with a msgCounter2
+
+	tx = newTxCounter(1, 3)
+	tx.Msgs = append(tx.Msgs, msgCounter2{0})
+	tx.Msgs = append(tx.Msgs, msgCounter2{1})
+	txBytes, err = codec.MarshalBinaryBare(tx)
+	require.NoError(t, err)
+	res = app.DeliverTx(abci.RequestDeliverTx{Tx: txBytes})
+	require.True(t, res.IsOK(), fmt.Sprintf("%v", res))
+
+	store = app.deliverState.ctx.KVStore(capKey1)
+
+	// tx counter only incremented once
+	txCounter = getIntFromStore(store, anteKey)
+	require.Equal(t, int64(2), txCounter)
+
+	// original counter increments by one
+	// new counter increments by two
+	msgCounter = getIntFromStore(store, deliverKey)
+	require.Equal(t, int64(4), msgCounter)
+	msgCounter2 := getIntFromStore(store, deliverKey2)
+	require.Equal(t, int64(2), msgCounter2)
+}
+
+// Interleave calls to Check and Deliver and ensure
+// that there is no cross-talk. Check sees results of the previous Check calls
+// and Deliver sees that of the previous Deliver calls, but they don't see eachother.
+func TestConcurrentCheckDeliver(t *testing.T) {
+	// TODO
+}
+
+// Simulate a transaction that uses gas to compute the gas.
+// Simulate() and Query("/app/simulate", txBytes) should give
+// the same results.
+func TestSimulateTx(t *testing.T) {
+	gasConsumed := uint64(5)
+
+	anteOpt := func(bapp *BaseApp) {
+		bapp.SetAnteHandler(func(ctx sdk.Context, tx sdk.Tx, simulate bool) (newCtx sdk.Context, err error) {
+			newCtx = ctx.WithGasMeter(sdk.NewGasMeter(gasConsumed))
+			return
+		})
+	}
+
+	routerOpt := func(bapp *BaseApp) {
+		bapp.Router().AddRoute(routeMsgCounter, func(ctx sdk.Context, msg sdk.Msg) (*sdk.Result, error) {
+			ctx.GasMeter().ConsumeGas(gasConsumed, "test")
+			return &sdk.Result{}, nil
+		})
+	}
+
+	app := setupBaseApp(t, anteOpt, routerOpt)
+
+	app.InitChain(abci.RequestInitChain{})
+
+	// Create same codec used in txDecoder
+	cdc := codec.New()
+	registerTestCodec(cdc)
+
+	nBlocks := 3
+	for blockN := 0; blockN < nBlocks; blockN++ {
+		count := int64(blockN + 1)
+		header := abci.Header{Height: count}
+		app.BeginBlock(abci.RequestBeginBlock{Header: header})
+
+		tx := newTxCounter(count, count)
+		txBytes, err := cdc.MarshalBinaryBare(tx)
+		require.Nil(t, err)
+
+		// simulate a message, check gas reported
+		gInfo, result, err := app.Simulate(txBytes, tx)
+		require.NoError(t, err)
+		require.NotNil(t, result)
+		require.Equal(t, gasConsumed, gInfo.GasUsed)
+
+		// simulate again, same result
+		gInfo, result, err = app.Simulate(txBytes, tx)
+		require.NoError(t, err)
+		require.NotNil(t, result)
+		require.Equal(t, gasConsumed, gInfo.GasUsed)
+
+		// simulate by calling Query with encoded tx
+		query := abci.RequestQuery{
+			Path: "/app/simulate",
+			Data: txBytes,
+		}
+		queryResult := app.Query(query)
+		require.True(t, queryResult.IsOK(), queryResult.Log)
+
+		var simRes sdk.SimulationResponse
+		require.NoError(t, jsonpb.Unmarshal(strings.NewReader(string(queryResult.Value)), &simRes))
+
+		require.Equal(t, gInfo, simRes.GasInfo)
+		require.Equal(t, result.Log, simRes.Result.Log)
+		require.Equal(t, result.Events, simRes.Result.Events)
+		require.True(t, bytes.Equal(result.Data, simRes.Result.Data))
+
+		app.EndBlock(abci.RequestEndBlock{})
+		app.Commit()
+	}
+}
+
+func TestTraceTxQuery(t *testing.T) {
+	deliverKey := []byte("deliver-key")
+	routerOpt := func(bapp *BaseApp) {
+		bapp.Router().AddRoute(routeMsgCounter, handlerMsgCounter(t, capKey1, deliverKey))
+	}
+
+	app := setupBaseApp(t, routerOpt)
+	app.InitChain(abci.RequestInitChain{})
+
+	cdc := codec.New()
+	registerTestCodec(cdc)
+
+	txBytes, err := cdc.MarshalBinaryBare(newTxCounter(0, 0))
+	require.NoError(t, err)
+
+	query := abci.RequestQuery{Path: "/app/trace-tx", Data: txBytes}
+	for i := 0; i < 2; i++ {
+		res := app.Query(query)
+		require.True(t, res.IsOK(), res.Log)
+
+		var traceRes sdk.TxTraceResponse
+		require.NoError(t, json.Unmarshal(res.Value, &traceRes))
+		require.Empty(t, traceRes.Error)
+		require.NotNil(t, traceRes.Result)
+		require.False(t, traceRes.Truncated)
+
+		// the handler writes the incremented counter
+		var written bool
+		for _, raw := range traceRes.Trace {
+			var op struct {
+				Operation string `json:"operation"`
+				Key       []byte `json:"key"`
+				Value     []byte `json:"value"`
+			}
+			require.NoError(t, json.Unmarshal(raw, &op))
+
+			if op.Operation == "write" && bytes.Equal(deliverKey, op.Key) {
+				written = true
+				require.Equal(t, []byte{2}, op.Value)
 			}
 		}
+		require.True(t, written)
+	}
+
+	// no state is written by the trace
+	store := app.checkState.ctx.KVStore(capKey1)
+	require.Equal(t, int64(0), getIntFromStore(store, deliverKey))
+
+	// the trace is bounded
+	tracer := &boundedTraceWriter{limit: 4}
+	n, err := tracer.Write([]byte("12345"))
+	require.NoError(t, err)
+	require.Equal(t, 5, n)
+	require.True(t, tracer.truncated)
+	require.Empty(t, tracer.operations())
+}
+
+func TestSimulateAtHeight(t *testing.T) {
+	counterKey := []byte("counter")
+
+	// the handler increments the counter and returns its previous value
+	routerOpt := func(bapp *BaseApp) {
+		bapp.Router().AddRoute(routeMsgCounter, func(ctx sdk.Context, msg sdk.Msg) (*sdk.Result, error) {
+			store := ctx.KVStore(capKey1)
+			counter := getIntFromStore(store, counterKey)
+			setIntOnStore(store, counterKey, counter+1)
+			return &sdk.Result{Data: []byte(fmt.Sprintf("%d", counter))}, nil
+		})
 	}
+
+	app := setupBaseApp(t, routerOpt)
+	app.InitChain(abci.RequestInitChain{})
+
+	cdc := codec.New()
+	registerTestCodec(cdc)
+
+	txBytes, err := cdc.MarshalBinaryBare(newTxCounter(0, 0))
+	require.NoError(t, err)
+
+	for height := int64(1); height <= 3; height++ {
+		app.BeginBlock(abci.RequestBeginBlock{Header: abci.Header{Height: height}})
+		res := app.DeliverTx(abci.RequestDeliverTx{Tx: txBytes})
+		require.True(t, res.IsOK(), res.Log)
+		app.EndBlock(abci.RequestEndBlock{})
+		app.Commit()
+	}
+
+	for height := int64(1); height <= 3; height++ {
+		_, result, err := app.SimulateAtHeight(txBytes, height)
+		require.NoError(t, err)
+		require.Equal(t, []byte(fmt.Sprintf("%d", height)), result.Data)
+	}
+
+	// writes are discarded
+	_, result, err := app.SimulateAtHeight(txBytes, 1)
+	require.NoError(t, err)
+	require.Equal(t, []byte("1"), result.Data)
+
+	_, result, err = app.Simulate(txBytes, newTxCounter(0, 0))
+	require.NoError(t, err)
+	require.Equal(t, []byte("3"), result.Data)
+
+	// unknown heights are rejected
+	_, _, err = app.SimulateAtHeight(txBytes, 10)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "failed to load state at height 10")
+}
+
+// A panicking handler must not crash a node serving simulation queries.
+func TestSimulateTxPanicReturnsError(t *testing.T) {
+	routerOpt := func(bapp *BaseApp) {
+		bapp.Router().AddRoute(routeMsgCounter, func(ctx sdk.Context, msg sdk.Msg) (*sdk.Result, error) {
+			panic("handler panic")
+		})
+	}
+
+	app := setupBaseApp(t, routerOpt)
+	app.InitChain(abci.RequestInitChain{})
+
+	cdc := codec.New()
+	registerTestCodec(cdc)
+
+	header := abci.Header{Height: 1}
+	app.BeginBlock(abci.RequestBeginBlock{Header: header})
+
+	txBytes, err := cdc.MarshalBinaryBare(newTxCounter(0, 0))
+	require.NoError(t, err)
+
+	var queryResult abci.ResponseQuery
+	require.NotPanics(t, func() {
+		queryResult = app.Query(abci.RequestQuery{Path: "/app/simulate", Data: txBytes})
+	})
+	require.False(t, queryResult.IsOK())
+	require.Equal(t, sdkerrors.ErrPanic.ABCICode(), queryResult.Code)
+}
+
+// A panic escaping tx decoding is also converted into a query error.
+func TestSimulateQueryRecoversPanic(t *testing.T) {
+	decoder := func(txBytes []byte) (sdk.Tx, error) {
+		panic("decoder panic")
+	}
+
+	app := NewBaseApp(t.Name(), defaultLogger(), dbm.NewMemDB(), decoder)
+	app.MountStores(capKey1)
+	require.NoError(t, app.LoadLatestVersion(capKey1))
+
+	var queryResult abci.ResponseQuery
+	require.NotPanics(t, func() {
+		queryResult = app.Query(abci.RequestQuery{Path: "/app/simulate", Data: []byte("tx")})
+	})
+	require.False(t, queryResult.IsOK())
+	require.Equal(t, sdkerrors.ErrPanic.ABCICode(), queryResult.Code)
+}
+
+func TestLastRecoveredPanic(t *testing.T) {
+	routerOpt := func(bapp *BaseApp) {
+		bapp.Router().AddRoute(routeMsgCounter, func(ctx sdk.Context, msg sdk.Msg) (*sdk.Result, error) {
+			panic("handler panic")
+		})
+	}
+
+	app := setupBaseApp(t, routerOpt)
+	app.InitChain(abci.RequestInitChain{})
+
+	cdc := codec.New()
+	registerTestCodec(cdc)
+
+	_, err := app.GetLastRecoveredPanic()
+	require.Equal(t, ErrNoRecoveredPanic, err)
+
+	res := app.Query(abci.RequestQuery{Path: "/app/last-panic"})
+	require.False(t, res.IsOK())
+
+	header := abci.Header{Height: 1}
+	app.BeginBlock(abci.RequestBeginBlock{Header: header})
+
+	txBytes, err := cdc.MarshalBinaryBare(newTxCounter(0, 0))
+	require.NoError(t, err)
+
+	deliverRes := app.DeliverTx(abci.RequestDeliverTx{Tx: txBytes})
+	require.Equal(t, sdkerrors.ErrPanic.ABCICode(), deliverRes.Code)
+
+	last, err := app.GetLastRecoveredPanic()
+	require.NoError(t, err)
+	require.Contains(t, last, "recovered: handler panic")
+	require.Contains(t, last, "goroutine")
+
+	res = app.Query(abci.RequestQuery{Path: "/app/last-panic"})
+	require.True(t, res.IsOK(), res.Log)
+
+	var p RecoveredPanic
+	require.NoError(t, json.Unmarshal(res.Value, &p))
+	require.Equal(t, "handler panic", p.Message)
+	require.Equal(t, last, p.String())
+
+	app.ResetLastRecoveredPanic()
+	_, err = app.GetLastRecoveredPanic()
+	require.Equal(t, ErrNoRecoveredPanic, err)
+
+	// panics recovered while serving queries are captured as well
+	res = app.Query(abci.RequestQuery{Path: "/app/simulate", Data: txBytes})
+	require.Equal(t, sdkerrors.ErrPanic.ABCICode(), res.Code)
+
+	last, err = app.GetLastRecoveredPanic()
+	require.NoError(t, err)
+	require.Contains(t, last, "recovered: handler panic")
+}
+
+func TestRunInvalidTransaction(t *testing.T) {
+	anteOpt := func(bapp *BaseApp) {
+		bapp.SetAnteHandler(func(ctx sdk.Context, tx sdk.Tx, simulate bool) (newCtx sdk.Context, err error) {
+			return
+		})
+	}
+	routerOpt := func(bapp *BaseApp) {
+		bapp.Router().AddRoute(routeMsgCounter, func(ctx sdk.Context, msg sdk.Msg) (*sdk.Result, error) {
+			return &sdk.Result{}, nil
+		})
+	}
+
+	app := setupBaseApp(t, anteOpt, routerOpt)
+
+	header := abci.Header{Height: 1}
+	app.BeginBlock(abci.RequestBeginBlock{Header: header})
+
+	// transaction with no messages
+	{
+		emptyTx := &txTest{}
+		_, result, err := app.Deliver(emptyTx)
+		require.Error(t, err)
+		require.Nil(t, result)
+
+		space, code, _ := sdkerrors.ABCIInfo(err, false)
+		require.EqualValues(t, sdkerrors.ErrInvalidRequest.Codespace(), space, err)
+		require.EqualValues(t, sdkerrors.ErrInvalidRequest.ABCICode(), code, err)
+	}
+
+	// transaction where ValidateBasic fails
+	{
+		testCases := []struct {
+			tx   *txTest
+			fail bool
+		}{
+			{newTxCounter(0, 0), false},
+			{newTxCounter(-1, 0), false},
+			{newTxCounter(100, 100), false},
+			{newTxCounter(100, 5, 4, 3, 2, 1), false},
+
+			{newTxCounter(0, -1), true},
+			{newTxCounter(0, 1, -2), true},
+			{newTxCounter(0, 1, 2, -10, 5), true},
+		}
+
+		for _, testCase := range testCases {
+			tx := testCase.tx
+			_, result, err := app.Deliver(tx)
+
+			if testCase.fail {
+				require.Error(t, err)
+
+				space, code, _ := sdkerrors.ABCIInfo(err, false)
+				require.EqualValues(t, sdkerrors.ErrInvalidSequence.Codespace(), space, err)
+				require.EqualValues(t, sdkerrors.ErrInvalidSequence.ABCICode(), code, err)
+			} else {
+				require.NotNil(t, result)
+			}
+		}
+	}
+
+	// transaction with no known route
+	{
+		unknownRouteTx := txTest{[]sdk.Msg{msgNoRoute{}}, 0, false}
+		_, result, err := app.Deliver(unknownRouteTx)
+		require.Error(t, err)
+		require.Nil(t, result)
+
+		space, code, _ := sdkerrors.ABCIInfo(err, false)
+		require.EqualValues(t, sdkerrors.ErrUnknownRequest.Codespace(), space, err)
+		require.EqualValues(t, sdkerrors.ErrUnknownRequest.ABCICode(), code, err)
+
+		unknownRouteTx = txTest{[]sdk.Msg{msgCounter{}, msgNoRoute{}}, 0, false}
+		_, result, err = app.Deliver(unknownRouteTx)
+		require.Error(t, err)
+		require.Nil(t, result)
+
+		space, code, _ = sdkerrors.ABCIInfo(err, false)
+		require.EqualValues(t, sdkerrors.ErrUnknownRequest.Codespace(), space, err)
+		require.EqualValues(t, sdkerrors.ErrUnknownRequest.ABCICode(), code, err)
+	}
+
+	// Transaction with an unregistered message
+	{
+		tx := newTxCounter(0, 0)
+		tx.Msgs = append(tx.Msgs, msgNoDecode{})
+
+		// new codec so we can encode the tx, but we shouldn't be able to decode
+		newCdc := codec.New()
+		registerTestCodec(newCdc)
+		newCdc.RegisterConcrete(&msgNoDecode{}, "cosmos-sdk/baseapp/msgNoDecode", nil)
+
+		txBytes, err := newCdc.MarshalBinaryBare(tx)
+		require.NoError(t, err)
+
+		res := app.DeliverTx(abci.RequestDeliverTx{Tx: txBytes})
+		require.EqualValues(t, sdkerrors.ErrTxDecode.ABCICode(), res.Code)
+		require.EqualValues(t, sdkerrors.ErrTxDecode.Codespace(), res.Codespace)
+	}
+}
+
+func TestMsgRoutesQuery(t *testing.T) {
+	routerOpt := func(bapp *BaseApp) {
+		bapp.Router().AddRoute(routeMsgCounter2, testHandler)
+		bapp.Router().AddRoute(routeMsgCounter, testHandler)
+	}
+
+	app := setupBaseApp(t, routerOpt)
+	app.InitChain(abci.RequestInitChain{})
+
+	res := app.Query(abci.RequestQuery{Path: "/app/msg-routes", Height: 1})
+	require.True(t, res.IsOK(), res.Log)
+	require.Equal(t, sdkerrors.RootCodespace, res.Codespace)
+	require.Equal(t, int64(1), res.Height)
+
+	var routes []string
+	require.NoError(t, json.Unmarshal(res.Value, &routes))
+	require.Equal(t, []string{routeMsgCounter, routeMsgCounter2}, routes)
+	require.NotContains(t, routes, "unknown")
+
+	// custom routers which cannot list their routes
+	app = setupBaseApp(t, func(bapp *BaseApp) { bapp.SetRouter(&testCustomRouter{}) })
+	res = app.Query(abci.RequestQuery{Path: "/app/msg-routes"})
+	require.False(t, res.IsOK())
+}
+
+// Test that transactions exceeding gas limits fail
+func TestTxGasLimits(t *testing.T) {
+	gasGranted := uint64(10)
+	anteOpt := func(bapp *BaseApp) {
+		bapp.SetAnteHandler(func(ctx sdk.Context, tx sdk.Tx, simulate bool) (newCtx sdk.Context, err error) {
+			newCtx = ctx.WithGasMeter(sdk.NewGasMeter(gasGranted))
+
+			// AnteHandlers must have their own defer/recover in order for the BaseApp
+			// to know how much gas was used! This is because the GasMeter is created in
+			// the AnteHandler, but if it panics the context won't be set properly in
+			// runTx's recover call.
+			defer func() {
+				if r := recover(); r != nil {
+					switch rType := r.(type) {
+					case sdk.ErrorOutOfGas:
+						err = sdkerrors.Wrapf(sdkerrors.ErrOutOfGas, "out of gas in location: %v", rType.Descriptor)
+					default:
+						panic(r)
+					}
+				}
+			}()
+
+			count := tx.(*txTest).Counter
+			newCtx.GasMeter().ConsumeGas(uint64(count), "counter-ante")
+
+			return newCtx, nil
+		})
+
+	}
+
+	routerOpt := func(bapp *BaseApp) {
+		bapp.Router().AddRoute(routeMsgCounter, func(ctx sdk.Context, msg sdk.Msg) (*sdk.Result, error) {
+			count := msg.(msgCounter).Counter
+			ctx.GasMeter().ConsumeGas(uint64(count), "counter-handler")
+			return &sdk.Result{}, nil
+		})
+	}
+
+	app := setupBaseApp(t, anteOpt, routerOpt)
+
+	header := abci.Header{Height: 1}
+	app.BeginBlock(abci.RequestBeginBlock{Header: header})
+
+	testCases := []struct {
+		tx      *txTest
+		gasUsed uint64
+		fail    bool
+	}{
+		{newTxCounter(0, 0), 0, false},
+		{newTxCounter(1, 1), 2, false},
+		{newTxCounter(9, 1), 10, false},
+		{newTxCounter(1, 9), 10, false},
+		{newTxCounter(10, 0), 10, false},
+		{newTxCounter(0, 10), 10, false},
+		{newTxCounter(0, 8, 2), 10, false},
+		{newTxCounter(0, 5, 1, 1, 1, 1, 1), 10, false},
+		{newTxCounter(0, 5, 1, 1, 1, 1), 9, false},
+
+		{newTxCounter(9, 2), 11, true},
+		{newTxCounter(2, 9), 11, true},
+		{newTxCounter(9, 1, 1), 11, true},
+		{newTxCounter(1, 8, 1, 1), 11, true},
+		{newTxCounter(11, 0), 11, true},
+		{newTxCounter(0, 11), 11, true},
+		{newTxCounter(0, 5, 11), 16, true},
+	}
+
+	for i, tc := range testCases {
+		tx := tc.tx
+		gInfo, result, err := app.Deliver(tx)
+
+		// check gas used and wanted
+		require.Equal(t, tc.gasUsed, gInfo.GasUsed, fmt.Sprintf("tc #%d; gas: %v, result: %v, err: %s", i, gInfo, result, err))
+
+		// check for out of gas
+		if !tc.fail {
+			require.NotNil(t, result, fmt.Sprintf("%d: %v, %v", i, tc, err))
+		} else {
+			require.Error(t, err)
+			require.Nil(t, result)
+
+			space, code, _ := sdkerrors.ABCIInfo(err, false)
+			require.EqualValues(t, sdkerrors.ErrOutOfGas.Codespace(), space, err)
+			require.EqualValues(t, sdkerrors.ErrOutOfGas.ABCICode(), code, err)
+		}
+	}
+}
+
+func TestMaxBlockGasQuery(t *testing.T) {
+	testCases := []struct {
+		params   *abci.ConsensusParams
+		expected string
+	}{
+		{&abci.ConsensusParams{Block: &abci.BlockParams{MaxGas: 100}}, "100"},
+		{&abci.ConsensusParams{Block: &abci.BlockParams{MaxGas: -1}}, "0"},
+		{&abci.ConsensusParams{Block: &abci.BlockParams{MaxGas: 0}}, "0"},
+		{nil, "0"},
+	}
+
+	for i, tc := range testCases {
+		app := setupBaseApp(t)
+		app.InitChain(abci.RequestInitChain{ConsensusParams: tc.params})
+
+		res := app.Query(abci.RequestQuery{Path: "/app/max-block-gas", Height: 1})
+		require.True(t, res.IsOK(), res.Log)
+		require.Equal(t, tc.expected, string(res.Value), "case %d", i)
+		require.Equal(t, int64(1), res.Height)
+	}
+}
+
+// Test that transactions exceeding gas limits fail
+func TestMaxBlockGasLimits(t *testing.T) {
+	gasGranted := uint64(10)
+	anteOpt := func(bapp *BaseApp) {
+		bapp.SetAnteHandler(func(ctx sdk.Context, tx sdk.Tx, simulate bool) (newCtx sdk.Context, err error) {
+			newCtx = ctx.WithGasMeter(sdk.NewGasMeter(gasGranted))
+
+			defer func() {
+				if r := recover(); r != nil {
+					switch rType := r.(type) {
+					case sdk.ErrorOutOfGas:
+						err = sdkerrors.Wrapf(sdkerrors.ErrOutOfGas, "out of gas in location: %v", rType.Descriptor)
+					default:
+						panic(r)
+					}
+				}
+			}()
+
+			count := tx.(*txTest).Counter
+			newCtx.GasMeter().ConsumeGas(uint64(count), "counter-ante")
+
+			return
+		})
+
+	}
+
+	routerOpt := func(bapp *BaseApp) {
+		bapp.Router().AddRoute(routeMsgCounter, func(ctx sdk.Context, msg sdk.Msg) (*sdk.Result, error) {
+			count := msg.(msgCounter).Counter
+			ctx.GasMeter().ConsumeGas(uint64(count), "counter-handler")
+			return &sdk.Result{}, nil
+		})
+	}
+
+	app := setupBaseApp(t, anteOpt, routerOpt)
+	app.InitChain(abci.RequestInitChain{
+		ConsensusParams: &abci.ConsensusParams{
+			Block: &abci.BlockParams{
+				MaxGas: 100,
+			},
+		},
+	})
+
+	testCases := []struct {
+		tx                *txTest
+		numDelivers       int
+		gasUsedPerDeliver uint64
+		fail              bool
+		failAfterDeliver  int
+	}{
+		{newTxCounter(0, 0), 0, 0, false, 0},
+		{newTxCounter(9, 1), 2, 10, false, 0},
+		{newTxCounter(10, 0), 3, 10, false, 0},
+		{newTxCounter(10, 0), 10, 10, false, 0},
+		{newTxCounter(2, 7), 11, 9, false, 0},
+		{newTxCounter(10, 0), 10, 10, false, 0}, // hit the limit but pass
+
+		{newTxCounter(10, 0), 11, 10, true, 10},
+		{newTxCounter(10, 0), 15, 10, true, 10},
+		{newTxCounter(9, 0), 12, 9, true, 11}, // fly past the limit
+	}
+
+	for i, tc := range testCases {
+		tx := tc.tx
+
+		// reset the block gas
+		header := abci.Header{Height: app.LastBlockHeight() + 1}
+		app.BeginBlock(abci.RequestBeginBlock{Header: header})
+
+		// execute the transaction multiple times
+		for j := 0; j < tc.numDelivers; j++ {
+			_, result, err := app.Deliver(tx)
+
+			ctx := app.getState(runTxModeDeliver).ctx
+
+			// check for failed transactions
+			if tc.fail && (j+1) > tc.failAfterDeliver {
+				require.Error(t, err, fmt.Sprintf("tc #%d; result: %v, err: %s", i, result, err))
+				require.Nil(t, result, fmt.Sprintf("tc #%d; result: %v, err: %s", i, result, err))
+
+				space, code, _ := sdkerrors.ABCIInfo(err, false)
+				require.EqualValues(t, sdkerrors.ErrOutOfGas.Codespace(), space, err)
+				require.EqualValues(t, sdkerrors.ErrOutOfGas.ABCICode(), code, err)
+				require.True(t, ctx.BlockGasMeter().IsOutOfGas())
+			} else {
+				// check gas used and wanted
+				blockGasUsed := ctx.BlockGasMeter().GasConsumed()
+				expBlockGasUsed := tc.gasUsedPerDeliver * uint64(j+1)
+				require.Equal(
+					t, expBlockGasUsed, blockGasUsed,
+					fmt.Sprintf("%d,%d: %v, %v, %v, %v", i, j, tc, expBlockGasUsed, blockGasUsed, result),
+				)
+
+				require.NotNil(t, result, fmt.Sprintf("tc #%d; currDeliver: %d, result: %v, err: %s", i, j, result, err))
+				require.False(t, ctx.BlockGasMeter().IsPastLimit())
+			}
+		}
+	}
+}
+
+func TestBaseAppAnteHandler(t *testing.T) {
+	anteKey := []byte("ante-key")
+	anteOpt := func(bapp *BaseApp) {
+		bapp.SetAnteHandler(anteHandlerTxTest(t, capKey1, anteKey))
+	}
+
+	deliverKey := []byte("deliver-key")
+	routerOpt := func(bapp *BaseApp) {
+		bapp.Router().AddRoute(routeMsgCounter, handlerMsgCounter(t, capKey1, deliverKey))
+	}
+
+	cdc := codec.New()
+	app := setupBaseApp(t, anteOpt, routerOpt)
+
+	app.InitChain(abci.RequestInitChain{})
+	registerTestCodec(cdc)
+
+	header := abci.Header{Height: app.LastBlockHeight() + 1}
+	app.BeginBlock(abci.RequestBeginBlock{Header: header})
+
+	// execute a tx that will fail ante handler execution
+	//
+	// NOTE: State should not be mutated here. This will be implicitly checked by
+	// the next txs ante handler execution (anteHandlerTxTest).
+	tx := newTxCounter(0, 0)
+	tx.setFailOnAnte(true)
+	txBytes, err := cdc.MarshalBinaryBare(tx)
+	require.NoError(t, err)
+	res := app.DeliverTx(abci.RequestDeliverTx{Tx: txBytes})
+	require.False(t, res.IsOK(), fmt.Sprintf("%v", res))
+
+	ctx := app.getState(runTxModeDeliver).ctx
+	store := ctx.KVStore(capKey1)
+	require.Equal(t, int64(0), getIntFromStore(store, anteKey))
+
+	// execute at tx that will pass the ante handler (the checkTx state should
+	// mutate) but will fail the message handler
+	tx = newTxCounter(0, 0)
+	tx.setFailOnHandler(true)
+
+	txBytes, err = cdc.MarshalBinaryBare(tx)
+	require.NoError(t, err)
+
+	res = app.DeliverTx(abci.RequestDeliverTx{Tx: txBytes})
+	require.False(t, res.IsOK(), fmt.Sprintf("%v", res))
+
+	ctx = app.getState(runTxModeDeliver).ctx
+	store = ctx.KVStore(capKey1)
+	require.Equal(t, int64(1), getIntFromStore(store, anteKey))
+	require.Equal(t, int64(0), getIntFromStore(store, deliverKey))
+
+	// execute a successful ante handler and message execution where state is
+	// implicitly checked by previous tx executions
+	tx = newTxCounter(1, 0)
+
+	txBytes, err = cdc.MarshalBinaryBare(tx)
+	require.NoError(t, err)
+
+	res = app.DeliverTx(abci.RequestDeliverTx{Tx: txBytes})
+	require.True(t, res.IsOK(), fmt.Sprintf("%v", res))
+
+	ctx = app.getState(runTxModeDeliver).ctx
+	store = ctx.KVStore(capKey1)
+	require.Equal(t, int64(2), getIntFromStore(store, anteKey))
+	require.Equal(t, int64(1), getIntFromStore(store, deliverKey))
+
+	// commit
+	app.EndBlock(abci.RequestEndBlock{})
+	app.Commit()
+}
+
+func TestGasConsumptionBadTx(t *testing.T) {
+	gasWanted := uint64(5)
+	anteOpt := func(bapp *BaseApp) {
+		bapp.SetAnteHandler(func(ctx sdk.Context, tx sdk.Tx, simulate bool) (newCtx sdk.Context, err error) {
+			newCtx = ctx.WithGasMeter(sdk.NewGasMeter(gasWanted))
+
+			defer func() {
+				if r := recover(); r != nil {
+					switch rType := r.(type) {
+					case sdk.ErrorOutOfGas:
+						log := fmt.Sprintf("out of gas in location: %v", rType.Descriptor)
+						err = sdkerrors.Wrap(sdkerrors.ErrOutOfGas, log)
+					default:
+						panic(r)
+					}
+				}
+			}()
+
+			txTest := tx.(txTest)
+			newCtx.GasMeter().ConsumeGas(uint64(txTest.Counter), "counter-ante")
+			if txTest.FailOnAnte {
+				return newCtx, sdkerrors.Wrap(sdkerrors.ErrUnauthorized, "ante handler failure")
+			}
+
+			return
+		})
+	}
+
+	routerOpt := func(bapp *BaseApp) {
+		bapp.Router().AddRoute(routeMsgCounter, func(ctx sdk.Context, msg sdk.Msg) (*sdk.Result, error) {
+			count := msg.(msgCounter).Counter
+			ctx.GasMeter().ConsumeGas(uint64(count), "counter-handler")
+			return &sdk.Result{}, nil
+		})
+	}
+
+	cdc := codec.New()
+	registerTestCodec(cdc)
+
+	app := setupBaseApp(t, anteOpt, routerOpt)
+	app.InitChain(abci.RequestInitChain{
+		ConsensusParams: &abci.ConsensusParams{
+			Block: &abci.BlockParams{
+				MaxGas: 9,
+			},
+		},
+	})
+
+	app.InitChain(abci.RequestInitChain{})
+
+	header := abci.Header{Height: app.LastBlockHeight() + 1}
+	app.BeginBlock(abci.RequestBeginBlock{Header: header})
+
+	tx := newTxCounter(5, 0)
+	tx.setFailOnAnte(true)
+	txBytes, err := cdc.MarshalBinaryBare(tx)
+	require.NoError(t, err)
+
+	res := app.DeliverTx(abci.RequestDeliverTx{Tx: txBytes})
+	require.False(t, res.IsOK(), fmt.Sprintf("%v", res))
+
+	// require next tx to fail due to black gas limit
+	tx = newTxCounter(5, 0)
+	txBytes, err = cdc.MarshalBinaryBare(tx)
+	require.NoError(t, err)
+
+	res = app.DeliverTx(abci.RequestDeliverTx{Tx: txBytes})
+	require.False(t, res.IsOK(), fmt.Sprintf("%v", res))
+}
+
+// Test that we can only query from the latest committed state.
+func TestQuery(t *testing.T) {
+	key, value := []byte("hello"), []byte("goodbye")
+	anteOpt := func(bapp *BaseApp) {
+		bapp.SetAnteHandler(func(ctx sdk.Context, tx sdk.Tx, simulate bool) (newCtx sdk.Context, err error) {
+			store := ctx.KVStore(capKey1)
+			store.Set(key, value)
+			return
+		})
+	}
+
+	routerOpt := func(bapp *BaseApp) {
+		bapp.Router().AddRoute(routeMsgCounter, func(ctx sdk.Context, msg sdk.Msg) (*sdk.Result, error) {
+			store := ctx.KVStore(capKey1)
+			store.Set(key, value)
+			return &sdk.Result{}, nil
+		})
+	}
+
+	app := setupBaseApp(t, anteOpt, routerOpt)
+
+	app.InitChain(abci.RequestInitChain{})
+
+	// NOTE: "/store/key1" tells us KVStore
+	// and the final "/key" says to use the data as the
+	// key in the given KVStore ...
+	query := abci.RequestQuery{
+		Path: "/store/key1/key",
+		Data: key,
+	}
+	tx := newTxCounter(0, 0)
+
+	// query is empty before we do anything
+	res := app.Query(query)
+	require.Equal(t, 0, len(res.Value))
+
+	// query is still empty after a CheckTx
+	_, resTx, err := app.Check(tx)
+	require.NoError(t, err)
+	require.NotNil(t, resTx)
+	res = app.Query(query)
+	require.Equal(t, 0, len(res.Value))
+
+	// query is still empty after a DeliverTx before we commit
+	header := abci.Header{Height: app.LastBlockHeight() + 1}
+	app.BeginBlock(abci.RequestBeginBlock{Header: header})
+
+	_, resTx, err = app.Deliver(tx)
+	require.NoError(t, err)
+	require.NotNil(t, resTx)
+	res = app.Query(query)
+	require.Equal(t, 0, len(res.Value))
+
+	// query returns correct value after Commit
+	app.Commit()
+	res = app.Query(query)
+	require.Equal(t, value, res.Value)
+}
+
+func TestQueryAbsenceProof(t *testing.T) {
+	key, value := []byte("hello"), []byte("goodbye")
+	anteOpt := func(bapp *BaseApp) {
+		bapp.SetAnteHandler(func(ctx sdk.Context, tx sdk.Tx, simulate bool) (newCtx sdk.Context, err error) {
+			ctx.KVStore(capKey1).Set(key, value)
+			return
+		})
+	}
+	routerOpt := func(bapp *BaseApp) {
+		bapp.Router().AddRoute(routeMsgCounter, func(ctx sdk.Context, msg sdk.Msg) (*sdk.Result, error) {
+			return &sdk.Result{}, nil
+		})
+	}
+
+	app := setupBaseApp(t, anteOpt, routerOpt)
+	app.InitChain(abci.RequestInitChain{})
+
+	for height := int64(1); height <= 2; height++ {
+		app.BeginBlock(abci.RequestBeginBlock{Header: abci.Header{Height: height}})
+		_, _, err := app.Deliver(newTxCounter(height, 0))
+		require.NoError(t, err)
+		app.EndBlock(abci.RequestEndBlock{Height: height})
+		app.Commit()
+	}
+
+	absent := []byte("absent")
+	res := app.Query(abci.RequestQuery{
+		Path:   "/store/key1/key",
+		Data:   absent,
+		Height: 2,
+		Prove:  true,
+	})
+	require.True(t, res.IsOK(), res.Log)
+	require.Nil(t, res.Value)
+	require.NotNil(t, res.Proof)
+
+	prt := rootmulti.DefaultProofRuntime()
+	root := app.LastCommitID().Hash
+	require.NoError(t, prt.VerifyAbsence(res.Proof, root, "/key1/absent"))
+	require.Error(t, prt.VerifyValue(res.Proof, root, "/key1/absent", value))
+
+	// the absence of an existing key cannot be proven
+	res = app.Query(abci.RequestQuery{
+		Path:   "/store/key1/key",
+		Data:   key,
+		Height: 2,
+		Prove:  true,
+	})
+	require.True(t, res.IsOK(), res.Log)
+	require.NoError(t, prt.VerifyValue(res.Proof, root, "/key1/hello", value))
+	require.Error(t, prt.VerifyAbsence(res.Proof, root, "/key1/hello"))
+}
+
+func TestMaxQueryResponseBytes(t *testing.T) {
+	const maxBytes = 16
+	key := []byte("key")
+
+	queryOpt := func(bapp *BaseApp) {
+		bapp.SetBeginBlocker(func(ctx sdk.Context, req abci.RequestBeginBlock) abci.ResponseBeginBlock {
+			ctx.KVStore(capKey1).Set(key, make([]byte, maxBytes+1))
+			return abci.ResponseBeginBlock{}
+		})
+		bapp.QueryRouter().AddRoute("size", func(ctx sdk.Context, path []string, req abci.RequestQuery) ([]byte, error) {
+			n, err := strconv.Atoi(path[0])
+			if err != nil {
+				return nil, err
+			}
+			return make([]byte, n), nil
+		})
+	}
+
+	app := setupBaseApp(t, queryOpt, SetMaxQueryResponseBytes(maxBytes))
+	app.InitChain(abci.RequestInitChain{})
+	app.BeginBlock(abci.RequestBeginBlock{Header: abci.Header{Height: 1}})
+	app.EndBlock(abci.RequestEndBlock{Height: 1})
+	app.Commit()
+
+	res := app.Query(abci.RequestQuery{Path: fmt.Sprintf("/custom/size/%d", maxBytes)})
+	require.True(t, res.IsOK(), res.Log)
+	require.Len(t, res.Value, maxBytes)
+
+	res = app.Query(abci.RequestQuery{Path: fmt.Sprintf("/custom/size/%d", maxBytes+1)})
+	require.False(t, res.IsOK())
+	require.Equal(t, sdkerrors.ErrInvalidRequest.ABCICode(), res.Code)
+	require.Contains(t, res.Log, "response too large")
+	require.Empty(t, res.Value)
+
+	res = app.Query(abci.RequestQuery{Path: "/store/key1/key", Data: key})
+	require.False(t, res.IsOK())
+	require.Equal(t, sdkerrors.ErrInvalidRequest.ABCICode(), res.Code)
+	require.Empty(t, res.Value)
+}
+
+func TestQueryLatencyObserver(t *testing.T) {
+	type observation struct {
+		route    string
+		duration time.Duration
+		err      error
+	}
+
+	var observations []observation
+	queryOpt := func(bapp *BaseApp) {
+		bapp.QueryRouter().AddRoute("slow", func(ctx sdk.Context, path []string, req abci.RequestQuery) ([]byte, error) {
+			time.Sleep(10 * time.Millisecond)
+			return []byte("ok"), nil
+		})
+		bapp.QueryRouter().AddRoute("failing", func(ctx sdk.Context, path []string, req abci.RequestQuery) ([]byte, error) {
+			return nil, sdkerrors.ErrUnknownRequest
+		})
+		bapp.SetQueryLatencyObserver(func(route string, duration time.Duration, err error) {
+			observations = append(observations, observation{route, duration, err})
+		})
+	}
+
+	app := setupBaseApp(t, queryOpt)
+	app.InitChain(abci.RequestInitChain{})
+	app.BeginBlock(abci.RequestBeginBlock{Header: abci.Header{Height: 1}})
+	app.EndBlock(abci.RequestEndBlock{Height: 1})
+	app.Commit()
+
+	res := app.Query(abci.RequestQuery{Path: "/custom/slow/path"})
+	require.True(t, res.IsOK(), res.Log)
+	res = app.Query(abci.RequestQuery{Path: "/custom/failing"})
+	require.False(t, res.IsOK())
+
+	// queries not reaching a querier are not observed
+	res = app.Query(abci.RequestQuery{Path: "/custom/unknown"})
+	require.False(t, res.IsOK())
+
+	require.Len(t, observations, 2)
+	require.Equal(t, "slow", observations[0].route)
+	require.True(t, observations[0].duration >= 10*time.Millisecond)
+	require.True(t, observations[0].duration < time.Minute)
+	require.NoError(t, observations[0].err)
+	require.Equal(t, "failing", observations[1].route)
+	require.True(t, sdkerrors.ErrUnknownRequest.Is(observations[1].err))
+}
+
+// Test p2p filter queries
+func TestP2PQuery(t *testing.T) {
+	addrPeerFilterOpt := func(bapp *BaseApp) {
+		bapp.SetAddrPeerFilter(func(addrport string) abci.ResponseQuery {
+			require.Equal(t, "1.1.1.1:8000", addrport)
+			return abci.ResponseQuery{Code: uint32(3)}
+		})
+	}
+
+	idPeerFilterOpt := func(bapp *BaseApp) {
+		bapp.SetIDPeerFilter(func(id string) abci.ResponseQuery {
+			require.Equal(t, "testid", id)
+			return abci.ResponseQuery{Code: uint32(4)}
+		})
+	}
+
+	app := setupBaseApp(t, addrPeerFilterOpt, idPeerFilterOpt)
+
+	addrQuery := abci.RequestQuery{
+		Path: "/p2p/filter/addr/1.1.1.1:8000",
+	}
+	res := app.Query(addrQuery)
+	require.Equal(t, uint32(3), res.Code)
+
+	idQuery := abci.RequestQuery{
+		Path: "/p2p/filter/id/testid",
+	}
+	res = app.Query(idQuery)
+	require.Equal(t, uint32(4), res.Code)
+}
+
+func TestRegisterAppQueryHandler(t *testing.T) {
+	queryOpt := func(bapp *BaseApp) {
+		bapp.RegisterAppQueryHandler("custom", func(app *BaseApp, req abci.RequestQuery) abci.ResponseQuery {
+			return abci.ResponseQuery{
+				Codespace: sdkerrors.RootCodespace,
+				Height:    req.Height,
+				Value:     append([]byte(app.Name()+":"), req.Data...),
+			}
+		})
+
+		require.Panics(t, func() {
+			bapp.RegisterAppQueryHandler("simulate", func(*BaseApp, abci.RequestQuery) abci.ResponseQuery {
+				return abci.ResponseQuery{}
+			})
+		})
+		require.Panics(t, func() {
+			bapp.RegisterAppQueryHandler("custom", func(*BaseApp, abci.RequestQuery) abci.ResponseQuery {
+				return abci.ResponseQuery{}
+			})
+		})
+	}
+
+	app := setupBaseApp(t, queryOpt)
+
+	res := app.Query(abci.RequestQuery{Path: "/app/custom", Data: []byte("data")})
+	require.True(t, res.IsOK(), res.Log)
+	require.Equal(t, []byte(t.Name()+":data"), res.Value)
+
+	res = app.Query(abci.RequestQuery{Path: "/app/unknown"})
+	require.False(t, res.IsOK())
+
+	// built-in queries are still served
+	res = app.Query(abci.RequestQuery{Path: "/app/version"})
+	require.True(t, res.IsOK(), res.Log)
+}
+
+func TestHaltNotifier(t *testing.T) {
+	// capture the signals sent by halt so the test process keeps running
+	sigs := make(chan os.Signal, 2)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigs)
+
+	var (
+		notified     int
+		gotReason    string
+		gotHeight    int64
+		signalsAtRun int
+	)
+
+	haltOpt := func(bapp *BaseApp) {
+		bapp.SetHaltNotifier(func(reason string, height int64, _ int64) {
+			notified++
+			gotReason = reason
+			gotHeight = height
+			signalsAtRun = len(sigs)
+		})
+	}
+
+	app := setupBaseApp(t, SetHaltHeight(2), haltOpt)
+	app.InitChain(abci.RequestInitChain{})
+
+	header := abci.Header{Height: 1}
+	app.BeginBlock(abci.RequestBeginBlock{Header: header})
+	app.Commit()
+	require.Equal(t, 0, notified)
+
+	header = abci.Header{Height: 2}
+	app.BeginBlock(abci.RequestBeginBlock{Header: header})
+	app.Commit()
+
+	require.Equal(t, 1, notified)
+	require.Equal(t, HaltReasonHeight, gotReason)
+	require.Equal(t, int64(2), gotHeight)
+
+	// the notifier runs before any signal is sent
+	require.Equal(t, 0, signalsAtRun)
+	<-sigs
+}
+
+func TestPreHaltHook(t *testing.T) {
+	var (
+		hookCalls     int
+		gotHeight     int64
+		gotTime       int64
+		signalsAtHook int
+		signals       []os.Signal
+	)
+
+	hookOpt := func(bapp *BaseApp) {
+		bapp.SetPreHaltHook(func(height int64, time int64) error {
+			hookCalls++
+			gotHeight = height
+			gotTime = time
+			signalsAtHook = len(signals)
+			return fmt.Errorf("export failed")
+		})
+	}
+
+	app := setupBaseApp(t, SetHaltHeight(2), hookOpt)
+	app.signalProcess = func(sig os.Signal) error {
+		signals = append(signals, sig)
+		return nil
+	}
+	app.InitChain(abci.RequestInitChain{})
+
+	app.BeginBlock(abci.RequestBeginBlock{Header: abci.Header{Height: 1}})
+	app.Commit()
+	require.Equal(t, 0, hookCalls)
+	require.Empty(t, signals)
+
+	blockTime := time.Unix(1000, 0)
+	app.BeginBlock(abci.RequestBeginBlock{Header: abci.Header{Height: 2, Time: blockTime}})
+	app.Commit()
+
+	// the hook runs before the node is signaled, and its failure does not
+	// prevent the shutdown
+	require.Equal(t, 1, hookCalls)
+	require.Equal(t, int64(2), gotHeight)
+	require.Equal(t, blockTime.Unix(), gotTime)
+	require.Equal(t, 0, signalsAtHook)
+	require.Equal(t, []os.Signal{syscall.SIGINT, syscall.SIGTERM}, signals)
+
+	// the hook runs only once if the node commits again before shutting down
+	app.BeginBlock(abci.RequestBeginBlock{Header: abci.Header{Height: 3}})
+	app.Commit()
+	require.Equal(t, 1, hookCalls)
+	require.Len(t, signals, 4)
+}
+
+func TestStoreWriteAuditor(t *testing.T) {
+	type write struct {
+		store, key, value string
+		height            int64
+	}
+	var writes []write
+
+	auditOpt := func(bapp *BaseApp) {
+		bapp.SetStoreWriteAuditor([]string{capKey1.Name()}, func(store string, key, value []byte, height int64) {
+			writes = append(writes, write{store, string(key), string(value), height})
+		})
+	}
+	routerOpt := func(bapp *BaseApp) {
+		bapp.Router().AddRoute(routeMsgCounter, func(ctx sdk.Context, msg sdk.Msg) (*sdk.Result, error) {
+			key := []byte(fmt.Sprintf("counter-%d", msg.(*msgCounter).Counter))
+			ctx.KVStore(capKey1).Set(key, []byte("one"))
+			ctx.KVStore(capKey2).Set(key, []byte("two"))
+
+			if msg.(*msgCounter).FailOnHandler {
+				return nil, sdkerrors.Wrap(sdkerrors.ErrInvalidRequest, "handler failure")
+			}
+			return &sdk.Result{}, nil
+		})
+	}
+
+	app := setupBaseApp(t, auditOpt, routerOpt)
+	app.InitChain(abci.RequestInitChain{})
+
+	cdc := codec.New()
+	registerTestCodec(cdc)
+
+	deliverTx := func(tx *txTest) {
+		txBytes, err := cdc.MarshalBinaryBare(tx)
+		require.NoError(t, err)
+		app.DeliverTx(abci.RequestDeliverTx{Tx: txBytes})
+	}
+
+	app.BeginBlock(abci.RequestBeginBlock{Header: abci.Header{Height: 1}})
+	deliverTx(newTxCounter(0, 1))
+
+	failed := newTxCounter(1, 2)
+	failed.setFailOnHandler(true)
+	deliverTx(failed)
+
+	// writes are only reported once committed
+	require.Empty(t, writes)
+
+	app.EndBlock(abci.RequestEndBlock{Height: 1})
+	app.Commit()
+	require.Equal(t, []write{{capKey1.Name(), "counter-1", "one", 1}}, writes)
+
+	writes = nil
+	app.BeginBlock(abci.RequestBeginBlock{Header: abci.Header{Height: 2}})
+	deliverTx(newTxCounter(2, 3))
+	app.EndBlock(abci.RequestEndBlock{Height: 2})
+	app.Commit()
+	require.Equal(t, []write{{capKey1.Name(), "counter-3", "one", 2}}, writes)
+
+	// the audited writes are committed
+	store := app.cms.GetCommitKVStore(capKey1)
+	require.Equal(t, []byte("one"), store.Get([]byte("counter-3")))
+	require.Equal(t, []byte("two"), app.cms.GetCommitKVStore(capKey2).Get([]byte("counter-3")))
+}
+
+func TestStoreWriteAuditorInterBlockCache(t *testing.T) {
+	auditOpt := func(bapp *BaseApp) {
+		bapp.SetStoreWriteAuditor([]string{capKey1.Name()}, func(string, []byte, []byte, int64) {})
+	}
+	routerOpt := func(bapp *BaseApp) {
+		bapp.Router().AddRoute(routeMsgCounter, func(ctx sdk.Context, msg sdk.Msg) (*sdk.Result, error) {
+			setIntOnStore(ctx.KVStore(capKey1), []byte("value"), msg.(*msgCounter).Counter)
+			return &sdk.Result{}, nil
+		})
+	}
+
+	app := setupBaseApp(t, auditOpt, routerOpt, SetInterBlockCache(cache.NewCommitKVStoreCacheManager(cache.DefaultCommitKVStoreCacheSize)))
+	app.InitChain(abci.RequestInitChain{})
+
+	cdc := codec.New()
+	registerTestCodec(cdc)
+
+	for height := int64(1); height <= 2; height++ {
+		app.BeginBlock(abci.RequestBeginBlock{Header: abci.Header{Height: height}})
+		txBytes, err := cdc.MarshalBinaryBare(newTxCounter(height, height))
+		require.NoError(t, err)
+		require.True(t, app.DeliverTx(abci.RequestDeliverTx{Tx: txBytes}).IsOK())
+		app.EndBlock(abci.RequestEndBlock{Height: height})
+		app.Commit()
+
+		// the committed writes go through the inter-block cache, which is
+		// hence not stale
+		require.Equal(t, height, getIntFromStore(app.cms.GetKVStore(capKey1), []byte("value")))
+		require.Equal(t, height, getIntFromStore(app.checkState.ms.GetKVStore(capKey1), []byte("value")))
+	}
+}
+
+func TestCommitWithoutDeliverState(t *testing.T) {
+	app := setupBaseApp(t)
+
+	msg := "Commit called without active deliver state; BeginBlock must precede Commit"
+	require.PanicsWithValue(t, msg, func() { app.Commit() })
+
+	// a committed block resets the deliver state
+	app.InitChain(abci.RequestInitChain{})
+	app.BeginBlock(abci.RequestBeginBlock{Header: abci.Header{Height: 1}})
+	app.Commit()
+	require.PanicsWithValue(t, msg, func() { app.Commit() })
+}
+
+func TestHeightValidationMode(t *testing.T) {
+	app := setupBaseApp(t)
+	app.InitChain(abci.RequestInitChain{})
+
+	// consensus mode panics with the expected and received heights
+	panicErr := func(height int64) (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = r.(error)
+			}
+		}()
+		app.BeginBlock(abci.RequestBeginBlock{Header: abci.Header{Height: height}})
+		return nil
+	}
+	err := panicErr(3)
+	require.Contains(t, err.Error(), "invalid height: 3; expected: 1")
+	require.Contains(t, err.Error(), "blocks 1 to 2 must be replayed first")
+
+	app.BeginBlock(abci.RequestBeginBlock{Header: abci.Header{Height: 1}})
+	app.Commit()
+
+	err = panicErr(1)
+	require.Contains(t, err.Error(), "invalid height: 1; expected: 2")
+	require.Contains(t, err.Error(), "the app height (1) is ahead of the block")
+
+	// recovery mode rejects the block without panicking
+	app = setupBaseApp(t, SetHeightValidationMode(HeightValidationRecovery))
+	app.InitChain(abci.RequestInitChain{})
+
+	require.NotPanics(t, func() {
+		app.BeginBlock(abci.RequestBeginBlock{Header: abci.Header{Height: 3}})
+	})
+	require.Error(t, app.LastHeightError())
+	require.Contains(t, app.LastHeightError().Error(), "invalid height: 3; expected: 1")
+	require.Equal(t, int64(0), app.LastBlockHeight())
+
+	// the expected height is still accepted
+	app.BeginBlock(abci.RequestBeginBlock{Header: abci.Header{Height: 1}})
+	require.NoError(t, app.LastHeightError())
+	res := app.Commit()
+	require.Equal(t, int64(1), app.LastBlockHeight())
+
+	// the rest of a rejected block is refused without panicking
+	app.BeginBlock(abci.RequestBeginBlock{Header: abci.Header{Height: 3}})
+	require.Error(t, app.LastHeightError())
+
+	cdc := codec.New()
+	registerTestCodec(cdc)
+	txBytes, err := cdc.MarshalBinaryBare(newTxCounter(0, 0))
+	require.NoError(t, err)
+
+	require.NotPanics(t, func() {
+		deliverRes := app.DeliverTx(abci.RequestDeliverTx{Tx: txBytes})
+		require.Equal(t, sdkerrors.ErrInvalidRequest.ABCICode(), deliverRes.Code)
+		app.EndBlock(abci.RequestEndBlock{Height: 3})
+		require.Equal(t, res, app.Commit())
+	})
+	require.Equal(t, int64(1), app.LastBlockHeight())
+
+	// and the next block is begun on top of the last committed one
+	app.BeginBlock(abci.RequestBeginBlock{Header: abci.Header{Height: 2}})
+	require.NoError(t, app.LastHeightError())
+	app.EndBlock(abci.RequestEndBlock{Height: 2})
+	app.Commit()
+	require.Equal(t, int64(2), app.LastBlockHeight())
+}
+
+// flakyCommitStore is a CommitMultiStore whose Commit panics with err the first
+// failures times.
+type flakyCommitStore struct {
+	sdk.CommitMultiStore
+
+	failures int
+	err      error
+}
+
+func (s *flakyCommitStore) Commit() sdk.CommitID {
+	if s.failures > 0 {
+		s.failures--
+		panic(s.err)
+	}
+
+	return s.CommitMultiStore.Commit()
+}
+
+func TestCommitRetry(t *testing.T) {
+	commitBlock := func(app *BaseApp) {
+		height := app.LastBlockHeight() + 1
+		app.BeginBlock(abci.RequestBeginBlock{Header: abci.Header{Height: height}})
+		app.EndBlock(abci.RequestEndBlock{Height: height})
+		app.Commit()
+	}
+
+	// a retriable failure is retried
+	app := setupBaseApp(t, SetCommitRetry(2, time.Millisecond))
+	app.InitChain(abci.RequestInitChain{})
+	store := &flakyCommitStore{CommitMultiStore: app.cms, failures: 1, err: syscall.EAGAIN}
+	app.cms = store
+
+	require.NotPanics(t, func() { commitBlock(app) })
+	require.Equal(t, 0, store.failures)
+	require.Equal(t, int64(1), app.LastBlockHeight())
+
+	// the node crashes once the retries are exhausted
+	store.failures = 3
+	require.Panics(t, func() { commitBlock(app) })
+
+	// a non retriable failure is not retried
+	app = setupBaseApp(t, SetCommitRetry(2, time.Millisecond))
+	app.InitChain(abci.RequestInitChain{})
+	store = &flakyCommitStore{CommitMultiStore: app.cms, failures: 1, err: fmt.Errorf("corrupted")}
+	app.cms = store
+
+	require.Panics(t, func() { commitBlock(app) })
+	require.Equal(t, 0, store.failures)
+	require.Equal(t, int64(0), app.LastBlockHeight())
+
+	// a wrapped retriable failure is retried
+	app = setupBaseApp(t, SetCommitRetry(2, time.Millisecond))
+	app.InitChain(abci.RequestInitChain{})
+	store = &flakyCommitStore{CommitMultiStore: app.cms, failures: 1, err: fmt.Errorf("write: %w", syscall.EINTR)}
+	app.cms = store
+
+	require.NotPanics(t, func() { commitBlock(app) })
+	require.Equal(t, int64(1), app.LastBlockHeight())
+}
+
+func TestPostCommitBarrier(t *testing.T) {
+	key := []byte("key")
+
+	var (
+		app      *BaseApp
+		barriers []sdk.CommitID
+	)
+
+	barrierOpt := func(bapp *BaseApp) {
+		bapp.SetBeginBlocker(func(ctx sdk.Context, req abci.RequestBeginBlock) abci.ResponseBeginBlock {
+			ctx.KVStore(capKey1).Set(key, []byte(fmt.Sprintf("%d", req.Header.Height)))
+			return abci.ResponseBeginBlock{}
+		})
+		bapp.SetPostCommitBarrier(func(commitID sdk.CommitID) {
+			// the block state is written and committed
+			require.Equal(t, commitID, app.cms.LastCommitID())
+			value := app.cms.GetCommitKVStore(capKey1).Get(key)
+			require.Equal(t, fmt.Sprintf("%d", commitID.Version), string(value))
+
+			barriers = append(barriers, commitID)
+		})
+	}
+
+	app = setupBaseApp(t, barrierOpt)
+	app.InitChain(abci.RequestInitChain{})
+
+	for height := int64(1); height <= 2; height++ {
+		app.BeginBlock(abci.RequestBeginBlock{Header: abci.Header{Height: height}})
+		app.EndBlock(abci.RequestEndBlock{Height: height})
+		require.Len(t, barriers, int(height-1))
+
+		res := app.Commit()
+		require.Len(t, barriers, int(height))
+		require.Equal(t, sdk.CommitID{Version: height, Hash: res.Data}, barriers[height-1])
+	}
+}
+
+func TestPreCommitHook(t *testing.T) {
+	key := []byte("key")
+
+	hookOpt := func(bapp *BaseApp) {
+		bapp.SetBeginBlocker(func(ctx sdk.Context, req abci.RequestBeginBlock) abci.ResponseBeginBlock {
+			ctx.KVStore(capKey1).Set(key, []byte(fmt.Sprintf("%d", req.Header.Height)))
+			return abci.ResponseBeginBlock{}
+		})
+		// the invariant breaks at height 2
+		bapp.SetPreCommitHook(func(ctx sdk.Context) error {
+			if string(ctx.KVStore(capKey1).Get(key)) == "2" {
+				return fmt.Errorf("invariant broken")
+			}
+			return nil
+		})
+	}
+
+	app := setupBaseApp(t, hookOpt)
+	app.InitChain(abci.RequestInitChain{})
+
+	app.BeginBlock(abci.RequestBeginBlock{Header: abci.Header{Height: 1}})
+	app.Commit()
+	require.Equal(t, int64(1), app.LastBlockHeight())
+
+	app.BeginBlock(abci.RequestBeginBlock{Header: abci.Header{Height: 2}})
+	require.PanicsWithValue(t, "pre-commit hook failed at height 2: invariant broken", func() {
+		app.Commit()
+	})
+
+	// the block is not committed
+	require.Equal(t, int64(1), app.LastBlockHeight())
+	require.Equal(t, "1", string(app.cms.GetCommitKVStore(capKey1).Get(key)))
 }
 
-func TestBaseAppAnteHandler(t *testing.T) {
-	anteKey := []byte("ante-key")
-	anteOpt := func(bapp *BaseApp) {
-		bapp.SetAnteHandler(anteHandlerTxTest(t, capKey1, anteKey))
-	}
+func TestValidatorUpdateTransformer(t *testing.T) {
+	const maxChurn = 2
+	deferredKey := []byte("deferred")
 
-	deliverKey := []byte("deliver-key")
-	routerOpt := func(bapp *BaseApp) {
-		bapp.Router().AddRoute(routeMsgCounter, handlerMsgCounter(t, capKey1, deliverKey))
+	updates := make([]abci.ValidatorUpdate, 5)
+	for i := range updates {
+		updates[i] = abci.ValidatorUpdate{Power: int64(i + 1)}
 	}
 
-	cdc := codec.New()
-	app := setupBaseApp(t, anteOpt, routerOpt)
+	transformerOpt := func(bapp *BaseApp) {
+		bapp.SetEndBlocker(func(ctx sdk.Context, _ abci.RequestEndBlock) abci.ResponseEndBlock {
+			return abci.ResponseEndBlock{ValidatorUpdates: updates}
+		})
+		bapp.SetValidatorUpdateTransformer(func(ctx sdk.Context, updates []abci.ValidatorUpdate) []abci.ValidatorUpdate {
+			if len(updates) <= maxChurn {
+				return updates
+			}
+
+			// queue the remaining updates in state
+			ctx.KVStore(capKey1).Set(deferredKey, []byte(fmt.Sprintf("%d", len(updates)-maxChurn)))
+			return updates[:maxChurn]
+		})
+	}
 
+	app := setupBaseApp(t, transformerOpt)
 	app.InitChain(abci.RequestInitChain{})
-	registerTestCodec(cdc)
 
-	header := abci.Header{Height: app.LastBlockHeight() + 1}
+	header := abci.Header{Height: 1}
 	app.BeginBlock(abci.RequestBeginBlock{Header: header})
+	res := app.EndBlock(abci.RequestEndBlock{Height: header.Height})
+	require.Equal(t, updates[:maxChurn], res.ValidatorUpdates)
+	app.Commit()
 
-	// execute a tx that will fail ante handler execution
-	//
-	// NOTE: State should not be mutated here. This will be implicitly checked by
-	// the next txs ante handler execution (anteHandlerTxTest).
-	tx := newTxCounter(0, 0)
-	tx.setFailOnAnte(true)
-	txBytes, err := cdc.MarshalBinaryBare(tx)
-	require.NoError(t, err)
-	res := app.DeliverTx(abci.RequestDeliverTx{Tx: txBytes})
-	require.False(t, res.IsOK(), fmt.Sprintf("%v", res))
+	deferred := app.cms.GetCommitKVStore(capKey1).Get(deferredKey)
+	require.Equal(t, "3", string(deferred))
+}
 
-	ctx := app.getState(runTxModeDeliver).ctx
-	store := ctx.KVStore(capKey1)
-	require.Equal(t, int64(0), getIntFromStore(store, anteKey))
+func TestStateConsistencyCheck(t *testing.T) {
+	key := []byte("key")
+	diverge := false
+	logs := &bytes.Buffer{}
+
+	consistencyOpt := func(bapp *BaseApp) {
+		bapp.logger = log.NewTMLogger(log.NewSyncWriter(logs))
+		bapp.SetAnteHandler(func(ctx sdk.Context, tx sdk.Tx, simulate bool) (sdk.Context, error) {
+			value := fmt.Sprintf("%d", tx.(*txTest).Counter)
+			if diverge && !ctx.IsCheckTx() {
+				value = "deliver"
+			}
+			ctx.KVStore(capKey1).Set(key, []byte(value))
+			return ctx, nil
+		})
+		bapp.Router().AddRoute(routeMsgCounter, func(ctx sdk.Context, msg sdk.Msg) (*sdk.Result, error) {
+			return &sdk.Result{}, nil
+		})
+		bapp.SetStateConsistencyCheck(map[sdk.StoreKey][][]byte{capKey1: {key}})
+	}
 
-	// execute at tx that will pass the ante handler (the checkTx state should
-	// mutate) but will fail the message handler
-	tx = newTxCounter(0, 0)
-	tx.setFailOnHandler(true)
+	app := setupBaseApp(t, consistencyOpt)
+	app.InitChain(abci.RequestInitChain{})
 
-	txBytes, err = cdc.MarshalBinaryBare(tx)
-	require.NoError(t, err)
+	for i, d := range []bool{false, true} {
+		diverge = d
+		logs.Reset()
 
-	res = app.DeliverTx(abci.RequestDeliverTx{Tx: txBytes})
-	require.False(t, res.IsOK(), fmt.Sprintf("%v", res))
+		tx := newTxCounter(int64(i), 0)
+		_, _, err := app.Check(tx)
+		require.NoError(t, err)
 
-	ctx = app.getState(runTxModeDeliver).ctx
-	store = ctx.KVStore(capKey1)
-	require.Equal(t, int64(1), getIntFromStore(store, anteKey))
-	require.Equal(t, int64(0), getIntFromStore(store, deliverKey))
+		height := int64(i + 1)
+		app.BeginBlock(abci.RequestBeginBlock{Header: abci.Header{Height: height}})
+		_, _, err = app.Deliver(tx)
+		require.NoError(t, err)
+		app.EndBlock(abci.RequestEndBlock{Height: height})
+		app.Commit()
 
-	// execute a successful ante handler and message execution where state is
-	// implicitly checked by previous tx executions
-	tx = newTxCounter(1, 0)
+		require.Equal(t, diverge, strings.Contains(logs.String(), "checkState diverged from committed state"))
+	}
+}
 
-	txBytes, err = cdc.MarshalBinaryBare(tx)
-	require.NoError(t, err)
+func TestHaltPredicate(t *testing.T) {
+	// capture the signals sent by halt so the test process keeps running
+	sigs := make(chan os.Signal, 2)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigs)
+
+	planKey := []byte("upgrade-plan")
+
+	var (
+		notified  int
+		gotReason string
+		gotHeight int64
+	)
+
+	haltOpt := func(bapp *BaseApp) {
+		// store an upgrade plan at height 2
+		bapp.SetBeginBlocker(func(ctx sdk.Context, req abci.RequestBeginBlock) abci.ResponseBeginBlock {
+			if req.Header.Height == 2 {
+				ctx.KVStore(capKey1).Set(planKey, []byte("v2"))
+			}
+			return abci.ResponseBeginBlock{}
+		})
+		bapp.SetHaltPredicate(func(ctx sdk.Context) bool {
+			// writes are discarded
+			ctx.KVStore(capKey1).Set([]byte("predicate"), []byte{1})
+			return ctx.KVStore(capKey1).Has(planKey)
+		})
+		bapp.SetHaltNotifier(func(reason string, height int64, _ int64) {
+			notified++
+			gotReason = reason
+			gotHeight = height
+		})
+	}
 
-	res = app.DeliverTx(abci.RequestDeliverTx{Tx: txBytes})
-	require.True(t, res.IsOK(), fmt.Sprintf("%v", res))
+	app := setupBaseApp(t, haltOpt)
+	app.InitChain(abci.RequestInitChain{})
 
-	ctx = app.getState(runTxModeDeliver).ctx
-	store = ctx.KVStore(capKey1)
-	require.Equal(t, int64(2), getIntFromStore(store, anteKey))
-	require.Equal(t, int64(1), getIntFromStore(store, deliverKey))
+	header := abci.Header{Height: 1}
+	app.BeginBlock(abci.RequestBeginBlock{Header: header})
+	app.Commit()
+	require.Equal(t, 0, notified)
 
-	// commit
-	app.EndBlock(abci.RequestEndBlock{})
+	header = abci.Header{Height: 2}
+	app.BeginBlock(abci.RequestBeginBlock{Header: header})
 	app.Commit()
-}
 
-func TestGasConsumptionBadTx(t *testing.T) {
-	gasWanted := uint64(5)
-	anteOpt := func(bapp *BaseApp) {
-		bapp.SetAnteHandler(func(ctx sdk.Context, tx sdk.Tx, simulate bool) (newCtx sdk.Context, err error) {
-			newCtx = ctx.WithGasMeter(sdk.NewGasMeter(gasWanted))
+	require.Equal(t, 1, notified)
+	require.Equal(t, HaltReasonPredicate, gotReason)
+	require.Equal(t, int64(2), gotHeight)
+	<-sigs
 
-			defer func() {
-				if r := recover(); r != nil {
-					switch rType := r.(type) {
-					case sdk.ErrorOutOfGas:
-						log := fmt.Sprintf("out of gas in location: %v", rType.Descriptor)
-						err = sdkerrors.Wrap(sdkerrors.ErrOutOfGas, log)
-					default:
-						panic(r)
-					}
-				}
-			}()
+	// the predicate sees the committed state but cannot write to it
+	store := app.cms.GetKVStore(capKey1)
+	require.Equal(t, []byte("v2"), store.Get(planKey))
+	require.False(t, store.Has([]byte("predicate")))
+}
 
-			txTest := tx.(txTest)
-			newCtx.GasMeter().ConsumeGas(uint64(txTest.Counter), "counter-ante")
-			if txTest.FailOnAnte {
-				return newCtx, sdkerrors.Wrap(sdkerrors.ErrUnauthorized, "ante handler failure")
-			}
+func TestABCITimingObserver(t *testing.T) {
+	const sleep = 2 * time.Millisecond
 
-			return
+	var (
+		observed  int
+		gotHeight int64
+		got       ABCITimings
+	)
+
+	opt := func(bapp *BaseApp) {
+		bapp.SetBeginBlocker(func(ctx sdk.Context, _ abci.RequestBeginBlock) abci.ResponseBeginBlock {
+			time.Sleep(sleep)
+			return abci.ResponseBeginBlock{}
+		})
+		bapp.SetEndBlocker(func(ctx sdk.Context, _ abci.RequestEndBlock) abci.ResponseEndBlock {
+			time.Sleep(sleep)
+			return abci.ResponseEndBlock{}
+		})
+		bapp.Router().AddRoute(routeMsgCounter, func(ctx sdk.Context, msg sdk.Msg) (*sdk.Result, error) {
+			time.Sleep(sleep)
+			return &sdk.Result{}, nil
 		})
+		bapp.SetABCITimingObserver(func(height int64, timings ABCITimings) {
+			observed++
+			gotHeight = height
+			got = timings
+		})
+	}
+
+	app := setupBaseApp(t, opt)
+	app.InitChain(abci.RequestInitChain{})
+
+	codec := codec.New()
+	registerTestCodec(codec)
+
+	app.BeginBlock(abci.RequestBeginBlock{Header: abci.Header{Height: 1}})
+	const numTxs = 3
+	for i := 0; i < numTxs; i++ {
+		txBytes, err := codec.MarshalBinaryBare(newTxCounter(int64(i), 0))
+		require.NoError(t, err)
+
+		res := app.DeliverTx(abci.RequestDeliverTx{Tx: txBytes})
+		require.True(t, res.IsOK(), res.Log)
 	}
+	app.EndBlock(abci.RequestEndBlock{Height: 1})
+	require.Equal(t, 0, observed)
+
+	app.Commit()
+	require.Equal(t, 1, observed)
+	require.Equal(t, int64(1), gotHeight)
+	require.True(t, got.BeginBlock >= sleep, got.BeginBlock)
+	require.True(t, got.EndBlock >= sleep, got.EndBlock)
+	require.True(t, got.Commit > 0, got.Commit)
+
+	// the DeliverTx time is summed over all the txs of the block
+	require.True(t, got.DeliverTx >= numTxs*sleep, got.DeliverTx)
+
+	// timings are reset for the next block
+	app.BeginBlock(abci.RequestBeginBlock{Header: abci.Header{Height: 2}})
+	app.EndBlock(abci.RequestEndBlock{Height: 2})
+	app.Commit()
+	require.Equal(t, 2, observed)
+	require.Equal(t, int64(2), gotHeight)
+	require.Equal(t, time.Duration(0), got.DeliverTx)
+}
+
+func TestDeterminismCheck(t *testing.T) {
+	codec := codec.New()
+	registerTestCodec(codec)
 
+	// the handler writes a value that changes on every execution unless
+	// deterministic is set
+	deterministic := true
+	executions := int64(0)
 	routerOpt := func(bapp *BaseApp) {
 		bapp.Router().AddRoute(routeMsgCounter, func(ctx sdk.Context, msg sdk.Msg) (*sdk.Result, error) {
-			count := msg.(msgCounter).Counter
-			ctx.GasMeter().ConsumeGas(uint64(count), "counter-handler")
+			executions++
+			value := int64(0)
+			if !deterministic {
+				value = executions
+			}
+			setIntOnStore(ctx.KVStore(capKey1), []byte("value"), value)
 			return &sdk.Result{}, nil
 		})
 	}
 
-	cdc := codec.New()
-	registerTestCodec(cdc)
-
-	app := setupBaseApp(t, anteOpt, routerOpt)
-	app.InitChain(abci.RequestInitChain{
-		ConsensusParams: &abci.ConsensusParams{
-			Block: &abci.BlockParams{
-				MaxGas: 9,
-			},
-		},
-	})
-
+	app := setupBaseApp(t, SetDeterminismCheck(true), routerOpt)
 	app.InitChain(abci.RequestInitChain{})
 
-	header := abci.Header{Height: app.LastBlockHeight() + 1}
-	app.BeginBlock(abci.RequestBeginBlock{Header: header})
-
-	tx := newTxCounter(5, 0)
-	tx.setFailOnAnte(true)
-	txBytes, err := cdc.MarshalBinaryBare(tx)
-	require.NoError(t, err)
+	runBlock := func(height int64) {
+		app.BeginBlock(abci.RequestBeginBlock{Header: abci.Header{Height: height}})
+		txBytes, err := codec.MarshalBinaryBare(newTxCounter(0, 0))
+		require.NoError(t, err)
+		res := app.DeliverTx(abci.RequestDeliverTx{Tx: txBytes})
+		require.True(t, res.IsOK(), fmt.Sprintf("%v", res))
+		app.EndBlock(abci.RequestEndBlock{})
+		app.Commit()
+	}
 
-	res := app.DeliverTx(abci.RequestDeliverTx{Tx: txBytes})
-	require.False(t, res.IsOK(), fmt.Sprintf("%v", res))
+	// the first block builds on top of InitChain and is not replayed
+	runBlock(1)
+	require.Equal(t, int64(1), executions)
 
-	// require next tx to fail due to black gas limit
-	tx = newTxCounter(5, 0)
-	txBytes, err = cdc.MarshalBinaryBare(tx)
-	require.NoError(t, err)
+	runBlock(2)
+	require.Equal(t, int64(3), executions)
+	require.Equal(t, int64(2), app.LastBlockHeight())
 
-	res = app.DeliverTx(abci.RequestDeliverTx{Tx: txBytes})
-	require.False(t, res.IsOK(), fmt.Sprintf("%v", res))
+	deterministic = false
+	require.Panics(t, func() { runBlock(3) })
 }
 
-// Test that we can only query from the latest committed state.
-func TestQuery(t *testing.T) {
-	key, value := []byte("hello"), []byte("goodbye")
-	anteOpt := func(bapp *BaseApp) {
-		bapp.SetAnteHandler(func(ctx sdk.Context, tx sdk.Tx, simulate bool) (newCtx sdk.Context, err error) {
-			store := ctx.KVStore(capKey1)
-			store.Set(key, value)
-			return
-		})
-	}
+func TestDeterminismCheckBookkeeping(t *testing.T) {
+	codec := codec.New()
+	registerTestCodec(codec)
 
-	routerOpt := func(bapp *BaseApp) {
+	transformed := 0
+	opts := func(bapp *BaseApp) {
 		bapp.Router().AddRoute(routeMsgCounter, func(ctx sdk.Context, msg sdk.Msg) (*sdk.Result, error) {
-			store := ctx.KVStore(capKey1)
-			store.Set(key, value)
 			return &sdk.Result{}, nil
 		})
+		bapp.SetValidatorUpdateTransformer(func(_ sdk.Context, updates []abci.ValidatorUpdate) []abci.ValidatorUpdate {
+			transformed++
+			return updates
+		})
 	}
 
-	app := setupBaseApp(t, anteOpt, routerOpt)
-
+	app := setupBaseApp(t, opts, SetDeterminismCheck(true), SetBlockSummaryEvent(true))
 	app.InitChain(abci.RequestInitChain{})
 
-	// NOTE: "/store/key1" tells us KVStore
-	// and the final "/key" says to use the data as the
-	// key in the given KVStore ...
-	query := abci.RequestQuery{
-		Path: "/store/key1/key",
-		Data: key,
+	for height := int64(1); height <= 2; height++ {
+		app.BeginBlock(abci.RequestBeginBlock{Header: abci.Header{Height: height}})
+		for i := int64(0); i < height; i++ {
+			txBytes, err := codec.MarshalBinaryBare(newTxCounter(i, 0))
+			require.NoError(t, err)
+			res := app.DeliverTx(abci.RequestDeliverTx{Tx: txBytes})
+			require.True(t, res.IsOK(), fmt.Sprintf("%v", res))
+		}
+		app.EndBlock(abci.RequestEndBlock{})
+		summary := app.blockSummary
+		app.Commit()
+
+		// the replay of the block must not be accounted as a second execution
+		require.Equal(t, int(height), transformed)
+		require.Equal(t, summary, app.blockSummary)
+		require.Equal(t, uint64(height), app.blockSummary.txs)
 	}
-	tx := newTxCounter(0, 0)
+}
 
-	// query is empty before we do anything
-	res := app.Query(query)
-	require.Equal(t, 0, len(res.Value))
+func TestBlockRandomnessSeeder(t *testing.T) {
+	codec := codec.New()
+	registerTestCodec(codec)
 
-	// query is still empty after a CheckTx
-	_, resTx, err := app.Check(tx)
+	txBytes, err := codec.MarshalBinaryBare(newTxCounter(0, 0))
 	require.NoError(t, err)
-	require.NotNil(t, resTx)
-	res = app.Query(query)
-	require.Equal(t, 0, len(res.Value))
 
-	// query is still empty after a DeliverTx before we commit
-	header := abci.Header{Height: app.LastBlockHeight() + 1}
-	app.BeginBlock(abci.RequestBeginBlock{Header: header})
+	// runBlock returns the seeds observed by the BeginBlocker and a handler
+	runBlock := func(seeder BlockRandomnessSeeder, req abci.RequestBeginBlock) (beginSeed, txSeed []byte) {
+		opt := func(bapp *BaseApp) {
+			if seeder != nil {
+				bapp.SetBlockRandomnessSeeder(seeder)
+			}
+			bapp.SetBeginBlocker(func(ctx sdk.Context, _ abci.RequestBeginBlock) abci.ResponseBeginBlock {
+				beginSeed = BlockRandomnessSeed(ctx)
+				return abci.ResponseBeginBlock{}
+			})
+			bapp.Router().AddRoute(routeMsgCounter, func(ctx sdk.Context, msg sdk.Msg) (*sdk.Result, error) {
+				txSeed = BlockRandomnessSeed(ctx)
+				return &sdk.Result{}, nil
+			})
+		}
 
-	_, resTx, err = app.Deliver(tx)
-	require.NoError(t, err)
-	require.NotNil(t, resTx)
-	res = app.Query(query)
-	require.Equal(t, 0, len(res.Value))
+		app := setupBaseApp(t, opt)
+		app.InitChain(abci.RequestInitChain{})
+		app.BeginBlock(req)
+		res := app.DeliverTx(abci.RequestDeliverTx{Tx: txBytes})
+		require.True(t, res.IsOK(), res.Log)
 
-	// query returns correct value after Commit
-	app.Commit()
-	res = app.Query(query)
-	require.Equal(t, value, res.Value)
-}
+		return beginSeed, txSeed
+	}
 
-// Test p2p filter queries
-func TestP2PQuery(t *testing.T) {
-	addrPeerFilterOpt := func(bapp *BaseApp) {
-		bapp.SetAddrPeerFilter(func(addrport string) abci.ResponseQuery {
-			require.Equal(t, "1.1.1.1:8000", addrport)
-			return abci.ResponseQuery{Code: uint32(3)}
-		})
+	req := abci.RequestBeginBlock{
+		Hash:   []byte("block hash"),
+		Header: abci.Header{Height: 1, ProposerAddress: []byte("proposer")},
 	}
 
-	idPeerFilterOpt := func(bapp *BaseApp) {
-		bapp.SetIDPeerFilter(func(id string) abci.ResponseQuery {
-			require.Equal(t, "testid", id)
-			return abci.ResponseQuery{Code: uint32(4)}
+	beginSeed, txSeed := runBlock(DefaultBlockRandomnessSeeder, req)
+	require.Len(t, beginSeed, 32)
+	require.Equal(t, beginSeed, txSeed)
+
+	// independent nodes derive the same seed from the same block
+	otherSeed, _ := runBlock(DefaultBlockRandomnessSeeder, req)
+	require.Equal(t, beginSeed, otherSeed)
+	require.Equal(t, beginSeed, DefaultBlockRandomnessSeeder(req))
+
+	// a different block results in a different seed
+	req.Hash = []byte("other block hash")
+	otherSeed, _ = runBlock(DefaultBlockRandomnessSeeder, req)
+	require.NotEqual(t, beginSeed, otherSeed)
+
+	// the seed is opt-in
+	beginSeed, txSeed = runBlock(nil, req)
+	require.Nil(t, beginSeed)
+	require.Nil(t, txSeed)
+}
+
+func TestBlockerStateWriteLimit(t *testing.T) {
+	var valueSize int
+	opt := func(bapp *BaseApp) {
+		bapp.SetEndBlocker(func(ctx sdk.Context, _ abci.RequestEndBlock) abci.ResponseEndBlock {
+			ctx.KVStore(capKey1).Set([]byte("k"), make([]byte, valueSize))
+			return abci.ResponseEndBlock{}
 		})
 	}
 
-	app := setupBaseApp(t, addrPeerFilterOpt, idPeerFilterOpt)
+	app := setupBaseApp(t, opt, SetBlockerStateWriteLimit(10))
+	app.InitChain(abci.RequestInitChain{})
 
-	addrQuery := abci.RequestQuery{
-		Path: "/p2p/filter/addr/1.1.1.1:8000",
-	}
-	res := app.Query(addrQuery)
-	require.Equal(t, uint32(3), res.Code)
+	// key and value fit within the limit
+	valueSize = 9
+	app.BeginBlock(abci.RequestBeginBlock{Header: abci.Header{Height: 1}})
+	app.EndBlock(abci.RequestEndBlock{})
+	require.Len(t, app.deliverState.ctx.KVStore(capKey1).Get([]byte("k")), valueSize)
+	app.Commit()
 
-	idQuery := abci.RequestQuery{
-		Path: "/p2p/filter/id/testid",
-	}
-	res = app.Query(idQuery)
-	require.Equal(t, uint32(4), res.Code)
+	valueSize = 10
+	app.BeginBlock(abci.RequestBeginBlock{Header: abci.Header{Height: 2}})
+	require.Panics(t, func() { app.EndBlock(abci.RequestEndBlock{}) })
+
+	// nothing was written to the deliverState
+	require.Len(t, app.deliverState.ctx.KVStore(capKey1).Get([]byte("k")), 9)
 }
 
 func TestGetMaximumBlockGas(t *testing.T) {
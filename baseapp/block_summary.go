@@ -0,0 +1,53 @@
+package baseapp
+
+import (
+	"strconv"
+
+	abci "github.com/tendermint/tendermint/abci/types"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+)
+
+// Event type and attributes of the block summary event added to EndBlock
+// responses when block summaries are enabled.
+const (
+	EventTypeBlockSummary = "block_summary"
+
+	AttributeKeyTxCount          = "tx_count"
+	AttributeKeyBlockGasUsed     = "gas_used"
+	AttributeKeyValidatorUpdates = "validator_updates"
+)
+
+// blockSummary aggregates the txs delivered in the current block.
+type blockSummary struct {
+	txs     uint64
+	gasUsed uint64
+}
+
+// recordBlockSummaryTx accounts a delivered tx, successful or not, in the block
+// summary if enabled.
+func (app *BaseApp) recordBlockSummaryTx(gasUsed uint64) {
+	if !app.blockSummaryEvent {
+		return
+	}
+
+	app.blockSummary.txs++
+	app.blockSummary.gasUsed += gasUsed
+}
+
+// appendBlockSummaryEvent appends the block summary event to the events of res
+// if enabled.
+func (app *BaseApp) appendBlockSummaryEvent(res abci.ResponseEndBlock) abci.ResponseEndBlock {
+	if !app.blockSummaryEvent {
+		return res
+	}
+
+	res.Events = append(res.Events, sdk.Events{sdk.NewEvent(
+		EventTypeBlockSummary,
+		sdk.NewAttribute(AttributeKeyTxCount, strconv.FormatUint(app.blockSummary.txs, 10)),
+		sdk.NewAttribute(AttributeKeyBlockGasUsed, strconv.FormatUint(app.blockSummary.gasUsed, 10)),
+		sdk.NewAttribute(AttributeKeyValidatorUpdates, strconv.Itoa(len(res.ValidatorUpdates))),
+	)}.ToABCIEvents()...)
+
+	return res
+}
@@ -0,0 +1,87 @@
+package baseapp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+)
+
+// runBlocker runs a begin or end blocker on the deliverState. If a blocker state
+// write limit is set, the blocker runs on a cache-wrapped store whose writes are
+// measured when flushed into the deliverState, panicking if the limit is
+// exceeded. Exceeding the limit indicates a bug in a module, hence it is fatal.
+func (app *BaseApp) runBlocker(name string, blocker func(ctx sdk.Context)) {
+	if app.blockerWriteLimit == 0 {
+		blocker(app.deliverState.ctx)
+		return
+	}
+
+	// The cache layers created on top of the traced store report every write
+	// that is flushed into it.
+	counter := &writeSizeCounter{}
+	traced := app.deliverState.ms.CacheMultiStore().SetTracer(counter).(sdk.CacheMultiStore)
+	msCache := traced.CacheMultiStore()
+
+	blocker(app.deliverState.ctx.WithMultiStore(msCache))
+	msCache.Write()
+
+	if counter.err != nil {
+		panic(fmt.Errorf("failed to measure %s state writes: %w", name, counter.err))
+	}
+
+	if counter.written > app.blockerWriteLimit {
+		panic(fmt.Sprintf(
+			"%s wrote %d bytes to state, exceeding the limit of %d bytes", name, counter.written, app.blockerWriteLimit,
+		))
+	}
+
+	traced.Write()
+}
+
+// writeSizeCounter is a store tracer that sums up the size of the keys and
+// values of all traced write and delete operations.
+type writeSizeCounter struct {
+	pending []byte
+	written uint64
+	err     error
+}
+
+func (c *writeSizeCounter) Write(p []byte) (int, error) {
+	c.pending = append(c.pending, p...)
+
+	// trace operations are terminated by a new line
+	for {
+		i := bytes.IndexByte(c.pending, '\n')
+		if i < 0 {
+			break
+		}
+
+		c.count(c.pending[:i])
+		c.pending = c.pending[i+1:]
+	}
+
+	return len(p), nil
+}
+
+func (c *writeSizeCounter) count(line []byte) {
+	var op struct {
+		Operation string `json:"operation"`
+		Key       []byte `json:"key"`
+		Value     []byte `json:"value"`
+	}
+
+	if err := json.Unmarshal(line, &op); err != nil {
+		c.err = err
+		return
+	}
+
+	switch op.Operation {
+	case "write":
+		c.written += uint64(len(op.Key) + len(op.Value))
+
+	case "delete":
+		c.written += uint64(len(op.Key))
+	}
+}
@@ -0,0 +1,70 @@
+package baseapp
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+)
+
+// SetCommitRetry returns a BaseApp option function that retries the commit of
+// the multistore up to n times, waiting backoff between attempts, when it fails
+// with a retriable error. An error is retriable if it, or an error it wraps,
+// reports itself as temporary through a Temporary() bool method returning true,
+// as e.g. EINTR and EAGAIN syscall errors do. Retrying relies on the commit of
+// the CommitMultiStore being retriable, as the one of rootmulti.Store is: the
+// stores committed by a failed attempt are not committed again. Any other
+// failure, or a retriable one once the retries are exhausted, still crashes
+// the node as a committed block must be durable.
+func SetCommitRetry(n int, backoff time.Duration) func(*BaseApp) {
+	return func(bap *BaseApp) { bap.setCommitRetry(n, backoff) }
+}
+
+func (app *BaseApp) setCommitRetry(n int, backoff time.Duration) {
+	if n < 0 {
+		panic(fmt.Sprintf("invalid commit retries: %d", n))
+	}
+
+	app.commitRetries = n
+	app.commitRetryBackoff = backoff
+}
+
+// commitStore commits the multistore, retrying retriable failures.
+func (app *BaseApp) commitStore() sdk.CommitID {
+	for attempt := 0; ; attempt++ {
+		commitID, err := app.tryCommitStore(attempt < app.commitRetries)
+		if err == nil {
+			return commitID
+		}
+
+		app.logger.Error("store commit failed; retrying", "attempt", attempt+1, "err", err)
+		time.Sleep(app.commitRetryBackoff)
+	}
+}
+
+// tryCommitStore commits the multistore. If canRetry is set, a panic with a
+// retriable error is recovered and returned, any other panic is propagated.
+func (app *BaseApp) tryCommitStore(canRetry bool) (commitID sdk.CommitID, err error) {
+	if canRetry {
+		defer func() {
+			if r := recover(); r != nil {
+				rerr, ok := r.(error)
+				if !ok || !isRetriableCommitError(rerr) {
+					panic(r)
+				}
+
+				err = rerr
+			}
+		}()
+	}
+
+	return app.cms.Commit(), nil
+}
+
+// isRetriableCommitError returns true if err, or an error it wraps, reports
+// itself as temporary.
+func isRetriableCommitError(err error) bool {
+	var temporary interface{ Temporary() bool }
+	return errors.As(err, &temporary) && temporary.Temporary()
+}
@@ -0,0 +1,109 @@
+package baseapp
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+
+	abci "github.com/tendermint/tendermint/abci/types"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+)
+
+// blockRecord holds the ABCI requests of the block being executed so it can be
+// replayed by the determinism check.
+type blockRecord struct {
+	beginBlock abci.RequestBeginBlock
+	txs        [][]byte
+	endBlock   abci.RequestEndBlock
+}
+
+// recordBeginBlock starts recording a block for the determinism check. Blocks
+// that do not start from the last committed state (i.e. the first block, which
+// builds on top of the InitChain deliverState) cannot be replayed and are not
+// recorded.
+func (app *BaseApp) recordBeginBlock(req abci.RequestBeginBlock) {
+	if !app.determinismCheck {
+		return
+	}
+
+	app.determinismBlock = nil
+	if app.deliverState == nil {
+		app.determinismBlock = &blockRecord{beginBlock: req}
+	}
+}
+
+func (app *BaseApp) recordDeliverTx(req abci.RequestDeliverTx) {
+	if app.determinismCheck && app.determinismBlock != nil {
+		app.determinismBlock.txs = append(app.determinismBlock.txs, req.Tx)
+	}
+}
+
+func (app *BaseApp) recordEndBlock(req abci.RequestEndBlock) {
+	if app.determinismCheck && app.determinismBlock != nil {
+		app.determinismBlock.endBlock = req
+	}
+}
+
+// checkDeterminism replays the recorded block against a fresh cache of the
+// last committed state and panics if the contents of any mounted store differ
+// from the ones produced by the original execution. It must be called before
+// the deliverState is written.
+func (app *BaseApp) checkDeterminism() {
+	block := app.determinismBlock
+	app.determinismBlock = nil
+
+	if !app.determinismCheck || block == nil {
+		return
+	}
+
+	// The replay only re-runs the state transition: it bypasses the ABCI
+	// methods so the block summary, the timings, the tx cache and the
+	// validator updates of the original execution are left untouched. It is
+	// timed as part of Commit.
+	deliverState := app.deliverState
+	defer func() { app.deliverState = deliverState }()
+
+	// a nil deliverState is set up anew from the last committed state
+	app.deliverState = nil
+	app.beginBlock(block.beginBlock)
+	for _, txBytes := range block.txs {
+		// txs which fail to decode were rejected by the original execution too
+		if tx, err := app.txDecoder(txBytes); err == nil {
+			app.runTx(runTxModeDeliver, txBytes, tx)
+		}
+	}
+	app.endBlock(block.endBlock)
+
+	for _, key := range app.storeKeys {
+		expected := storeDigest(deliverState.ms.GetKVStore(key))
+		got := storeDigest(app.deliverState.ms.GetKVStore(key))
+
+		if !bytes.Equal(expected, got) {
+			panic(fmt.Sprintf(
+				"non-deterministic state transition at height %d: store %s diverged on re-execution (%X != %X)",
+				block.beginBlock.Header.Height, key.Name(), expected, got,
+			))
+		}
+	}
+}
+
+// storeDigest returns a hash over all the key/value pairs of a store.
+func storeDigest(store sdk.KVStore) []byte {
+	h := sha256.New()
+	lenBz := make([]byte, binary.MaxVarintLen64)
+
+	iter := store.Iterator(nil, nil)
+	defer iter.Close()
+
+	for ; iter.Valid(); iter.Next() {
+		for _, bz := range [][]byte{iter.Key(), iter.Value()} {
+			n := binary.PutUvarint(lenBz, uint64(len(bz)))
+			h.Write(lenBz[:n])
+			h.Write(bz)
+		}
+	}
+
+	return h.Sum(nil)
+}
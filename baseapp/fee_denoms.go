@@ -0,0 +1,33 @@
+package baseapp
+
+import (
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	sdkerrors "github.com/cosmos/cosmos-sdk/types/errors"
+)
+
+// feeTx is implemented by txs exposing their fee, e.g. auth.StdTx.
+type feeTx interface {
+	GetFee() sdk.Coins
+}
+
+// validateFeeDenoms returns an error if the fee of tx contains a denom which is
+// not accepted by the node. Txs which do not expose their fee, or pay no fee,
+// are left to the AnteHandler.
+func (app *BaseApp) validateFeeDenoms(tx sdk.Tx) error {
+	if len(app.acceptedFeeDenoms) == 0 {
+		return nil
+	}
+
+	ftx, ok := tx.(feeTx)
+	if !ok {
+		return nil
+	}
+
+	for _, coin := range ftx.GetFee() {
+		if !app.acceptedFeeDenoms[coin.Denom] {
+			return sdkerrors.Wrapf(sdkerrors.ErrInsufficientFee, "fee denom %s is not accepted", coin.Denom)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,56 @@
+package baseapp
+
+import (
+	"fmt"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	sdkerrors "github.com/cosmos/cosmos-sdk/types/errors"
+)
+
+// SetForensicHeight returns a BaseApp option function that pins the app to the
+// state committed at the given height for forensic analysis. The version is
+// loaded instead of the latest one and queries serve it as the latest state.
+// As the state must not be modified, the app refuses to execute blocks and txs:
+// DeliverTx and CheckTx fail and the other consensus ABCI methods panic.
+//
+// NOTE: The option replaces the store loader and loading fails if the version
+// does not exist or has been pruned.
+func SetForensicHeight(height int64) func(*BaseApp) {
+	return func(bap *BaseApp) { bap.setForensicHeight(height) }
+}
+
+func (app *BaseApp) setForensicHeight(height int64) {
+	app.forensicHeight = height
+	app.storeLoader = forensicStoreLoader(height)
+}
+
+// forensicStoreLoader returns a StoreLoader loading the given version once it
+// has been verified to be available.
+func forensicStoreLoader(height int64) StoreLoader {
+	return func(ms sdk.CommitMultiStore) error {
+		if err := ms.LoadLatestVersion(); err != nil {
+			return err
+		}
+
+		latest, earliest := ms.LastCommitID().Version, ms.EarliestVersion()
+		if height < earliest || height > latest {
+			return fmt.Errorf(
+				"forensic height %d is not available; available heights: %d-%d", height, earliest, latest,
+			)
+		}
+
+		return ms.LoadVersion(height)
+	}
+}
+
+// errForensicMode returns the error of the consensus operations refused by an
+// app pinned to a forensic height, or nil if it is not pinned.
+func (app *BaseApp) errForensicMode(op string) error {
+	if app.forensicHeight == 0 {
+		return nil
+	}
+
+	return sdkerrors.Wrapf(
+		sdkerrors.ErrInvalidRequest, "%s refused: state is pinned at forensic height %d", op, app.forensicHeight,
+	)
+}
@@ -0,0 +1,51 @@
+package baseapp
+
+import (
+	sdk "github.com/cosmos/cosmos-sdk/types"
+)
+
+// GasMeterFactory returns a gas meter limited to limit gas, or an infinite gas
+// meter if limit is 0.
+type GasMeterFactory func(limit uint64) sdk.GasMeter
+
+// SetGasMeterFactory sets the factory of the block gas meter and of the gas
+// meters txs are executed with, e.g. to experiment with alternative gas
+// accounting. The AnteHandler still determines the tx gas limit: once it
+// returns, a meter of the factory limited to the limit of the AnteHandler gas
+// meter is set up, carrying over the gas consumed so far, and the messages are
+// executed with it.
+func (app *BaseApp) SetGasMeterFactory(factory GasMeterFactory) {
+	if app.sealed {
+		panic("SetGasMeterFactory() on sealed BaseApp")
+	}
+	app.gasMeterFactory = factory
+}
+
+// newGasMeter returns a gas meter of the factory if set, or of the standard
+// gas meters otherwise. A limit of 0 means infinite gas.
+func (app *BaseApp) newGasMeter(limit uint64) sdk.GasMeter {
+	switch {
+	case app.gasMeterFactory != nil:
+		return app.gasMeterFactory(limit)
+
+	case limit > 0:
+		return sdk.NewGasMeter(limit)
+
+	default:
+		return sdk.NewInfiniteGasMeter()
+	}
+}
+
+// withFactoryGasMeter replaces the gas meter of ctx with a meter of the factory
+// of the same limit, which has consumed the same gas. It is a no-op if no
+// factory is set.
+func (app *BaseApp) withFactoryGasMeter(ctx sdk.Context) sdk.Context {
+	if app.gasMeterFactory == nil {
+		return ctx
+	}
+
+	meter := app.gasMeterFactory(ctx.GasMeter().Limit())
+	meter.ConsumeGas(ctx.GasMeter().GasConsumed(), "gas consumed before message execution")
+
+	return ctx.WithGasMeter(meter)
+}
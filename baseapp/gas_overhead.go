@@ -0,0 +1,67 @@
+package baseapp
+
+import (
+	"strconv"
+
+	abci "github.com/tendermint/tendermint/abci/types"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+)
+
+// Event type and attributes of the gas breakdown event added to CheckTx and
+// DeliverTx responses when gas overhead tracking is enabled.
+const (
+	EventTypeGasBreakdown = "gas_breakdown"
+
+	AttributeKeyOverheadGas  = "overhead_gas"
+	AttributeKeyExecutionGas = "execution_gas"
+)
+
+// GasBreakdown splits the gas used by a tx into the gas consumed before message
+// execution (tx decoding and the AnteHandler) and the gas consumed executing
+// the tx messages. Overhead + Execution always equals the tx GasUsed.
+//
+// NOTE: tx decoding happens before a gas meter is set up and is not metered,
+// hence the overhead is the gas consumed by the AnteHandler.
+type GasBreakdown struct {
+	Overhead  uint64 `json:"overhead"`
+	Execution uint64 `json:"execution"`
+}
+
+// newGasBreakdown returns a GasBreakdown to be filled in by runTx if gas
+// overhead tracking is enabled and nil otherwise.
+func (app *BaseApp) newGasBreakdown() *GasBreakdown {
+	if !app.gasOverheadTracking {
+		return nil
+	}
+
+	return &GasBreakdown{}
+}
+
+// set splits gasUsed at overhead. If message execution was not reached, all
+// gas is accounted as overhead.
+func (b *GasBreakdown) set(gasUsed, overhead uint64, executed bool) {
+	if b == nil {
+		return
+	}
+
+	if !executed || overhead > gasUsed {
+		overhead = gasUsed
+	}
+
+	b.Overhead, b.Execution = overhead, gasUsed-overhead
+}
+
+// appendEvent appends the gas breakdown event to events. It is a no-op on a
+// nil GasBreakdown.
+func (b *GasBreakdown) appendEvent(events []abci.Event) []abci.Event {
+	if b == nil {
+		return events
+	}
+
+	return append(events, sdk.Events{sdk.NewEvent(
+		EventTypeGasBreakdown,
+		sdk.NewAttribute(AttributeKeyOverheadGas, strconv.FormatUint(b.Overhead, 10)),
+		sdk.NewAttribute(AttributeKeyExecutionGas, strconv.FormatUint(b.Execution, 10)),
+	)}.ToABCIEvents()...)
+}
@@ -0,0 +1,84 @@
+package baseapp
+
+import (
+	"fmt"
+
+	abci "github.com/tendermint/tendermint/abci/types"
+
+	sdkerrors "github.com/cosmos/cosmos-sdk/types/errors"
+)
+
+// HeightValidationMode defines how BeginBlock handles a block whose height is
+// not the one following the last committed height.
+type HeightValidationMode uint8
+
+const (
+	// HeightValidationConsensus panics on an unexpected height. It is the
+	// default and the only mode suitable for a node taking part in consensus.
+	HeightValidationConsensus HeightValidationMode = iota
+
+	// HeightValidationRecovery rejects a block with an unexpected height
+	// without panicking, so that replay and recovery tools can handle gaps. The
+	// block is not begun and the error is returned by LastHeightError. Until a
+	// block is begun, DeliverTx fails and EndBlock and Commit are no-ops.
+	HeightValidationRecovery
+)
+
+// SetHeightValidationMode returns a BaseApp option function that sets how
+// BeginBlock handles blocks with an unexpected height.
+func SetHeightValidationMode(mode HeightValidationMode) func(*BaseApp) {
+	return func(bap *BaseApp) { bap.setHeightValidationMode(mode) }
+}
+
+func (app *BaseApp) setHeightValidationMode(mode HeightValidationMode) {
+	app.heightValidationMode = mode
+}
+
+// newHeightMismatchError returns the error of a block at height received while
+// expected was the next height, along with a hint to recover.
+func newHeightMismatchError(expected, received int64) error {
+	var hint string
+	if received < expected {
+		hint = fmt.Sprintf(
+			"the app height (%d) is ahead of the block; the app state may have been restored from a later "+
+				"height than the block store, which must be synced or replayed up to the app height",
+			expected-1,
+		)
+	} else {
+		hint = fmt.Sprintf(
+			"the block is ahead of the app height (%d); blocks %d to %d must be replayed first",
+			expected-1, expected, received-1,
+		)
+	}
+
+	return fmt.Errorf("invalid height: %d; expected: %d: %s", received, expected, hint)
+}
+
+// rejectHeight panics with err in consensus mode. In recovery mode, it logs and
+// records err instead.
+func (app *BaseApp) rejectHeight(req abci.RequestBeginBlock, err error) {
+	if app.heightValidationMode != HeightValidationRecovery {
+		panic(err)
+	}
+
+	app.logger.Error("rejected block", "height", req.Header.Height, "err", err)
+	app.lastHeightErr = err
+}
+
+// errRejectedBlock returns the error of the operations refused on a block
+// rejected for its height, or nil if the last block was begun.
+func (app *BaseApp) errRejectedBlock(op string) error {
+	if app.lastHeightErr == nil {
+		return nil
+	}
+
+	return sdkerrors.Wrapf(
+		sdkerrors.ErrInvalidRequest, "%s refused: the block was rejected: %s", op, app.lastHeightErr,
+	)
+}
+
+// LastHeightError returns the error of the last block rejected by BeginBlock
+// for its height in recovery mode, or nil if the last block was begun.
+func (app *BaseApp) LastHeightError() error {
+	return app.lastHeightErr
+}
@@ -6,6 +6,7 @@ import (
 	abci "github.com/tendermint/tendermint/abci/types"
 
 	sdk "github.com/cosmos/cosmos-sdk/types"
+	sdkerrors "github.com/cosmos/cosmos-sdk/types/errors"
 )
 
 var isAlphaNumeric = regexp.MustCompile(`^[a-zA-Z0-9]+$`).MatchString
@@ -18,6 +19,36 @@ func (app *BaseApp) Simulate(txBytes []byte, tx sdk.Tx) (sdk.GasInfo, *sdk.Resul
 	return app.runTx(runTxModeSimulate, txBytes, tx)
 }
 
+// SimulateAtHeight simulates the tx against the committed state at the given
+// height instead of the latest state. All writes are discarded. The context
+// carries the latest block header with its height set to the given height. An
+// error is returned if the state at that height has been pruned or does not
+// exist.
+func (app *BaseApp) SimulateAtHeight(txBytes []byte, height int64) (sdk.GasInfo, *sdk.Result, error) {
+	tx, err := app.txDecoder(txBytes)
+	if err != nil {
+		return sdk.GasInfo{}, nil, sdkerrors.Wrap(err, "failed to decode tx")
+	}
+
+	cacheMS, err := app.cms.CacheMultiStoreWithVersion(height)
+	if err != nil {
+		return sdk.GasInfo{}, nil, sdkerrors.Wrapf(
+			sdkerrors.ErrInvalidRequest,
+			"failed to load state at height %d; %s (latest height: %d)", height, err, app.LastBlockHeight(),
+		)
+	}
+
+	header := app.checkState.ctx.BlockHeader()
+	header.Height = height
+
+	ctx := sdk.NewContext(cacheMS, header, true, app.logger).
+		WithMinGasPrices(app.minGasPrices).
+		WithTxBytes(txBytes).
+		WithConsensusParams(app.consensusParams)
+
+	return app.runTxWithContext(ctx, runTxModeSimulate, txBytes, tx)
+}
+
 func (app *BaseApp) Deliver(tx sdk.Tx) (sdk.GasInfo, *sdk.Result, error) {
 	return app.runTx(runTxModeDeliver, nil, tx)
 }
@@ -0,0 +1,60 @@
+package baseapp
+
+import (
+	"errors"
+	"sync/atomic"
+
+	sdkerrors "github.com/cosmos/cosmos-sdk/types/errors"
+)
+
+// MempoolStats contains the number of CheckTx calls by outcome since the
+// BaseApp was created. The counters are cumulative and never reset.
+type MempoolStats struct {
+	Accepted     uint64 `json:"accepted"`
+	AnteFailed   uint64 `json:"ante_failed"`
+	DecodeFailed uint64 `json:"decode_failed"`
+	TooLarge     uint64 `json:"too_large"`
+}
+
+// mempoolCounters tracks MempoolStats. The counters are updated atomically as
+// CheckTx may run concurrently with queries reading them.
+type mempoolCounters struct {
+	accepted     uint64
+	anteFailed   uint64
+	decodeFailed uint64
+	tooLarge     uint64
+}
+
+// recordCheckTx increments the counter matching the outcome of a CheckTx call
+// that decoded the tx successfully.
+func (c *mempoolCounters) recordCheckTx(err error) {
+	switch {
+	case err == nil:
+		atomic.AddUint64(&c.accepted, 1)
+
+	case errors.Is(err, sdkerrors.ErrTxTooLarge):
+		atomic.AddUint64(&c.tooLarge, 1)
+
+	default:
+		atomic.AddUint64(&c.anteFailed, 1)
+	}
+}
+
+func (c *mempoolCounters) recordDecodeFailed() {
+	atomic.AddUint64(&c.decodeFailed, 1)
+}
+
+func (c *mempoolCounters) stats() MempoolStats {
+	return MempoolStats{
+		Accepted:     atomic.LoadUint64(&c.accepted),
+		AnteFailed:   atomic.LoadUint64(&c.anteFailed),
+		DecodeFailed: atomic.LoadUint64(&c.decodeFailed),
+		TooLarge:     atomic.LoadUint64(&c.tooLarge),
+	}
+}
+
+// GetMempoolStats returns the cumulative CheckTx admission statistics. The
+// same statistics are served by the "/app/mempool-stats" query.
+func (app *BaseApp) GetMempoolStats() MempoolStats {
+	return app.mempoolStats.stats()
+}
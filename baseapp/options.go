@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io"
 
+	abci "github.com/tendermint/tendermint/abci/types"
 	dbm "github.com/tendermint/tm-db"
 
 	"github.com/cosmos/cosmos-sdk/store"
@@ -28,6 +29,90 @@ func SetMinGasPrices(gasPricesStr string) func(*BaseApp) {
 	return func(bap *BaseApp) { bap.setMinGasPrices(gasPrices) }
 }
 
+// SetRecheckMinGasPrices returns a BaseApp option function that sets the source
+// of the minimum gas prices provided to the AnteHandler on recheck, so that
+// txs in the mempool no longer paying the current minimum are evicted. Initial
+// CheckTx keeps using the static minimum gas prices.
+func SetRecheckMinGasPrices(fn func(ctx sdk.Context) sdk.DecCoins) func(*BaseApp) {
+	return func(bap *BaseApp) { bap.setRecheckMinGasPrices(fn) }
+}
+
+// SetMaxMsgsPerTx returns a BaseApp option function that limits the number of
+// messages a tx may contain. Txs exceeding the limit are rejected before the
+// AnteHandler runs. A value of 0 means unlimited.
+func SetMaxMsgsPerTx(maxMsgs int) func(*BaseApp) {
+	return func(bap *BaseApp) { bap.setMaxMsgsPerTx(maxMsgs) }
+}
+
+// SetMaxQueryResponseBytes returns a BaseApp option function that limits the
+// size of the value returned by custom and store queries. Larger results are
+// replaced by an ErrInvalidRequest error. A value of 0 means unlimited.
+func SetMaxQueryResponseBytes(n int) func(*BaseApp) {
+	return func(bap *BaseApp) { bap.setMaxQueryResponseBytes(n) }
+}
+
+// SetAcceptedFeeDenoms returns a BaseApp option function that restricts the
+// denoms a tx fee may be paid in. CheckTx rejects txs paying fees in any other
+// denom before the AnteHandler runs. An empty list accepts all denoms.
+func SetAcceptedFeeDenoms(denoms []string) func(*BaseApp) {
+	return func(bap *BaseApp) { bap.setAcceptedFeeDenoms(denoms) }
+}
+
+// SetZeroGasTxPredicate returns a BaseApp option function that exempts the txs
+// approved by fn, e.g. whitelisted system txs, from the minimum gas prices in
+// CheckTx, so that they may pay no fee. All other txs must still meet the
+// minimum gas prices. A nil fn exempts no tx.
+func SetZeroGasTxPredicate(fn func(tx sdk.Tx) bool) func(*BaseApp) {
+	return func(bap *BaseApp) { bap.setZeroGasTxPredicate(fn) }
+}
+
+// SetParallelExecution returns a BaseApp option function that enables the
+// EXPERIMENTAL parallel execution of the txs delivered via DeliverTxBatch.
+// conflictFn decides which txs must not be executed concurrently. The resulting
+// state matches sequential execution regardless, but the conflicts it misses
+// are paid for by executing txs again.
+func SetParallelExecution(conflictFn TxConflictFunc) func(*BaseApp) {
+	return func(bap *BaseApp) { bap.setParallelExecution(conflictFn) }
+}
+
+// SetGasOverheadTracking returns a BaseApp option function that enables adding
+// a gas_breakdown event, splitting the gas used by a tx between the AnteHandler
+// and message execution, to CheckTx and DeliverTx responses.
+func SetGasOverheadTracking(enabled bool) func(*BaseApp) {
+	return func(bap *BaseApp) { bap.setGasOverheadTracking(enabled) }
+}
+
+// SetTxCacheSize returns a BaseApp option function that enables caching up to
+// n txs decoded by CheckTx, so that rechecking and delivering them does not
+// decode them again. The least recently used txs are evicted first, and
+// delivered txs are evicted from the cache. A value of 0 disables the cache.
+func SetTxCacheSize(n int) func(*BaseApp) {
+	return func(bap *BaseApp) { bap.setTxCacheSize(n) }
+}
+
+// SetStructuredErrors returns a BaseApp option function that enables returning
+// structured error details (codespace, code, root cause and failing message)
+// as JSON in the Data field of failed DeliverTx responses. The flat Log is
+// returned unchanged.
+func SetStructuredErrors(enabled bool) func(*BaseApp) {
+	return func(bap *BaseApp) { bap.setStructuredErrors(enabled) }
+}
+
+// SetBlockSummaryEvent returns a BaseApp option function that enables adding a
+// block_summary event to EndBlock responses with the number of txs delivered in
+// the block, the total gas they used and the number of validator updates.
+func SetBlockSummaryEvent(enabled bool) func(*BaseApp) {
+	return func(bap *BaseApp) { bap.setBlockSummaryEvent(enabled) }
+}
+
+// SetBlockerStateWriteLimit returns a BaseApp option function that limits the
+// number of bytes (keys and values) the BeginBlocker and EndBlocker may each
+// write to state in a block. Exceeding the limit panics, halting the chain, as
+// it indicates a bug in a module. A value of 0 means unlimited.
+func SetBlockerStateWriteLimit(limit uint64) func(*BaseApp) {
+	return func(bap *BaseApp) { bap.setBlockerStateWriteLimit(limit) }
+}
+
 // SetHaltHeight returns a BaseApp option function that sets the halt block height.
 func SetHaltHeight(blockHeight uint64) func(*BaseApp) {
 	return func(bap *BaseApp) { bap.setHaltHeight(blockHeight) }
@@ -38,6 +123,18 @@ func SetHaltTime(haltTime uint64) func(*BaseApp) {
 	return func(bap *BaseApp) { bap.setHaltTime(haltTime) }
 }
 
+// SetDeterminismCheck returns a BaseApp option function that enables or
+// disables the block determinism check. When enabled, Commit re-executes the
+// block's BeginBlock, DeliverTx and EndBlock calls against a fresh cache of the
+// last committed state and panics if any store ends up with different contents.
+//
+// NOTE: This more than doubles block execution time and iterates over the full
+// contents of every mounted store on each Commit. It is meant for development
+// and test harnesses only and must never be enabled on a live network.
+func SetDeterminismCheck(enabled bool) func(*BaseApp) {
+	return func(bap *BaseApp) { bap.setDeterminismCheck(enabled) }
+}
+
 // SetInterBlockCache provides a BaseApp option function that sets the
 // inter-block cache.
 func SetInterBlockCache(cache sdk.MultiStorePersistentCache) func(*BaseApp) {
@@ -80,6 +177,17 @@ func (app *BaseApp) SetInitChainer(initChainer sdk.InitChainer) {
 	app.initChainer = initChainer
 }
 
+// SetUpgradeInitChainer sets an InitChainer which runs instead of the regular
+// InitChainer when the genesis app state flags an upgrade, i.e. when its
+// UpgradeGenesisKey entry is true. It is meant to run the store migrations of a
+// chain relaunched from an exported genesis and runs without gas limits.
+func (app *BaseApp) SetUpgradeInitChainer(initChainer sdk.InitChainer) {
+	if app.sealed {
+		panic("SetUpgradeInitChainer() on sealed BaseApp")
+	}
+	app.upgradeInitChainer = initChainer
+}
+
 func (app *BaseApp) SetBeginBlocker(beginBlocker sdk.BeginBlocker) {
 	if app.sealed {
 		panic("SetBeginBlocker() on sealed BaseApp")
@@ -143,3 +251,125 @@ func (app *BaseApp) SetRouter(router sdk.Router) {
 	}
 	app.router = router
 }
+
+// RegisterAppQueryHandler registers a handler for the "/app/<name>" query path.
+// It panics if the name is already registered or clashes with a built-in
+// "/app" query.
+func (app *BaseApp) RegisterAppQueryHandler(name string, handler AppQueryHandler) {
+	if app.sealed {
+		panic("RegisterAppQueryHandler() on sealed BaseApp")
+	}
+	if builtinAppQueries[name] {
+		panic(fmt.Sprintf("cannot override built-in app query: %s", name))
+	}
+	if _, ok := app.appQueries[name]; ok {
+		panic(fmt.Sprintf("app query %s has already been registered", name))
+	}
+
+	app.appQueries[name] = handler
+}
+
+// SetBlockRandomnessSeeder sets the function used in BeginBlock to derive the
+// block's randomness seed, which is then available to the BeginBlocker, the
+// DeliverTx handlers and the EndBlocker through BlockRandomnessSeed. Use
+// DefaultBlockRandomnessSeeder unless the app requires a custom derivation.
+func (app *BaseApp) SetBlockRandomnessSeeder(seeder BlockRandomnessSeeder) {
+	if app.sealed {
+		panic("SetBlockRandomnessSeeder() on sealed BaseApp")
+	}
+	app.randomnessSeeder = seeder
+}
+
+// SetABCITimingObserver sets an observer which is called at the end of Commit
+// with the time spent in BeginBlock, DeliverTx (summed over all txs), EndBlock
+// and Commit for the committed block. ABCI phases are not timed if no observer
+// is set.
+func (app *BaseApp) SetABCITimingObserver(observer ABCITimingObserver) {
+	if app.sealed {
+		panic("SetABCITimingObserver() on sealed BaseApp")
+	}
+	app.abciTimingObserver = observer
+}
+
+// SetQueryLatencyObserver sets an observer which is called after each custom
+// query with the route of the querier, e.g. "gov" for "custom/gov/proposal",
+// the time spent in the querier and its error. Queries failing before the
+// querier is called are not reported.
+func (app *BaseApp) SetQueryLatencyObserver(observer QueryLatencyObserver) {
+	if app.sealed {
+		panic("SetQueryLatencyObserver() on sealed BaseApp")
+	}
+	app.queryLatencyObserver = observer
+}
+
+// SetHaltPredicate sets a predicate which is evaluated in Commit against the
+// newly committed state. The node halts, like with the halt height and halt
+// time, when it returns true. The predicate must only depend on state for all
+// nodes to halt at the same height; writes made by it are discarded.
+func (app *BaseApp) SetHaltPredicate(predicate func(ctx sdk.Context) bool) {
+	if app.sealed {
+		panic("SetHaltPredicate() on sealed BaseApp")
+	}
+	app.haltPredicate = predicate
+}
+
+// SetPreCommitHook sets a hook which is invoked in Commit against the state of
+// the block, right before it is written and committed, e.g. to enforce
+// invariants. If the hook returns an error, Commit panics and the node halts
+// without committing the block, as committing a broken state is worse than
+// halting consensus. Writes made by the hook are discarded.
+func (app *BaseApp) SetPreCommitHook(hook func(ctx sdk.Context) error) {
+	if app.sealed {
+		panic("SetPreCommitHook() on sealed BaseApp")
+	}
+	app.preCommitHook = hook
+}
+
+// SetPostCommitBarrier sets a callback which is invoked in Commit once the
+// block state has been written and the CommitMultiStore committed, with the
+// resulting commit ID. External processes sharing the backing database may
+// proceed once it fires. The callback blocks Commit until it returns.
+func (app *BaseApp) SetPostCommitBarrier(barrier func(commitID sdk.CommitID)) {
+	if app.sealed {
+		panic("SetPostCommitBarrier() on sealed BaseApp")
+	}
+	app.postCommitBarrier = barrier
+}
+
+// ValidatorUpdateTransformer transforms the validator updates returned by the
+// EndBlocker before they are handed to Tendermint.
+type ValidatorUpdateTransformer func(ctx sdk.Context, updates []abci.ValidatorUpdate) []abci.ValidatorUpdate
+
+// SetValidatorUpdateTransformer sets a transformer applied to the validator
+// updates of EndBlock, e.g. to cap the validator set churn per block. It runs
+// with the deliverState context and may read and write state, e.g. to queue
+// deferred updates. As the updates are part of consensus, the transformer
+// must be deterministic.
+func (app *BaseApp) SetValidatorUpdateTransformer(transformer ValidatorUpdateTransformer) {
+	if app.sealed {
+		panic("SetValidatorUpdateTransformer() on sealed BaseApp")
+	}
+	app.validatorUpdateTransformer = transformer
+}
+
+// SetHaltNotifier sets a callback which is invoked in Commit right before the
+// node halts due to the configured halt height, halt time or halt predicate.
+// The reason is one of HaltReasonHeight, HaltReasonTime or HaltReasonPredicate.
+func (app *BaseApp) SetHaltNotifier(notifier func(reason string, height int64, time int64)) {
+	if app.sealed {
+		panic("SetHaltNotifier() on sealed BaseApp")
+	}
+	app.haltNotifier = notifier
+}
+
+// SetPreHaltHook sets a hook which is invoked once when the node halts due to
+// the configured halt height, halt time or halt predicate, before the node is
+// signaled to shut down, e.g. to flush an export. It receives the height and
+// time of the last committed block. A failing hook is logged and the node
+// halts regardless.
+func (app *BaseApp) SetPreHaltHook(hook func(height int64, time int64) error) {
+	if app.sealed {
+		panic("SetPreHaltHook() on sealed BaseApp")
+	}
+	app.preHaltHook = hook
+}
@@ -0,0 +1,181 @@
+package baseapp
+
+import (
+	"sync"
+
+	abci "github.com/tendermint/tendermint/abci/types"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+)
+
+// TxConflictFunc reports whether two txs may access overlapping state, i.e.
+// whether either may read or write a key written by the other. Conflicts it
+// misses are detected when the txs are merged, at the cost of executing the
+// conflicting tx again.
+type TxConflictFunc func(a, b sdk.Tx) bool
+
+// parallelTx holds a tx of a DeliverTxBatch and its execution results.
+type parallelTx struct {
+	req   abci.RequestDeliverTx
+	tx    sdk.Tx
+	err   error // decoding error
+	ms    sdk.CacheMultiStore
+	gInfo sdk.GasInfo
+	res   *sdk.Result
+	rErr  error // execution error
+
+	access       *accessSet
+	gasBreakdown *GasBreakdown
+}
+
+// DeliverTxBatch delivers the txs of reqs in order and returns their responses.
+// It is equivalent to calling DeliverTx for each request, and does so unless
+// parallel execution is enabled.
+//
+// EXPERIMENTAL: With parallel execution enabled, the txs are split into
+// contiguous batches in which no two txs conflict according to the app's
+// TxConflictFunc. The txs of a batch are executed concurrently, each on its own
+// branch of the block state, and the branches are then written to the block
+// state in tx order. Conflicting txs are placed in different batches and hence
+// executed sequentially. The keys accessed by each tx are recorded, and a tx
+// which accessed a key written by an earlier tx of its batch is executed again
+// on top of the merged state before being written. Execution falls back to
+// DeliverTx when the block gas is limited or no AnteHandler is set, as the
+// block and tx gas meters would be shared between txs.
+func (app *BaseApp) DeliverTxBatch(reqs []abci.RequestDeliverTx) []abci.ResponseDeliverTx {
+	responses := make([]abci.ResponseDeliverTx, 0, len(reqs))
+
+	if app.txConflictFn == nil || app.anteHandler == nil || app.lastHeightErr != nil ||
+		app.deliverState.ctx.BlockGasMeter().Limit() != 0 {
+		for _, req := range reqs {
+			responses = append(responses, app.DeliverTx(req))
+		}
+		return responses
+	}
+
+	defer app.startABCITimer(&app.blockTimings.DeliverTx)()
+
+	txs := make([]*parallelTx, len(reqs))
+	for i, req := range reqs {
+		app.recordDeliverTx(req)
+
+		tx, err := app.decodeDeliverTx(req.Tx)
+		txs[i] = &parallelTx{req: req, tx: tx, err: err}
+	}
+
+	for _, batch := range app.scheduleTxs(txs) {
+		app.executeBatch(batch)
+
+		// keys written by the txs of the batch merged so far
+		written := newAccessSet()
+		for _, ptx := range batch {
+			if ptx.err != nil {
+				responses = append(responses, app.responseDeliverTx(ptx.err, 0, 0))
+				continue
+			}
+
+			// a tx which accessed a key written by an earlier tx of the batch
+			// ran on stale state, i.e. the TxConflictFunc missed a conflict,
+			// and is executed again on top of the merged state
+			if ptx.access.conflicts(written) {
+				app.runParallelTx(ptx, app.branchParallelTx(ptx))
+			}
+
+			responses = append(responses, app.mergeParallelTx(ptx))
+			written.addWrites(ptx.access)
+		}
+	}
+
+	return responses
+}
+
+// scheduleTxs splits txs into contiguous batches of txs which do not conflict
+// with each other. Txs which failed to decode do not touch state and never
+// conflict.
+func (app *BaseApp) scheduleTxs(txs []*parallelTx) [][]*parallelTx {
+	var (
+		batches [][]*parallelTx
+		batch   []*parallelTx
+	)
+
+	for _, ptx := range txs {
+		if ptx.err == nil {
+			for _, other := range batch {
+				if other.err == nil && app.txConflictFn(other.tx, ptx.tx) {
+					batches = append(batches, batch)
+					batch = nil
+					break
+				}
+			}
+		}
+
+		batch = append(batch, ptx)
+	}
+
+	if len(batch) > 0 {
+		batches = append(batches, batch)
+	}
+
+	return batches
+}
+
+// executeBatch executes the txs of batch concurrently, each on its own branch
+// of the block state. The branches are not written.
+func (app *BaseApp) executeBatch(batch []*parallelTx) {
+	var wg sync.WaitGroup
+
+	for _, ptx := range batch {
+		if ptx.err != nil {
+			continue
+		}
+
+		// branches are created before running the batch as the block state
+		// multi-store is not safe for concurrent cache wrapping
+		ctx := app.branchParallelTx(ptx)
+
+		wg.Add(1)
+		go func(ptx *parallelTx, ctx sdk.Context) {
+			defer wg.Done()
+			app.runParallelTx(ptx, ctx)
+		}(ptx, ctx)
+	}
+
+	wg.Wait()
+}
+
+// branchParallelTx creates a new branch of the block state for ptx, which
+// records the keys accessed by the tx, and returns the context to execute the
+// tx with.
+func (app *BaseApp) branchParallelTx(ptx *parallelTx) sdk.Context {
+	ptx.access = newAccessSet()
+	ptx.ms = newAccessTrackingMultiStore(app.deliverState.ms.CacheMultiStore(), ptx.access)
+	ptx.gasBreakdown = app.newGasBreakdown()
+
+	return app.getContextForTx(runTxModeDeliver, ptx.req.Tx).
+		WithMultiStore(ptx.ms).
+		WithEventManager(sdk.NewEventManager()).
+		WithBlockGasMeter(sdk.NewInfiniteGasMeter())
+}
+
+// runParallelTx executes ptx with the context of its branch.
+func (app *BaseApp) runParallelTx(ptx *parallelTx, ctx sdk.Context) {
+	ptx.gInfo, ptx.res, ptx.rErr = app.runTxWithGasBreakdown(
+		ctx, runTxModeDeliver, ptx.req.Tx, ptx.tx, ptx.gasBreakdown,
+	)
+}
+
+// mergeParallelTx writes the branch of an executed tx to the block state,
+// accounts its gas in the block gas meter and returns its response.
+func (app *BaseApp) mergeParallelTx(ptx *parallelTx) abci.ResponseDeliverTx {
+	// runTx only writes the AnteHandler changes and, on success, the message
+	// changes to the branch
+	ptx.ms.Write()
+
+	gasUsed := ptx.gInfo.GasUsed
+	if ptx.gInfo.GasWanted > 0 && gasUsed > ptx.gInfo.GasWanted {
+		gasUsed = ptx.gInfo.GasWanted
+	}
+	app.deliverState.ctx.BlockGasMeter().ConsumeGas(gasUsed, "block gas meter")
+
+	return app.deliverTxResponse(ptx.gInfo, ptx.res, ptx.rErr, ptx.gasBreakdown)
+}
@@ -0,0 +1,213 @@
+package baseapp
+
+import (
+	"bytes"
+	"io"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+)
+
+// keyRange is the domain [start, end) of an iterator. A nil start or end is
+// unbounded.
+type keyRange struct {
+	start, end []byte
+}
+
+func (r keyRange) contains(key []byte) bool {
+	return (r.start == nil || bytes.Compare(key, r.start) >= 0) &&
+		(r.end == nil || bytes.Compare(key, r.end) < 0)
+}
+
+// accessSet records the keys of each store read and written by a tx executed
+// in parallel, so that the conflicts missed by the app's TxConflictFunc are
+// detected before the tx branch is written.
+type accessSet struct {
+	reads  map[sdk.StoreKey]map[string]struct{}
+	ranges map[sdk.StoreKey][]keyRange
+	writes map[sdk.StoreKey]map[string]struct{}
+}
+
+func newAccessSet() *accessSet {
+	return &accessSet{
+		reads:  make(map[sdk.StoreKey]map[string]struct{}),
+		ranges: make(map[sdk.StoreKey][]keyRange),
+		writes: make(map[sdk.StoreKey]map[string]struct{}),
+	}
+}
+
+func addKey(keys map[sdk.StoreKey]map[string]struct{}, storeKey sdk.StoreKey, key []byte) {
+	if keys[storeKey] == nil {
+		keys[storeKey] = make(map[string]struct{})
+	}
+	keys[storeKey][string(key)] = struct{}{}
+}
+
+func (as *accessSet) read(storeKey sdk.StoreKey, key []byte) {
+	addKey(as.reads, storeKey, key)
+}
+
+func (as *accessSet) readRange(storeKey sdk.StoreKey, start, end []byte) {
+	// an empty bound is copied as nil, i.e. unbounded, which is conservative
+	as.ranges[storeKey] = append(as.ranges[storeKey], keyRange{
+		start: append([]byte(nil), start...),
+		end:   append([]byte(nil), end...),
+	})
+}
+
+func (as *accessSet) write(storeKey sdk.StoreKey, key []byte) {
+	addKey(as.writes, storeKey, key)
+}
+
+// addWrites adds the keys written by other to the keys written by as.
+func (as *accessSet) addWrites(other *accessSet) {
+	for storeKey, keys := range other.writes {
+		for key := range keys {
+			addKey(as.writes, storeKey, []byte(key))
+		}
+	}
+}
+
+// conflicts reports whether any key read or written by as was written by
+// other.
+func (as *accessSet) conflicts(other *accessSet) bool {
+	for storeKey, written := range other.writes {
+		for key := range written {
+			if _, ok := as.reads[storeKey][key]; ok {
+				return true
+			}
+			if _, ok := as.writes[storeKey][key]; ok {
+				return true
+			}
+			for _, r := range as.ranges[storeKey] {
+				if r.contains([]byte(key)) {
+					return true
+				}
+			}
+		}
+	}
+
+	return false
+}
+
+// accessTrackingMultiStore is a CacheMultiStore which records the keys
+// accessed through its KVStores, and those of its own cache wraps, in an
+// accessSet.
+type accessTrackingMultiStore struct {
+	parent sdk.CacheMultiStore
+	access *accessSet
+}
+
+var _ sdk.CacheMultiStore = accessTrackingMultiStore{}
+
+func newAccessTrackingMultiStore(parent sdk.CacheMultiStore, access *accessSet) accessTrackingMultiStore {
+	return accessTrackingMultiStore{parent: parent, access: access}
+}
+
+// GetStoreType implements sdk.Store.
+func (ms accessTrackingMultiStore) GetStoreType() sdk.StoreType {
+	return ms.parent.GetStoreType()
+}
+
+// CacheWrap implements sdk.CacheWrapper.
+func (ms accessTrackingMultiStore) CacheWrap() sdk.CacheWrap {
+	return ms.CacheMultiStore()
+}
+
+// CacheWrapWithTrace implements sdk.CacheWrapper.
+func (ms accessTrackingMultiStore) CacheWrapWithTrace(_ io.Writer, _ sdk.TraceContext) sdk.CacheWrap {
+	return ms.CacheWrap()
+}
+
+// CacheMultiStore implements sdk.MultiStore, tracking the accesses of the
+// returned cache wrap as well.
+func (ms accessTrackingMultiStore) CacheMultiStore() sdk.CacheMultiStore {
+	return newAccessTrackingMultiStore(ms.parent.CacheMultiStore(), ms.access)
+}
+
+// CacheMultiStoreWithVersion implements sdk.MultiStore.
+func (ms accessTrackingMultiStore) CacheMultiStoreWithVersion(version int64) (sdk.CacheMultiStore, error) {
+	return ms.parent.CacheMultiStoreWithVersion(version)
+}
+
+// GetStore implements sdk.MultiStore.
+func (ms accessTrackingMultiStore) GetStore(key sdk.StoreKey) sdk.Store {
+	store := ms.parent.GetStore(key)
+	if kvStore, ok := store.(sdk.KVStore); ok {
+		return accessTrackingKVStore{KVStore: kvStore, storeKey: key, access: ms.access}
+	}
+	return store
+}
+
+// GetKVStore implements sdk.MultiStore.
+func (ms accessTrackingMultiStore) GetKVStore(key sdk.StoreKey) sdk.KVStore {
+	return accessTrackingKVStore{KVStore: ms.parent.GetKVStore(key), storeKey: key, access: ms.access}
+}
+
+// TracingEnabled implements sdk.MultiStore.
+func (ms accessTrackingMultiStore) TracingEnabled() bool {
+	return ms.parent.TracingEnabled()
+}
+
+// SetTracer implements sdk.MultiStore.
+func (ms accessTrackingMultiStore) SetTracer(w io.Writer) sdk.MultiStore {
+	ms.parent.SetTracer(w)
+	return ms
+}
+
+// SetTracingContext implements sdk.MultiStore.
+func (ms accessTrackingMultiStore) SetTracingContext(tc sdk.TraceContext) sdk.MultiStore {
+	ms.parent.SetTracingContext(tc)
+	return ms
+}
+
+// Write implements sdk.CacheMultiStore.
+func (ms accessTrackingMultiStore) Write() {
+	ms.parent.Write()
+}
+
+// accessTrackingKVStore is a KVStore which records the keys it accesses in an
+// accessSet.
+type accessTrackingKVStore struct {
+	sdk.KVStore
+
+	storeKey sdk.StoreKey
+	access   *accessSet
+}
+
+var _ sdk.KVStore = accessTrackingKVStore{}
+
+// Get implements sdk.KVStore.
+func (s accessTrackingKVStore) Get(key []byte) []byte {
+	s.access.read(s.storeKey, key)
+	return s.KVStore.Get(key)
+}
+
+// Has implements sdk.KVStore.
+func (s accessTrackingKVStore) Has(key []byte) bool {
+	s.access.read(s.storeKey, key)
+	return s.KVStore.Has(key)
+}
+
+// Set implements sdk.KVStore.
+func (s accessTrackingKVStore) Set(key, value []byte) {
+	s.access.write(s.storeKey, key)
+	s.KVStore.Set(key, value)
+}
+
+// Delete implements sdk.KVStore.
+func (s accessTrackingKVStore) Delete(key []byte) {
+	s.access.write(s.storeKey, key)
+	s.KVStore.Delete(key)
+}
+
+// Iterator implements sdk.KVStore.
+func (s accessTrackingKVStore) Iterator(start, end []byte) sdk.Iterator {
+	s.access.readRange(s.storeKey, start, end)
+	return s.KVStore.Iterator(start, end)
+}
+
+// ReverseIterator implements sdk.KVStore.
+func (s accessTrackingKVStore) ReverseIterator(start, end []byte) sdk.Iterator {
+	s.access.readRange(s.storeKey, start, end)
+	return s.KVStore.ReverseIterator(start, end)
+}
@@ -0,0 +1,43 @@
+package baseapp
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+
+	abci "github.com/tendermint/tendermint/abci/types"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+)
+
+// BlockRandomnessSeeder derives a seed from the data of the block being
+// executed. It must be a pure function of the request so that all honest nodes
+// compute the same seed.
+type BlockRandomnessSeeder func(req abci.RequestBeginBlock) []byte
+
+type blockRandomnessSeedKey struct{}
+
+// DefaultBlockRandomnessSeeder returns the SHA-256 hash of the block hash, the
+// big endian encoded block height and the proposer address.
+//
+// NOTE: The seed is derived from public block data and can be computed, and to
+// some extent influenced by the proposer, before the block is executed. It must
+// not be used where cryptographically unpredictable randomness is required.
+func DefaultBlockRandomnessSeeder(req abci.RequestBeginBlock) []byte {
+	heightBz := make([]byte, 8)
+	binary.BigEndian.PutUint64(heightBz, uint64(req.Header.Height))
+
+	h := sha256.New()
+	h.Write(req.Hash)
+	h.Write(heightBz)
+	h.Write(req.Header.ProposerAddress)
+
+	return h.Sum(nil)
+}
+
+// BlockRandomnessSeed returns the seed of the current block computed by the
+// BlockRandomnessSeeder set on the BaseApp. It returns nil if no seeder is set
+// or outside of block execution.
+func BlockRandomnessSeed(ctx sdk.Context) []byte {
+	seed, _ := ctx.Context().Value(blockRandomnessSeedKey{}).([]byte)
+	return seed
+}
@@ -0,0 +1,80 @@
+package baseapp
+
+import (
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync"
+)
+
+// ErrNoRecoveredPanic is returned by GetLastRecoveredPanic if no panic has been
+// recovered since the BaseApp was created or the last reset.
+var ErrNoRecoveredPanic = errors.New("no recovered panic")
+
+// RecoveredPanic is a panic recovered from a handler rather than crashing the
+// node, along with the stack of the panicking goroutine.
+type RecoveredPanic struct {
+	Message string `json:"message"`
+	Stack   string `json:"stack"`
+}
+
+// String returns the message and stack of the panic.
+func (p RecoveredPanic) String() string {
+	return fmt.Sprintf("recovered: %s\nstack:\n%s", p.Message, p.Stack)
+}
+
+// panicRecorder holds the last recovered panic. It is guarded by a mutex as
+// panics may be recovered while serving queries concurrently with block
+// execution.
+type panicRecorder struct {
+	mtx  sync.RWMutex
+	last *RecoveredPanic
+}
+
+// record stores r as the last recovered panic. It must be called from the
+// deferred function which recovered r for the stack to be the one of the panic.
+func (pr *panicRecorder) record(r interface{}) {
+	p := &RecoveredPanic{
+		Message: fmt.Sprintf("%v", r),
+		Stack:   string(debug.Stack()),
+	}
+
+	pr.mtx.Lock()
+	pr.last = p
+	pr.mtx.Unlock()
+}
+
+func (pr *panicRecorder) get() (RecoveredPanic, bool) {
+	pr.mtx.RLock()
+	defer pr.mtx.RUnlock()
+
+	if pr.last == nil {
+		return RecoveredPanic{}, false
+	}
+
+	return *pr.last, true
+}
+
+func (pr *panicRecorder) reset() {
+	pr.mtx.Lock()
+	pr.last = nil
+	pr.mtx.Unlock()
+}
+
+// GetLastRecoveredPanic returns the message and stack of the last panic
+// recovered while executing a tx or serving a simulation or trace query. It
+// returns ErrNoRecoveredPanic if there is none. The same panic is served by the
+// "/app/last-panic" query.
+func (app *BaseApp) GetLastRecoveredPanic() (string, error) {
+	p, ok := app.lastPanic.get()
+	if !ok {
+		return "", ErrNoRecoveredPanic
+	}
+
+	return p.String(), nil
+}
+
+// ResetLastRecoveredPanic clears the last recovered panic.
+func (app *BaseApp) ResetLastRecoveredPanic() {
+	app.lastPanic.reset()
+}
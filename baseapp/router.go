@@ -2,15 +2,26 @@ package baseapp
 
 import (
 	"fmt"
+	"sort"
 
 	sdk "github.com/cosmos/cosmos-sdk/types"
 )
 
+// RouteLister is implemented by routers able to list their routes. Routers set
+// via SetRouter which do not implement it cannot serve the "/app/msg-routes"
+// query.
+type RouteLister interface {
+	Routes() []string
+}
+
 type Router struct {
 	routes map[string]sdk.Handler
 }
 
-var _ sdk.Router = NewRouter()
+var (
+	_ sdk.Router  = NewRouter()
+	_ RouteLister = NewRouter()
+)
 
 // NewRouter returns a reference to a new router.
 func NewRouter() *Router {
@@ -39,3 +50,14 @@ func (rtr *Router) AddRoute(path string, h sdk.Handler) sdk.Router {
 func (rtr *Router) Route(_ sdk.Context, path string) sdk.Handler {
 	return rtr.routes[path]
 }
+
+// Routes returns the registered route paths in sorted order.
+func (rtr *Router) Routes() []string {
+	routes := make([]string, 0, len(rtr.routes))
+	for path := range rtr.routes {
+		routes = append(routes, path)
+	}
+
+	sort.Strings(routes)
+	return routes
+}
@@ -29,3 +29,12 @@ func TestRouter(t *testing.T) {
 		rtr.AddRoute("testRoute", testHandler)
 	})
 }
+
+func TestRouterRoutes(t *testing.T) {
+	rtr := NewRouter()
+	require.Empty(t, rtr.Routes())
+
+	rtr.AddRoute("routeB", testHandler)
+	rtr.AddRoute("routeA", testHandler)
+	require.Equal(t, []string{"routeA", "routeB"}, rtr.Routes())
+}
@@ -0,0 +1,77 @@
+package baseapp
+
+import (
+	"fmt"
+
+	abci "github.com/tendermint/tendermint/abci/types"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	sdkerrors "github.com/cosmos/cosmos-sdk/types/errors"
+)
+
+// OptionKeyMinGasPrices is the key of the built-in SetOption handler updating
+// the minimum gas prices, e.g. "0.025uatom".
+const OptionKeyMinGasPrices = "minimum-gas-prices"
+
+// SetOptionHandler applies the value of an option set through the ABCI
+// SetOption method. The returned string is reported as the response info.
+type SetOptionHandler func(key, value string) (string, error)
+
+// RegisterOptionHandler registers the handler of the options set through the
+// ABCI SetOption method with the given key. It panics if a handler is already
+// registered for the key, including the built-in OptionKeyMinGasPrices.
+func (app *BaseApp) RegisterOptionHandler(key string, handler SetOptionHandler) {
+	if app.sealed {
+		panic("RegisterOptionHandler() on sealed BaseApp")
+	}
+
+	if key == OptionKeyMinGasPrices || app.optionHandlers[key] != nil {
+		panic(fmt.Sprintf("option handler for key %s already registered", key))
+	}
+
+	if app.optionHandlers == nil {
+		app.optionHandlers = make(map[string]SetOptionHandler)
+	}
+	app.optionHandlers[key] = handler
+}
+
+// SetOption implements the ABCI interface. It dispatches the option to the
+// handler registered for its key.
+func (app *BaseApp) SetOption(req abci.RequestSetOption) abci.ResponseSetOption {
+	handler := app.optionHandlers[req.Key]
+	if req.Key == OptionKeyMinGasPrices {
+		handler = app.setMinGasPricesOption
+	}
+
+	if handler == nil {
+		return responseSetOption(sdkerrors.Wrapf(sdkerrors.ErrUnknownRequest, "unknown option: %s", req.Key))
+	}
+
+	info, err := handler(req.Key, req.Value)
+	if err != nil {
+		return responseSetOption(err)
+	}
+
+	return abci.ResponseSetOption{Info: info}
+}
+
+// setMinGasPricesOption updates the minimum gas prices, which apply to the txs
+// checked from then on.
+func (app *BaseApp) setMinGasPricesOption(_, value string) (string, error) {
+	gasPrices, err := sdk.ParseDecCoins(value)
+	if err != nil {
+		return "", sdkerrors.Wrapf(sdkerrors.ErrInvalidRequest, "invalid minimum gas prices: %s", err)
+	}
+
+	app.setMinGasPrices(gasPrices)
+	if app.checkState != nil {
+		app.checkState.ctx = app.checkState.ctx.WithMinGasPrices(gasPrices)
+	}
+
+	return fmt.Sprintf("minimum gas prices set to %s", gasPrices), nil
+}
+
+func responseSetOption(err error) abci.ResponseSetOption {
+	_, code, log := sdkerrors.ABCIInfo(err, false)
+	return abci.ResponseSetOption{Code: code, Log: log}
+}
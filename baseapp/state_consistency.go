@@ -0,0 +1,76 @@
+package baseapp
+
+import (
+	"bytes"
+	"fmt"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+)
+
+// checkedValue is the value of a sampled key in the checkState before Commit.
+type checkedValue struct {
+	storeKey sdk.StoreKey
+	key      []byte
+	value    []byte
+}
+
+// SetStateConsistencyCheck enables a diagnostic comparing, on Commit, the
+// checkState values of the given keys with the values committed by the block.
+// A warning is logged for every key written by CheckTx whose value differs
+// from the committed one, which hints at CheckTx and DeliverTx logic diverging.
+//
+// The check is heuristic: txs checked but not included in the block, or
+// included in a different order, legitimately cause differences, hence it
+// should only be relied upon on networks where all checked txs are expected
+// to be committed in the next block. Keys not written by CheckTx are not
+// checked.
+func (app *BaseApp) SetStateConsistencyCheck(keys map[sdk.StoreKey][][]byte) {
+	if app.sealed {
+		panic("SetStateConsistencyCheck() on sealed BaseApp")
+	}
+	app.consistencyCheckKeys = keys
+}
+
+// sampleCheckState returns the checkState values of the sampled keys which
+// differ from the last committed state, i.e. the ones written by CheckTx. It
+// must be called before the deliverState is written.
+func (app *BaseApp) sampleCheckState() []checkedValue {
+	if len(app.consistencyCheckKeys) == 0 || app.checkState == nil {
+		return nil
+	}
+
+	var checked []checkedValue
+	for storeKey, keys := range app.consistencyCheckKeys {
+		checkStore := app.checkState.ms.GetKVStore(storeKey)
+		committedStore := app.cms.GetKVStore(storeKey)
+
+		for _, key := range keys {
+			value := checkStore.Get(key)
+			if !bytes.Equal(value, committedStore.Get(key)) {
+				checked = append(checked, checkedValue{storeKey: storeKey, key: key, value: value})
+			}
+		}
+	}
+
+	return checked
+}
+
+// checkStateConsistency logs a warning for every checked value differing from
+// the value committed at the given height.
+func (app *BaseApp) checkStateConsistency(height int64, checked []checkedValue) {
+	for _, cv := range checked {
+		committed := app.cms.GetKVStore(cv.storeKey).Get(cv.key)
+		if bytes.Equal(cv.value, committed) {
+			continue
+		}
+
+		app.logger.Error(
+			"checkState diverged from committed state",
+			"height", height,
+			"store", cv.storeKey.Name(),
+			"key", fmt.Sprintf("%X", cv.key),
+			"checked", fmt.Sprintf("%X", cv.value),
+			"committed", fmt.Sprintf("%X", committed),
+		)
+	}
+}
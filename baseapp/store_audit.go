@@ -0,0 +1,78 @@
+package baseapp
+
+import (
+	"io"
+
+	"github.com/cosmos/cosmos-sdk/store/cachekv"
+	"github.com/cosmos/cosmos-sdk/store/tracekv"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+)
+
+// StoreWriteAuditor is called for every key written to an audited store. A nil
+// value denotes a deletion.
+type StoreWriteAuditor func(store string, key, value []byte, height int64)
+
+// auditKVStore is the parent of the deliverState cache of an audited store. As
+// the cache is only written on Commit, it observes the committed writes of a
+// block only, once per key with its final value.
+type auditKVStore struct {
+	sdk.KVStore
+
+	name    string
+	height  func() int64
+	auditor StoreWriteAuditor
+}
+
+func (s auditKVStore) Set(key, value []byte) {
+	s.KVStore.Set(key, value)
+	s.auditor(s.name, key, value, s.height())
+}
+
+func (s auditKVStore) Delete(key []byte) {
+	s.KVStore.Delete(key)
+	s.auditor(s.name, key, nil, s.height())
+}
+
+// CacheWrap wraps the audit store itself rather than its parent so that writes
+// of the cache go through the audit store.
+func (s auditKVStore) CacheWrap() sdk.CacheWrap {
+	return cachekv.NewStore(s)
+}
+
+func (s auditKVStore) CacheWrapWithTrace(w io.Writer, tc sdk.TraceContext) sdk.CacheWrap {
+	return cachekv.NewStore(tracekv.NewStore(s, w, tc))
+}
+
+// auditedCacheMultiStore returns a cache of the CommitMultiStore in which the
+// audited stores write through an auditKVStore.
+func (app *BaseApp) auditedCacheMultiStore() sdk.CacheMultiStore {
+	return app.cms.CacheMultiStoreWithWrapper(func(key sdk.StoreKey, store sdk.KVStore) sdk.KVStore {
+		if !app.auditedStores[key.Name()] {
+			return store
+		}
+
+		return auditKVStore{
+			KVStore: store,
+			name:    key.Name(),
+			height:  func() int64 { return app.deliverState.ctx.BlockHeight() },
+			auditor: app.storeWriteAuditor,
+		}
+	})
+}
+
+// SetStoreWriteAuditor sets an auditor called for every key written to the
+// named stores by a block. The auditor is called on Commit, as the block state
+// is written, hence writes of failed txs and of blocks that are not committed
+// are never reported.
+func (app *BaseApp) SetStoreWriteAuditor(storeNames []string, auditor StoreWriteAuditor) {
+	if app.sealed {
+		panic("SetStoreWriteAuditor() on sealed BaseApp")
+	}
+
+	app.auditedStores = make(map[string]bool, len(storeNames))
+	for _, name := range storeNames {
+		app.auditedStores[name] = true
+	}
+
+	app.storeWriteAuditor = auditor
+}
@@ -0,0 +1,106 @@
+package baseapp
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	abci "github.com/tendermint/tendermint/abci/types"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	sdkerrors "github.com/cosmos/cosmos-sdk/types/errors"
+)
+
+// GenesisOpener opens the reader of a genesis app state, i.e. of a JSON object
+// mapping module names to their genesis state.
+type GenesisOpener func() (io.ReadCloser, error)
+
+// GenesisChunkHandler initializes the state of a module from its genesis state.
+// It is called in the order of the modules in the genesis app state.
+type GenesisChunkHandler func(ctx sdk.Context, module string, state json.RawMessage) error
+
+// SetStreamingGenesis makes InitChain read the genesis app state from the reader
+// returned by open rather than from the request, and decode it one module at a
+// time: handler is called with the genesis state of each module, hence only the
+// largest module state is held in memory at once. The InitChainer, if any, is
+// then called with an empty app state, i.e. the empty JSON object, to complete
+// the initialization, e.g. to return the genesis validators. The app state of
+// the request is ignored.
+func (app *BaseApp) SetStreamingGenesis(open GenesisOpener, handler GenesisChunkHandler) {
+	if app.sealed {
+		panic("SetStreamingGenesis() on sealed BaseApp")
+	}
+	app.genesisOpener = open
+	app.genesisChunkHandler = handler
+}
+
+// runStreamingGenesis streams the genesis app state to the chunk handler and
+// runs the InitChainer on the deliverState.
+func (app *BaseApp) runStreamingGenesis(req abci.RequestInitChain) abci.ResponseInitChain {
+	// add block gas meter for any genesis transactions (allow infinite gas)
+	app.deliverState.ctx = app.deliverState.ctx.WithBlockGasMeter(sdk.NewInfiniteGasMeter())
+
+	if err := app.streamGenesis(app.deliverState.ctx); err != nil {
+		panic(sdkerrors.Wrap(err, "failed to stream genesis app state"))
+	}
+
+	if app.initChainer == nil {
+		return abci.ResponseInitChain{}
+	}
+
+	req.AppStateBytes = []byte("{}")
+	return app.initChainer(app.deliverState.ctx, req)
+}
+
+// streamGenesis decodes the genesis app state module by module and passes the
+// state of each module to the chunk handler.
+func (app *BaseApp) streamGenesis(ctx sdk.Context) error {
+	r, err := app.genesisOpener()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	dec := json.NewDecoder(r)
+	if err := expectDelim(dec, '{'); err != nil {
+		return err
+	}
+
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+
+		module, ok := tok.(string)
+		if !ok {
+			return fmt.Errorf("unexpected token %v; expected module name", tok)
+		}
+
+		var state json.RawMessage
+		if err := dec.Decode(&state); err != nil {
+			return sdkerrors.Wrapf(err, "failed to decode genesis state of module %s", module)
+		}
+
+		if err := app.genesisChunkHandler(ctx, module, state); err != nil {
+			return sdkerrors.Wrapf(err, "failed to initialize module %s", module)
+		}
+	}
+
+	return expectDelim(dec, '}')
+}
+
+// expectDelim reads the next token of dec and returns an error if it is not the
+// delimiter d.
+func expectDelim(dec *json.Decoder, d json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+
+	if tok != d {
+		return fmt.Errorf("unexpected token %v; expected %v", tok, d)
+	}
+
+	return nil
+}
@@ -0,0 +1,108 @@
+package baseapp
+
+import (
+	"encoding/json"
+	"fmt"
+
+	abci "github.com/tendermint/tendermint/abci/types"
+
+	sdkerrors "github.com/cosmos/cosmos-sdk/types/errors"
+)
+
+// TxErrorDetails defines the structured error information returned in the Data
+// field of a failed ResponseDeliverTx when structured errors are enabled.
+type TxErrorDetails struct {
+	Codespace string `json:"codespace"`
+	Code      uint32 `json:"code"`
+	// Cause is the description of the registered error at the root of the
+	// error chain.
+	Cause string `json:"cause"`
+	// MsgIndex and MsgRoute identify the failing message, if the error was
+	// returned while executing a message.
+	MsgIndex *int   `json:"msg_index,omitempty"`
+	MsgRoute string `json:"msg_route,omitempty"`
+}
+
+// msgError annotates an error returned while executing a message with the
+// index and route of that message. It is transparent to the error chain.
+type msgError struct {
+	err      error
+	msgIndex int
+	msgRoute string
+}
+
+func (e *msgError) Error() string { return e.err.Error() }
+func (e *msgError) Cause() error  { return e.err }
+func (e *msgError) Unwrap() error { return e.err }
+
+func (e *msgError) Format(s fmt.State, verb rune) {
+	if f, ok := e.err.(fmt.Formatter); ok {
+		f.Format(s, verb)
+		return
+	}
+
+	fmt.Fprintf(s, fmt.Sprintf("%%%c", verb), e.err)
+}
+
+// wrapMsgError records the failing message on err if structured errors are
+// enabled, and returns err unchanged otherwise.
+func (app *BaseApp) wrapMsgError(err error, msgIndex int, msgRoute string) error {
+	if !app.structuredErrors {
+		return err
+	}
+
+	return &msgError{err: err, msgIndex: msgIndex, msgRoute: msgRoute}
+}
+
+// newTxErrorDetails builds the structured details of err by walking its error
+// chain. Errors that are not registered ABCI errors are reported as internal
+// errors, as in the flat log.
+func newTxErrorDetails(err error) TxErrorDetails {
+	space, code, log := sdkerrors.ABCIInfo(err, false)
+	details := TxErrorDetails{Codespace: space, Code: code, Cause: log}
+	redacted := sdkerrors.Redact(err) != err
+
+	for cur := err; cur != nil; {
+		switch e := cur.(type) {
+		case *msgError:
+			if details.MsgIndex == nil {
+				msgIndex := e.msgIndex
+				details.MsgIndex, details.MsgRoute = &msgIndex, e.msgRoute
+			}
+
+		case *sdkerrors.Error:
+			if !redacted {
+				details.Cause = e.Error()
+			}
+		}
+
+		c, ok := cur.(interface{ Cause() error })
+		if !ok {
+			break
+		}
+		cur = c.Cause()
+	}
+
+	return details
+}
+
+// responseDeliverTx returns the ResponseDeliverTx for a failed tx, including
+// the structured error details in Data if structured errors are enabled. The
+// tx is accounted in the block summary.
+func (app *BaseApp) responseDeliverTx(err error, gasWanted, gasUsed uint64) abci.ResponseDeliverTx {
+	app.recordBlockSummaryTx(gasUsed)
+
+	res := sdkerrors.ResponseDeliverTx(err, gasWanted, gasUsed)
+	if !app.structuredErrors {
+		return res
+	}
+
+	bz, mErr := json.Marshal(newTxErrorDetails(err))
+	if mErr != nil {
+		app.logger.Error("failed to encode structured error details", "err", mErr)
+		return res
+	}
+
+	res.Data = bz
+	return res
+}
@@ -0,0 +1,65 @@
+package baseapp
+
+import (
+	"crypto/sha256"
+	"fmt"
+
+	lru "github.com/hashicorp/golang-lru"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+)
+
+// decodeTx decodes the tx of a CheckTx request. When the tx cache is enabled,
+// the decoded tx is looked up by the SHA-256 hash of txBytes first and cached
+// on a miss, so that rechecking or delivering the tx does not decode it again.
+// Txs failing to decode are not cached.
+func (app *BaseApp) decodeTx(txBytes []byte) (sdk.Tx, error) {
+	if app.txCache == nil {
+		return app.txDecoder(txBytes)
+	}
+
+	key := sha256.Sum256(txBytes)
+	if tx, ok := app.txCache.Get(key); ok {
+		return tx.(sdk.Tx), nil
+	}
+
+	tx, err := app.txDecoder(txBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	app.txCache.Add(key, tx)
+
+	return tx, nil
+}
+
+// decodeDeliverTx decodes the tx of a DeliverTx request like decodeTx, but
+// evicts the tx from the cache instead of caching it: a delivered tx leaves
+// the mempool and is not checked again.
+func (app *BaseApp) decodeDeliverTx(txBytes []byte) (sdk.Tx, error) {
+	if app.txCache == nil {
+		return app.txDecoder(txBytes)
+	}
+
+	key := sha256.Sum256(txBytes)
+	if tx, ok := app.txCache.Get(key); ok {
+		app.txCache.Remove(key)
+		return tx.(sdk.Tx), nil
+	}
+
+	return app.txDecoder(txBytes)
+}
+
+func (app *BaseApp) setTxCacheSize(n int) {
+	if n <= 0 {
+		app.txCache = nil
+		return
+	}
+
+	cache, err := lru.New(n)
+	if err != nil {
+		panic(fmt.Errorf("failed to create tx cache: %s", err))
+	}
+
+	app.txCache = cache
+}
@@ -0,0 +1,56 @@
+package baseapp
+
+import (
+	"encoding/json"
+	"time"
+
+	abci "github.com/tendermint/tendermint/abci/types"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+)
+
+// UpgradeGenesisKey is the top-level app state key flagging a genesis exported
+// from a previous chain as part of an upgrade. If it is set to true and an
+// upgrade InitChainer is set, InitChain runs the upgrade InitChainer instead of
+// the regular one.
+const UpgradeGenesisKey = "upgrade_genesis"
+
+// isUpgradeGenesis returns whether the app state is flagged as an upgrade
+// genesis. Malformed app state is not considered an upgrade genesis and is left
+// for the InitChainer to reject.
+func isUpgradeGenesis(appState []byte) bool {
+	var state map[string]json.RawMessage
+	if err := json.Unmarshal(appState, &state); err != nil {
+		return false
+	}
+
+	var upgrade bool
+	if raw, ok := state[UpgradeGenesisKey]; !ok || json.Unmarshal(raw, &upgrade) != nil {
+		return false
+	}
+
+	return upgrade
+}
+
+// runUpgradeInitChainer runs the upgrade InitChainer on the deliverState. Store
+// migrations may be expensive, hence neither the block nor the tx gas meter is
+// limited. The unlimited gas meters and the logger are scoped to the migration
+// and not kept on the deliverState.
+func (app *BaseApp) runUpgradeInitChainer(req abci.RequestInitChain) abci.ResponseInitChain {
+	logger := app.logger.With("module", "upgrade-init")
+	ctx := app.deliverState.ctx.
+		WithBlockGasMeter(sdk.NewInfiniteGasMeter()).
+		WithGasMeter(sdk.NewInfiniteGasMeter()).
+		WithLogger(logger)
+
+	logger.Info("running upgrade InitChainer", "chain-id", req.ChainId)
+	start := time.Now()
+
+	res := app.upgradeInitChainer(ctx, req)
+
+	logger.Info(
+		"upgrade InitChainer finished", "duration", time.Since(start).String(), "validators", len(res.Validators),
+	)
+
+	return res
+}
@@ -14,6 +14,7 @@ import (
 	rpcclient "github.com/tendermint/tendermint/rpc/client"
 	tmtypes "github.com/tendermint/tendermint/types"
 
+	"github.com/cosmos/cosmos-sdk/codec"
 	"github.com/cosmos/cosmos-sdk/store/rootmulti"
 	sdk "github.com/cosmos/cosmos-sdk/types"
 )
@@ -176,7 +177,18 @@ func (ctx CLIContext) verifyProof(queryPath string, resp abci.ResponseQuery) err
 		}
 		return nil
 	}
-	err = prt.VerifyValue(resp.Proof, commit.Header.AppHash, kp.String(), resp.Value)
+
+	// the proof of a key-with-version query proves the raw value
+	value := resp.Value
+	if strings.HasSuffix(queryPath, "/key-with-version") {
+		var vv sdk.VersionedValue
+		if err := codec.Cdc.UnmarshalBinaryBare(resp.Value, &vv); err != nil {
+			return errors.Wrap(err, "failed to decode versioned value")
+		}
+		value = vv.Value
+	}
+
+	err = prt.VerifyValue(resp.Proof, commit.Header.AppHash, kp.String(), value)
 	if err != nil {
 		return errors.Wrap(err, "failed to prove merkle proof")
 	}
@@ -193,7 +205,8 @@ func (ctx CLIContext) queryStore(key tmbytes.HexBytes, storeName, endPath string
 }
 
 // isQueryStoreWithProof expects a format like /<queryType>/<storeName>/<subpath>
-// queryType must be "store" and subpath must be "key" to require a proof.
+// queryType must be "store" and subpath must be "key" or "key-with-version" to
+// require a proof.
 func isQueryStoreWithProof(path string) bool {
 	if !strings.HasPrefix(path, "/") {
 		return false
@@ -212,7 +225,8 @@ func isQueryStoreWithProof(path string) bool {
 	return false
 }
 
-// parseQueryStorePath expects a format like /store/<storeName>/key.
+// parseQueryStorePath expects a format like /store/<storeName>/key or
+// /store/<storeName>/key-with-version.
 func parseQueryStorePath(path string) (storeName string, err error) {
 	if !strings.HasPrefix(path, "/") {
 		return "", errors.New("expected path to start with /")
@@ -224,7 +238,7 @@ func parseQueryStorePath(path string) (storeName string, err error) {
 		return "", errors.New("expected format like /store/<storeName>/key")
 	case paths[0] != "store":
 		return "", errors.New("expected format like /store/<storeName>/key")
-	case paths[2] != "key":
+	case paths[2] != "key" && paths[2] != "key-with-version":
 		return "", errors.New("expected format like /store/<storeName>/key")
 	}
 
@@ -2,11 +2,9 @@ package keys
 
 import (
 	"bufio"
-	"bytes"
 	"errors"
 	"fmt"
 	"io"
-	"sort"
 
 	bip39 "github.com/cosmos/go-bip39"
 
@@ -19,7 +17,6 @@ import (
 	"github.com/spf13/viper"
 
 	"github.com/tendermint/tendermint/crypto"
-	"github.com/tendermint/tendermint/crypto/multisig"
 	"github.com/tendermint/tendermint/libs/cli"
 )
 
@@ -154,14 +151,7 @@ func RunAddCmd(cmd *cobra.Command, args []string, kb keyring.Keybase, inBuf *buf
 			}
 
 			// Handle --nosort
-			if !viper.GetBool(flagNoSort) {
-				sort.Slice(pks, func(i, j int) bool {
-					return bytes.Compare(pks[i].Address(), pks[j].Address()) < 0
-				})
-			}
-
-			pk := multisig.NewPubKeyMultisigThreshold(multisigThreshold, pks)
-			if _, err := kb.CreateMulti(name, pk); err != nil {
+			if _, err := kb.CreateMultisig(name, multisigThreshold, pks, viper.GetBool(flagNoSort)); err != nil {
 				return err
 			}
 
@@ -1,8 +1,10 @@
 package crypto
 
 import (
+	"encoding/base64"
 	"encoding/hex"
 	"fmt"
+	"strconv"
 
 	"github.com/tendermint/crypto/bcrypt"
 
@@ -23,6 +25,15 @@ const (
 
 	headerVersion = "version"
 	headerType    = "type"
+
+	// headerBcryptCost is the armor header of the bcrypt cost an armored private
+	// key was encrypted with. Armors without it were encrypted with the cost of
+	// BcryptSecurityParameter.
+	headerBcryptCost = "cost"
+
+	// MinBcryptCost and MaxBcryptCost bound the supported bcrypt costs.
+	MinBcryptCost = 4
+	MaxBcryptCost = 31
 )
 
 // Make bcrypt security parameter var, so it can be changed within the lcd test
@@ -119,10 +130,27 @@ func unarmorBytes(armorStr, blockType string) (bz []byte, header map[string]stri
 
 // Encrypt and armor the private key.
 func EncryptArmorPrivKey(privKey crypto.PrivKey, passphrase string, algo string) string {
-	saltBytes, encBytes := encryptPrivKey(privKey, passphrase)
+	return EncryptArmorPrivKeyWithCost(privKey, passphrase, algo, BcryptSecurityParameter)
+}
+
+// EncryptArmorPrivKeyWithCost encrypts and armors the private key like
+// EncryptArmorPrivKey, deriving the encryption key with the given bcrypt cost.
+// The cost is recorded in the armor header for UnarmorDecryptPrivKey to use.
+// Each increment doubles the work factor; costs below the default of
+// BcryptSecurityParameter should only be used in tests. Costs below
+// MinBcryptCost are replaced as defined by EffectiveBcryptCost. It panics if
+// the cost exceeds MaxBcryptCost.
+func EncryptArmorPrivKeyWithCost(privKey crypto.PrivKey, passphrase string, algo string, cost int) string {
+	if cost > MaxBcryptCost {
+		panic(fmt.Errorf("invalid bcrypt cost: %d", cost))
+	}
+	cost = EffectiveBcryptCost(cost)
+
+	saltBytes, encBytes := encryptPrivKey(privKey, passphrase, cost)
 	header := map[string]string{
-		"kdf":  "bcrypt",
-		"salt": fmt.Sprintf("%X", saltBytes),
+		"kdf":            "bcrypt",
+		"salt":           fmt.Sprintf("%X", saltBytes),
+		headerBcryptCost: strconv.Itoa(cost),
 	}
 	if algo != "" {
 		header[headerType] = algo
@@ -131,12 +159,23 @@ func EncryptArmorPrivKey(privKey crypto.PrivKey, passphrase string, algo string)
 	return armorStr
 }
 
+// EffectiveBcryptCost returns the cost bcrypt derives keys with when given
+// cost: like bcrypt, costs below MinBcryptCost are replaced by its default
+// cost.
+func EffectiveBcryptCost(cost int) int {
+	if cost < MinBcryptCost {
+		return bcrypt.DefaultCost
+	}
+
+	return cost
+}
+
 // encrypt the given privKey with the passphrase using a randomly
 // generated salt and the xsalsa20 cipher. returns the salt and the
 // encrypted priv key.
-func encryptPrivKey(privKey crypto.PrivKey, passphrase string) (saltBytes []byte, encBytes []byte) {
+func encryptPrivKey(privKey crypto.PrivKey, passphrase string, cost int) (saltBytes []byte, encBytes []byte) {
 	saltBytes = crypto.CRandBytes(16)
-	key, err := bcrypt.GenerateFromPassword(saltBytes, []byte(passphrase), BcryptSecurityParameter)
+	key, err := bcrypt.GenerateFromPassword(saltBytes, []byte(passphrase), cost)
 	if err != nil {
 		panic(sdkerrors.Wrap(err, "error generating bcrypt key from passphrase"))
 	}
@@ -164,7 +203,14 @@ func UnarmorDecryptPrivKey(armorStr string, passphrase string) (privKey crypto.P
 	if err != nil {
 		return privKey, "", fmt.Errorf("error decoding salt: %v", err.Error())
 	}
-	privKey, err = decryptPrivKey(saltBytes, encBytes, passphrase)
+	cost := BcryptSecurityParameter
+	if header[headerBcryptCost] != "" {
+		cost, err = strconv.Atoi(header[headerBcryptCost])
+		if err != nil || cost < MinBcryptCost || cost > MaxBcryptCost {
+			return privKey, "", fmt.Errorf("invalid bcrypt cost: %v", header[headerBcryptCost])
+		}
+	}
+	privKey, err = decryptPrivKey(saltBytes, encBytes, passphrase, cost)
 
 	if header[headerType] == "" {
 		header[headerType] = defaultAlgo
@@ -172,8 +218,8 @@ func UnarmorDecryptPrivKey(armorStr string, passphrase string) (privKey crypto.P
 	return privKey, header[headerType], err
 }
 
-func decryptPrivKey(saltBytes []byte, encBytes []byte, passphrase string) (privKey crypto.PrivKey, err error) {
-	key, err := bcrypt.GenerateFromPassword(saltBytes, []byte(passphrase), BcryptSecurityParameter)
+func decryptPrivKey(saltBytes []byte, encBytes []byte, passphrase string, cost int) (privKey crypto.PrivKey, err error) {
+	key, err := bcrypt.GenerateFromPassword(saltBytes, []byte(passphrase), cost)
 	if err != nil {
 		return privKey, sdkerrors.Wrap(err, "error generating bcrypt key from passphrase")
 	}
@@ -187,3 +233,102 @@ func decryptPrivKey(saltBytes []byte, encBytes []byte, passphrase string) (privK
 	privKey, err = cryptoAmino.PrivKeyFromBytes(privKeyBytes)
 	return privKey, err
 }
+
+//-----------------------------------------------------------------
+// compact encryption
+
+// compactPrivKeyVersion is the version byte of compact encrypted private keys.
+// Version 1 keys have no cost byte and were encrypted with the bcrypt cost of
+// BcryptSecurityParameter.
+const (
+	compactPrivKeyVersion       = 2
+	compactPrivKeyVersionNoCost = 1
+)
+
+const compactSaltLen = 16
+
+// EncryptCompactPrivKey encrypts privKey with passphrase like EncryptArmorPrivKey
+// but encodes the result as a dense unpadded base64url string fitting a single
+// QR code:
+//
+//	base64url(version (1) || cost (1) || len(algo) (1) || algo || salt (16) || ciphertext)
+//
+// A secp256k1 key encodes to 140 characters, which fits a version 8 QR code in
+// byte mode with medium error correction. Keys with a longer amino encoding
+// grow accordingly; a single QR code holds at most 2953 bytes.
+func EncryptCompactPrivKey(privKey crypto.PrivKey, passphrase string, algo string) string {
+	return EncryptCompactPrivKeyWithCost(privKey, passphrase, algo, BcryptSecurityParameter)
+}
+
+// EncryptCompactPrivKeyWithCost encrypts privKey like EncryptCompactPrivKey,
+// deriving the encryption key with the given bcrypt cost, which is recorded for
+// DecryptCompactPrivKey to use. Costs are handled as by
+// EncryptArmorPrivKeyWithCost.
+func EncryptCompactPrivKeyWithCost(privKey crypto.PrivKey, passphrase string, algo string, cost int) string {
+	if cost > MaxBcryptCost {
+		panic(fmt.Errorf("invalid bcrypt cost: %d", cost))
+	}
+	cost = EffectiveBcryptCost(cost)
+
+	saltBytes, encBytes := encryptPrivKey(privKey, passphrase, cost)
+
+	bz := make([]byte, 0, 3+len(algo)+len(saltBytes)+len(encBytes))
+	bz = append(bz, compactPrivKeyVersion, byte(cost), byte(len(algo)))
+	bz = append(bz, algo...)
+	bz = append(bz, saltBytes...)
+	bz = append(bz, encBytes...)
+
+	return base64.RawURLEncoding.EncodeToString(bz)
+}
+
+// DecryptCompactPrivKey decrypts a private key encoded by EncryptCompactPrivKey
+// and returns it along with its algo.
+func DecryptCompactPrivKey(compact string, passphrase string) (privKey crypto.PrivKey, algo string, err error) {
+	bz, err := base64.RawURLEncoding.DecodeString(compact)
+	if err != nil {
+		return privKey, "", fmt.Errorf("error decoding compact private key: %v", err.Error())
+	}
+
+	if len(bz) < 1 {
+		return privKey, "", fmt.Errorf("unrecognized compact private key version")
+	}
+
+	cost := BcryptSecurityParameter
+	switch bz[0] {
+	case compactPrivKeyVersionNoCost:
+		bz = bz[1:]
+
+	case compactPrivKeyVersion:
+		if len(bz) < 2 {
+			return privKey, "", fmt.Errorf("compact private key too short")
+		}
+		cost = int(bz[1])
+		if cost < MinBcryptCost || cost > MaxBcryptCost {
+			return privKey, "", fmt.Errorf("invalid bcrypt cost: %d", cost)
+		}
+		bz = bz[2:]
+
+	default:
+		return privKey, "", fmt.Errorf("unrecognized compact private key version")
+	}
+
+	if len(bz) < 1 {
+		return privKey, "", fmt.Errorf("compact private key too short")
+	}
+
+	algoLen := int(bz[0])
+	bz = bz[1:]
+	if len(bz) < algoLen+compactSaltLen {
+		return privKey, "", fmt.Errorf("compact private key too short")
+	}
+
+	algo = string(bz[:algoLen])
+	saltBytes, encBytes := bz[algoLen:algoLen+compactSaltLen], bz[algoLen+compactSaltLen:]
+
+	privKey, err = decryptPrivKey(saltBytes, encBytes, passphrase, cost)
+	if algo == "" {
+		algo = defaultAlgo
+	}
+
+	return privKey, algo, err
+}
@@ -2,6 +2,7 @@ package crypto_test
 
 import (
 	"bytes"
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"io"
@@ -65,6 +66,101 @@ func TestArmorUnarmorPrivKey(t *testing.T) {
 	require.Equal(t, "unrecognized KDF type: wrong", err.Error())
 }
 
+func TestArmorUnarmorPrivKeyWithCost(t *testing.T) {
+	priv := secp256k1.GenPrivKey()
+
+	for _, cost := range []int{crypto.MinBcryptCost, 6} {
+		armored := crypto.EncryptArmorPrivKeyWithCost(priv, "passphrase", "", cost)
+		_, header, _, err := armor.DecodeArmor(armored)
+		require.NoError(t, err)
+		require.Equal(t, fmt.Sprintf("%d", cost), header["cost"])
+
+		decrypted, _, err := crypto.UnarmorDecryptPrivKey(armored, "passphrase")
+		require.NoError(t, err)
+		require.True(t, priv.Equals(decrypted))
+	}
+
+	require.Panics(t, func() {
+		crypto.EncryptArmorPrivKeyWithCost(priv, "passphrase", "", crypto.MaxBcryptCost+1)
+	})
+
+	// costs below the minimum are replaced by the bcrypt default, as bcrypt does
+	armored := crypto.EncryptArmorPrivKeyWithCost(priv, "passphrase", "", crypto.MinBcryptCost-1)
+	_, header, _, err := armor.DecodeArmor(armored)
+	require.NoError(t, err)
+	require.Equal(t, fmt.Sprintf("%d", crypto.EffectiveBcryptCost(crypto.MinBcryptCost-1)), header["cost"])
+	decrypted, _, err := crypto.UnarmorDecryptPrivKey(armored, "passphrase")
+	require.NoError(t, err)
+	require.True(t, priv.Equals(decrypted))
+
+	// the key cannot be decrypted with another cost
+	armored = crypto.EncryptArmorPrivKeyWithCost(priv, "passphrase", "", crypto.MinBcryptCost)
+	_, header, encBytes, err := armor.DecodeArmor(armored)
+	require.NoError(t, err)
+	header["cost"] = fmt.Sprintf("%d", crypto.MinBcryptCost+1)
+	_, _, err = crypto.UnarmorDecryptPrivKey(armor.EncodeArmor("TENDERMINT PRIVATE KEY", header, encBytes), "passphrase")
+	require.Error(t, err)
+
+	header["cost"] = "invalid"
+	_, _, err = crypto.UnarmorDecryptPrivKey(armor.EncodeArmor("TENDERMINT PRIVATE KEY", header, encBytes), "passphrase")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "invalid bcrypt cost")
+}
+
+func TestEncryptDecryptCompactPrivKey(t *testing.T) {
+	priv := secp256k1.GenPrivKey()
+	compact := crypto.EncryptCompactPrivKey(priv, "passphrase", "")
+
+	_, _, err := crypto.DecryptCompactPrivKey(compact, "wrongpassphrase")
+	require.Error(t, err)
+
+	decrypted, algo, err := crypto.DecryptCompactPrivKey(compact, "passphrase")
+	require.NoError(t, err)
+	require.Equal(t, string(keyring.Secp256k1), algo)
+	require.True(t, priv.Equals(decrypted))
+
+	_, _, err = crypto.DecryptCompactPrivKey("", "passphrase")
+	require.EqualError(t, err, "unrecognized compact private key version")
+
+	_, _, err = crypto.DecryptCompactPrivKey("AQk", "passphrase")
+	require.EqualError(t, err, "compact private key too short")
+
+	_, _, err = crypto.DecryptCompactPrivKey("not base64!", "passphrase")
+	require.Error(t, err)
+
+	// version 1 keys have no cost byte and use the default cost
+	bz, err := base64.RawURLEncoding.DecodeString(compact)
+	require.NoError(t, err)
+	require.Equal(t, byte(crypto.BcryptSecurityParameter), bz[1])
+	legacy := base64.RawURLEncoding.EncodeToString(append([]byte{1}, bz[2:]...))
+	decrypted, _, err = crypto.DecryptCompactPrivKey(legacy, "passphrase")
+	require.NoError(t, err)
+	require.True(t, priv.Equals(decrypted))
+
+	invalid := base64.RawURLEncoding.EncodeToString(append([]byte{bz[0], crypto.MaxBcryptCost + 1}, bz[2:]...))
+	_, _, err = crypto.DecryptCompactPrivKey(invalid, "passphrase")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "invalid bcrypt cost")
+}
+
+func TestEncryptDecryptCompactPrivKeyWithCost(t *testing.T) {
+	priv := secp256k1.GenPrivKey()
+	compact := crypto.EncryptCompactPrivKeyWithCost(priv, "passphrase", "", crypto.MinBcryptCost)
+
+	// the cost is read from the key, whatever the current default
+	defaultCost := crypto.BcryptSecurityParameter
+	crypto.BcryptSecurityParameter = crypto.MinBcryptCost + 1
+	defer func() { crypto.BcryptSecurityParameter = defaultCost }()
+
+	decrypted, _, err := crypto.DecryptCompactPrivKey(compact, "passphrase")
+	require.NoError(t, err)
+	require.True(t, priv.Equals(decrypted))
+
+	require.Panics(t, func() {
+		crypto.EncryptCompactPrivKeyWithCost(priv, "passphrase", "", crypto.MaxBcryptCost+1)
+	})
+}
+
 func TestArmorUnarmorPubKey(t *testing.T) {
 	// Select the encryption and storage for your cryptostore
 	cstore := keyring.NewInMemory()
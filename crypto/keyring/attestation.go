@@ -0,0 +1,83 @@
+package keyring
+
+import (
+	"encoding/binary"
+
+	"github.com/pkg/errors"
+	tmcrypto "github.com/tendermint/tendermint/crypto"
+
+	"github.com/cosmos/cosmos-sdk/types"
+)
+
+// OwnershipAttestationDomain is the signing domain of ownership attestations.
+const OwnershipAttestationDomain = "ownership-attestation"
+
+// OwnershipAttestationBytes returns the bytes signed by an ownership attestation
+// of addr. The attestation message is the concatenation of the address, the
+// UTF-8 encoded statement and the nonce, each prefixed with its length as an
+// unsigned varint:
+//
+//	len(addr) || addr || len(statement) || statement || len(nonce) || nonce
+//
+// and is signed in OwnershipAttestationDomain as defined by DomainSignBytes,
+// hence an attestation can never be a valid tx signature nor the other way
+// around.
+func OwnershipAttestationBytes(addr types.AccAddress, statement string, nonce []byte) []byte {
+	var msg []byte
+	for _, field := range [][]byte{addr, []byte(statement), nonce} {
+		var prefix [binary.MaxVarintLen64]byte
+		n := binary.PutUvarint(prefix[:], uint64(len(field)))
+
+		msg = append(msg, prefix[:n]...)
+		msg = append(msg, field...)
+	}
+
+	return DomainSignBytes(OwnershipAttestationDomain, msg)
+}
+
+// SignOwnershipAttestation signs an attestation that the named key controls its
+// address, binding the statement and the nonce chosen by the verifier. The
+// nonce must not be empty so that attestations cannot be replayed.
+func (kb keyringKeybase) SignOwnershipAttestation(name, statement string, nonce []byte) ([]byte, tmcrypto.PubKey, error) {
+	if len(nonce) == 0 {
+		return nil, nil, errors.Wrap(ErrInvalidAttestation, "empty nonce")
+	}
+
+	info, err := kb.Get(name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return kb.Sign(name, "", OwnershipAttestationBytes(kb.addressOf(info), statement, nonce))
+}
+
+// VerifyOwnershipAttestation verifies that sig attests the ownership of addr by
+// pub for the given statement and nonce. It returns ErrInvalidAttestation if pub
+// does not match addr or sig was signed for another address, statement or
+// nonce.
+func VerifyOwnershipAttestation(addr types.AccAddress, pub tmcrypto.PubKey, statement string, nonce, sig []byte) error {
+	return VerifyOwnershipAttestationWithDeriver(nil, addr, pub, statement, nonce, sig)
+}
+
+// VerifyOwnershipAttestationWithDeriver is like VerifyOwnershipAttestation but
+// matches pub against addr with deriver, which must be the AddressDeriver of the
+// keybase that signed the attestation. A nil deriver uses the default address
+// derivation.
+func VerifyOwnershipAttestationWithDeriver(
+	deriver AddressDeriver, addr types.AccAddress, pub tmcrypto.PubKey, statement string, nonce, sig []byte,
+) error {
+
+	if len(nonce) == 0 {
+		return errors.Wrap(ErrInvalidAttestation, "empty nonce")
+	}
+
+	if !addr.Equals(derivedAddress(deriver, pub)) {
+		return errors.Wrapf(ErrInvalidAttestation, "public key does not match address %s", addr)
+	}
+
+	if !pub.VerifyBytes(OwnershipAttestationBytes(addr, statement, nonce), sig) {
+		return errors.Wrap(ErrInvalidAttestation, "invalid signature")
+	}
+
+	return nil
+}
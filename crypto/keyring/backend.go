@@ -0,0 +1,122 @@
+package keyring
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/99designs/keyring"
+	"github.com/pkg/errors"
+)
+
+// healthCheckKey is the key of the sentinel item written and read back by
+// HealthCheck. Its data is a constant and holds no key material.
+const healthCheckKey = "keyring.healthcheck"
+
+var healthCheckSentinel = []byte("ok")
+
+// HealthCheck verifies that the keyring backend is accessible: the stored keys
+// can be listed and the sentinel item can be read back, being written first if
+// missing. No item but the sentinel is read. Failures wrap
+// ErrBackendUnavailable.
+func (kb keyringKeybase) HealthCheck() error {
+	if _, err := kb.db.Keys(); err != nil {
+		return errors.Wrap(ErrBackendUnavailable, err.Error())
+	}
+
+	item, err := kb.db.Get(healthCheckKey)
+	if err == keyring.ErrKeyNotFound {
+		err = kb.db.Set(keyring.Item{
+			Key:   healthCheckKey,
+			Data:  healthCheckSentinel,
+			Label: healthCheckKey,
+		})
+		if err != nil {
+			return errors.Wrap(ErrBackendUnavailable, err.Error())
+		}
+
+		item, err = kb.db.Get(healthCheckKey)
+	}
+	if err != nil {
+		return errors.Wrap(ErrBackendUnavailable, err.Error())
+	}
+
+	if !bytes.Equal(item.Data, healthCheckSentinel) {
+		return errors.Wrap(ErrBackendUnavailable, "sentinel item mismatch")
+	}
+
+	return nil
+}
+
+// retryKeyring wraps a keyring backend and retries operations failing with a
+// transient error, as reported by isTransientBackendError. The passphrase
+// session, if any, is locked before retrying, which reopens the backend so that
+// it prompts for the passphrase again.
+type retryKeyring struct {
+	keyring.Keyring
+
+	session  *passphraseSession
+	attempts int
+	delay    time.Duration
+}
+
+func newRetryKeyring(db keyring.Keyring, session *passphraseSession, attempts int, delay time.Duration) keyring.Keyring {
+	return retryKeyring{
+		Keyring:  db,
+		session:  session,
+		attempts: attempts,
+		delay:    delay,
+	}
+}
+
+// retry calls op until it succeeds, fails with a non transient error or the
+// attempts are exhausted, and returns its last error.
+func (rk retryKeyring) retry(op func() error) error {
+	err := op()
+	for i := 1; i < rk.attempts && isTransientBackendError(err); i++ {
+		if rk.session != nil {
+			rk.session.lock()
+		}
+
+		time.Sleep(rk.delay)
+		err = op()
+	}
+
+	return err
+}
+
+// isTransientBackendError returns true if err, or an error it wraps, reports
+// itself as temporary through a Temporary() bool method returning true. Other
+// errors, e.g. a missing key or a wrong passphrase, would fail again and are
+// not retried.
+func isTransientBackendError(err error) bool {
+	var temporary interface{ Temporary() bool }
+	return errors.As(err, &temporary) && temporary.Temporary()
+}
+
+func (rk retryKeyring) Get(key string) (item keyring.Item, err error) {
+	err = rk.retry(func() error {
+		item, err = rk.Keyring.Get(key)
+		return err
+	})
+	return item, err
+}
+
+func (rk retryKeyring) Set(item keyring.Item) error {
+	return rk.retry(func() error {
+		return rk.Keyring.Set(item)
+	})
+}
+
+func (rk retryKeyring) Remove(key string) error {
+	return rk.retry(func() error {
+		return rk.Keyring.Remove(key)
+	})
+}
+
+func (rk retryKeyring) Keys() (keys []string, err error) {
+	err = rk.retry(func() error {
+		keys, err = rk.Keyring.Keys()
+		return err
+	})
+	return keys, err
+}
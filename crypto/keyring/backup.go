@@ -0,0 +1,205 @@
+package keyring
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+
+	"github.com/pkg/errors"
+	"github.com/tendermint/crypto/bcrypt"
+	tmcrypto "github.com/tendermint/tendermint/crypto"
+	"github.com/tendermint/tendermint/crypto/armor"
+	"github.com/tendermint/tendermint/crypto/xsalsa20symmetric"
+
+	"github.com/cosmos/cosmos-sdk/crypto"
+)
+
+// Keyring backup archive format.
+//
+// A backup is an ASCII armored block of type "COSMOS KEYRING BACKUP" with the
+// following headers:
+//
+//	version: the format version, currently 1
+//	kdf:     the key derivation function, always bcrypt
+//	cost:    the bcrypt cost
+//	salt:    the hex encoded 16 bytes bcrypt salt
+//
+// The body is the JSON encoded backupPayload sealed with xsalsa20-poly1305 under
+// the SHA-256 hash of the bcrypt key derived from the passphrase. The poly1305
+// authenticator is the integrity check: a modified archive, like a wrong
+// passphrase, fails to decrypt.
+const (
+	backupBlockType = "COSMOS KEYRING BACKUP"
+	backupVersion   = 1
+	backupSaltLen   = 16
+)
+
+// backupPayload is the content of a backup: the amino encoded Info of each key,
+// which includes the private key of local keys, and the default key name.
+// Modification times and export audit logs are not backed up.
+type backupPayload struct {
+	Keys    [][]byte `json:"keys"`
+	Default string   `json:"default,omitempty"`
+}
+
+// BackupToFile writes an encrypted backup of all keys of the keyring to the
+// file at path, which is created with owner only permissions. See the backup
+// format above. With WithExportAudit, the backup is recorded in the export
+// audit log of each backed up key holding a private key.
+func (kb keyringKeybase) BackupToFile(path, passphrase string) error {
+	if kb.base.options.noPrivExport {
+		return ErrPrivExportDisabled
+	}
+
+	cost, err := kb.armorBcryptCost()
+	if err != nil {
+		return err
+	}
+
+	infos, err := kb.List()
+	if err != nil {
+		return err
+	}
+
+	var payload backupPayload
+	for _, info := range infos {
+		payload.Keys = append(payload.Keys, marshalInfo(info))
+	}
+
+	if def, err := kb.GetDefault(); err == nil {
+		payload.Default = def.GetName()
+	}
+
+	bz, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	salt := tmcrypto.CRandBytes(backupSaltLen)
+	key, err := backupKey(salt, passphrase, cost)
+	if err != nil {
+		return err
+	}
+
+	header := map[string]string{
+		"version": strconv.Itoa(backupVersion),
+		"kdf":     "bcrypt",
+		"cost":    strconv.Itoa(cost),
+		"salt":    fmt.Sprintf("%X", salt),
+	}
+	archive := armor.EncodeArmor(backupBlockType, header, xsalsa20symmetric.EncryptSymmetric(bz, key))
+
+	if err := ioutil.WriteFile(path, []byte(archive), 0600); err != nil {
+		return err
+	}
+
+	if kb.base.options.exportAudit {
+		for _, info := range infos {
+			if !hasPrivKey(info) {
+				continue
+			}
+
+			if err := kb.recordExport(info.GetName()); err != nil {
+				return errors.Wrap(err, "failed to record key export")
+			}
+		}
+	}
+
+	return nil
+}
+
+// RestoreFromFile restores the keys of the backup at path. Keys whose name is
+// already in use are skipped. The default key of the backup is restored only
+// if the keyring has none. It returns the number of restored keys.
+func (kb keyringKeybase) RestoreFromFile(path, passphrase string) (imported int, err error) {
+	archive, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+
+	payload, err := openBackup(string(archive), passphrase)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, bz := range payload.Keys {
+		info, err := unmarshalInfo(bz)
+		if err != nil {
+			return imported, errors.Wrap(err, "invalid key in backup")
+		}
+
+		if kb.HasKey(info.GetName()) {
+			continue
+		}
+
+		if err := kb.writeInfo(info.GetName(), info); err != nil {
+			return imported, err
+		}
+		imported++
+	}
+
+	if payload.Default != "" {
+		if _, err := kb.GetDefault(); err == ErrNoDefaultKey {
+			if err := kb.SetDefault(payload.Default); err != nil {
+				return imported, err
+			}
+		}
+	}
+
+	return imported, nil
+}
+
+// openBackup decrypts and decodes a backup archive.
+func openBackup(archive, passphrase string) (payload backupPayload, err error) {
+	blockType, header, sealed, err := armor.DecodeArmor(archive)
+	if err != nil {
+		return payload, err
+	}
+
+	if blockType != backupBlockType {
+		return payload, fmt.Errorf("unrecognized armor type: %v", blockType)
+	}
+
+	if header["version"] != strconv.Itoa(backupVersion) {
+		return payload, fmt.Errorf("unsupported backup version: %v", header["version"])
+	}
+
+	if header["kdf"] != "bcrypt" {
+		return payload, fmt.Errorf("unrecognized KDF type: %v", header["kdf"])
+	}
+
+	cost, err := strconv.Atoi(header["cost"])
+	if err != nil || cost < crypto.MinBcryptCost || cost > crypto.MaxBcryptCost {
+		return payload, fmt.Errorf("invalid bcrypt cost: %v", header["cost"])
+	}
+
+	salt, err := hex.DecodeString(header["salt"])
+	if err != nil || len(salt) != backupSaltLen {
+		return payload, fmt.Errorf("invalid salt: %v", header["salt"])
+	}
+
+	key, err := backupKey(salt, passphrase, cost)
+	if err != nil {
+		return payload, err
+	}
+
+	bz, err := xsalsa20symmetric.DecryptSymmetric(sealed, key)
+	if err != nil {
+		return payload, errors.Wrap(err, "wrong passphrase or corrupted backup")
+	}
+
+	err = json.Unmarshal(bz, &payload)
+	return payload, err
+}
+
+// backupKey derives the 32 bytes archive key from the passphrase.
+func backupKey(salt []byte, passphrase string, cost int) ([]byte, error) {
+	key, err := bcrypt.GenerateFromPassword(salt, []byte(passphrase), cost)
+	if err != nil {
+		return nil, errors.Wrap(err, "error generating bcrypt key from passphrase")
+	}
+
+	return tmcrypto.Sha256(key), nil
+}
@@ -1,6 +1,9 @@
 package keyring
 
 import (
+	"fmt"
+	"io"
+
 	"github.com/pkg/errors"
 
 	tmcrypto "github.com/tendermint/tendermint/crypto"
@@ -25,11 +28,11 @@ type (
 	}
 
 	writeLocalKeyer interface {
-		writeLocalKey(name string, priv tmcrypto.PrivKey, algo SigningAlgo) Info
+		writeLocalKey(name string, priv tmcrypto.PrivKey, algo SigningAlgo) (Info, error)
 	}
 
 	infoWriter interface {
-		writeInfo(name string, info Info)
+		writeInfo(name string, info Info) error
 	}
 )
 
@@ -43,6 +46,8 @@ func newBaseKeybase(optionsFns ...KeybaseOption) baseKeybase {
 		deriveFunc:           StdDeriveKey,
 		supportedAlgos:       []SigningAlgo{Secp256k1},
 		supportedAlgosLedger: []SigningAlgo{Secp256k1},
+		sessionTimeout:       DefaultSessionTimeout,
+		infoCodec:            AminoInfoCodec{},
 	}
 
 	for _, optionFn := range optionsFns {
@@ -84,15 +89,119 @@ func (kb baseKeybase) CreateAccount(
 		return nil, err
 	}
 
-	var info Info
-
 	if encryptPasswd != "" {
-		info = keyWriter.writeLocalKey(name, privKey, algo)
-	} else {
-		info = kb.writeOfflineKey(keyWriter, name, privKey.PubKey(), algo)
+		return kb.writeDerivedLocalKey(keyWriter, name, privKey, algo, hdPath, bip39Passphrase)
 	}
 
-	return info, nil
+	return kb.writeOfflineKey(keyWriter, name, privKey.PubKey(), algo)
+}
+
+// RestoreFromMnemonic derives the keys of the mnemonic at sequential address
+// indices of the first account and stores the funded ones, named after
+// namePrefix and their index. Discovery stops after gapLimit consecutive
+// unfunded addresses, following the BIP 44 gap limit convention. Keys are only
+// stored once the discovery completes.
+func (kb baseKeybase) RestoreFromMnemonic(
+	keyWriter keyWriter, namePrefix, mnemonic, bip39Passphrase string, algo SigningAlgo,
+	isFunded func(addr types.AccAddress) (bool, error), gapLimit int,
+) ([]Info, error) {
+
+	if gapLimit <= 0 {
+		return nil, errors.New("gap limit must be a positive integer")
+	}
+
+	if !IsSupportedAlgorithm(kb.SupportedAlgos(), algo) {
+		return nil, ErrUnsupportedSigningAlgo
+	}
+
+	var (
+		funded []tmcrypto.PrivKey
+		names  []string
+		paths  []string
+	)
+
+	for index, gap := uint32(0), 0; gap < gapLimit; index++ {
+		hdPath := CreateHDPath(0, index).String()
+
+		derivedPriv, err := kb.options.deriveFunc(mnemonic, bip39Passphrase, hdPath, algo)
+		if err != nil {
+			return nil, err
+		}
+
+		privKey, err := kb.options.keygenFunc(derivedPriv, algo)
+		if err != nil {
+			return nil, err
+		}
+
+		ok, err := isFunded(kb.pubKeyAddress(privKey.PubKey()))
+		if err != nil {
+			return nil, err
+		}
+
+		if !ok {
+			gap++
+			continue
+		}
+
+		gap = 0
+		funded = append(funded, privKey)
+		names = append(names, fmt.Sprintf("%s-%d", namePrefix, index))
+		paths = append(paths, hdPath)
+	}
+
+	infos := make([]Info, len(funded))
+	for i, privKey := range funded {
+		info, err := kb.writeDerivedLocalKey(keyWriter, names[i], privKey, algo, paths[i], bip39Passphrase)
+		if err != nil {
+			return nil, err
+		}
+
+		infos[i] = info
+	}
+
+	return infos, nil
+}
+
+// pubKeyAddress returns the address of pub as derived by the configured
+// AddressDeriver, if any.
+func (kb baseKeybase) pubKeyAddress(pub tmcrypto.PubKey) types.AccAddress {
+	return derivedAddress(kb.options.addressDeriver, pub)
+}
+
+// derivedAddress returns the address of pub as derived by deriver, or the
+// default address of pub if deriver is nil.
+func derivedAddress(deriver AddressDeriver, pub tmcrypto.PubKey) types.AccAddress {
+	if deriver != nil {
+		return deriver(pub)
+	}
+
+	return types.AccAddress(pub.Address())
+}
+
+// CreateExtendedAccount derives the secp256k1 extended private key for the given
+// mnemonic and HD path and stores it along with its chain code.
+func (kb baseKeybase) CreateExtendedAccount(
+	w infoWriter, name, mnemonic, bip39Passphrase, hdPath string, algo SigningAlgo,
+) (Info, error) {
+
+	if algo != Secp256k1 {
+		return nil, ErrUnsupportedSigningAlgo
+	}
+
+	seed, err := bip39.NewSeedWithErrorChecking(mnemonic, bip39Passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	derivedPriv, chainCode := hd.ComputeMastersFromSeed(seed)
+	if len(hdPath) > 0 {
+		derivedPriv, chainCode, err = hd.DeriveExtendedPrivateKeyForPath(derivedPriv, chainCode, hdPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return kb.writeExtendedLocalKey(w, name, SecpPrivKeyGen(derivedPriv[:]), chainCode[:], algo)
 }
 
 // CreateLedger creates a new reference to a Ledger key pair. It returns a public
@@ -113,7 +222,7 @@ func (kb baseKeybase) CreateLedger(
 		return nil, err
 	}
 
-	return kb.writeLedgerKey(w, name, priv.PubKey(), *hdPath, algo), nil
+	return kb.writeLedgerKey(w, name, priv.PubKey(), *hdPath, algo)
 }
 
 // CreateMnemonic generates a new key with the given algorithm and language pair.
@@ -121,6 +230,18 @@ func (kb baseKeybase) CreateMnemonic(
 	keyWriter keyWriter, name string, language Language, passwd string, algo SigningAlgo,
 ) (info Info, mnemonic string, err error) {
 
+	// Default number of words (24): This generates a mnemonic directly from the
+	// number of words by reading system entropy.
+	return kb.CreateMnemonicWithEntropy(keyWriter, name, language, passwd, defaultEntropySize, algo)
+}
+
+// CreateMnemonicWithEntropy generates a new key with the given algorithm and
+// language pair from a mnemonic of entropyBits bits of entropy, i.e. of 12, 15,
+// 18, 21 or 24 words for 128, 160, 192, 224 or 256 bits.
+func (kb baseKeybase) CreateMnemonicWithEntropy(
+	keyWriter keyWriter, name string, language Language, passwd string, entropyBits int, algo SigningAlgo,
+) (info Info, mnemonic string, err error) {
+
 	if language != English {
 		return nil, "", ErrUnsupportedLanguage
 	}
@@ -129,9 +250,11 @@ func (kb baseKeybase) CreateMnemonic(
 		return nil, "", ErrUnsupportedSigningAlgo
 	}
 
-	// Default number of words (24): This generates a mnemonic directly from the
-	// number of words by reading system entropy.
-	entropy, err := bip39.NewEntropy(defaultEntropySize)
+	if entropyBits < 128 || entropyBits > 256 || entropyBits%32 != 0 {
+		return nil, "", ErrInvalidEntropySize
+	}
+
+	entropy, err := kb.newEntropy(entropyBits)
 	if err != nil {
 		return nil, "", err
 	}
@@ -149,22 +272,83 @@ func (kb baseKeybase) CreateMnemonic(
 	return info, mnemonic, err
 }
 
-func (kb baseKeybase) writeLedgerKey(w infoWriter, name string, pub tmcrypto.PubKey, path hd.BIP44Params, algo SigningAlgo) Info {
+// newEntropy returns bits bits of entropy for a new mnemonic, read from the
+// configured entropy source if any or from the system's secure random source
+// otherwise.
+func (kb baseKeybase) newEntropy(bits int) ([]byte, error) {
+	if kb.options.entropySource == nil {
+		return bip39.NewEntropy(bits)
+	}
+
+	entropy := make([]byte, bits/8)
+	if _, err := io.ReadFull(kb.options.entropySource, entropy); err != nil {
+		return nil, errors.Wrap(err, "failed to read entropy")
+	}
+
+	return entropy, nil
+}
+
+func (kb baseKeybase) writeLedgerKey(w infoWriter, name string, pub tmcrypto.PubKey, path hd.BIP44Params, algo SigningAlgo) (Info, error) {
 	info := newLedgerInfo(name, pub, path, algo)
-	w.writeInfo(name, info)
-	return info
+	if err := w.writeInfo(name, info); err != nil {
+		return nil, err
+	}
+
+	return info, nil
+}
+
+func (kb baseKeybase) writeExtendedLocalKey(w infoWriter, name string, priv tmcrypto.PrivKey, chainCode []byte, algo SigningAlgo) (Info, error) {
+	info := &localInfo{
+		Name:         name,
+		PubKey:       priv.PubKey(),
+		PrivKeyArmor: string(priv.Bytes()),
+		Algo:         algo,
+		ChainCode:    chainCode,
+	}
+	if err := w.writeInfo(name, info); err != nil {
+		return nil, err
+	}
+
+	return info, nil
+}
+
+// writeDerivedLocalKey stores a local key along with the context it was derived
+// in from its mnemonic.
+func (kb baseKeybase) writeDerivedLocalKey(
+	w infoWriter, name string, priv tmcrypto.PrivKey, algo SigningAlgo, hdPath, bip39Passphrase string,
+) (Info, error) {
+
+	info := &localInfo{
+		Name:               name,
+		PubKey:             priv.PubKey(),
+		PrivKeyArmor:       string(priv.Bytes()),
+		Algo:               algo,
+		HDPath:             hdPath,
+		HasBIP39Passphrase: bip39Passphrase != "",
+	}
+	if err := w.writeInfo(name, info); err != nil {
+		return nil, err
+	}
+
+	return info, nil
 }
 
-func (kb baseKeybase) writeOfflineKey(w infoWriter, name string, pub tmcrypto.PubKey, algo SigningAlgo) Info {
+func (kb baseKeybase) writeOfflineKey(w infoWriter, name string, pub tmcrypto.PubKey, algo SigningAlgo) (Info, error) {
 	info := newOfflineInfo(name, pub, algo)
-	w.writeInfo(name, info)
-	return info
+	if err := w.writeInfo(name, info); err != nil {
+		return nil, err
+	}
+
+	return info, nil
 }
 
-func (kb baseKeybase) writeMultisigKey(w infoWriter, name string, pub tmcrypto.PubKey) Info {
+func (kb baseKeybase) writeMultisigKey(w infoWriter, name string, pub tmcrypto.PubKey) (Info, error) {
 	info := NewMultiInfo(name, pub)
-	w.writeInfo(name, info)
-	return info
+	if err := w.writeInfo(name, info); err != nil {
+		return nil, err
+	}
+
+	return info, nil
 }
 
 // StdDeriveKey is the default DeriveKey function in the keybase.
@@ -206,6 +390,32 @@ func (kb baseKeybase) SupportedAlgosLedger() []SigningAlgo {
 	return kb.options.supportedAlgosLedger
 }
 
+// newLedgerPrivKey connects to the ledger device and returns its key at the
+// given path. It is a variable so that tests can replace the device.
+var newLedgerPrivKey = crypto.NewPrivKeyLedgerSecp256k1Unsafe
+
+// ledgerPrivKey returns the key of the connected ledger device at the path
+// stored in the ledger Info object. It returns ErrLedgerDeviceNotAvailable if
+// the device cannot be reached and ErrLedgerPubKeyMismatch if the device key
+// differs from the stored public key.
+func ledgerPrivKey(info Info) (tmcrypto.PrivKey, error) {
+	path, err := info.GetPath()
+	if err != nil {
+		return nil, err
+	}
+
+	priv, err := newLedgerPrivKey(*path)
+	if err != nil {
+		return nil, errors.Wrap(ErrLedgerDeviceNotAvailable, err.Error())
+	}
+
+	if !priv.PubKey().Equals(info.GetPubKey()) {
+		return nil, ErrLedgerPubKeyMismatch
+	}
+
+	return priv, nil
+}
+
 // SignWithLedger signs a binary message with the ledger device referenced by an Info object
 // and returns the signed bytes and the public key. It returns an error if the device could
 // not be queried or it returned an error.
@@ -215,14 +425,10 @@ func SignWithLedger(info Info, msg []byte) (sig []byte, pub tmcrypto.PubKey, err
 	default:
 		return nil, nil, errors.New("not a ledger object")
 	}
-	path, err := info.GetPath()
-	if err != nil {
-		return
-	}
 
-	priv, err := crypto.NewPrivKeyLedgerSecp256k1Unsafe(*path)
+	priv, err := ledgerPrivKey(info)
 	if err != nil {
-		return
+		return nil, nil, err
 	}
 
 	sig, err = priv.Sign(msg)
@@ -25,4 +25,7 @@ func RegisterCodec(cdc *codec.Codec) {
 	cdc.RegisterConcrete(ledgerInfo{}, "crypto/keys/ledgerInfo", nil)
 	cdc.RegisterConcrete(offlineInfo{}, "crypto/keys/offlineInfo", nil)
 	cdc.RegisterConcrete(multiInfo{}, "crypto/keys/multiInfo", nil)
+	cdc.RegisterConcrete(fido2Info{}, "crypto/keys/fido2Info", nil)
+	cdc.RegisterConcrete(PubKeyFIDO2{}, "cosmos-sdk/PubKeyFIDO2", nil)
+	cdc.RegisterConcrete(FIDO2Signature{}, "cosmos-sdk/FIDO2Signature", nil)
 }
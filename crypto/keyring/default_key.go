@@ -0,0 +1,54 @@
+package keyring
+
+import (
+	"github.com/99designs/keyring"
+)
+
+// defaultKey is the key of the item holding the name of the default key. It
+// cannot clash with the items of a key as it has no key item suffix.
+const defaultKey = "keyring.default"
+
+// SetDefault designates the named key as the default signer, replacing the
+// previous default if any. The default is stored in the keyring.
+func (kb keyringKeybase) SetDefault(name string) error {
+	if _, err := kb.Get(name); err != nil {
+		return err
+	}
+
+	return kb.db.Set(keyring.Item{
+		Key:   defaultKey,
+		Data:  []byte(name),
+		Label: defaultKey,
+	})
+}
+
+// GetDefault returns the default key. It returns ErrNoDefaultKey if no default
+// is set.
+func (kb keyringKeybase) GetDefault() (Info, error) {
+	item, err := kb.db.Get(defaultKey)
+	if err == keyring.ErrKeyNotFound || (err == nil && len(item.Data) == 0) {
+		return nil, ErrNoDefaultKey
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return kb.Get(string(item.Data))
+}
+
+// clearDefault unsets the default key if it is the named key.
+func (kb keyringKeybase) clearDefault(name string) error {
+	item, err := kb.db.Get(defaultKey)
+	if err == keyring.ErrKeyNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if string(item.Data) != name {
+		return nil
+	}
+
+	return kb.db.Remove(defaultKey)
+}
@@ -0,0 +1,44 @@
+package keyring
+
+import (
+	"fmt"
+)
+
+// DerivationContext describes how a key was derived from its mnemonic, so that
+// it can be reconstructed. It holds no secret: whether a BIP 39 passphrase was
+// used is recorded, but not the passphrase.
+type DerivationContext struct {
+	Name               string      `json:"name"`
+	Algo               SigningAlgo `json:"algo"`
+	HDPath             string      `json:"hd_path,omitempty"`
+	HasBIP39Passphrase bool        `json:"has_bip39_passphrase"`
+	// Imported is set if no derivation path is known, i.e. the key was
+	// imported directly or was created before derivation contexts were stored.
+	Imported bool `json:"imported"`
+}
+
+// GetDerivationContext returns the derivation context of the named local or
+// Ledger key. Ledger keys never use a BIP 39 passphrase known to the keyring.
+func (kb keyringKeybase) GetDerivationContext(name string) (DerivationContext, error) {
+	info, err := kb.Get(name)
+	if err != nil {
+		return DerivationContext{}, err
+	}
+
+	ctx := DerivationContext{Name: name, Algo: info.GetAlgo()}
+
+	switch i := info.(type) {
+	case localInfo:
+		ctx.HDPath = i.HDPath
+		ctx.HasBIP39Passphrase = i.HasBIP39Passphrase
+		ctx.Imported = i.HDPath == ""
+
+	case ledgerInfo:
+		ctx.HDPath = i.Path.String()
+
+	default:
+		return DerivationContext{}, fmt.Errorf("derivation context is not available for %s key %s", info.GetType(), name)
+	}
+
+	return ctx, nil
+}
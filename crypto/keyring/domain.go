@@ -0,0 +1,26 @@
+package keyring
+
+import (
+	"crypto/sha256"
+)
+
+// DomainSeparationPrefix is prepended to the domain name before it is hashed
+// into a domain separation tag.
+const DomainSeparationPrefix = "cosmos-sdk/keyring/domain:"
+
+// DomainSignBytes returns the bytes signed by SignInDomain for msg in the given
+// domain. They are the SHA-256 hash of DomainSeparationPrefix followed by the
+// UTF-8 encoded domain, followed by msg:
+//
+//	SHA-256(DomainSeparationPrefix || domain) || msg
+//
+// The tag has a fixed length of 32 bytes, hence a signature produced for one
+// domain cannot be verified as a signature in another domain.
+func DomainSignBytes(domain string, msg []byte) []byte {
+	tag := sha256.Sum256([]byte(DomainSeparationPrefix + domain))
+
+	bz := make([]byte, 0, len(tag)+len(msg))
+	bz = append(bz, tag[:]...)
+
+	return append(bz, msg...)
+}
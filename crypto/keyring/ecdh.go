@@ -0,0 +1,50 @@
+package keyring
+
+import (
+	"crypto/sha256"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/pkg/errors"
+	tmcrypto "github.com/tendermint/tendermint/crypto"
+	"github.com/tendermint/tendermint/crypto/secp256k1"
+)
+
+// SharedSecretKDFLabel is prepended to the raw ECDH shared point before it is
+// hashed into a shared secret.
+const SharedSecretKDFLabel = "cosmos-sdk/keyring/ecdh:"
+
+// ECDHSharedSecret computes the ECDH shared secret between priv and peer on the
+// secp256k1 curve. The raw shared point is not returned; the shared secret is
+// derived from its x-coordinate X, encoded as 32 big-endian bytes, as:
+//
+//	SHA-256(SharedSecretKDFLabel || X)
+//
+// ECDHSharedSecret(a, B) == ECDHSharedSecret(b, A) for any two key pairs.
+func ECDHSharedSecret(priv tmcrypto.PrivKey, peer tmcrypto.PubKey) ([]byte, error) {
+	privKey, ok := priv.(secp256k1.PrivKeySecp256k1)
+	if !ok {
+		return nil, ErrUnsupportedSigningAlgo
+	}
+
+	peerKey, ok := peer.(secp256k1.PubKeySecp256k1)
+	if !ok {
+		return nil, ErrCurveMismatch
+	}
+
+	peerPub, err := btcec.ParsePubKey(peerKey[:], btcec.S256())
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid peer public key")
+	}
+
+	x, _ := btcec.S256().ScalarMult(peerPub.X, peerPub.Y, privKey[:])
+
+	var point [32]byte
+	xBz := x.Bytes()
+	copy(point[len(point)-len(xBz):], xBz)
+
+	h := sha256.New()
+	h.Write([]byte(SharedSecretKDFLabel))
+	h.Write(point[:])
+
+	return h.Sum(nil), nil
+}
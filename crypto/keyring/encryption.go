@@ -0,0 +1,108 @@
+package keyring
+
+import (
+	"fmt"
+
+	"golang.org/x/crypto/curve25519"
+
+	"github.com/cosmos/cosmos-sdk/crypto/keys/hd"
+	bip39 "github.com/cosmos/go-bip39"
+)
+
+// encryptionKeyBranch is the hardened child of the signing key HD path from
+// which the encryption key is derived. Being hardened, the encryption key can
+// not be derived from the public key of the signing key.
+const encryptionKeyBranch = "1'"
+
+// DeriveEncryptionKey derives the x25519 encryption key pair of the given
+// mnemonic and HD path, the same one NewAccountWithEncryption derives. As the
+// private key is not stored, this is how it is recovered to decrypt data.
+func DeriveEncryptionKey(mnemonic, bip39Passphrase, hdPath string) (priv, pub [32]byte, err error) {
+	seed, err := bip39.NewSeedWithErrorChecking(mnemonic, bip39Passphrase)
+	if err != nil {
+		return priv, pub, err
+	}
+
+	path := encryptionKeyBranch
+	if len(hdPath) > 0 {
+		path = hdPath + "/" + encryptionKeyBranch
+	}
+
+	masterPriv, ch := hd.ComputeMastersFromSeed(seed)
+	priv, err = hd.DerivePrivateKeyForPath(masterPriv, ch, path)
+	if err != nil {
+		return priv, pub, err
+	}
+
+	// the scalar is clamped by the base point multiplication
+	curve25519.ScalarBaseMult(&pub, &priv)
+
+	return priv, pub, nil
+}
+
+// CreateAccountWithEncryption derives the signing key like CreateAccount and the
+// encryption key like DeriveEncryptionKey, and stores them as a local key.
+func (kb baseKeybase) CreateAccountWithEncryption(
+	w infoWriter, name, mnemonic, bip39Passphrase, hdPath string, algo SigningAlgo,
+) (Info, error) {
+
+	derivedPriv, err := kb.options.deriveFunc(mnemonic, bip39Passphrase, hdPath, algo)
+	if err != nil {
+		return nil, err
+	}
+
+	privKey, err := kb.options.keygenFunc(derivedPriv, algo)
+	if err != nil {
+		return nil, err
+	}
+
+	_, encPub, err := DeriveEncryptionKey(mnemonic, bip39Passphrase, hdPath)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &localInfo{
+		Name:               name,
+		PubKey:             privKey.PubKey(),
+		PrivKeyArmor:       string(privKey.Bytes()),
+		Algo:               algo,
+		EncryptionPubKey:   encPub[:],
+		HDPath:             hdPath,
+		HasBIP39Passphrase: bip39Passphrase != "",
+	}
+	if err := w.writeInfo(name, info); err != nil {
+		return nil, err
+	}
+
+	return info, nil
+}
+
+// NewAccountWithEncryption converts a mnemonic to a signing key and an x25519
+// encryption key and persists them. Only the encryption public key is stored,
+// see DeriveEncryptionKey to recover its private key.
+func (kb keyringKeybase) NewAccountWithEncryption(
+	name, mnemonic, bip39Passwd, hdPath string, algo SigningAlgo,
+) (Info, error) {
+
+	return kb.base.CreateAccountWithEncryption(kb, name, mnemonic, bip39Passwd, hdPath, algo)
+}
+
+// GetEncryptionPubKey returns the x25519 encryption public key of the named key.
+// It returns ErrNoEncryptionKey if the key was not created with one.
+func (kb keyringKeybase) GetEncryptionPubKey(name string) ([]byte, error) {
+	info, err := kb.Get(name)
+	if err != nil {
+		return nil, err
+	}
+
+	local, ok := info.(localInfo)
+	if !ok {
+		return nil, fmt.Errorf("encryption keys are only supported for local keys, %s is a %s key", name, info.GetType())
+	}
+
+	if len(local.EncryptionPubKey) == 0 {
+		return nil, ErrNoEncryptionKey
+	}
+
+	return local.EncryptionPubKey, nil
+}
@@ -10,4 +10,82 @@ var (
 	// ErrUnsupportedLanguage is raised when the caller tries to use a
 	// different language than english for creating a mnemonic sentence.
 	ErrUnsupportedLanguage = errors.New("unsupported language: only english is supported")
+
+	// ErrSessionNotSupported is raised when attempting to unlock a keyring
+	// whose backend does not prompt for a passphrase.
+	ErrSessionNotSupported = errors.New("keyring backend does not support session unlock")
+
+	// ErrMultisigThresholdNotMet is raised when a multisig signature carries
+	// fewer member signatures than the key's threshold.
+	ErrMultisigThresholdNotMet = errors.New("multisig threshold not met")
+
+	// ErrInvalidMultisigMemberSignature is raised when a member signature of a
+	// multisig signature fails verification.
+	ErrInvalidMultisigMemberSignature = errors.New("invalid multisig member signature")
+
+	// ErrIncorrectPassphrase is raised when a keyring session is unlocked with
+	// a passphrase that does not match the stored passphrase hash.
+	ErrIncorrectPassphrase = errors.New("incorrect passphrase")
+
+	// ErrCurveMismatch is raised when a peer public key is not on the curve of
+	// the local key it is combined with.
+	ErrCurveMismatch = errors.New("peer public key curve does not match key curve")
+
+	// ErrLedgerDeviceNotAvailable is raised when signing with a ledger key while
+	// the device cannot be reached, e.g. for watch-only ledger keys.
+	ErrLedgerDeviceNotAvailable = errors.New("ledger device not available")
+
+	// ErrNotLedgerKey is raised when auditing the derivation of a key which is
+	// not a ledger key.
+	ErrNotLedgerKey = errors.New("not a ledger key")
+
+	// ErrLedgerPubKeyMismatch is raised when the connected ledger device derives
+	// a different public key than the one stored for a ledger key.
+	ErrLedgerPubKeyMismatch = errors.New("ledger device public key does not match stored key")
+
+	// ErrFIDO2NotAvailable is raised when using a FIDO2 key while no FIDO2
+	// authenticator is configured.
+	ErrFIDO2NotAvailable = errors.New("FIDO2 authenticator not available")
+
+	// ErrFIDO2ExportNotPermitted is raised when exporting the private key of a
+	// FIDO2 key, which never leaves the authenticator.
+	ErrFIDO2ExportNotPermitted = errors.New("permission denied: FIDO2 private keys cannot be exported")
+
+	// ErrFIDO2NoPath is raised when requesting the BIP44 path of a FIDO2 key.
+	ErrFIDO2NoPath = errors.New("BIP44 Paths are not available for FIDO2 keys")
+
+	// ErrBackendUnavailable is raised by HealthCheck when the keyring backend
+	// cannot be accessed, e.g. because the OS keychain is locked.
+	ErrBackendUnavailable = errors.New("keyring backend unavailable")
+
+	// ErrPrivExportDisabled is raised when exporting a private key from a
+	// keyring created WithNoPrivExport.
+	ErrPrivExportDisabled = errors.New("permission denied: private key export is disabled")
+
+	// ErrInvalidSignDoc is raised when signing a malformed sign document.
+	ErrInvalidSignDoc = errors.New("invalid sign document")
+
+	// ErrNoEncryptionKey is raised when requesting the encryption public key of
+	// a key created without one.
+	ErrNoEncryptionKey = errors.New("key has no encryption key")
+
+	// ErrInvalidAttestation is raised when verifying an ownership attestation
+	// which was not signed for the given address, statement and nonce.
+	ErrInvalidAttestation = errors.New("invalid ownership attestation")
+
+	// ErrSignRateLimitExceeded is raised when signing with a key beyond its sign
+	// rate limit.
+	ErrSignRateLimitExceeded = errors.New("sign rate limit exceeded")
+
+	// ErrInvalidEntropySize is raised when creating a mnemonic from an amount
+	// of entropy that is not a BIP 39 entropy size.
+	ErrInvalidEntropySize = errors.New("entropy size must be one of 128, 160, 192, 224 or 256 bits")
+
+	// ErrNoDefaultKey is raised when requesting the default key of a keyring
+	// without one.
+	ErrNoDefaultKey = errors.New("no default key set")
+
+	// ErrStealthAddressesDisabled is raised when deriving or scanning for
+	// stealth addresses with a keyring created without WithStealthAddresses.
+	ErrStealthAddressesDisabled = errors.New("stealth addresses are disabled")
 )
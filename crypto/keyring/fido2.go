@@ -0,0 +1,171 @@
+package keyring
+
+import (
+	"bytes"
+	"crypto/sha256"
+
+	tmcrypto "github.com/tendermint/tendermint/crypto"
+	"github.com/tendermint/tendermint/crypto/ed25519"
+
+	"github.com/cosmos/cosmos-sdk/crypto/keys/hd"
+	"github.com/cosmos/cosmos-sdk/types"
+)
+
+// fido2FlagUserPresent is the user present (UP) flag of the authenticator data.
+const fido2FlagUserPresent = 0x01
+
+// fido2AuthDataMinLen is the length of the authenticator data of an assertion
+// without extensions: rpIdHash (32) || flags (1) || signCount (4).
+const fido2AuthDataMinLen = 37
+
+// FIDO2Authenticator defines the operations of a FIDO2 authenticator holding
+// Ed25519 (COSE algorithm -8) credentials. Private keys never leave the device.
+type FIDO2Authenticator interface {
+	// MakeCredential creates a new credential scoped to the relying party rpID
+	// and returns its ID and public key.
+	MakeCredential(rpID string) (credentialID []byte, pub ed25519.PubKeyEd25519, err error)
+
+	// GetAssertion requires the user's presence and signs clientDataHash with
+	// the credential. It returns the authenticator data and the signature over
+	// authenticatorData || clientDataHash.
+	GetAssertion(rpID string, credentialID, clientDataHash []byte) (authData, sig []byte, err error)
+}
+
+// FIDO2Signature is the signature produced by signing with a FIDO2 key. The
+// authenticator signs its authenticator data followed by the SHA-256 hash of
+// the message, hence both are needed to verify the signature.
+type FIDO2Signature struct {
+	AuthenticatorData []byte `json:"authenticator_data"`
+	Signature         []byte `json:"signature"`
+}
+
+// PubKeyFIDO2 is the public key of a FIDO2 credential. It verifies signatures
+// encoded as amino FIDO2Signature. Its address is the address of the Ed25519
+// credential key.
+type PubKeyFIDO2 struct {
+	RPID string                `json:"rp_id"`
+	Key  ed25519.PubKeyEd25519 `json:"key"`
+}
+
+var _ tmcrypto.PubKey = PubKeyFIDO2{}
+
+// Address implements tmcrypto.PubKey.
+func (pk PubKeyFIDO2) Address() tmcrypto.Address {
+	return pk.Key.Address()
+}
+
+// Bytes implements tmcrypto.PubKey.
+func (pk PubKeyFIDO2) Bytes() []byte {
+	return CryptoCdc.MustMarshalBinaryBare(pk)
+}
+
+// VerifyBytes implements tmcrypto.PubKey. It verifies that sig is an assertion
+// of the credential over msg, made for the key's relying party with the user
+// present.
+func (pk PubKeyFIDO2) VerifyBytes(msg, sig []byte) bool {
+	var fsig FIDO2Signature
+	if err := CryptoCdc.UnmarshalBinaryBare(sig, &fsig); err != nil {
+		return false
+	}
+
+	authData := fsig.AuthenticatorData
+	if len(authData) < fido2AuthDataMinLen {
+		return false
+	}
+
+	rpIDHash := sha256.Sum256([]byte(pk.RPID))
+	if !bytes.Equal(authData[:32], rpIDHash[:]) || authData[32]&fido2FlagUserPresent == 0 {
+		return false
+	}
+
+	return pk.Key.VerifyBytes(fido2SignedBytes(authData, msg), fsig.Signature)
+}
+
+// Equals implements tmcrypto.PubKey.
+func (pk PubKeyFIDO2) Equals(other tmcrypto.PubKey) bool {
+	otherPk, ok := other.(PubKeyFIDO2)
+	return ok && pk.RPID == otherPk.RPID && pk.Key.Equals(otherPk.Key)
+}
+
+// fido2SignedBytes returns the bytes signed by the authenticator for msg.
+func fido2SignedBytes(authData, msg []byte) []byte {
+	clientDataHash := sha256.Sum256(msg)
+
+	bz := make([]byte, 0, len(authData)+len(clientDataHash))
+	bz = append(bz, authData...)
+
+	return append(bz, clientDataHash[:]...)
+}
+
+// fido2Info is the public information about a key held by a FIDO2
+// authenticator.
+type fido2Info struct {
+	Name         string          `json:"name"`
+	PubKey       tmcrypto.PubKey `json:"pubkey"`
+	CredentialID []byte          `json:"credential_id"`
+	Algo         SigningAlgo     `json:"algo"`
+}
+
+var _ Info = &fido2Info{}
+
+func newFIDO2Info(name string, pub PubKeyFIDO2, credentialID []byte) Info {
+	return &fido2Info{
+		Name:         name,
+		PubKey:       pub,
+		CredentialID: credentialID,
+		Algo:         Ed25519,
+	}
+}
+
+// GetType implements Info interface
+func (i fido2Info) GetType() KeyType {
+	return TypeFIDO2
+}
+
+// GetName implements Info interface
+func (i fido2Info) GetName() string {
+	return i.Name
+}
+
+// GetPubKey implements Info interface
+func (i fido2Info) GetPubKey() tmcrypto.PubKey {
+	return i.PubKey
+}
+
+// GetAddress implements Info interface
+func (i fido2Info) GetAddress() types.AccAddress {
+	return i.PubKey.Address().Bytes()
+}
+
+// GetAlgo implements Info interface
+func (i fido2Info) GetAlgo() SigningAlgo {
+	return i.Algo
+}
+
+// GetPath implements Info interface
+func (i fido2Info) GetPath() (*hd.BIP44Params, error) {
+	return nil, ErrFIDO2NoPath
+}
+
+// signWithFIDO2 signs msg with the credential of info. The authenticator
+// requires the user's presence.
+func signWithFIDO2(authenticator FIDO2Authenticator, info fido2Info, msg []byte) ([]byte, tmcrypto.PubKey, error) {
+	if authenticator == nil {
+		return nil, nil, ErrFIDO2NotAvailable
+	}
+
+	pub := info.PubKey.(PubKeyFIDO2)
+	clientDataHash := sha256.Sum256(msg)
+
+	authData, sig, err := authenticator.GetAssertion(pub.RPID, info.CredentialID, clientDataHash[:])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	bz, err := CryptoCdc.MarshalBinaryBare(FIDO2Signature{AuthenticatorData: authData, Signature: sig})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return bz, pub, nil
+}
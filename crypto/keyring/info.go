@@ -34,12 +34,28 @@ var (
 )
 
 // localInfo is the public information about a locally stored key
-// Note: Algo must be last field in struct for backwards amino compatibility
+// Note: new fields must be appended after Algo for backwards amino compatibility
 type localInfo struct {
 	Name         string        `json:"name"`
 	PubKey       crypto.PubKey `json:"pubkey"`
 	PrivKeyArmor string        `json:"privkey.armor"`
 	Algo         SigningAlgo   `json:"algo"`
+	// ChainCode is the BIP 32 chain code of the stored private key. It is only
+	// set for extended keys, i.e. keys that support relative derivation.
+	ChainCode []byte `json:"chaincode,omitempty"`
+	// PassphraseHint is an optional user provided reminder of the passphrase
+	// protecting exported copies of the key. It is stored and displayed in
+	// plaintext and must never contain the passphrase or any derived material.
+	PassphraseHint string `json:"passphrase_hint,omitempty"`
+	// EncryptionPubKey is the x25519 public key derived from the same seed as
+	// the signing key. It is only set for keys created NewAccountWithEncryption.
+	EncryptionPubKey []byte `json:"encryption_pubkey,omitempty"`
+	// HDPath is the path the key was derived at from its mnemonic. It is empty
+	// for imported keys.
+	HDPath string `json:"hd_path,omitempty"`
+	// HasBIP39Passphrase records whether the key was derived from its mnemonic
+	// with a non empty BIP 39 passphrase. The passphrase itself is never stored.
+	HasBIP39Passphrase bool `json:"has_bip39_passphrase,omitempty"`
 }
 
 func newLocalInfo(name string, pub crypto.PubKey, privArmor string, algo SigningAlgo) Info {
@@ -237,6 +253,28 @@ func (i multiInfo) GetPath() (*hd.BIP44Params, error) {
 	return nil, fmt.Errorf("BIP44 Paths are not available for this type")
 }
 
+// InfoCodec defines the serialization of the Info objects stored in a keyring.
+type InfoCodec interface {
+	Marshal(info Info) ([]byte, error)
+	Unmarshal(bz []byte) (Info, error)
+}
+
+var _ InfoCodec = AminoInfoCodec{}
+
+// AminoInfoCodec is the default InfoCodec. It encodes Info objects as length
+// prefixed amino binary.
+type AminoInfoCodec struct{}
+
+// Marshal implements InfoCodec.
+func (AminoInfoCodec) Marshal(info Info) ([]byte, error) {
+	return CryptoCdc.MarshalBinaryLengthPrefixed(info)
+}
+
+// Unmarshal implements InfoCodec.
+func (AminoInfoCodec) Unmarshal(bz []byte) (Info, error) {
+	return unmarshalInfo(bz)
+}
+
 // encoding info
 func marshalInfo(i Info) []byte {
 	return CryptoCdc.MustMarshalBinaryLengthPrefixed(i)
@@ -1,8 +1,11 @@
 package keyring
 
 import (
+	"time"
+
 	"github.com/tendermint/tendermint/crypto"
 
+	"github.com/cosmos/cosmos-sdk/crypto/keys/hd"
 	"github.com/cosmos/cosmos-sdk/types"
 )
 
@@ -12,13 +15,65 @@ type Keybase interface {
 	List() ([]Info, error)
 	// Get returns the public information about one key.
 	Get(name string) (Info, error)
+	// ListModifiedSince returns the keys written after the given time.
+	ListModifiedSince(t time.Time) ([]Info, error)
 	// Get performs a by-address lookup and returns the public
 	// information about one key if there's any.
 	GetByAddress(address types.AccAddress) (Info, error)
+	// GetAddressForPrefix returns the address of a key Bech32 encoded with the
+	// given human readable prefix, regardless of the global Bech32 config.
+	GetAddressForPrefix(name, prefix string) (string, error)
+	// Fingerprint returns a short digest of the public key of a key.
+	Fingerprint(name string) (string, error)
+	// ListFingerprints returns the fingerprints of all keys.
+	ListFingerprints() ([]KeyFingerprint, error)
+	// FindDuplicates returns the groups of names of keys sharing a public key.
+	FindDuplicates() ([][]string, error)
+	// MergeDuplicates deletes the merged keys once verified to share the public
+	// key of the kept key.
+	MergeDuplicates(keepName string, mergeNames []string) error
+	// ListWithCapabilities returns the operations possible with each key.
+	ListWithCapabilities() ([]KeyCapabilities, error)
+	// SignableAddresses returns the addresses of all keys which can sign.
+	SignableAddresses() ([]types.AccAddress, error)
+	// CanSatisfyMultisig reports whether the keyring holds enough signing
+	// member keys to meet the threshold of a multisig key.
+	CanSatisfyMultisig(name string) (ok bool, available, required int, err error)
 	// Delete removes a key.
 	Delete(name, passphrase string, skipPass bool) error
+	// SetDefault designates a key as the default signer.
+	SetDefault(name string) error
+	// GetDefault returns the default signer, which is unset when it is deleted.
+	GetDefault() (Info, error)
+	// DeleteBatch deletes the named keys, or only reports the ones that would be
+	// deleted if dryRun is set, collecting the per-key errors.
+	DeleteBatch(names []string, dryRun bool) (deleted []string, errs map[string]error)
 	// Sign bytes, looking up the private key to use.
 	Sign(name, passphrase string, msg []byte) ([]byte, crypto.PubKey, error)
+	// SignMulti signs a batch of messages, each with its own key, collecting
+	// the error of each request.
+	SignMulti(requests []SignRequest) ([]SignResult, error)
+	// SignInDomain signs msg prefixed with the domain separation tag of domain.
+	// See DomainSignBytes for the exact bytes being signed.
+	SignInDomain(name, domain string, msg []byte) ([]byte, crypto.PubKey, error)
+	// SignTx validates a tx sign document and signs its canonical bytes.
+	SignTx(name string, doc StdSignDoc) ([]byte, crypto.PubKey, error)
+	// SignEncoded signs msg like Sign and returns the signature encoded with enc.
+	SignEncoded(name string, msg []byte, enc SignatureEncoding) (string, crypto.PubKey, error)
+	// SharedSecret derives an ECDH shared secret between a local key and a peer
+	// public key. See ECDHSharedSecret for the KDF applied.
+	SharedSecret(name string, peerPub crypto.PubKey) ([]byte, error)
+	// StealthAddress derives a one-time address paying the owner of a scan and
+	// a spend public key, and the ephemeral public key published alongside it.
+	StealthAddress(scanPubKey, spendPubKey crypto.PubKey) (types.AccAddress, crypto.PubKey, error)
+	// ScanForStealth reports whether a one-time address derived by
+	// StealthAddress pays the owner of a local scan key and a spend public key.
+	ScanForStealth(name string, spendPubKey, ephemeralPub crypto.PubKey, oneTimeAddr types.AccAddress) (bool, error)
+	// VerifyInDomain verifies a signature produced by SignInDomain.
+	VerifyInDomain(name, domain string, msg, sig []byte) (bool, error)
+	// SignOwnershipAttestation signs an attestation that the key controls its
+	// address. See OwnershipAttestationBytes for the signed bytes.
+	SignOwnershipAttestation(name, statement string, nonce []byte) ([]byte, crypto.PubKey, error)
 
 	// CreateMnemonic generates a new mnemonic, derives a hierarchical deterministic
 	// key from that. and persists it to storage, encrypted using the provided password.
@@ -27,19 +82,77 @@ type Keybase interface {
 	// same name.
 	CreateMnemonic(name string, language Language, passwd string, algo SigningAlgo) (info Info, seed string, err error)
 
+	// CreateMnemonicWithEntropy is like CreateMnemonic but generates a mnemonic
+	// of 12, 15, 18, 21 or 24 words for 128, 160, 192, 224 or 256 entropy bits.
+	CreateMnemonicWithEntropy(
+		name string, language Language, passwd string, entropyBits int, algo SigningAlgo,
+	) (info Info, seed string, err error)
+
 	// CreateAccount converts a mnemonic to a private key and BIP 32 HD Path
 	// and persists it, encrypted with the given password.
 	CreateAccount(name, mnemonic, bip39Passwd, encryptPasswd, hdPath string, algo SigningAlgo) (Info, error)
 
+	// VerifyMultisig verifies a combined multisig signature against the named
+	// multisig key. It returns ErrMultisigThresholdNotMet if fewer than threshold
+	// member signatures are present and ErrInvalidMultisigMemberSignature if any
+	// member signature is invalid.
+	VerifyMultisig(name string, msg, combinedSig []byte) (bool, error)
+
+	// CreateExtendedAccount converts a mnemonic to a BIP 32 extended private key
+	// at the given HD path and persists both the private key and its chain code,
+	// allowing child keys to be derived on demand via SignWithRelativePath.
+	CreateExtendedAccount(name, mnemonic, bip39Passwd, hdPath string, algo SigningAlgo) (Info, error)
+
+	// RestoreFromMnemonic derives the keys of a mnemonic at sequential indices
+	// and stores the ones isFunded reports as funded, stopping after gapLimit
+	// consecutive unfunded addresses.
+	RestoreFromMnemonic(
+		namePrefix, mnemonic, bip39Passwd string, algo SigningAlgo,
+		isFunded func(addr types.AccAddress) (bool, error), gapLimit int,
+	) ([]Info, error)
+
+	// NewAccountWithEncryption converts a mnemonic to a private key like
+	// CreateAccount and additionally derives an x25519 encryption key from the
+	// same seed, whose public key is stored alongside the signing key.
+	NewAccountWithEncryption(name, mnemonic, bip39Passwd, hdPath string, algo SigningAlgo) (Info, error)
+
+	// GetEncryptionPubKey returns the x25519 encryption public key of a key
+	// created by NewAccountWithEncryption.
+	GetEncryptionPubKey(name string) ([]byte, error)
+
+	// GetDerivationContext returns the HD path, algorithm and BIP 39
+	// passphrase presence a key was derived with, without any secret.
+	GetDerivationContext(name string) (DerivationContext, error)
+
+	// SignWithRelativePath derives a child key of a stored extended private key
+	// following relativePath and signs msg with it. The child key is not persisted.
+	SignWithRelativePath(name, relativePath string, msg []byte) ([]byte, crypto.PubKey, error)
+
 	// CreateLedger creates, stores, and returns a new Ledger key reference
 	CreateLedger(name string, algo SigningAlgo, hrp string, account, index uint32) (info Info, err error)
 
+	// CreateLedgerPubKey stores and returns a watch-only Ledger key reference
+	// from a previously exported public key and HD path, without the device
+	CreateLedgerPubKey(name string, pub crypto.PubKey, path hd.BIP44Params, algo SigningAlgo) (info Info, err error)
+
+	// AuditDerivation checks that the connected ledger device derives the
+	// stored public key of a ledger key from its stored path
+	AuditDerivation(name string) error
+
+	// CreateFIDO2 creates a credential for rpID on the FIDO2 authenticator and
+	// stores and returns a reference to it
+	CreateFIDO2(name, rpID string) (info Info, err error)
+
 	// CreateOffline creates, stores, and returns a new offline key reference
 	CreateOffline(name string, pubkey crypto.PubKey, algo SigningAlgo) (info Info, err error)
 
 	// CreateMulti creates, stores, and returns a new multsig (offline) key reference
 	CreateMulti(name string, pubkey crypto.PubKey) (info Info, err error)
 
+	// CreateMultisig creates, stores, and returns a new threshold multisig key
+	// reference of the given members, sorted canonically unless noSort is set
+	CreateMultisig(name string, threshold int, pubKeys []crypto.PubKey, noSort bool) (info Info, err error)
+
 	// Import imports ASCII armored Info objects.
 	Import(name string, armor string) (err error)
 
@@ -48,6 +161,15 @@ type Keybase interface {
 	// supplied.
 	ImportPrivKey(name, armor, passphrase string) error
 
+	// ImportExtendedPrivKey imports a BIP 32 extended private key (xprv) along
+	// with its chain code.
+	ImportExtendedPrivKey(name, xprv string, algo SigningAlgo) error
+
+	// ImportPrivKeyFromKMS imports a raw private key encrypted by an external key
+	// management service. decryptFn is called with the ciphertext and must return
+	// the plaintext private key bytes.
+	ImportPrivKeyFromKMS(name string, ciphertext []byte, decryptFn func([]byte) ([]byte, error), algo SigningAlgo) error
+
 	// ImportPubKey imports ASCII-armored public keys.
 	// Store a new Info object holding a public key only, i.e. it will
 	// not be possible to sign with it as it lacks the secret key.
@@ -65,9 +187,65 @@ type Keybase interface {
 	// It returns an error if the key does not exist or a wrong encryption passphrase is supplied.
 	ExportPrivKey(name, decryptPassphrase, encryptPassphrase string) (armor string, err error)
 
+	// BackupToFile writes an encrypted backup of all keys to a file.
+	BackupToFile(path, passphrase string) error
+
+	// RestoreFromFile restores the keys of a backup written by BackupToFile,
+	// skipping the names already in use, and returns the number of restored keys.
+	RestoreFromFile(path, passphrase string) (imported int, err error)
+
+	// ExportCompact returns a private key encrypted in a compact base64url
+	// format fitting a single QR code.
+	ExportCompact(name, passphrase string) (string, error)
+
+	// ImportCompact imports a private key exported by ExportCompact.
+	ImportCompact(name, compact, passphrase string) error
+
 	// ExportPrivateKeyObject *only* works on locally-stored keys. Temporary method until we redo the exporting API
 	ExportPrivateKeyObject(name string, passphrase string) (crypto.PrivKey, error)
 
+	// ExportHistory returns the export audit log of a key, oldest first. Exports
+	// are only recorded if the keyring was created WithExportAudit.
+	ExportHistory(name string) ([]ExportRecord, error)
+
+	// ExportAddressBook returns the name, address and public key of every stored
+	// key without any private key material.
+	ExportAddressBook() ([]byte, error)
+
+	// ImportAddressBook stores the entries of an exported address book as offline
+	// key references. Entries whose name already exists are skipped.
+	ImportAddressBook(bz []byte) error
+
+	// ExportValidatorPubKeys returns the consensus public key entries of the
+	// named keys for use in genesis validator setup.
+	ExportValidatorPubKeys(names []string) ([]ValidatorPubKeyEntry, error)
+
+	// SetPassphraseHint stores a plaintext reminder of the passphrase used for
+	// exported copies of a local key. The hint is not secret and must never
+	// contain the passphrase itself or anything derived from it.
+	SetPassphraseHint(name, hint string) error
+	// GetPassphraseHint returns the passphrase hint of a local key, if any.
+	GetPassphraseHint(name string) (string, error)
+
+	// SetSignRateLimit limits the number of signatures of a key per interval
+	// within this process.
+	SetSignRateLimit(name string, maxPerInterval int, interval time.Duration)
+
+	// Unlock caches the keyring passphrase for a bounded duration so that
+	// subsequent operations do not prompt for it again. It returns
+	// ErrSessionNotSupported for backends that do not prompt for a passphrase.
+	Unlock(passphrase string) (Session, error)
+
+	// Lock clears the passphrase cached by Unlock, if any, so that the next
+	// operation prompts for the passphrase again.
+	Lock()
+
+	// HealthCheck verifies that the keyring backend is accessible by listing
+	// the keys and reading back the keyring.healthcheck sentinel item, which
+	// is written first if missing, so that a broken keyring is detected before
+	// signing. The sentinel holds no key material.
+	HealthCheck() error
+
 	// SupportedAlgos returns a list of signing algorithms supported by the keybase
 	SupportedAlgos() []SigningAlgo
 
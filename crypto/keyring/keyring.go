@@ -2,6 +2,8 @@ package keyring
 
 import (
 	"bufio"
+	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/hex"
 	"fmt"
 	"io"
@@ -10,6 +12,8 @@ import (
 	"path/filepath"
 	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/99designs/keyring"
 	"github.com/pkg/errors"
@@ -17,9 +21,13 @@ import (
 	"github.com/tendermint/crypto/bcrypt"
 	tmcrypto "github.com/tendermint/tendermint/crypto"
 	cryptoAmino "github.com/tendermint/tendermint/crypto/encoding/amino"
+	"github.com/tendermint/tendermint/crypto/multisig"
+	"github.com/tendermint/tendermint/crypto/secp256k1"
+	"github.com/tendermint/tendermint/libs/bech32"
 
 	"github.com/cosmos/cosmos-sdk/client/input"
 	"github.com/cosmos/cosmos-sdk/crypto"
+	"github.com/cosmos/cosmos-sdk/crypto/keys/hd"
 	"github.com/cosmos/cosmos-sdk/types"
 	sdkerrors "github.com/cosmos/cosmos-sdk/types/errors"
 )
@@ -44,16 +52,29 @@ var _ Keybase = keyringKeybase{}
 // keyringKeybase implements the Keybase interface by using the Keyring library
 // for account key persistence.
 type keyringKeybase struct {
-	base baseKeybase
-	db   keyring.Keyring
+	base     baseKeybase
+	db       keyring.Keyring
+	session  *passphraseSession // nil for backends that don't prompt
+	writeMtx *sync.Mutex        // serializes writes so that key limits hold
+
+	signLimiter *signRateLimiter
 }
 
 var maxPassphraseEntryAttempts = 3
 
-func newKeyringKeybase(db keyring.Keyring, opts ...KeybaseOption) Keybase {
+func newKeyringKeybase(db keyring.Keyring, session *passphraseSession, opts ...KeybaseOption) Keybase {
+	base := newBaseKeybase(opts...)
+	if base.options.backendAttempts > 1 {
+		db = newRetryKeyring(db, session, base.options.backendAttempts, base.options.backendRetryDelay)
+	}
+
 	return keyringKeybase{
-		db:   db,
-		base: newBaseKeybase(opts...),
+		db:       db,
+		base:     base,
+		session:  session,
+		writeMtx: &sync.Mutex{},
+
+		signLimiter: newSignRateLimiter(),
 	}
 }
 
@@ -64,8 +85,13 @@ func NewKeyring(
 	appName, backend, rootDir string, userInput io.Reader, opts ...KeybaseOption,
 ) (Keybase, error) {
 
-	var db keyring.Keyring
-	var err error
+	var (
+		db      keyring.Keyring
+		session *passphraseSession
+		err     error
+	)
+
+	sessionTimeout := newBaseKeybase(opts...).options.sessionTimeout
 
 	switch backend {
 	case BackendMemory:
@@ -73,9 +99,15 @@ func NewKeyring(
 	case BackendTest:
 		db, err = keyring.Open(lkbToKeyringConfig(appName, rootDir, nil, true))
 	case BackendFile:
-		db, err = keyring.Open(newFileBackendKeyringConfig(appName, rootDir, userInput))
+		config := newFileBackendKeyringConfig(appName, rootDir, userInput)
+		session = newPassphraseSession(config.FileDir, sessionTimeout)
+		config.FilePasswordFunc = session.wrapPrompt(config.FilePasswordFunc)
+		db, err = openSessionKeyring(config, session)
 	case BackendOS:
-		db, err = keyring.Open(lkbToKeyringConfig(appName, rootDir, userInput, false))
+		config := lkbToKeyringConfig(appName, rootDir, userInput, false)
+		session = newPassphraseSession(config.FileDir, sessionTimeout)
+		config.FilePasswordFunc = session.wrapPrompt(config.FilePasswordFunc)
+		db, err = openSessionKeyring(config, session)
 	case BackendKWallet:
 		db, err = keyring.Open(newKWalletBackendKeyringConfig(appName, rootDir, userInput))
 	case BackendPass:
@@ -87,14 +119,14 @@ func NewKeyring(
 		return nil, err
 	}
 
-	return newKeyringKeybase(db, opts...), nil
+	return newKeyringKeybase(db, session, opts...), nil
 }
 
 // NewInMemory creates a transient keyring useful for testing
 // purposes and on-the-fly key generation.
 // Keybase options can be applied when generating this new Keybase.
 func NewInMemory(opts ...KeybaseOption) Keybase {
-	return newKeyringKeybase(keyring.NewArrayKeyring(nil), opts...)
+	return newKeyringKeybase(keyring.NewArrayKeyring(nil), nil, opts...)
 }
 
 // CreateMnemonic generates a new key and persists it to storage, encrypted
@@ -108,6 +140,15 @@ func (kb keyringKeybase) CreateMnemonic(
 	return kb.base.CreateMnemonic(kb, name, language, passwd, algo)
 }
 
+// CreateMnemonicWithEntropy is like CreateMnemonic but generates a mnemonic of
+// entropyBits bits of entropy, which must be a BIP 39 entropy size.
+func (kb keyringKeybase) CreateMnemonicWithEntropy(
+	name string, language Language, passwd string, entropyBits int, algo SigningAlgo,
+) (info Info, mnemonic string, err error) {
+
+	return kb.base.CreateMnemonicWithEntropy(kb, name, language, passwd, entropyBits, algo)
+}
+
 // CreateAccount converts a mnemonic to a private key and persists it, encrypted
 // with the given password.
 func (kb keyringKeybase) CreateAccount(
@@ -117,6 +158,25 @@ func (kb keyringKeybase) CreateAccount(
 	return kb.base.CreateAccount(kb, name, mnemonic, bip39Passwd, encryptPasswd, hdPath, algo)
 }
 
+// RestoreFromMnemonic discovers the funded accounts of a mnemonic and stores
+// them as local keys named namePrefix-index.
+func (kb keyringKeybase) RestoreFromMnemonic(
+	namePrefix, mnemonic, bip39Passwd string, algo SigningAlgo,
+	isFunded func(addr types.AccAddress) (bool, error), gapLimit int,
+) ([]Info, error) {
+
+	return kb.base.RestoreFromMnemonic(kb, namePrefix, mnemonic, bip39Passwd, algo, isFunded, gapLimit)
+}
+
+// CreateExtendedAccount converts a mnemonic to an extended private key at the
+// given HD path and persists it along with its chain code.
+func (kb keyringKeybase) CreateExtendedAccount(
+	name, mnemonic, bip39Passwd, hdPath string, algo SigningAlgo,
+) (Info, error) {
+
+	return kb.base.CreateExtendedAccount(kb, name, mnemonic, bip39Passwd, hdPath, algo)
+}
+
 // CreateLedger creates a new locally-stored reference to a Ledger keypair.
 // It returns the created key info and an error if the Ledger could not be queried.
 func (kb keyringKeybase) CreateLedger(
@@ -126,16 +186,58 @@ func (kb keyringKeybase) CreateLedger(
 	return kb.base.CreateLedger(kb, name, algo, hrp, account, index)
 }
 
+// CreateLedgerPubKey creates a new locally-stored reference to a Ledger keypair
+// from its public key and HD path, without querying the device. The key can be
+// used to verify signatures; signing fails with ErrLedgerDeviceNotAvailable
+// unless the device is connected.
+func (kb keyringKeybase) CreateLedgerPubKey(
+	name string, pub tmcrypto.PubKey, path hd.BIP44Params, algo SigningAlgo,
+) (Info, error) {
+
+	if !IsSupportedAlgorithm(kb.SupportedAlgosLedger(), algo) {
+		return nil, ErrUnsupportedSigningAlgo
+	}
+
+	if pub == nil {
+		return nil, errors.New("public key is required")
+	}
+
+	return kb.base.writeLedgerKey(kb, name, pub, path, algo)
+}
+
+// CreateFIDO2 creates a new Ed25519 credential scoped to the relying party rpID
+// on the configured FIDO2 authenticator and stores a reference to it. The
+// private key never leaves the authenticator, signing with the key requires
+// the user's presence.
+func (kb keyringKeybase) CreateFIDO2(name, rpID string) (Info, error) {
+	authenticator := kb.base.options.fido2Authenticator
+	if authenticator == nil {
+		return nil, ErrFIDO2NotAvailable
+	}
+
+	credentialID, pub, err := authenticator.MakeCredential(rpID)
+	if err != nil {
+		return nil, err
+	}
+
+	info := newFIDO2Info(name, PubKeyFIDO2{RPID: rpID, Key: pub}, credentialID)
+	if err := kb.writeInfo(name, info); err != nil {
+		return nil, err
+	}
+
+	return info, nil
+}
+
 // CreateOffline creates a new reference to an offline keypair. It returns the
 // created key info.
 func (kb keyringKeybase) CreateOffline(name string, pub tmcrypto.PubKey, algo SigningAlgo) (Info, error) {
-	return kb.base.writeOfflineKey(kb, name, pub, algo), nil
+	return kb.base.writeOfflineKey(kb, name, pub, algo)
 }
 
 // CreateMulti creates a new reference to a multisig (offline) keypair. It
 // returns the created key Info object.
 func (kb keyringKeybase) CreateMulti(name string, pub tmcrypto.PubKey) (Info, error) {
-	return kb.base.writeMultisigKey(kb, name, pub), nil
+	return kb.base.writeMultisigKey(kb, name, pub)
 }
 
 // List returns the keys from storage in alphabetical order.
@@ -159,7 +261,7 @@ func (kb keyringKeybase) List() ([]Info, error) {
 				return nil, sdkerrors.Wrap(sdkerrors.ErrKeyNotFound, key)
 			}
 
-			info, err := unmarshalInfo(rawInfo.Data)
+			info, err := kb.decodeInfo(rawInfo.Data)
 			if err != nil {
 				return nil, err
 			}
@@ -171,6 +273,40 @@ func (kb keyringKeybase) List() ([]Info, error) {
 	return res, nil
 }
 
+// ListModifiedSince returns the keys written after t, sorted by name. Keys are
+// stamped with their modification time whenever they are written. Keys written
+// before modification times were recorded have no stamp and are always
+// returned, so that incremental backups never miss them.
+func (kb keyringKeybase) ListModifiedSince(t time.Time) ([]Info, error) {
+	infos, err := kb.List()
+	if err != nil {
+		return nil, err
+	}
+
+	var res []Info
+	for _, info := range infos {
+		item, err := kb.db.Get(string(modifiedKey(info.GetName())))
+		if err == keyring.ErrKeyNotFound {
+			res = append(res, info)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		modified, err := time.Parse(time.RFC3339Nano, string(item.Data))
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid modification time of key %s", info.GetName())
+		}
+
+		if modified.After(t) {
+			res = append(res, info)
+		}
+	}
+
+	return res, nil
+}
+
 // Get returns the public information about one key.
 func (kb keyringKeybase) Get(name string) (Info, error) {
 	key := infoKey(name)
@@ -184,7 +320,7 @@ func (kb keyringKeybase) Get(name string) (Info, error) {
 		return nil, sdkerrors.Wrap(sdkerrors.ErrKeyNotFound, name)
 	}
 
-	return unmarshalInfo(bs.Data)
+	return kb.decodeInfo(bs.Data)
 }
 
 // GetByAddress fetches a key by address and returns its public information.
@@ -203,17 +339,212 @@ func (kb keyringKeybase) GetByAddress(address types.AccAddress) (Info, error) {
 		return nil, err
 	}
 
-	return unmarshalInfo(bs.Data)
+	return kb.decodeInfo(bs.Data)
+}
+
+// GetAddressForPrefix returns the address of the named key Bech32 encoded with
+// the given human readable prefix. Unlike AccAddress.String, it does not depend
+// on the global sdk.Config, which therefore never needs to be modified in order
+// to display an address for another chain.
+func (kb keyringKeybase) GetAddressForPrefix(name, prefix string) (string, error) {
+	info, err := kb.Get(name)
+	if err != nil {
+		return "", err
+	}
+
+	if prefix == "" {
+		return "", errors.New("bech32 prefix cannot be empty")
+	}
+
+	return bech32.ConvertAndEncode(prefix, kb.addressOf(info).Bytes())
+}
+
+// Fingerprint returns the fingerprint of the public key of the named key. See
+// PubKeyFingerprint.
+func (kb keyringKeybase) Fingerprint(name string) (string, error) {
+	info, err := kb.Get(name)
+	if err != nil {
+		return "", err
+	}
+
+	return PubKeyFingerprint(info.GetPubKey()), nil
+}
+
+// ListFingerprints returns the fingerprints of all stored keys sorted by name.
+func (kb keyringKeybase) ListFingerprints() ([]KeyFingerprint, error) {
+	infos, err := kb.List()
+	if err != nil {
+		return nil, err
+	}
+
+	fingerprints := make([]KeyFingerprint, len(infos))
+	for i, info := range infos {
+		fingerprints[i] = KeyFingerprint{
+			Name:        info.GetName(),
+			Fingerprint: PubKeyFingerprint(info.GetPubKey()),
+		}
+	}
+
+	return fingerprints, nil
+}
+
+// FindDuplicates returns the names of the keys sharing the same public key,
+// grouped by public key fingerprint. Groups and the names within them are
+// sorted; keys with a unique public key are not reported.
+func (kb keyringKeybase) FindDuplicates() ([][]string, error) {
+	infos, err := kb.List()
+	if err != nil {
+		return nil, err
+	}
+
+	groups := make(map[string][]string)
+	var fingerprints []string
+	for _, info := range infos {
+		fp := PubKeyFingerprint(info.GetPubKey())
+		if _, ok := groups[fp]; !ok {
+			fingerprints = append(fingerprints, fp)
+		}
+		groups[fp] = append(groups[fp], info.GetName())
+	}
+
+	var duplicates [][]string
+	for _, fp := range fingerprints {
+		if names := groups[fp]; len(names) > 1 {
+			sort.Strings(names)
+			duplicates = append(duplicates, names)
+		}
+	}
+
+	sort.Slice(duplicates, func(i, j int) bool { return duplicates[i][0] < duplicates[j][0] })
+
+	return duplicates, nil
+}
+
+// MergeDuplicates deletes the merged keys, keeping keepName. All of them must
+// share the public key of the kept key, which is verified before anything is
+// deleted. The address lookup entry shared by the keys is kept pointing at the
+// kept key. A merged key which is the default key is unset as the default.
+func (kb keyringKeybase) MergeDuplicates(keepName string, mergeNames []string) error {
+	keep, err := kb.Get(keepName)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range mergeNames {
+		if name == keepName {
+			return fmt.Errorf("cannot merge key %s into itself", name)
+		}
+
+		info, err := kb.Get(name)
+		if err != nil {
+			return err
+		}
+
+		if !info.GetPubKey().Equals(keep.GetPubKey()) {
+			return fmt.Errorf("key %s does not share the public key of %s", name, keepName)
+		}
+	}
+
+	for _, name := range mergeNames {
+		if err := kb.db.Remove(string(infoKey(name))); err != nil {
+			return err
+		}
+
+		err := kb.db.Remove(string(modifiedKey(name)))
+		if err != nil && err != keyring.ErrKeyNotFound {
+			return err
+		}
+
+		if err := kb.clearDefault(name); err != nil {
+			return err
+		}
+	}
+
+	return kb.db.Set(keyring.Item{
+		Key:  string(addrHexKey(kb.addressOf(keep))),
+		Data: infoKey(keepName),
+	})
+}
+
+// ListWithCapabilities returns the capabilities of all stored keys sorted by
+// name.
+func (kb keyringKeybase) ListWithCapabilities() ([]KeyCapabilities, error) {
+	infos, err := kb.List()
+	if err != nil {
+		return nil, err
+	}
+
+	capabilities := make([]KeyCapabilities, len(infos))
+	for i, info := range infos {
+		capabilities[i] = kb.capabilities(info)
+	}
+
+	return capabilities, nil
+}
+
+// SignableAddresses returns the addresses of the stored keys which can sign,
+// i.e. local keys holding a private key, ledger keys and FIDO2 keys when an
+// authenticator is set, in the alphabetical order of the key names.
+func (kb keyringKeybase) SignableAddresses() ([]types.AccAddress, error) {
+	infos, err := kb.List()
+	if err != nil {
+		return nil, err
+	}
+
+	var addrs []types.AccAddress
+	for _, info := range infos {
+		if kb.capabilities(info).CanSign {
+			addrs = append(addrs, kb.addressOf(info))
+		}
+	}
+
+	return addrs, nil
+}
+
+// capabilities returns the capabilities of the key described by info. It must
+// agree with the checks of Sign and ExportPrivateKeyObject.
+func (kb keyringKeybase) capabilities(info Info) KeyCapabilities {
+	c := KeyCapabilities{Name: info.GetName()}
+
+	switch linfo := info.(type) {
+	case localInfo:
+		c.CanSign = linfo.PrivKeyArmor != ""
+		c.CanExportPriv = c.CanSign && !kb.base.options.noPrivExport
+
+	case ledgerInfo:
+		c.CanSign = true
+		c.IsLedger = true
+
+	case fido2Info:
+		c.CanSign = kb.base.options.fido2Authenticator != nil
+
+	case multiInfo:
+		c.IsMultisig = true
+	}
+
+	return c
 }
 
 // Sign signs an arbitrary set of bytes with the named key. It returns an error
 // if the key doesn't exist or the decryption fails.
 func (kb keyringKeybase) Sign(name, passphrase string, msg []byte) (sig []byte, pub tmcrypto.PubKey, err error) {
+	// only existing keys are rate limited, so that signing with unknown names
+	// does not fill the limiter with buckets
 	info, err := kb.Get(name)
 	if err != nil {
 		return
 	}
 
+	if err := kb.signLimiter.take(name); err != nil {
+		return nil, nil, err
+	}
+
+	defer func() {
+		if err == nil {
+			kb.auditSign(name, msg)
+		}
+	}()
+
 	var priv tmcrypto.PrivKey
 
 	switch i := info.(type) {
@@ -230,6 +561,9 @@ func (kb keyringKeybase) Sign(name, passphrase string, msg []byte) (sig []byte,
 	case ledgerInfo:
 		return SignWithLedger(info, msg)
 
+	case fido2Info:
+		return signWithFIDO2(kb.base.options.fido2Authenticator, i, msg)
+
 	case offlineInfo, multiInfo:
 		return nil, info.GetPubKey(), errors.New("cannot sign with offline keys")
 	}
@@ -242,8 +576,200 @@ func (kb keyringKeybase) Sign(name, passphrase string, msg []byte) (sig []byte,
 	return sig, priv.PubKey(), nil
 }
 
+// SignEncoded signs msg with the named key and returns the signature encoded
+// with enc.
+func (kb keyringKeybase) SignEncoded(name string, msg []byte, enc SignatureEncoding) (string, tmcrypto.PubKey, error) {
+	sig, pub, err := kb.Sign(name, "", msg)
+	if err != nil {
+		return "", nil, err
+	}
+
+	encoded, err := enc.Encode(sig)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return encoded, pub, nil
+}
+
+// SignInDomain signs the domain separated bytes of msg as defined by
+// DomainSignBytes with the named key.
+func (kb keyringKeybase) SignInDomain(name, domain string, msg []byte) ([]byte, tmcrypto.PubKey, error) {
+	return kb.Sign(name, "", DomainSignBytes(domain, msg))
+}
+
+// VerifyInDomain verifies that sig is a signature of msg in the given domain
+// by the named key.
+func (kb keyringKeybase) VerifyInDomain(name, domain string, msg, sig []byte) (bool, error) {
+	info, err := kb.Get(name)
+	if err != nil {
+		return false, err
+	}
+
+	return info.GetPubKey().VerifyBytes(DomainSignBytes(domain, msg), sig), nil
+}
+
+// SharedSecret derives the ECDH shared secret between the named local key and
+// peerPub as defined by ECDHSharedSecret. Only local secp256k1 keys are
+// supported.
+func (kb keyringKeybase) SharedSecret(name string, peerPub tmcrypto.PubKey) ([]byte, error) {
+	info, err := kb.Get(name)
+	if err != nil {
+		return nil, err
+	}
+
+	linfo, ok := info.(localInfo)
+	if !ok {
+		return nil, errors.New("shared secrets can only be derived from local keys")
+	}
+
+	if linfo.PrivKeyArmor == "" {
+		return nil, fmt.Errorf("private key not available")
+	}
+
+	priv, err := cryptoAmino.PrivKeyFromBytes([]byte(linfo.PrivKeyArmor))
+	if err != nil {
+		return nil, err
+	}
+
+	return ECDHSharedSecret(priv, peerPub)
+}
+
+// VerifyMultisig verifies that combinedSig is a valid multisig signature of msg
+// for the named multisig key, i.e. that it contains at least threshold member
+// signatures and that every member signature is valid.
+func (kb keyringKeybase) VerifyMultisig(name string, msg, combinedSig []byte) (bool, error) {
+	info, err := kb.Get(name)
+	if err != nil {
+		return false, err
+	}
+
+	multiPK, ok := info.GetPubKey().(multisig.PubKeyMultisigThreshold)
+	if !ok {
+		return false, fmt.Errorf("key %s is not a multisig key", name)
+	}
+
+	var sig multisig.Multisignature
+	if err := CryptoCdc.UnmarshalBinaryBare(combinedSig, &sig); err != nil {
+		return false, errors.Wrap(err, "failed to decode multisig signature")
+	}
+
+	size := len(multiPK.PubKeys)
+	if sig.BitArray == nil || sig.BitArray.Size() != size {
+		return false, fmt.Errorf("multisig signature does not match the %d members of key %s", size, name)
+	}
+
+	numSigs := sig.BitArray.NumTrueBitsBefore(size)
+	if numSigs != len(sig.Sigs) {
+		return false, fmt.Errorf("multisig signature bit array marks %d signatures but contains %d", numSigs, len(sig.Sigs))
+	}
+
+	if numSigs < int(multiPK.K) {
+		return false, errors.Wrapf(ErrMultisigThresholdNotMet, "got %d signatures, require %d", numSigs, multiPK.K)
+	}
+
+	sigIndex := 0
+	for i := 0; i < size; i++ {
+		if !sig.BitArray.GetIndex(i) {
+			continue
+		}
+
+		if !multiPK.PubKeys[i].VerifyBytes(msg, sig.Sigs[sigIndex]) {
+			return false, errors.Wrapf(ErrInvalidMultisigMemberSignature, "member %d", i)
+		}
+
+		sigIndex++
+	}
+
+	return true, nil
+}
+
+// SignWithRelativePath derives the child key at relativePath from the named
+// extended private key and signs msg with it. It returns an error if the key
+// does not hold extended key material.
+func (kb keyringKeybase) SignWithRelativePath(name, relativePath string, msg []byte) ([]byte, tmcrypto.PubKey, error) {
+	info, err := kb.Get(name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := kb.signLimiter.take(name); err != nil {
+		return nil, nil, err
+	}
+
+	linfo, ok := info.(localInfo)
+	if !ok || len(linfo.ChainCode) != 32 {
+		return nil, nil, fmt.Errorf("key %s is not an extended private key", name)
+	}
+
+	priv, err := cryptoAmino.PrivKeyFromBytes([]byte(linfo.PrivKeyArmor))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	secpPriv, ok := priv.(secp256k1.PrivKeySecp256k1)
+	if !ok {
+		return nil, nil, ErrUnsupportedSigningAlgo
+	}
+
+	var chainCode [32]byte
+	copy(chainCode[:], linfo.ChainCode)
+
+	derivedPriv, err := hd.DerivePrivateKeyForPath(secpPriv, chainCode, relativePath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	child := SecpPrivKeyGen(derivedPriv[:])
+
+	sig, err := child.Sign(msg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	kb.auditSign(name, msg)
+
+	return sig, child.PubKey(), nil
+}
+
+// auditSign reports a successful signature of msg by the named key to the sign
+// audit log, if any.
+func (kb keyringKeybase) auditSign(name string, msg []byte) {
+	if kb.base.options.signAuditLog == nil {
+		return
+	}
+
+	hash := sha256.Sum256(msg)
+	kb.base.options.signAuditLog(name, hash[:], time.Now().UTC())
+}
+
+// AuditDerivation re-derives the public key of a ledger key from its stored
+// path on the connected device and compares it to the stored public key. It
+// returns ErrLedgerDeviceNotAvailable if the device cannot be reached and
+// ErrLedgerPubKeyMismatch if the keys differ, e.g. because the stored key was
+// tampered with or another device is connected.
+func (kb keyringKeybase) AuditDerivation(name string) error {
+	info, err := kb.Get(name)
+	if err != nil {
+		return err
+	}
+
+	switch info.(type) {
+	case *ledgerInfo, ledgerInfo:
+	default:
+		return errors.Wrap(ErrNotLedgerKey, name)
+	}
+
+	_, err = ledgerPrivKey(info)
+	return err
+}
+
 // ExportPrivateKeyObject exports an armored private key object.
 func (kb keyringKeybase) ExportPrivateKeyObject(name string, passphrase string) (tmcrypto.PrivKey, error) {
+	if kb.base.options.noPrivExport {
+		return nil, ErrPrivExportDisabled
+	}
+
 	info, err := kb.Get(name)
 	if err != nil {
 		return nil, err
@@ -263,14 +789,65 @@ func (kb keyringKeybase) ExportPrivateKeyObject(name string, passphrase string)
 			return nil, err
 		}
 
+	case fido2Info:
+		return nil, ErrFIDO2ExportNotPermitted
+
 	case ledgerInfo, offlineInfo, multiInfo:
 		return nil, errors.New("only works on local private keys")
 	}
 
+	if kb.base.options.exportAudit {
+		if err := kb.recordExport(name); err != nil {
+			return nil, errors.Wrap(err, "failed to record key export")
+		}
+	}
+
 	return priv, nil
 }
 
-// Export exports armored private key to the caller.
+// ExportHistory returns the export audit log of the named key. The log is kept
+// even if the key is deleted.
+func (kb keyringKeybase) ExportHistory(name string) ([]ExportRecord, error) {
+	item, err := kb.db.Get(string(exportAuditKey(name)))
+	if err == keyring.ErrKeyNotFound || (err == nil && len(item.Data) == 0) {
+		return []ExportRecord{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var records []ExportRecord
+	if err := CryptoCdc.UnmarshalJSON(item.Data, &records); err != nil {
+		return nil, errors.Wrap(err, "failed to decode export history")
+	}
+
+	return records, nil
+}
+
+// recordExport appends an entry to the export audit log of the named key.
+func (kb keyringKeybase) recordExport(name string) error {
+	kb.writeMtx.Lock()
+	defer kb.writeMtx.Unlock()
+
+	records, err := kb.ExportHistory(name)
+	if err != nil {
+		return err
+	}
+
+	bz, err := CryptoCdc.MarshalJSON(append(records, ExportRecord{Name: name, Time: time.Now().UTC()}))
+	if err != nil {
+		return err
+	}
+
+	return kb.db.Set(keyring.Item{
+		Key:  string(exportAuditKey(name)),
+		Data: bz,
+	})
+}
+
+// Export exports armored private key to the caller. The armored Info of a
+// local key includes its private key, hence such keys cannot be exported from
+// a keyring created WithNoPrivExport.
 func (kb keyringKeybase) Export(name string) (armor string, err error) {
 	bz, err := kb.db.Get(string(infoKey(name)))
 	if err != nil {
@@ -281,9 +858,33 @@ func (kb keyringKeybase) Export(name string) (armor string, err error) {
 		return "", fmt.Errorf("no key to export with name: %s", name)
 	}
 
+	info, err := unmarshalInfo(bz.Data)
+	if err != nil {
+		return "", err
+	}
+
+	if hasPrivKey(info) {
+		if kb.base.options.noPrivExport {
+			return "", ErrPrivExportDisabled
+		}
+
+		if kb.base.options.exportAudit {
+			if err := kb.recordExport(name); err != nil {
+				return "", errors.Wrap(err, "failed to record key export")
+			}
+		}
+	}
+
 	return crypto.ArmorInfoBytes(bz.Data), nil
 }
 
+// hasPrivKey reports whether info holds a private key, i.e. is a local key
+// which is not offline.
+func hasPrivKey(info Info) bool {
+	linfo, ok := info.(localInfo)
+	return ok && linfo.PrivKeyArmor != ""
+}
+
 // ExportPubKey returns public keys in ASCII armored format. It retrieves an Info
 // object by its name and return the public key in a portable format.
 func (kb keyringKeybase) ExportPubKey(name string) (armor string, err error) {
@@ -316,22 +917,12 @@ func (kb keyringKeybase) Import(name string, armor string) error {
 		return err
 	}
 
-	info, err := unmarshalInfo(infoBytes)
-	if err != nil {
-		return err
-	}
-
-	kb.writeInfo(name, info)
-
-	err = kb.db.Set(keyring.Item{
-		Key:  string(addrHexKey(info.GetAddress())),
-		Data: infoKey(name),
-	})
+	info, err := kb.decodeInfo(infoBytes)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	return kb.writeInfo(name, info)
 }
 
 // ExportPrivKey returns a private key in ASCII armored format. An error is returned
@@ -347,7 +938,26 @@ func (kb keyringKeybase) ExportPrivKey(name, decryptPassphrase, encryptPassphras
 		return "", err
 	}
 
-	return crypto.EncryptArmorPrivKey(priv, encryptPassphrase, string(info.GetAlgo())), nil
+	cost, err := kb.armorBcryptCost()
+	if err != nil {
+		return "", err
+	}
+
+	return crypto.EncryptArmorPrivKeyWithCost(priv, encryptPassphrase, string(info.GetAlgo()), cost), nil
+}
+
+// armorBcryptCost returns the bcrypt cost of the key derivation protecting
+// exported private keys.
+func (kb keyringKeybase) armorBcryptCost() (int, error) {
+	cost := kb.base.options.armorBcryptCost
+	if cost == 0 {
+		return crypto.EffectiveBcryptCost(crypto.BcryptSecurityParameter), nil
+	}
+	if cost < crypto.MinBcryptCost || cost > crypto.MaxBcryptCost {
+		return 0, fmt.Errorf("invalid armor bcrypt cost %d", cost)
+	}
+
+	return cost, nil
 }
 
 // ImportPrivKey imports a private key in ASCII armor format. An error is returned
@@ -364,8 +974,106 @@ func (kb keyringKeybase) ImportPrivKey(name, armor, passphrase string) error {
 	}
 
 	// NOTE: The keyring keystore has no need for a passphrase.
-	kb.writeLocalKey(name, privKey, SigningAlgo(algo))
-	return nil
+	_, err = kb.writeLocalKey(name, privKey, SigningAlgo(algo))
+	return err
+}
+
+// ExportCompact exports the private key of a local key encrypted with
+// passphrase in the compact format of crypto.EncryptCompactPrivKey, suitable
+// for a single QR code. Only local keys can be exported.
+func (kb keyringKeybase) ExportCompact(name, passphrase string) (string, error) {
+	priv, err := kb.ExportPrivateKeyObject(name, "")
+	if err != nil {
+		return "", err
+	}
+
+	info, err := kb.Get(name)
+	if err != nil {
+		return "", err
+	}
+
+	cost, err := kb.armorBcryptCost()
+	if err != nil {
+		return "", err
+	}
+
+	return crypto.EncryptCompactPrivKeyWithCost(priv, passphrase, string(info.GetAlgo()), cost), nil
+}
+
+// ImportCompact imports a private key exported by ExportCompact. It returns an
+// error if a key with the same name exists or a wrong passphrase is supplied.
+func (kb keyringKeybase) ImportCompact(name, compact, passphrase string) error {
+	if kb.HasKey(name) {
+		return fmt.Errorf("cannot overwrite key: %s", name)
+	}
+
+	privKey, algo, err := crypto.DecryptCompactPrivKey(compact, passphrase)
+	if err != nil {
+		return errors.Wrap(err, "failed to decrypt private key")
+	}
+
+	_, err = kb.writeLocalKey(name, privKey, SigningAlgo(algo))
+	return err
+}
+
+// ImportExtendedPrivKey imports a Base58Check serialized BIP 32 extended
+// private key (xprv or tprv). The key is stored along with its chain code, so
+// that child keys can be derived relative to it via SignWithRelativePath. Only
+// secp256k1 keys are supported.
+func (kb keyringKeybase) ImportExtendedPrivKey(name, xprv string, algo SigningAlgo) error {
+	if algo != Secp256k1 {
+		return ErrUnsupportedSigningAlgo
+	}
+
+	if kb.HasKey(name) {
+		return fmt.Errorf("cannot overwrite key: %s", name)
+	}
+
+	priv, chainCode, err := hd.ParseExtendedPrivKey(xprv)
+	if err != nil {
+		return errors.Wrap(err, "failed to parse extended private key")
+	}
+
+	_, err = kb.base.writeExtendedLocalKey(kb, name, SecpPrivKeyGen(priv[:]), chainCode[:], algo)
+	return err
+}
+
+// ImportPrivKeyFromKMS decrypts ciphertext with decryptFn, which typically wraps
+// a call to an external key management service, and stores the resulting raw
+// private key. The decrypted bytes are zeroed once the key has been stored.
+func (kb keyringKeybase) ImportPrivKeyFromKMS(
+	name string, ciphertext []byte, decryptFn func([]byte) ([]byte, error), algo SigningAlgo,
+) error {
+	if kb.HasKey(name) {
+		return fmt.Errorf("cannot overwrite key: %s", name)
+	}
+
+	if !IsSupportedAlgorithm(kb.SupportedAlgos(), algo) {
+		return ErrUnsupportedSigningAlgo
+	}
+
+	plaintext, err := decryptFn(ciphertext)
+	if err != nil {
+		return errors.Wrap(err, "failed to decrypt private key")
+	}
+
+	defer func() {
+		for i := range plaintext {
+			plaintext[i] = 0
+		}
+	}()
+
+	if size, ok := privKeySizes[algo]; !ok || len(plaintext) != size {
+		return fmt.Errorf("invalid %s private key length: %d", algo, len(plaintext))
+	}
+
+	privKey, err := kb.base.options.keygenFunc(plaintext, algo)
+	if err != nil {
+		return err
+	}
+
+	_, err = kb.writeLocalKey(name, privKey, algo)
+	return err
 }
 
 // HasKey returns whether the key exists in the keyring.
@@ -397,8 +1105,8 @@ func (kb keyringKeybase) ImportPubKey(name string, armor string) error {
 		return err
 	}
 
-	kb.base.writeOfflineKey(kb, name, pubKey, SigningAlgo(algo))
-	return nil
+	_, err = kb.base.writeOfflineKey(kb, name, pubKey, SigningAlgo(algo))
+	return err
 }
 
 // Delete removes key forever, but we must present the proper passphrase before
@@ -412,7 +1120,7 @@ func (kb keyringKeybase) Delete(name, _ string, _ bool) error {
 		return err
 	}
 
-	err = kb.db.Remove(string(addrHexKey(info.GetAddress())))
+	err = kb.db.Remove(string(addrHexKey(kb.addressOf(info))))
 	if err != nil {
 		return err
 	}
@@ -422,9 +1130,171 @@ func (kb keyringKeybase) Delete(name, _ string, _ bool) error {
 		return err
 	}
 
+	err = kb.db.Remove(string(modifiedKey(name)))
+	if err != nil && err != keyring.ErrKeyNotFound {
+		return err
+	}
+
+	return kb.clearDefault(name)
+}
+
+// DeleteBatch deletes the named keys along with their address lookup entries.
+// It continues past keys that cannot be deleted and returns the names of the
+// deleted keys and the errors of the failed ones, keyed by name. If dryRun is
+// set nothing is removed and the keys that exist are reported as deleted.
+func (kb keyringKeybase) DeleteBatch(names []string, dryRun bool) (deleted []string, errs map[string]error) {
+	errs = make(map[string]error)
+
+	for _, name := range names {
+		var err error
+		if dryRun {
+			_, err = kb.Get(name)
+		} else {
+			err = kb.Delete(name, "", true)
+		}
+
+		if err != nil {
+			errs[name] = err
+			continue
+		}
+
+		deleted = append(deleted, name)
+	}
+
+	return deleted, errs
+}
+
+// ExportAddressBook returns a JSON encoded list of public-only Info objects for
+// all stored keys. Local and Ledger keys are exported as offline keys while
+// multisig keys retain their threshold information.
+func (kb keyringKeybase) ExportAddressBook() ([]byte, error) {
+	infos, err := kb.List()
+	if err != nil {
+		return nil, err
+	}
+
+	book := make([]Info, 0, len(infos))
+	for _, info := range infos {
+		switch info.(type) {
+		case multiInfo, *multiInfo:
+			book = append(book, NewMultiInfo(info.GetName(), info.GetPubKey()))
+
+		default:
+			book = append(book, newOfflineInfo(info.GetName(), info.GetPubKey(), info.GetAlgo()))
+		}
+	}
+
+	return CryptoCdc.MarshalJSON(book)
+}
+
+// ImportAddressBook stores the entries of an address book produced by
+// ExportAddressBook. Imported keys can be used to verify signatures but not to
+// sign. Entries whose name already exists in the keyring are skipped.
+func (kb keyringKeybase) ImportAddressBook(bz []byte) error {
+	var book []Info
+	if err := CryptoCdc.UnmarshalJSON(bz, &book); err != nil {
+		return errors.Wrap(err, "failed to decode address book")
+	}
+
+	for _, info := range book {
+		switch info.(type) {
+		case offlineInfo, *offlineInfo, multiInfo, *multiInfo:
+		default:
+			return fmt.Errorf("address book entry %s is not a public-only key", info.GetName())
+		}
+
+		if kb.HasKey(info.GetName()) {
+			continue
+		}
+
+		if err := kb.writeInfo(info.GetName(), info); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
+// ExportValidatorPubKeys returns a ValidatorPubKeyEntry for each of the named
+// keys. Multisig keys cannot be used as consensus keys and are rejected.
+func (kb keyringKeybase) ExportValidatorPubKeys(names []string) ([]ValidatorPubKeyEntry, error) {
+	entries := make([]ValidatorPubKeyEntry, 0, len(names))
+
+	for _, name := range names {
+		info, err := kb.Get(name)
+		if err != nil {
+			return nil, err
+		}
+
+		if info.GetType() == TypeMulti {
+			return nil, fmt.Errorf("key %s is a multisig key and has no usable validator public key", name)
+		}
+
+		entry, err := NewValidatorPubKeyEntry(info)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to encode public key of %s", name)
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+// SetPassphraseHint stores a plaintext passphrase hint alongside the named local
+// key. An empty hint removes an existing one.
+func (kb keyringKeybase) SetPassphraseHint(name, hint string) error {
+	info, err := kb.Get(name)
+	if err != nil {
+		return err
+	}
+
+	local, ok := info.(localInfo)
+	if !ok {
+		return fmt.Errorf("passphrase hints are only supported for local keys, %s is a %s key", name, info.GetType())
+	}
+
+	local.PassphraseHint = hint
+
+	return kb.writeInfo(name, local)
+}
+
+// GetPassphraseHint returns the passphrase hint stored alongside the named local
+// key. An empty string is returned if no hint has been set.
+func (kb keyringKeybase) GetPassphraseHint(name string) (string, error) {
+	info, err := kb.Get(name)
+	if err != nil {
+		return "", err
+	}
+
+	local, ok := info.(localInfo)
+	if !ok {
+		return "", fmt.Errorf("passphrase hints are only supported for local keys, %s is a %s key", name, info.GetType())
+	}
+
+	return local.PassphraseHint, nil
+}
+
+// Unlock opens a keyring session for backends that prompt for a passphrase. The
+// passphrase is verified against the stored passphrase hash and cached until the
+// session times out or Lock is called. The backend is then reopened, so that it
+// prompts for the passphrase again.
+func (kb keyringKeybase) Unlock(passphrase string) (Session, error) {
+	if kb.session == nil {
+		return Session{}, ErrSessionNotSupported
+	}
+
+	return kb.session.unlock(passphrase)
+}
+
+// Lock clears the passphrase cached by Unlock and closes the backend, so that
+// the passphrase is prompted for again.
+func (kb keyringKeybase) Lock() {
+	if kb.session != nil {
+		kb.session.lock()
+	}
+}
+
 // SupportedAlgos returns a list of supported signing algorithms.
 func (kb keyringKeybase) SupportedAlgos() []SigningAlgo {
 	return kb.base.SupportedAlgos()
@@ -435,35 +1305,80 @@ func (kb keyringKeybase) SupportedAlgosLedger() []SigningAlgo {
 	return kb.base.SupportedAlgosLedger()
 }
 
-func (kb keyringKeybase) writeLocalKey(name string, priv tmcrypto.PrivKey, algo SigningAlgo) Info {
+func (kb keyringKeybase) writeLocalKey(name string, priv tmcrypto.PrivKey, algo SigningAlgo) (Info, error) {
 	// encrypt private key using keyring
 	pub := priv.PubKey()
 	info := newLocalInfo(name, pub, string(priv.Bytes()), algo)
 
-	kb.writeInfo(name, info)
-	return info
+	if err := kb.writeInfo(name, info); err != nil {
+		return nil, err
+	}
+
+	return info, nil
+}
+
+// decodeInfo decodes an Info object with the configured InfoCodec, falling back
+// to amino for Info objects written before the codec was changed.
+func (kb keyringKeybase) decodeInfo(bz []byte) (Info, error) {
+	codec := kb.base.options.infoCodec
+
+	info, err := codec.Unmarshal(bz)
+	if err == nil {
+		return info, nil
+	}
+
+	if _, ok := codec.(AminoInfoCodec); !ok {
+		if info, aminoErr := unmarshalInfo(bz); aminoErr == nil {
+			return info, nil
+		}
+	}
+
+	return nil, err
 }
 
-func (kb keyringKeybase) writeInfo(name string, info Info) {
+func (kb keyringKeybase) writeInfo(name string, info Info) error {
+	kb.writeMtx.Lock()
+	defer kb.writeMtx.Unlock()
+
+	if maxKeys := kb.base.options.maxKeys; maxKeys > 0 && !kb.HasKey(name) {
+		infos, err := kb.List()
+		if err != nil {
+			return err
+		}
+
+		if len(infos) >= maxKeys {
+			return fmt.Errorf("cannot add key %s: keyring is limited to %d keys", name, maxKeys)
+		}
+	}
+
 	// write the info by key
 	key := infoKey(name)
-	serializedInfo := marshalInfo(info)
+	serializedInfo, err := kb.base.options.infoCodec.Marshal(info)
+	if err != nil {
+		return err
+	}
 
-	err := kb.db.Set(keyring.Item{
+	err = kb.db.Set(keyring.Item{
 		Key:  string(key),
 		Data: serializedInfo,
 	})
 	if err != nil {
-		panic(err)
+		return err
 	}
 
 	err = kb.db.Set(keyring.Item{
-		Key:  string(addrHexKey(info.GetAddress())),
+		Key:  string(addrHexKey(kb.addressOf(info))),
 		Data: key,
 	})
 	if err != nil {
-		panic(err)
+		return err
 	}
+
+	// stamp the modification time
+	return kb.db.Set(keyring.Item{
+		Key:  string(modifiedKey(name)),
+		Data: []byte(time.Now().UTC().Format(time.RFC3339Nano)),
+	})
 }
 
 func lkbToKeyringConfig(appName, dir string, buf io.Reader, test bool) keyring.Config {
@@ -513,28 +1428,45 @@ func newFileBackendKeyringConfig(name, dir string, buf io.Reader) keyring.Config
 	}
 }
 
-func newRealPrompt(dir string, buf io.Reader) func(string) (string, error) {
-	return func(prompt string) (string, error) {
-		keyhashStored := false
-		keyhashFilePath := filepath.Join(dir, "keyhash")
+// readKeyhash returns the bcrypt hash of the keyring passphrase stored in dir
+// and whether such a hash exists.
+func readKeyhash(dir string) ([]byte, bool, error) {
+	keyhashFilePath := filepath.Join(dir, "keyhash")
 
-		var keyhash []byte
+	_, err := os.Stat(keyhashFilePath)
+	switch {
+	case err == nil:
+		keyhash, err := ioutil.ReadFile(keyhashFilePath)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to read %s: %v", keyhashFilePath, err)
+		}
 
-		_, err := os.Stat(keyhashFilePath)
-		switch {
-		case err == nil:
-			keyhash, err = ioutil.ReadFile(keyhashFilePath)
-			if err != nil {
-				return "", fmt.Errorf("failed to read %s: %v", keyhashFilePath, err)
-			}
+		return keyhash, true, nil
 
-			keyhashStored = true
+	case os.IsNotExist(err):
+		return nil, false, nil
 
-		case os.IsNotExist(err):
-			keyhashStored = false
+	default:
+		return nil, false, fmt.Errorf("failed to open %s: %v", keyhashFilePath, err)
+	}
+}
 
-		default:
-			return "", fmt.Errorf("failed to open %s: %v", keyhashFilePath, err)
+// writeKeyhash stores the bcrypt hash of the given keyring passphrase in dir.
+func writeKeyhash(dir, pass string) error {
+	saltBytes := tmcrypto.CRandBytes(16)
+	passwordHash, err := bcrypt.GenerateFromPassword(saltBytes, []byte(pass), 2)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(dir+"/keyhash", passwordHash, 0555)
+}
+
+func newRealPrompt(dir string, buf io.Reader) func(string) (string, error) {
+	return func(prompt string) (string, error) {
+		keyhash, keyhashStored, err := readKeyhash(dir)
+		if err != nil {
+			return "", err
 		}
 
 		failureCounter := 0
@@ -565,19 +1497,12 @@ func newRealPrompt(dir string, buf io.Reader) func(string) (string, error) {
 				continue
 			}
 
-			if pass != reEnteredPass {
+			if !passphrasesEqual(pass, reEnteredPass) {
 				fmt.Fprintln(os.Stderr, "passphrase do not match")
 				continue
 			}
 
-			saltBytes := tmcrypto.CRandBytes(16)
-			passwordHash, err := bcrypt.GenerateFromPassword(saltBytes, []byte(pass), 2)
-			if err != nil {
-				fmt.Fprintln(os.Stderr, err)
-				continue
-			}
-
-			if err := ioutil.WriteFile(dir+"/keyhash", passwordHash, 0555); err != nil {
+			if err := writeKeyhash(dir, pass); err != nil {
 				return "", err
 			}
 
@@ -586,6 +1511,34 @@ func newRealPrompt(dir string, buf io.Reader) func(string) (string, error) {
 	}
 }
 
+// passphrasesEqual compares two passphrases in constant time, so that the time
+// taken does not leak the length of their common prefix.
+func passphrasesEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// addressOf returns the address of the key described by info as derived by the
+// configured AddressDeriver, if any.
+func (kb keyringKeybase) addressOf(info Info) types.AccAddress {
+	if kb.base.options.addressDeriver != nil {
+		return kb.pubKeyAddress(info.GetPubKey())
+	}
+
+	return info.GetAddress()
+}
+
+func (kb keyringKeybase) pubKeyAddress(pub tmcrypto.PubKey) types.AccAddress {
+	return kb.base.pubKeyAddress(pub)
+}
+
 func addrHexKey(address types.AccAddress) []byte {
 	return []byte(fmt.Sprintf("%s.%s", hex.EncodeToString(address.Bytes()), addressSuffix))
 }
+
+func exportAuditKey(name string) []byte {
+	return []byte(fmt.Sprintf("%s.%s", name, exportAuditSuffix))
+}
+
+func modifiedKey(name string) []byte {
+	return []byte(fmt.Sprintf("%s.%s", name, modifiedSuffix))
+}
@@ -2,19 +2,32 @@ package keyring
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io/ioutil"
+	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/99designs/keyring"
+	"github.com/btcsuite/btcd/btcec"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/tendermint/go-amino"
 	tmcrypto "github.com/tendermint/tendermint/crypto"
+	tmarmor "github.com/tendermint/tendermint/crypto/armor"
 	"github.com/tendermint/tendermint/crypto/ed25519"
 	tmamino "github.com/tendermint/tendermint/crypto/encoding/amino"
 	"github.com/tendermint/tendermint/crypto/multisig"
 	"github.com/tendermint/tendermint/crypto/secp256k1"
+	"github.com/tendermint/tendermint/libs/bech32"
+	"golang.org/x/crypto/sha3"
 
 	"github.com/cosmos/cosmos-sdk/codec"
 	"github.com/cosmos/cosmos-sdk/crypto"
@@ -424,6 +437,181 @@ func TestKeyringKeybaseExportImportPrivKey(t *testing.T) {
 	require.Equal(t, "The specified item could not be found in the keyring", err.Error())
 }
 
+func TestKeyringExportAudit(t *testing.T) {
+	dir, cleanup := tests.NewTestCaseDir(t)
+	t.Cleanup(cleanup)
+
+	kr, err := NewKeyring("cosmos", BackendTest, dir, nil, WithExportAudit())
+	require.NoError(t, err)
+
+	_, _, err = kr.CreateMnemonic("john", English, "password", Secp256k1)
+	require.NoError(t, err)
+
+	history, err := kr.ExportHistory("john")
+	require.NoError(t, err)
+	require.Empty(t, history)
+
+	// public exports are not recorded
+	_, err = kr.ExportPubKey("john")
+	require.NoError(t, err)
+
+	_, err = kr.ExportPrivKey("john", "", "password")
+	require.NoError(t, err)
+	_, err = kr.ExportPrivateKeyObject("john", "")
+	require.NoError(t, err)
+
+	// the audit log survives reopening the keyring
+	kr, err = NewKeyring("cosmos", BackendTest, dir, nil, WithExportAudit())
+	require.NoError(t, err)
+
+	history, err = kr.ExportHistory("john")
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	for _, record := range history {
+		require.Equal(t, "john", record.Name)
+		require.False(t, record.Time.IsZero())
+	}
+	require.False(t, history[1].Time.Before(history[0].Time))
+
+	// the audit log is kept after the key is deleted
+	require.NoError(t, kr.Delete("john", "", true))
+	history, err = kr.ExportHistory("john")
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+
+	// exports of the armored Info and backups are recorded for keys holding a
+	// private key only
+	_, _, err = kr.CreateMnemonic("jane", English, "password", Secp256k1)
+	require.NoError(t, err)
+	_, err = kr.CreateOffline("offline", secp256k1.GenPrivKey().PubKey(), Secp256k1)
+	require.NoError(t, err)
+
+	_, err = kr.Export("jane")
+	require.NoError(t, err)
+	_, err = kr.Export("offline")
+	require.NoError(t, err)
+	require.NoError(t, kr.BackupToFile(filepath.Join(dir, "backup"), "passphrase"))
+
+	history, err = kr.ExportHistory("jane")
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	history, err = kr.ExportHistory("offline")
+	require.NoError(t, err)
+	require.Empty(t, history)
+
+	// exports are not recorded unless the audit log is enabled
+	kr = NewInMemory()
+	_, _, err = kr.CreateMnemonic("john", English, "password", Secp256k1)
+	require.NoError(t, err)
+	_, err = kr.ExportPrivateKeyObject("john", "")
+	require.NoError(t, err)
+	history, err = kr.ExportHistory("john")
+	require.NoError(t, err)
+	require.Empty(t, history)
+}
+
+func TestKeyringFingerprint(t *testing.T) {
+	dir, cleanup := tests.NewTestCaseDir(t)
+	t.Cleanup(cleanup)
+
+	fileKr, err := NewKeyring("cosmos", BackendTest, dir, nil)
+	require.NoError(t, err)
+	memKr := NewInMemory()
+
+	_, mnemonic, err := fileKr.CreateMnemonic("a", English, DefaultBIP39Passphrase, Secp256k1)
+	require.NoError(t, err)
+	_, err = memKr.CreateAccount("b", mnemonic, DefaultBIP39Passphrase, DefaultBIP39Passphrase, fundraiserPath, Secp256k1)
+	require.NoError(t, err)
+
+	// the same key yields the same fingerprint in both backends
+	fileFp, err := fileKr.Fingerprint("a")
+	require.NoError(t, err)
+	memFp, err := memKr.Fingerprint("b")
+	require.NoError(t, err)
+	require.Equal(t, fileFp, memFp)
+	require.Len(t, fileFp, 16)
+
+	other, err := memKr.CreateOffline("c", secp256k1.GenPrivKey().PubKey(), Secp256k1)
+	require.NoError(t, err)
+
+	fps, err := memKr.ListFingerprints()
+	require.NoError(t, err)
+	require.Equal(t, []KeyFingerprint{
+		{Name: "b", Fingerprint: memFp},
+		{Name: "c", Fingerprint: PubKeyFingerprint(other.GetPubKey())},
+	}, fps)
+	require.NotEqual(t, fps[0].Fingerprint, fps[1].Fingerprint)
+
+	_, err = memKr.Fingerprint("missing")
+	require.Error(t, err)
+}
+
+// jsonInfoCodec is a test InfoCodec encoding Info objects as prefixed JSON.
+type jsonInfoCodec struct{}
+
+const jsonInfoPrefix = "json:"
+
+func (jsonInfoCodec) Marshal(info Info) ([]byte, error) {
+	bz, err := CryptoCdc.MarshalJSON(info)
+	return append([]byte(jsonInfoPrefix), bz...), err
+}
+
+func (jsonInfoCodec) Unmarshal(bz []byte) (info Info, err error) {
+	if !bytes.HasPrefix(bz, []byte(jsonInfoPrefix)) {
+		return nil, errors.New("not a JSON encoded info")
+	}
+
+	err = CryptoCdc.UnmarshalJSON(bz[len(jsonInfoPrefix):], &info)
+	return info, err
+}
+
+func TestInMemoryInfoCodec(t *testing.T) {
+	db := keyring.NewArrayKeyring(nil)
+
+	// a key written with the default codec before switching codecs
+	legacyKb := newKeyringKeybase(db, nil)
+	legacy, _, err := legacyKb.CreateMnemonic("legacy", English, "secretcpw", Secp256k1)
+	require.NoError(t, err)
+
+	kb := newKeyringKeybase(db, nil, WithInfoCodec(jsonInfoCodec{})).(keyringKeybase)
+
+	pub := secp256k1.GenPrivKey().PubKey()
+	infos := []Info{
+		newLocalInfo("local", pub, "armor", Secp256k1),
+		newLedgerInfo("ledger", secp256k1.GenPrivKey().PubKey(), *hd.NewFundraiserParams(0, sdk.CoinType, 0), Secp256k1),
+		newOfflineInfo("offline", secp256k1.GenPrivKey().PubKey(), Secp256k1),
+		NewMultiInfo("multi", multisig.NewPubKeyMultisigThreshold(1, []tmcrypto.PubKey{pub})),
+	}
+
+	for _, info := range infos {
+		require.NoError(t, kb.writeInfo(info.GetName(), info))
+
+		// the configured codec is used to write
+		item, err := db.Get(string(infoKey(info.GetName())))
+		require.NoError(t, err)
+		require.True(t, bytes.HasPrefix(item.Data, []byte(jsonInfoPrefix)))
+
+		stored, err := kb.Get(info.GetName())
+		require.NoError(t, err)
+		require.Equal(t, info.GetType(), stored.GetType())
+		require.Equal(t, info.GetPubKey(), stored.GetPubKey())
+		require.Equal(t, info.GetAlgo(), stored.GetAlgo())
+
+		byAddr, err := kb.GetByAddress(info.GetAddress())
+		require.NoError(t, err)
+		require.Equal(t, info.GetName(), byAddr.GetName())
+	}
+
+	// keys written with amino remain readable
+	stored, err := kb.Get("legacy")
+	require.NoError(t, err)
+	require.Equal(t, legacy.GetPubKey(), stored.GetPubKey())
+
+	list, err := kb.List()
+	require.NoError(t, err)
+	require.Len(t, list, len(infos)+1)
+}
+
 func TestSupportedAlgos(t *testing.T) {
 	dir, cleanup := tests.NewTestCaseDir(t)
 	t.Cleanup(cleanup)
@@ -737,6 +925,118 @@ func TestInMemoryExportImport(t *testing.T) {
 	require.Equal(t, john, john2)
 }
 
+func TestInMemoryExportImportAddressBook(t *testing.T) {
+	src := NewInMemory()
+
+	local, _, err := src.CreateMnemonic("john", English, "secretcpw", Secp256k1)
+	require.NoError(t, err)
+	multi := multisig.PubKeyMultisigThreshold{
+		K:       1,
+		PubKeys: []tmcrypto.PubKey{local.GetPubKey()},
+	}
+	_, err = src.CreateMulti("multi", multi)
+	require.NoError(t, err)
+
+	book, err := src.ExportAddressBook()
+	require.NoError(t, err)
+	require.NotContains(t, string(book), "privkey")
+
+	dst := NewInMemory()
+	existing, _, err := dst.CreateMnemonic("multi", English, "secretcpw", Secp256k1)
+	require.NoError(t, err)
+	require.NoError(t, dst.ImportAddressBook(book))
+
+	john, err := dst.Get("john")
+	require.NoError(t, err)
+	require.Equal(t, TypeOffline, john.GetType())
+	require.Equal(t, local.GetAddress(), john.GetAddress())
+
+	// imported keys can only be used for verification
+	_, _, err = dst.Sign("john", "", []byte("msg"))
+	require.Error(t, err)
+
+	byAddr, err := dst.GetByAddress(local.GetAddress())
+	require.NoError(t, err)
+	require.Equal(t, "john", byAddr.GetName())
+
+	// existing names are left untouched
+	m, err := dst.Get("multi")
+	require.NoError(t, err)
+	require.Equal(t, existing.GetAddress(), m.GetAddress())
+	require.Equal(t, TypeLocal, m.GetType())
+}
+
+func TestInMemoryExportValidatorPubKeys(t *testing.T) {
+	kb := NewInMemory()
+
+	local, _, err := kb.CreateMnemonic("local", English, "secretcpw", Secp256k1)
+	require.NoError(t, err)
+	offline, err := kb.CreateOffline("offline", ed25519.GenPrivKey().PubKey(), Ed25519)
+	require.NoError(t, err)
+	_, err = kb.CreateMulti("multi", multisig.NewPubKeyMultisigThreshold(1, []tmcrypto.PubKey{local.GetPubKey()}))
+	require.NoError(t, err)
+
+	names := []string{"local", "offline"}
+	expected := []Info{local, offline}
+
+	// ledger keys are only available with a ledger device or mock
+	if ledger, err := kb.CreateLedger("ledger", Secp256k1, "cosmos", 0, 0); err == nil {
+		names = append(names, "ledger")
+		expected = append(expected, ledger)
+	}
+
+	entries, err := kb.ExportValidatorPubKeys(names)
+	require.NoError(t, err)
+	require.Len(t, entries, len(expected))
+
+	for i, info := range expected {
+		consPubKey, err := sdk.Bech32ifyPubKey(sdk.Bech32PubKeyTypeConsPub, info.GetPubKey())
+		require.NoError(t, err)
+
+		require.Equal(t, info.GetName(), entries[i].Name)
+		require.Equal(t, info.GetPubKey(), entries[i].PubKey)
+		require.Equal(t, sdk.ConsAddress(info.GetPubKey().Address()).String(), entries[i].Address)
+		require.Equal(t, consPubKey, entries[i].ConsPubKey)
+	}
+
+	_, err = kb.ExportValidatorPubKeys([]string{"local", "multi"})
+	require.Error(t, err)
+
+	_, err = kb.ExportValidatorPubKeys([]string{"missing"})
+	require.Error(t, err)
+}
+
+func TestInMemoryPassphraseHint(t *testing.T) {
+	kb := NewInMemory()
+
+	_, _, err := kb.CreateMnemonic("john", English, "secretcpw", Secp256k1)
+	require.NoError(t, err)
+
+	hint, err := kb.GetPassphraseHint("john")
+	require.NoError(t, err)
+	require.Empty(t, hint)
+
+	require.NoError(t, kb.SetPassphraseHint("john", "favourite colour"))
+	hint, err = kb.GetPassphraseHint("john")
+	require.NoError(t, err)
+	require.Equal(t, "favourite colour", hint)
+
+	// the key remains usable
+	_, _, err = kb.Sign("john", "", []byte("msg"))
+	require.NoError(t, err)
+
+	// hints are only stored for local keys
+	_, err = kb.CreateOffline("offline", secp256k1.GenPrivKey().PubKey(), Secp256k1)
+	require.NoError(t, err)
+	require.Error(t, kb.SetPassphraseHint("offline", "hint"))
+
+	// info serialized without a hint still decodes
+	legacy := localInfo{Name: "legacy", PubKey: secp256k1.GenPrivKey().PubKey(), Algo: Secp256k1}
+	decoded, err := unmarshalInfo(marshalInfo(legacy))
+	require.NoError(t, err)
+	require.Equal(t, "", decoded.(localInfo).PassphraseHint)
+}
+
 func TestInMemoryExportImportPrivKey(t *testing.T) {
 	kb := NewInMemory()
 
@@ -764,6 +1064,58 @@ func TestInMemoryExportImportPrivKey(t *testing.T) {
 	require.True(t, priv1.GetPubKey().Equals(priv2.GetPubKey()))
 }
 
+func TestInMemoryImportPrivKeyFromKMS(t *testing.T) {
+	kb := NewInMemory()
+
+	priv := secp256k1.GenPrivKey()
+
+	// the mock KMS encrypts by xoring with a fixed pad
+	pad := bytes.Repeat([]byte{0x5a}, len(priv))
+	xor := func(bz []byte) []byte {
+		out := make([]byte, len(bz))
+		for i := range bz {
+			out[i] = bz[i] ^ pad[i%len(pad)]
+		}
+		return out
+	}
+
+	var plaintext []byte
+	decrypt := func(ciphertext []byte) ([]byte, error) {
+		plaintext = xor(ciphertext)
+		return plaintext, nil
+	}
+
+	ciphertext := xor(priv[:])
+	require.NoError(t, kb.ImportPrivKeyFromKMS("kms", ciphertext, decrypt, Secp256k1))
+
+	// the decrypted key material is wiped
+	require.Equal(t, make([]byte, len(priv)), plaintext)
+
+	info, err := kb.Get("kms")
+	require.NoError(t, err)
+	require.Equal(t, TypeLocal, info.GetType())
+	require.Equal(t, priv.PubKey(), info.GetPubKey())
+
+	sig, pub, err := kb.Sign("kms", "", []byte("msg"))
+	require.NoError(t, err)
+	require.True(t, pub.VerifyBytes([]byte("msg"), sig))
+
+	// existing keys are not overwritten
+	require.Error(t, kb.ImportPrivKeyFromKMS("kms", ciphertext, decrypt, Secp256k1))
+
+	// invalid key lengths and decryption failures are rejected
+	require.Error(t, kb.ImportPrivKeyFromKMS("short", ciphertext[:16], decrypt, Secp256k1))
+	require.Error(t, kb.ImportPrivKeyFromKMS("failed", ciphertext, func([]byte) ([]byte, error) {
+		return nil, errors.New("kms unavailable")
+	}, Secp256k1))
+	require.Equal(t, ErrUnsupportedSigningAlgo, kb.ImportPrivKeyFromKMS("ed", ciphertext, decrypt, Ed25519))
+
+	_, err = kb.Get("short")
+	require.Error(t, err)
+	_, err = kb.Get("failed")
+	require.Error(t, err)
+}
+
 func TestInMemoryExportImportPubKey(t *testing.T) {
 	// make the storage with reasonable defaults
 	cstore := NewInMemory()
@@ -851,6 +1203,223 @@ func TestInMemoryAdvancedKeyManagement(t *testing.T) {
 	require.NotNil(t, err)
 }
 
+func TestInMemorySignWithRelativePath(t *testing.T) {
+	cstore := NewInMemory()
+
+	_, mnemonic, err := cstore.CreateMnemonic("john", English, "secretcpw", Secp256k1)
+	require.NoError(t, err)
+
+	accountPath := "44'/118'/0'/0"
+	_, err = cstore.CreateExtendedAccount("xjohn", mnemonic, DefaultBIP39Passphrase, accountPath, Secp256k1)
+	require.NoError(t, err)
+
+	msg := []byte("hello")
+	for _, index := range []string{"0", "7"} {
+		expected, err := cstore.CreateAccount("child"+index, mnemonic, DefaultBIP39Passphrase, "pw", accountPath+"/"+index, Secp256k1)
+		require.NoError(t, err)
+
+		sig, pub, err := cstore.SignWithRelativePath("xjohn", index, msg)
+		require.NoError(t, err)
+		require.Equal(t, expected.GetPubKey(), pub)
+		require.True(t, pub.VerifyBytes(msg, sig))
+	}
+
+	// the derived child key is not persisted
+	list, err := cstore.List()
+	require.NoError(t, err)
+	require.Len(t, list, 4)
+
+	// invalid relative paths are rejected
+	_, _, err = cstore.SignWithRelativePath("xjohn", "0//1", msg)
+	require.Error(t, err)
+
+	// keys without extended key material cannot derive children
+	_, _, err = cstore.SignWithRelativePath("john", "0", msg)
+	require.Error(t, err)
+}
+
+func TestInMemoryMaxKeys(t *testing.T) {
+	cstore := NewInMemory(WithMaxKeys(2))
+
+	_, _, err := cstore.CreateMnemonic("john", English, "secretcpw", Secp256k1)
+	require.NoError(t, err)
+	_, err = cstore.CreateOffline("jane", secp256k1.GenPrivKey().PubKey(), Secp256k1)
+	require.NoError(t, err)
+
+	// the limit is reached
+	_, _, err = cstore.CreateMnemonic("jim", English, "secretcpw", Secp256k1)
+	require.Error(t, err)
+	_, err = cstore.Get("jim")
+	require.Error(t, err)
+
+	armor, err := cstore.ExportPubKey("jane")
+	require.NoError(t, err)
+	require.Error(t, cstore.ImportPubKey("jim", armor))
+
+	// deleting a key frees up room for another one
+	require.NoError(t, cstore.Delete("jane", "", true))
+	_, _, err = cstore.CreateMnemonic("jim", English, "secretcpw", Secp256k1)
+	require.NoError(t, err)
+
+	list, err := cstore.List()
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+}
+
+func TestInMemoryMaxKeysConcurrent(t *testing.T) {
+	const maxKeys = 3
+	cstore := NewInMemory(WithMaxKeys(maxKeys))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, _ = cstore.CreateOffline(fmt.Sprintf("key%d", i), secp256k1.GenPrivKey().PubKey(), Secp256k1)
+		}(i)
+	}
+	wg.Wait()
+
+	list, err := cstore.List()
+	require.NoError(t, err)
+	require.Len(t, list, maxKeys)
+}
+
+func TestInMemoryGetAddressForPrefix(t *testing.T) {
+	cstore := NewInMemory()
+
+	info, _, err := cstore.CreateMnemonic("key", English, "secretcpw", Secp256k1)
+	require.NoError(t, err)
+
+	accPrefix := sdk.GetConfig().GetBech32AccountAddrPrefix()
+
+	addr, err := cstore.GetAddressForPrefix("key", accPrefix)
+	require.NoError(t, err)
+	require.Equal(t, info.GetAddress().String(), addr)
+
+	for _, prefix := range []string{"osmo", "terra", "juno"} {
+		addr, err := cstore.GetAddressForPrefix("key", prefix)
+		require.NoError(t, err)
+		require.True(t, strings.HasPrefix(addr, prefix+"1"))
+
+		hrp, bz, err := bech32.DecodeAndConvert(addr)
+		require.NoError(t, err)
+		require.Equal(t, prefix, hrp)
+		require.Equal(t, info.GetAddress().Bytes(), bz)
+	}
+
+	// the global config is left untouched
+	require.Equal(t, accPrefix, sdk.GetConfig().GetBech32AccountAddrPrefix())
+
+	_, err = cstore.GetAddressForPrefix("key", "")
+	require.Error(t, err)
+	_, err = cstore.GetAddressForPrefix("missing", "osmo")
+	require.Error(t, err)
+}
+
+func TestInMemorySignEncoded(t *testing.T) {
+	cstore := NewInMemory()
+
+	_, _, err := cstore.CreateMnemonic("key", English, "secretcpw", Secp256k1)
+	require.NoError(t, err)
+
+	msg := []byte("msg")
+	sig, _, err := cstore.Sign("key", "", msg)
+	require.NoError(t, err)
+
+	decoders := map[SignatureEncoding]func(string) ([]byte, error){
+		SignatureEncodingRaw:    base64.RawStdEncoding.DecodeString,
+		SignatureEncodingHex:    hex.DecodeString,
+		SignatureEncodingBase64: base64.StdEncoding.DecodeString,
+	}
+
+	for enc, decode := range decoders {
+		encoded, pub, err := cstore.SignEncoded("key", msg, enc)
+		require.NoError(t, err)
+
+		decoded, err := decode(encoded)
+		require.NoError(t, err)
+		require.True(t, pub.VerifyBytes(msg, decoded), enc)
+
+		// secp256k1 signatures are deterministic
+		require.Equal(t, sig, decoded)
+	}
+
+	_, _, err = cstore.SignEncoded("key", msg, SignatureEncoding("base58"))
+	require.Error(t, err)
+}
+
+func TestInMemorySignInDomain(t *testing.T) {
+	cstore := NewInMemory()
+
+	info, _, err := cstore.CreateMnemonic("key", English, "secretcpw", Secp256k1)
+	require.NoError(t, err)
+
+	msg := []byte("msg")
+	sig, pub, err := cstore.SignInDomain("key", "vote", msg)
+	require.NoError(t, err)
+	require.Equal(t, info.GetPubKey(), pub)
+
+	ok, err := cstore.VerifyInDomain("key", "vote", msg, sig)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	// the signature can be verified independently of the keyring
+	require.True(t, pub.VerifyBytes(DomainSignBytes("vote", msg), sig))
+
+	// the signature doesn't verify in another domain nor as a plain signature
+	ok, err = cstore.VerifyInDomain("key", "transfer", msg, sig)
+	require.NoError(t, err)
+	require.False(t, ok)
+	require.False(t, pub.VerifyBytes(msg, sig))
+
+	_, err = cstore.VerifyInDomain("missing", "vote", msg, sig)
+	require.Error(t, err)
+}
+
+func TestInMemoryVerifyMultisig(t *testing.T) {
+	cstore := NewInMemory()
+
+	var pubKeys []tmcrypto.PubKey
+	for _, name := range []string{"a", "b", "c"} {
+		info, _, err := cstore.CreateMnemonic(name, English, "secretcpw", Secp256k1)
+		require.NoError(t, err)
+		pubKeys = append(pubKeys, info.GetPubKey())
+	}
+	_, err := cstore.CreateMulti("multi", multisig.NewPubKeyMultisigThreshold(2, pubKeys))
+	require.NoError(t, err)
+
+	msg := []byte("msg")
+	sign := func(mSig *multisig.Multisignature, name string) {
+		sig, pub, err := cstore.Sign(name, "", msg)
+		require.NoError(t, err)
+		require.NoError(t, mSig.AddSignatureFromPubKey(sig, pub, pubKeys))
+	}
+
+	// under threshold
+	mSig := multisig.NewMultisig(len(pubKeys))
+	sign(mSig, "a")
+	ok, err := cstore.VerifyMultisig("multi", msg, CryptoCdc.MustMarshalBinaryBare(mSig))
+	require.False(t, ok)
+	require.True(t, errors.Is(err, ErrMultisigThresholdNotMet))
+
+	// threshold met
+	sign(mSig, "c")
+	ok, err = cstore.VerifyMultisig("multi", msg, CryptoCdc.MustMarshalBinaryBare(mSig))
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	// tampered member signature
+	mSig.Sigs[1][0] ^= 0xff
+	ok, err = cstore.VerifyMultisig("multi", msg, CryptoCdc.MustMarshalBinaryBare(mSig))
+	require.False(t, ok)
+	require.True(t, errors.Is(err, ErrInvalidMultisigMemberSignature))
+
+	// not a multisig key
+	_, err = cstore.VerifyMultisig("a", msg, CryptoCdc.MustMarshalBinaryBare(mSig))
+	require.Error(t, err)
+}
+
 // TestInMemorySeedPhrase verifies restoring from a seed phrase
 func TestInMemorySeedPhrase(t *testing.T) {
 
@@ -1012,3 +1581,1545 @@ func TestInMemoryKeygenOverride(t *testing.T) {
 
 	require.True(t, exported.PubKey().Equals(info.GetPubKey()))
 }
+
+func TestECDHSharedSecret(t *testing.T) {
+	mustDecode := func(s string) []byte {
+		bz, err := hex.DecodeString(s)
+		require.NoError(t, err)
+		return bz
+	}
+
+	var alice, bob secp256k1.PrivKeySecp256k1
+	copy(alice[:], mustDecode("2bd806c97f0e00af1a1fc3328fa763a9269723c8db8fac4f93af71db186d6e90"))
+	copy(bob[:], mustDecode("81b637d8fcd2c6da6359e6963113a1170de795e4b725b84d1e0b4cfd9ec58ce9"))
+
+	var alicePub, bobPub secp256k1.PubKeySecp256k1
+	copy(alicePub[:], mustDecode("039997a497d964fc1a62885b05a51166a65a90df00492c8d7cf61d6accf54803be"))
+	copy(bobPub[:], mustDecode("024edfcf9dfe6c0b5c83d1ab3f78d1b39a46ebac6798e08e19761f5ed89ec83c10"))
+	require.Equal(t, alicePub, alice.PubKey())
+	require.Equal(t, bobPub, bob.PubKey())
+
+	// SHA-256(SharedSecretKDFLabel || X) with the shared point x-coordinate
+	// X = 05aaea3882116920f603246a563cc2f3da5704bdf9d33ca60a29298956c26cf9
+	expected := mustDecode("b55a7542850b7ce8c421c8d904f1c39781f8135133fe9b6c3c58753d2897fd10")
+
+	secret, err := ECDHSharedSecret(alice, bobPub)
+	require.NoError(t, err)
+	require.Equal(t, expected, secret)
+
+	secret, err = ECDHSharedSecret(bob, alicePub)
+	require.NoError(t, err)
+	require.Equal(t, expected, secret)
+
+	_, err = ECDHSharedSecret(alice, ed25519.GenPrivKey().PubKey())
+	require.Equal(t, ErrCurveMismatch, err)
+
+	_, err = ECDHSharedSecret(ed25519.GenPrivKey(), bobPub)
+	require.Equal(t, ErrUnsupportedSigningAlgo, err)
+
+	_, err = ECDHSharedSecret(alice, secp256k1.PubKeySecp256k1{})
+	require.Error(t, err)
+}
+
+func TestInMemorySharedSecret(t *testing.T) {
+	kb := NewInMemory()
+
+	alice, _, err := kb.CreateMnemonic("alice", English, "password", Secp256k1)
+	require.NoError(t, err)
+	bob, _, err := kb.CreateMnemonic("bob", English, "password", Secp256k1)
+	require.NoError(t, err)
+
+	aliceSecret, err := kb.SharedSecret("alice", bob.GetPubKey())
+	require.NoError(t, err)
+	bobSecret, err := kb.SharedSecret("bob", alice.GetPubKey())
+	require.NoError(t, err)
+	require.Equal(t, aliceSecret, bobSecret)
+	require.Len(t, aliceSecret, 32)
+
+	_, err = kb.SharedSecret("alice", ed25519.GenPrivKey().PubKey())
+	require.Equal(t, ErrCurveMismatch, err)
+
+	_, err = kb.SharedSecret("missing", bob.GetPubKey())
+	require.Error(t, err)
+
+	// only local keys hold a private key
+	_, err = kb.CreateOffline("offline", bob.GetPubKey(), Secp256k1)
+	require.NoError(t, err)
+	_, err = kb.SharedSecret("offline", alice.GetPubKey())
+	require.Error(t, err)
+
+	multi := multisig.NewPubKeyMultisigThreshold(1, []tmcrypto.PubKey{alice.GetPubKey(), bob.GetPubKey()})
+	_, err = kb.CreateMulti("multi", multi)
+	require.NoError(t, err)
+	_, err = kb.SharedSecret("multi", alice.GetPubKey())
+	require.Error(t, err)
+}
+
+func TestInMemoryCreateLedgerPubKey(t *testing.T) {
+	kb := NewInMemory()
+
+	priv := secp256k1.GenPrivKey()
+	path := *hd.NewFundraiserParams(0, sdk.CoinType, 3)
+
+	_, err := kb.CreateLedgerPubKey("watch", priv.PubKey(), path, Ed25519)
+	require.Equal(t, ErrUnsupportedSigningAlgo, err)
+
+	info, err := kb.CreateLedgerPubKey("watch", priv.PubKey(), path, Secp256k1)
+	require.NoError(t, err)
+	require.Equal(t, TypeLedger, info.GetType())
+
+	stored, err := kb.Get("watch")
+	require.NoError(t, err)
+	require.Equal(t, TypeLedger, stored.GetType())
+	require.Equal(t, priv.PubKey(), stored.GetPubKey())
+	storedPath, err := stored.GetPath()
+	require.NoError(t, err)
+	require.Equal(t, path, *storedPath)
+
+	// signatures of the key can be verified
+	msg := []byte("watch-only")
+	sig, err := priv.Sign(msg)
+	require.NoError(t, err)
+	require.True(t, stored.GetPubKey().VerifyBytes(msg, sig))
+
+	// signing requires the device holding the key: without a device the error
+	// reports it missing, a (mock) device holds a different key
+	_, _, err = kb.Sign("watch", "", msg)
+	require.Error(t, err)
+	if !errors.Is(err, ErrLedgerDeviceNotAvailable) {
+		require.Equal(t, ErrLedgerPubKeyMismatch, err)
+	}
+}
+
+func TestInMemoryDeleteBatch(t *testing.T) {
+	kb := NewInMemory()
+
+	names := []string{"one", "two", "three"}
+	infos := make(map[string]Info, len(names))
+	for _, name := range names {
+		info, _, err := kb.CreateMnemonic(name, English, "", Secp256k1)
+		require.NoError(t, err)
+		infos[name] = info
+	}
+
+	batch := []string{"one", "missing", "three"}
+
+	// dry-run reports the existing keys without removing anything
+	deleted, errs := kb.DeleteBatch(batch, true)
+	require.Equal(t, []string{"one", "three"}, deleted)
+	require.Len(t, errs, 1)
+	require.Error(t, errs["missing"])
+
+	list, err := kb.List()
+	require.NoError(t, err)
+	require.Len(t, list, 3)
+
+	// deletion continues past the missing key
+	deleted, errs = kb.DeleteBatch(batch, false)
+	require.Equal(t, []string{"one", "three"}, deleted)
+	require.Len(t, errs, 1)
+	require.Error(t, errs["missing"])
+
+	for _, name := range deleted {
+		_, err := kb.Get(name)
+		require.Error(t, err)
+		_, err = kb.GetByAddress(infos[name].GetAddress())
+		require.Error(t, err)
+	}
+
+	list, err = kb.List()
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	require.Equal(t, "two", list[0].GetName())
+
+	// a key listed twice is deleted once, the second attempt fails
+	deleted, errs = kb.DeleteBatch([]string{"two", "two"}, false)
+	require.Equal(t, []string{"two"}, deleted)
+	require.Len(t, errs, 1)
+}
+
+func TestInMemoryWithEntropySource(t *testing.T) {
+	// all-zero and all-one entropy map to well known BIP39 test vectors
+	zeroMnemonic := strings.Repeat("abandon ", 23) + "art"
+	onesMnemonic := strings.Repeat("zoo ", 23) + "vote"
+
+	entropy := append(make([]byte, 32), bytes.Repeat([]byte{0xff}, 32)...)
+	kb := NewInMemory(WithEntropySource(bytes.NewReader(entropy)))
+
+	info, mnemonic, err := kb.CreateMnemonic("first", English, "", Secp256k1)
+	require.NoError(t, err)
+	require.Equal(t, zeroMnemonic, mnemonic)
+
+	// the mnemonic recovers the created key
+	recovered, err := NewInMemory().CreateAccount("recovered", mnemonic, DefaultBIP39Passphrase, "", fundraiserPath, Secp256k1)
+	require.NoError(t, err)
+	require.Equal(t, info.GetPubKey(), recovered.GetPubKey())
+
+	// entropy is consumed from the reader
+	_, mnemonic, err = kb.CreateMnemonic("second", English, "", Secp256k1)
+	require.NoError(t, err)
+	require.Equal(t, onesMnemonic, mnemonic)
+
+	// the reader is exhausted
+	_, _, err = kb.CreateMnemonic("third", English, "", Secp256k1)
+	require.Error(t, err)
+	_, err = kb.Get("third")
+	require.Error(t, err)
+
+	// a short read does not produce a mnemonic
+	kb = NewInMemory(WithEntropySource(bytes.NewReader(make([]byte, 16))))
+	_, _, err = kb.CreateMnemonic("short", English, "", Secp256k1)
+	require.Error(t, err)
+}
+
+// mockFIDO2Authenticator is an in-memory FIDO2 authenticator.
+type mockFIDO2Authenticator struct {
+	keys        map[string]ed25519.PrivKeyEd25519
+	userPresent bool
+	signCount   uint32
+}
+
+func newMockFIDO2Authenticator() *mockFIDO2Authenticator {
+	return &mockFIDO2Authenticator{keys: make(map[string]ed25519.PrivKeyEd25519), userPresent: true}
+}
+
+func (m *mockFIDO2Authenticator) MakeCredential(rpID string) ([]byte, ed25519.PubKeyEd25519, error) {
+	priv := ed25519.GenPrivKey()
+	credentialID := []byte(fmt.Sprintf("%s/%d", rpID, len(m.keys)))
+	m.keys[string(credentialID)] = priv
+
+	return credentialID, priv.PubKey().(ed25519.PubKeyEd25519), nil
+}
+
+func (m *mockFIDO2Authenticator) GetAssertion(rpID string, credentialID, clientDataHash []byte) ([]byte, []byte, error) {
+	priv, ok := m.keys[string(credentialID)]
+	if !ok {
+		return nil, nil, errors.New("unknown credential")
+	}
+	if !m.userPresent {
+		return nil, nil, errors.New("user presence required")
+	}
+
+	m.signCount++
+	authData := m.authData(rpID, fido2FlagUserPresent)
+
+	sig, err := priv.Sign(append(authData, clientDataHash...))
+	return authData, sig, err
+}
+
+func (m *mockFIDO2Authenticator) authData(rpID string, flags byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(rpID))
+	authData := append(rpIDHash[:], flags)
+	return append(authData, byte(m.signCount>>24), byte(m.signCount>>16), byte(m.signCount>>8), byte(m.signCount))
+}
+
+func TestInMemoryFIDO2(t *testing.T) {
+	db := keyring.NewArrayKeyring(nil)
+	authenticator := newMockFIDO2Authenticator()
+	kb := newKeyringKeybase(db, nil, WithFIDO2Authenticator(authenticator))
+
+	_, err := NewInMemory().CreateFIDO2("fido", "example.com")
+	require.Equal(t, ErrFIDO2NotAvailable, err)
+
+	info, err := kb.CreateFIDO2("fido", "example.com")
+	require.NoError(t, err)
+	require.Equal(t, TypeFIDO2, info.GetType())
+
+	stored, err := kb.Get("fido")
+	require.NoError(t, err)
+	require.Equal(t, TypeFIDO2, stored.GetType())
+	require.True(t, stored.GetPubKey().Equals(info.GetPubKey()))
+	require.Equal(t, info.GetAddress(), stored.GetAddress())
+	_, err = stored.GetPath()
+	require.Error(t, err)
+
+	// signing delegates to the authenticator
+	msg := []byte("hello fido")
+	sig, pub, err := kb.Sign("fido", "", msg)
+	require.NoError(t, err)
+	require.True(t, pub.Equals(stored.GetPubKey()))
+	require.True(t, stored.GetPubKey().VerifyBytes(msg, sig))
+	require.False(t, stored.GetPubKey().VerifyBytes([]byte("other message"), sig))
+	require.Equal(t, uint32(1), authenticator.signCount)
+
+	// the assertion is bound to the relying party
+	fidoPub := stored.GetPubKey().(PubKeyFIDO2)
+	otherRP := PubKeyFIDO2{RPID: "evil.com", Key: fidoPub.Key}
+	require.False(t, otherRP.VerifyBytes(msg, sig))
+
+	// assertions made without the user present are rejected
+	credentialID := stored.(fido2Info).CredentialID
+	authData := authenticator.authData("example.com", 0)
+	rawSig, err := authenticator.keys[string(credentialID)].Sign(fido2SignedBytes(authData, msg))
+	require.NoError(t, err)
+	noUPSig := CryptoCdc.MustMarshalBinaryBare(FIDO2Signature{AuthenticatorData: authData, Signature: rawSig})
+	require.False(t, fidoPub.VerifyBytes(msg, noUPSig))
+
+	authenticator.userPresent = false
+	_, _, err = kb.Sign("fido", "", msg)
+	require.Error(t, err)
+
+	// the private key cannot be exported
+	_, err = kb.ExportPrivateKeyObject("fido", "")
+	require.Equal(t, ErrFIDO2ExportNotPermitted, err)
+	_, err = kb.ExportPrivKey("fido", "", "passphrase")
+	require.Equal(t, ErrFIDO2ExportNotPermitted, err)
+
+	// signing requires an authenticator
+	_, _, err = newKeyringKeybase(db, nil).Sign("fido", "", msg)
+	require.Equal(t, ErrFIDO2NotAvailable, err)
+}
+
+// flakyKeyring fails its first failures operations with failure, or with the
+// transient errBackendLocked if unset.
+type flakyKeyring struct {
+	keyring.Keyring
+
+	failure  error
+	failures int
+	calls    int
+}
+
+// temporaryError is an error reporting itself as temporary.
+type temporaryError string
+
+func (e temporaryError) Error() string   { return string(e) }
+func (e temporaryError) Temporary() bool { return true }
+
+var (
+	errBackendLocked   error = temporaryError("backend locked")
+	errWrongPassphrase       = errors.New("wrong passphrase")
+)
+
+func (fk *flakyKeyring) fail() error {
+	fk.calls++
+	if fk.failures > 0 {
+		fk.failures--
+		if fk.failure != nil {
+			return fk.failure
+		}
+		return errBackendLocked
+	}
+
+	return nil
+}
+
+func (fk *flakyKeyring) Get(key string) (keyring.Item, error) {
+	if err := fk.fail(); err != nil {
+		return keyring.Item{}, err
+	}
+
+	return fk.Keyring.Get(key)
+}
+
+func (fk *flakyKeyring) Set(item keyring.Item) error {
+	if err := fk.fail(); err != nil {
+		return err
+	}
+
+	return fk.Keyring.Set(item)
+}
+
+func (fk *flakyKeyring) Keys() ([]string, error) {
+	if err := fk.fail(); err != nil {
+		return nil, err
+	}
+
+	return fk.Keyring.Keys()
+}
+
+func TestInMemoryHealthCheck(t *testing.T) {
+	db := &flakyKeyring{Keyring: keyring.NewArrayKeyring(nil)}
+	kb := newKeyringKeybase(db, nil)
+	_, _, err := kb.CreateMnemonic("key", English, "password", Secp256k1)
+	require.NoError(t, err)
+
+	require.NoError(t, kb.HealthCheck())
+	require.NoError(t, kb.HealthCheck())
+
+	// the sentinel item is not listed as a key
+	infos, err := kb.List()
+	require.NoError(t, err)
+	require.Len(t, infos, 1)
+
+	// transient failures are reported without retries
+	db.failures = 1
+	err = kb.HealthCheck()
+	require.True(t, errors.Is(err, ErrBackendUnavailable), err)
+
+	db.failures = 1
+	_, _, err = kb.Sign("key", "", []byte("msg"))
+	require.Equal(t, errBackendLocked, err)
+
+	// transient failures are retried
+	kb = newKeyringKeybase(db, nil, WithBackendRetry(3, 0))
+
+	db.failures = 2
+	require.NoError(t, kb.HealthCheck())
+
+	db.failures = 2
+	_, _, err = kb.Sign("key", "", []byte("msg"))
+	require.NoError(t, err)
+
+	// retries are bounded
+	db.failures = 3
+	_, _, err = kb.Sign("key", "", []byte("msg"))
+	require.Equal(t, errBackendLocked, err)
+
+	// missing keys are not retried
+	db.calls = 0
+	_, err = kb.Get("missing")
+	require.Error(t, err)
+	require.Equal(t, 1, db.calls)
+
+	// nor are errors which are not temporary
+	db.calls = 0
+	db.failure, db.failures = errWrongPassphrase, 1
+	_, _, err = kb.Sign("key", "", []byte("msg"))
+	require.Equal(t, errWrongPassphrase, err)
+	require.Equal(t, 1, db.calls)
+
+	// wrapped temporary errors are retried
+	db.failure, db.failures = fmt.Errorf("get: %w", errBackendLocked), 2
+	_, _, err = kb.Sign("key", "", []byte("msg"))
+	require.NoError(t, err)
+}
+
+func TestInMemoryListWithCapabilities(t *testing.T) {
+	db := keyring.NewArrayKeyring(nil)
+	kb := newKeyringKeybase(db, nil, WithFIDO2Authenticator(newMockFIDO2Authenticator()))
+
+	_, _, err := kb.CreateMnemonic("local", English, "password", Secp256k1)
+	require.NoError(t, err)
+	path := *hd.NewFundraiserParams(0, sdk.CoinType, 0)
+	_, err = kb.CreateLedgerPubKey("ledger", secp256k1.GenPrivKey().PubKey(), path, Secp256k1)
+	require.NoError(t, err)
+	_, err = kb.CreateOffline("offline", secp256k1.GenPrivKey().PubKey(), Secp256k1)
+	require.NoError(t, err)
+	multi := multisig.PubKeyMultisigThreshold{
+		K:       1,
+		PubKeys: []tmcrypto.PubKey{secp256k1.GenPrivKey().PubKey()},
+	}
+	_, err = kb.CreateMulti("multi", multi)
+	require.NoError(t, err)
+	_, err = kb.CreateFIDO2("fido", "example.com")
+	require.NoError(t, err)
+
+	capabilities, err := kb.ListWithCapabilities()
+	require.NoError(t, err)
+	require.Equal(t, []KeyCapabilities{
+		{Name: "fido", CanSign: true},
+		{Name: "ledger", CanSign: true, IsLedger: true},
+		{Name: "local", CanSign: true, CanExportPriv: true},
+		{Name: "multi", IsMultisig: true},
+		{Name: "offline"},
+	}, capabilities)
+
+	// view-only keyrings cannot export private keys and keys of unavailable
+	// FIDO2 authenticators cannot sign
+	kb = newKeyringKeybase(db, nil, WithNoPrivExport())
+
+	capabilities, err = kb.ListWithCapabilities()
+	require.NoError(t, err)
+	require.Equal(t, KeyCapabilities{Name: "fido"}, capabilities[0])
+	require.Equal(t, KeyCapabilities{Name: "local", CanSign: true}, capabilities[2])
+
+	_, err = kb.ExportPrivateKeyObject("local", "")
+	require.Equal(t, ErrPrivExportDisabled, err)
+	_, err = kb.ExportPrivKey("local", "", "passphrase")
+	require.Equal(t, ErrPrivExportDisabled, err)
+	_, err = kb.Export("local")
+	require.Equal(t, ErrPrivExportDisabled, err)
+	_, _, err = kb.Sign("local", "", []byte("msg"))
+	require.NoError(t, err)
+
+	// keys without a private key are still exported
+	_, err = kb.Export("offline")
+	require.NoError(t, err)
+}
+
+func TestInMemorySignTx(t *testing.T) {
+	kb := NewInMemory()
+	_, _, err := kb.CreateMnemonic("key", English, "password", Secp256k1)
+	require.NoError(t, err)
+
+	doc := StdSignDoc{
+		AccountNumber: 3,
+		ChainID:       "test-chain",
+		Fee:           json.RawMessage(`{"amount":[],"gas":"200000"}`),
+		Msgs:          []json.RawMessage{json.RawMessage(`{"type":"test"}`)},
+		Sequence:      6,
+	}
+
+	sig, pub, err := kb.SignTx("key", doc)
+	require.NoError(t, err)
+	require.True(t, pub.VerifyBytes(doc.Bytes(), sig))
+	require.Equal(t,
+		`{"account_number":"3","chain_id":"test-chain","fee":{"amount":[],"gas":"200000"},"memo":"","msgs":[{"type":"test"}],"sequence":"6"}`,
+		string(doc.Bytes()),
+	)
+
+	malformed := []func(doc *StdSignDoc){
+		func(doc *StdSignDoc) { doc.ChainID = "" },
+		func(doc *StdSignDoc) { doc.ChainID = " test-chain" },
+		func(doc *StdSignDoc) { doc.Msgs = nil },
+		func(doc *StdSignDoc) { doc.Fee = nil },
+		func(doc *StdSignDoc) { doc.Msgs = []json.RawMessage{json.RawMessage(`{`)} },
+	}
+	for i, malform := range malformed {
+		bad := doc
+		malform(&bad)
+
+		_, _, err := kb.SignTx("key", bad)
+		require.True(t, errors.Is(err, ErrInvalidSignDoc), "case %d: %v", i, err)
+	}
+
+	_, _, err = kb.SignTx("missing", doc)
+	require.Error(t, err)
+}
+
+func TestInMemoryAuditDerivation(t *testing.T) {
+	device := secp256k1.GenPrivKey()
+	path := *hd.NewFundraiserParams(0, sdk.CoinType, 0)
+
+	var connected bool
+	defer func(f func(hd.BIP44Params) (tmcrypto.PrivKey, error)) { newLedgerPrivKey = f }(newLedgerPrivKey)
+	newLedgerPrivKey = func(p hd.BIP44Params) (tmcrypto.PrivKey, error) {
+		if !connected {
+			return nil, errors.New("no device")
+		}
+		require.Equal(t, path, p)
+		return device, nil
+	}
+
+	kb := NewInMemory()
+	_, err := kb.CreateLedgerPubKey("match", device.PubKey(), path, Secp256k1)
+	require.NoError(t, err)
+	_, err = kb.CreateLedgerPubKey("mismatch", secp256k1.GenPrivKey().PubKey(), path, Secp256k1)
+	require.NoError(t, err)
+	_, _, err = kb.CreateMnemonic("local", English, "", Secp256k1)
+	require.NoError(t, err)
+
+	err = kb.AuditDerivation("match")
+	require.True(t, errors.Is(err, ErrLedgerDeviceNotAvailable), err)
+
+	connected = true
+	require.NoError(t, kb.AuditDerivation("match"))
+	require.Equal(t, ErrLedgerPubKeyMismatch, kb.AuditDerivation("mismatch"))
+
+	err = kb.AuditDerivation("local")
+	require.True(t, errors.Is(err, ErrNotLedgerKey), err)
+	require.Error(t, kb.AuditDerivation("missing"))
+
+	// signing goes through the same checks
+	_, _, err = kb.Sign("match", "", []byte("msg"))
+	require.NoError(t, err)
+	_, _, err = kb.Sign("mismatch", "", []byte("msg"))
+	require.Equal(t, ErrLedgerPubKeyMismatch, err)
+}
+
+func TestInMemoryImportExtendedPrivKey(t *testing.T) {
+	// BIP 32 test vector 1
+	const xprv = "xprv9s21ZrQH143K3QTDL4LXw2F7HEK3wJUD2nW2nRk4stbPy6cq3jPPqjiChkVvvNKmPGJxWUtg6LnF5kejMRNNU3TGtRBeJgk33yuGBxrMPHi"
+	master, _ := hd.ComputeMastersFromSeed([]byte{
+		0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f,
+	})
+	childBz, err := hex.DecodeString("edb2e14f9ee77d26dd93b4ecede8d16ed408ce149b6cd80b0715a2d911a0afea")
+	require.NoError(t, err)
+
+	kb := NewInMemory()
+
+	require.Equal(t, ErrUnsupportedSigningAlgo, kb.ImportExtendedPrivKey("xprv", xprv, Ed25519))
+
+	err = kb.ImportExtendedPrivKey("xprv", xprv[:len(xprv)-1]+"j", Secp256k1)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "checksum")
+	_, err = kb.Get("xprv")
+	require.Error(t, err)
+
+	require.NoError(t, kb.ImportExtendedPrivKey("xprv", xprv, Secp256k1))
+	require.Error(t, kb.ImportExtendedPrivKey("xprv", xprv, Secp256k1))
+
+	info, err := kb.Get("xprv")
+	require.NoError(t, err)
+	require.Equal(t, TypeLocal, info.GetType())
+	expected := secp256k1.PrivKeySecp256k1(master)
+	require.Equal(t, sdk.AccAddress(expected.PubKey().Address()), info.GetAddress())
+
+	// child keys are derived from the imported chain code
+	msg := []byte("msg")
+	sig, pub, err := kb.SignWithRelativePath("xprv", "0'", msg)
+	require.NoError(t, err)
+
+	var child secp256k1.PrivKeySecp256k1
+	copy(child[:], childBz)
+	require.Equal(t, child.PubKey(), pub)
+	require.True(t, pub.VerifyBytes(msg, sig))
+}
+
+func TestInMemoryExportImportCompact(t *testing.T) {
+	kb := NewInMemory()
+	info, _, err := kb.CreateMnemonic("key", English, "password", Secp256k1)
+	require.NoError(t, err)
+
+	compact, err := kb.ExportCompact("key", "passphrase")
+	require.NoError(t, err)
+	armored, err := kb.ExportPrivKey("key", "", "passphrase")
+	require.NoError(t, err)
+
+	// a secp256k1 key takes about half the size of its armor
+	require.Len(t, compact, 140)
+	require.Less(t, len(compact), len(armored)*2/3)
+	for _, c := range compact {
+		require.True(t, strings.ContainsRune("ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-_", c))
+	}
+
+	kb2 := NewInMemory()
+	require.Error(t, kb2.ImportCompact("key", compact, "wrong"))
+	require.Error(t, kb2.ImportCompact("key", compact[1:], "passphrase"))
+	require.NoError(t, kb2.ImportCompact("key", compact, "passphrase"))
+	require.Error(t, kb2.ImportCompact("key", compact, "passphrase"))
+
+	imported, err := kb2.Get("key")
+	require.NoError(t, err)
+	require.Equal(t, info.GetPubKey(), imported.GetPubKey())
+	require.Equal(t, Secp256k1, imported.GetAlgo())
+
+	// only local keys can be exported
+	_, err = kb.CreateOffline("offline", secp256k1.GenPrivKey().PubKey(), Secp256k1)
+	require.NoError(t, err)
+	_, err = kb.ExportCompact("offline", "passphrase")
+	require.Error(t, err)
+}
+
+func TestInMemorySignableAddresses(t *testing.T) {
+	kb := NewInMemory()
+
+	addrs, err := kb.SignableAddresses()
+	require.NoError(t, err)
+	require.Empty(t, addrs)
+
+	local2, _, err := kb.CreateMnemonic("local2", English, "password", Secp256k1)
+	require.NoError(t, err)
+	local1, _, err := kb.CreateMnemonic("local1", English, "password", Secp256k1)
+	require.NoError(t, err)
+	path := *hd.NewFundraiserParams(0, sdk.CoinType, 0)
+	ledger, err := kb.CreateLedgerPubKey("ledger", secp256k1.GenPrivKey().PubKey(), path, Secp256k1)
+	require.NoError(t, err)
+	_, err = kb.CreateOffline("offline", secp256k1.GenPrivKey().PubKey(), Secp256k1)
+	require.NoError(t, err)
+	multi := multisig.PubKeyMultisigThreshold{
+		K:       1,
+		PubKeys: []tmcrypto.PubKey{local1.GetPubKey()},
+	}
+	_, err = kb.CreateMulti("multi", multi)
+	require.NoError(t, err)
+
+	addrs, err = kb.SignableAddresses()
+	require.NoError(t, err)
+	require.Equal(t, []sdk.AccAddress{ledger.GetAddress(), local1.GetAddress(), local2.GetAddress()}, addrs)
+}
+
+func TestInMemoryNewAccountWithEncryption(t *testing.T) {
+	kb := NewInMemory()
+
+	_, mnemonic, err := kb.CreateMnemonic("john", English, "", Secp256k1)
+	require.NoError(t, err)
+
+	path := sdk.FullFundraiserPath
+	signer, err := kb.CreateAccount("signer", mnemonic, DefaultBIP39Passphrase, "pw", path, Secp256k1)
+	require.NoError(t, err)
+	info, err := kb.NewAccountWithEncryption("enc", mnemonic, DefaultBIP39Passphrase, path, Secp256k1)
+	require.NoError(t, err)
+	require.Equal(t, signer.GetPubKey(), info.GetPubKey())
+
+	encPub, err := kb.GetEncryptionPubKey("enc")
+	require.NoError(t, err)
+	require.Len(t, encPub, 32)
+
+	// both keys are reproducible from the mnemonic
+	other := NewInMemory()
+	restored, err := other.NewAccountWithEncryption("enc", mnemonic, DefaultBIP39Passphrase, path, Secp256k1)
+	require.NoError(t, err)
+	require.Equal(t, info.GetPubKey(), restored.GetPubKey())
+	restoredEncPub, err := other.GetEncryptionPubKey("enc")
+	require.NoError(t, err)
+	require.Equal(t, encPub, restoredEncPub)
+
+	_, pub, err := DeriveEncryptionKey(mnemonic, DefaultBIP39Passphrase, path)
+	require.NoError(t, err)
+	require.Equal(t, encPub, pub[:])
+
+	// the encryption key depends on the HD path
+	_, pub, err = DeriveEncryptionKey(mnemonic, DefaultBIP39Passphrase, "44'/118'/0'/0/1")
+	require.NoError(t, err)
+	require.NotEqual(t, encPub, pub[:])
+
+	_, err = kb.GetEncryptionPubKey("signer")
+	require.True(t, errors.Is(err, ErrNoEncryptionKey))
+}
+
+func TestInMemoryFindAndMergeDuplicates(t *testing.T) {
+	kb := NewInMemory()
+
+	orig, _, err := kb.CreateMnemonic("orig", English, "password", Secp256k1)
+	require.NoError(t, err)
+	_, _, err = kb.CreateMnemonic("unique", English, "", Secp256k1)
+	require.NoError(t, err)
+
+	armor, err := kb.ExportPrivKey("orig", "", "pw")
+	require.NoError(t, err)
+	require.NoError(t, kb.ImportPrivKey("dup2", armor, "pw"))
+	require.NoError(t, kb.ImportPrivKey("dup1", armor, "pw"))
+
+	dups, err := kb.FindDuplicates()
+	require.NoError(t, err)
+	require.Equal(t, [][]string{{"dup1", "dup2", "orig"}}, dups)
+
+	// nothing is deleted if any merged key has a different public key
+	err = kb.MergeDuplicates("orig", []string{"dup1", "unique"})
+	require.Error(t, err)
+	dups, err = kb.FindDuplicates()
+	require.NoError(t, err)
+	require.Equal(t, [][]string{{"dup1", "dup2", "orig"}}, dups)
+
+	require.Error(t, kb.MergeDuplicates("orig", []string{"orig"}))
+
+	require.NoError(t, kb.MergeDuplicates("orig", []string{"dup1", "dup2"}))
+	dups, err = kb.FindDuplicates()
+	require.NoError(t, err)
+	require.Empty(t, dups)
+
+	_, err = kb.Get("dup1")
+	require.Error(t, err)
+	info, err := kb.GetByAddress(orig.GetAddress())
+	require.NoError(t, err)
+	require.Equal(t, "orig", info.GetName())
+
+	// the modification times of the merged keys are removed
+	for _, name := range []string{"dup1", "dup2"} {
+		_, err = kb.(keyringKeybase).db.Get(string(modifiedKey(name)))
+		require.Equal(t, keyring.ErrKeyNotFound, err)
+	}
+	_, err = kb.(keyringKeybase).db.Get(string(modifiedKey("orig")))
+	require.NoError(t, err)
+}
+
+func TestInMemoryOwnershipAttestation(t *testing.T) {
+	kb := NewInMemory()
+
+	info, _, err := kb.CreateMnemonic("john", English, "password", Secp256k1)
+	require.NoError(t, err)
+	other, _, err := kb.CreateMnemonic("jane", English, "", Secp256k1)
+	require.NoError(t, err)
+
+	addr := info.GetAddress()
+	statement := "I control this address"
+	nonce := []byte("nonce-1")
+
+	_, _, err = kb.SignOwnershipAttestation("john", statement, nil)
+	require.True(t, errors.Is(err, ErrInvalidAttestation))
+
+	sig, pub, err := kb.SignOwnershipAttestation("john", statement, nonce)
+	require.NoError(t, err)
+	require.Equal(t, info.GetPubKey(), pub)
+	require.NoError(t, VerifyOwnershipAttestation(addr, pub, statement, nonce, sig))
+
+	// a replayed attestation does not verify against a new nonce
+	err = VerifyOwnershipAttestation(addr, pub, statement, []byte("nonce-2"), sig)
+	require.True(t, errors.Is(err, ErrInvalidAttestation))
+
+	// tampered statement, address or signature
+	err = VerifyOwnershipAttestation(addr, pub, statement+"!", nonce, sig)
+	require.True(t, errors.Is(err, ErrInvalidAttestation))
+	err = VerifyOwnershipAttestation(other.GetAddress(), pub, statement, nonce, sig)
+	require.True(t, errors.Is(err, ErrInvalidAttestation))
+	err = VerifyOwnershipAttestation(other.GetAddress(), other.GetPubKey(), statement, nonce, sig)
+	require.True(t, errors.Is(err, ErrInvalidAttestation))
+	tampered := append([]byte{}, sig...)
+	tampered[0] ^= 0xff
+	err = VerifyOwnershipAttestation(addr, pub, statement, nonce, tampered)
+	require.True(t, errors.Is(err, ErrInvalidAttestation))
+
+	// attestations are domain separated from plain signatures
+	plainSig, _, err := kb.Sign("john", "", OwnershipAttestationBytes(addr, statement, nonce)[32:])
+	require.NoError(t, err)
+	err = VerifyOwnershipAttestation(addr, pub, statement, nonce, plainSig)
+	require.True(t, errors.Is(err, ErrInvalidAttestation))
+}
+
+func TestInMemorySignRateLimit(t *testing.T) {
+	kb := NewInMemory()
+	now := time.Now()
+	kb.(keyringKeybase).signLimiter.now = func() time.Time { return now }
+
+	_, _, err := kb.CreateMnemonic("hot", English, "password", Secp256k1)
+	require.NoError(t, err)
+	_, _, err = kb.CreateMnemonic("cold", English, "password", Secp256k1)
+	require.NoError(t, err)
+
+	kb.SetSignRateLimit("hot", 2, time.Minute)
+	msg := []byte("msg")
+
+	// concurrent signers cannot exceed the burst
+	var (
+		wg       sync.WaitGroup
+		mtx      sync.Mutex
+		signed   int
+		rejected int
+	)
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _, err := kb.Sign("hot", "", msg)
+
+			mtx.Lock()
+			defer mtx.Unlock()
+			if err == nil {
+				signed++
+			} else {
+				require.True(t, errors.Is(err, ErrSignRateLimitExceeded))
+				rejected++
+			}
+		}()
+	}
+	wg.Wait()
+	require.Equal(t, 2, signed)
+	require.Equal(t, 3, rejected)
+
+	// other keys are not limited
+	_, _, err = kb.Sign("cold", "", msg)
+	require.NoError(t, err)
+
+	// a token is refilled every half interval
+	now = now.Add(30 * time.Second)
+	_, _, err = kb.Sign("hot", "", msg)
+	require.NoError(t, err)
+	_, _, err = kb.Sign("hot", "", msg)
+	require.True(t, errors.Is(err, ErrSignRateLimitExceeded))
+
+	// the bucket does not refill beyond its capacity
+	now = now.Add(time.Hour)
+	for i := 0; i < 2; i++ {
+		_, _, err = kb.Sign("hot", "", msg)
+		require.NoError(t, err)
+	}
+	_, _, err = kb.Sign("hot", "", msg)
+	require.True(t, errors.Is(err, ErrSignRateLimitExceeded))
+
+	// removing the limit
+	kb.SetSignRateLimit("hot", 0, 0)
+	_, _, err = kb.Sign("hot", "", msg)
+	require.NoError(t, err)
+
+	// signing with a missing key does not consume tokens
+	kb.SetSignRateLimit("new", 1, time.Minute)
+	for i := 0; i < 2; i++ {
+		_, _, err = kb.Sign("new", "", msg)
+		require.False(t, errors.Is(err, ErrSignRateLimitExceeded))
+		_, _, err = kb.SignWithRelativePath("new", "0/0", msg)
+		require.False(t, errors.Is(err, ErrSignRateLimitExceeded))
+	}
+	_, _, err = kb.CreateMnemonic("new", English, "password", Secp256k1)
+	require.NoError(t, err)
+	_, _, err = kb.Sign("new", "", msg)
+	require.NoError(t, err)
+}
+
+func TestInMemoryCreateMultisigSorted(t *testing.T) {
+	kb := NewInMemory()
+
+	pks := []tmcrypto.PubKey{
+		secp256k1.GenPrivKey().PubKey(),
+		secp256k1.GenPrivKey().PubKey(),
+		secp256k1.GenPrivKey().PubKey(),
+	}
+	reversed := []tmcrypto.PubKey{pks[2], pks[1], pks[0]}
+
+	// sorted multisig keys do not depend on the order of the members
+	info1, err := kb.CreateMultisig("multi1", 2, pks, false)
+	require.NoError(t, err)
+	info2, err := kb.CreateMultisig("multi2", 2, reversed, false)
+	require.NoError(t, err)
+	require.Equal(t, info1.GetAddress(), info2.GetAddress())
+
+	sorted := append([]tmcrypto.PubKey{}, pks...)
+	SortMultisigPubKeys(sorted)
+	require.Equal(t, multisig.NewPubKeyMultisigThreshold(2, sorted), info1.GetPubKey())
+	for i := 1; i < len(sorted); i++ {
+		require.True(t, bytes.Compare(sorted[i-1].Address(), sorted[i].Address()) < 0)
+	}
+
+	// the members supplied are not reordered
+	require.Equal(t, pks[2], reversed[0])
+
+	// unsorted multisig keys preserve the order of the members
+	info3, err := kb.CreateMultisig("multi3", 2, reversed, true)
+	require.NoError(t, err)
+	require.Equal(t, multisig.NewPubKeyMultisigThreshold(2, reversed), info3.GetPubKey())
+
+	_, err = kb.CreateMultisig("invalid", 4, pks, false)
+	require.Error(t, err)
+	_, err = kb.CreateMultisig("invalid", 0, pks, false)
+	require.Error(t, err)
+}
+
+func TestInMemoryArmorKDFParams(t *testing.T) {
+	for _, cost := range []int{crypto.MinBcryptCost, 5, 0} {
+		kb := NewInMemory(WithArmorKDFParams(cost))
+		info, _, err := kb.CreateMnemonic("john", English, "password", Secp256k1)
+		require.NoError(t, err)
+
+		armor, err := kb.ExportPrivKey("john", "", "passphrase")
+		require.NoError(t, err)
+
+		// the cost is read from the armor, whatever the importing keyring options
+		imported := NewInMemory()
+		require.NoError(t, imported.ImportPrivKey("john", armor, "passphrase"))
+		importedInfo, err := imported.Get("john")
+		require.NoError(t, err)
+		require.Equal(t, info.GetPubKey(), importedInfo.GetPubKey())
+
+		// compact exports are protected with the same cost
+		compact, err := kb.ExportCompact("john", "passphrase")
+		require.NoError(t, err)
+		bz, err := base64.RawURLEncoding.DecodeString(compact)
+		require.NoError(t, err)
+		require.Equal(t, crypto.EffectiveBcryptCost(cost), int(bz[1]))
+
+		require.NoError(t, imported.ImportCompact("jane", compact, "passphrase"))
+		importedInfo, err = imported.Get("jane")
+		require.NoError(t, err)
+		require.Equal(t, info.GetPubKey(), importedInfo.GetPubKey())
+	}
+
+	kb := NewInMemory(WithArmorKDFParams(crypto.MaxBcryptCost + 1))
+	_, _, err := kb.CreateMnemonic("john", English, "password", Secp256k1)
+	require.NoError(t, err)
+	_, err = kb.ExportPrivKey("john", "", "passphrase")
+	require.Error(t, err)
+	_, err = kb.ExportCompact("john", "passphrase")
+	require.Error(t, err)
+}
+
+func TestInMemoryRestoreFromMnemonic(t *testing.T) {
+	_, mnemonic, err := NewInMemory().CreateMnemonic("john", English, "password", Secp256k1)
+	require.NoError(t, err)
+
+	// map the addresses of the first indices to their index
+	indices := make(map[string]uint32)
+	derived := NewInMemory()
+	for index := uint32(0); index < 10; index++ {
+		hdPath := CreateHDPath(0, index).String()
+		info, err := derived.CreateAccount(fmt.Sprintf("key%d", index), mnemonic, DefaultBIP39Passphrase, "password", hdPath, Secp256k1)
+		require.NoError(t, err)
+		indices[info.GetAddress().String()] = index
+	}
+
+	var checked []uint32
+	isFunded := func(addr sdk.AccAddress) (bool, error) {
+		index, ok := indices[addr.String()]
+		require.True(t, ok)
+		checked = append(checked, index)
+		return index == 0 || index == 2 || index == 5, nil
+	}
+
+	testCases := []struct {
+		gapLimit int
+		names    []string
+		checked  []uint32
+	}{
+		{1, []string{"wallet-0"}, []uint32{0, 1}},
+		{2, []string{"wallet-0", "wallet-2"}, []uint32{0, 1, 2, 3, 4}},
+		{3, []string{"wallet-0", "wallet-2", "wallet-5"}, []uint32{0, 1, 2, 3, 4, 5, 6, 7, 8}},
+	}
+
+	for i, tc := range testCases {
+		kb := NewInMemory()
+		checked = nil
+
+		infos, err := kb.RestoreFromMnemonic("wallet", mnemonic, DefaultBIP39Passphrase, Secp256k1, isFunded, tc.gapLimit)
+		require.NoError(t, err)
+		require.Equal(t, tc.checked, checked, "case %d", i)
+		require.Len(t, infos, len(tc.names), "case %d", i)
+
+		for j, info := range infos {
+			require.Equal(t, tc.names[j], info.GetName())
+			require.Equal(t, TypeLocal, info.GetType())
+
+			expected, err := derived.Get(fmt.Sprintf("key%d", indices[info.GetAddress().String()]))
+			require.NoError(t, err)
+			require.Equal(t, expected.GetPubKey(), info.GetPubKey())
+		}
+	}
+
+	// nothing is stored if the discovery fails
+	kb := NewInMemory()
+	_, err = kb.RestoreFromMnemonic("wallet", mnemonic, DefaultBIP39Passphrase, Secp256k1, func(addr sdk.AccAddress) (bool, error) {
+		if indices[addr.String()] == 1 {
+			return false, errors.New("node unavailable")
+		}
+		return true, nil
+	}, 1)
+	require.Error(t, err)
+	infos, err := kb.List()
+	require.NoError(t, err)
+	require.Empty(t, infos)
+
+	_, err = kb.RestoreFromMnemonic("wallet", mnemonic, DefaultBIP39Passphrase, Secp256k1, isFunded, 0)
+	require.Error(t, err)
+}
+
+func TestInMemoryListModifiedSince(t *testing.T) {
+	db := keyring.NewArrayKeyring(nil)
+	kb := newKeyringKeybase(db, nil)
+
+	_, _, err := kb.CreateMnemonic("old", English, "password", Secp256k1)
+	require.NoError(t, err)
+	_, _, err = kb.CreateMnemonic("hinted", English, "password", Secp256k1)
+	require.NoError(t, err)
+
+	since := time.Now()
+	time.Sleep(time.Millisecond)
+
+	names := func(infos []Info) []string {
+		res := []string{}
+		for _, info := range infos {
+			res = append(res, info.GetName())
+		}
+		return res
+	}
+
+	infos, err := kb.ListModifiedSince(since)
+	require.NoError(t, err)
+	require.Empty(t, infos)
+
+	// created and updated keys are listed
+	_, err = kb.CreateOffline("new", secp256k1.GenPrivKey().PubKey(), Secp256k1)
+	require.NoError(t, err)
+	require.NoError(t, kb.SetPassphraseHint("hinted", "hint"))
+
+	infos, err = kb.ListModifiedSince(since)
+	require.NoError(t, err)
+	require.Equal(t, []string{"hinted", "new"}, names(infos))
+
+	infos, err = kb.ListModifiedSince(time.Time{})
+	require.NoError(t, err)
+	require.Equal(t, []string{"hinted", "new", "old"}, names(infos))
+
+	// keys without modification time are always listed
+	require.NoError(t, db.Remove(string(modifiedKey("old"))))
+	infos, err = kb.ListModifiedSince(time.Now())
+	require.NoError(t, err)
+	require.Equal(t, []string{"old"}, names(infos))
+
+	// deleted keys are not listed
+	require.NoError(t, kb.Delete("new", "", true))
+	infos, err = kb.ListModifiedSince(since)
+	require.NoError(t, err)
+	require.Equal(t, []string{"hinted", "old"}, names(infos))
+}
+
+func TestInMemorySignAuditLog(t *testing.T) {
+	type entry struct {
+		name string
+		hash []byte
+		at   time.Time
+	}
+
+	var entries []entry
+	kb := NewInMemory(WithSignAuditLog(func(name string, msgHash []byte, at time.Time) {
+		entries = append(entries, entry{name, msgHash, at})
+	}))
+
+	_, _, err := kb.CreateMnemonic("signer", English, "password", Secp256k1)
+	require.NoError(t, err)
+	_, err = kb.CreateOffline("offline", secp256k1.GenPrivKey().PubKey(), Secp256k1)
+	require.NoError(t, err)
+
+	msg := []byte("message to sign")
+	before := time.Now().UTC()
+	sig, pub, err := kb.Sign("signer", "", msg)
+	require.NoError(t, err)
+	require.True(t, pub.VerifyBytes(msg, sig))
+
+	require.Len(t, entries, 1)
+	hash := sha256.Sum256(msg)
+	require.Equal(t, "signer", entries[0].name)
+	require.Equal(t, hash[:], entries[0].hash)
+	require.False(t, entries[0].at.Before(before))
+
+	// failed signatures are not recorded
+	_, _, err = kb.Sign("offline", "", msg)
+	require.Error(t, err)
+	_, _, err = kb.Sign("missing", "", msg)
+	require.Error(t, err)
+	require.Len(t, entries, 1)
+}
+
+// ethAddress derives Ethereum style addresses of secp256k1 keys, i.e. the last
+// 20 bytes of the Keccak-256 hash of the uncompressed public key.
+func ethAddress(pub tmcrypto.PubKey) sdk.AccAddress {
+	pk := pub.(secp256k1.PubKeySecp256k1)
+	parsed, err := btcec.ParsePubKey(pk[:], btcec.S256())
+	if err != nil {
+		panic(err)
+	}
+
+	hasher := sha3.NewLegacyKeccak256()
+	hasher.Write(parsed.SerializeUncompressed()[1:])
+	return hasher.Sum(nil)[12:]
+}
+
+func TestInMemoryAddressDeriver(t *testing.T) {
+	kb := NewInMemory(WithAddressDeriver(ethAddress))
+
+	var priv secp256k1.PrivKeySecp256k1
+	priv[31] = 1
+	armor := crypto.EncryptArmorPrivKey(priv, "password", string(Secp256k1))
+	require.NoError(t, kb.ImportPrivKey("eth", armor, "password"))
+
+	expected, err := hex.DecodeString("7E5F4552091A69125d5DfCb7b8C2659029395Bdf")
+	require.NoError(t, err)
+	require.Equal(t, sdk.AccAddress(expected), ethAddress(priv.PubKey()))
+
+	info, err := kb.GetByAddress(expected)
+	require.NoError(t, err)
+	require.Equal(t, "eth", info.GetName())
+
+	// keys are not indexed by their default address
+	_, err = kb.GetByAddress(sdk.AccAddress(priv.PubKey().Address()))
+	require.Error(t, err)
+
+	addrs, err := kb.SignableAddresses()
+	require.NoError(t, err)
+	require.Equal(t, []sdk.AccAddress{expected}, addrs)
+
+	// ownership attestations bind the derived address
+	nonce := []byte("nonce")
+	sig, pub, err := kb.SignOwnershipAttestation("eth", "statement", nonce)
+	require.NoError(t, err)
+	require.NoError(t, VerifyOwnershipAttestationWithDeriver(ethAddress, expected, pub, "statement", nonce, sig))
+	err = VerifyOwnershipAttestation(expected, pub, "statement", nonce, sig)
+	require.True(t, errors.Is(err, ErrInvalidAttestation))
+
+	require.NoError(t, kb.Delete("eth", "", true))
+	_, err = kb.GetByAddress(expected)
+	require.Error(t, err)
+
+	// the funded addresses of a restored mnemonic are derived addresses
+	source := NewInMemory(WithAddressDeriver(ethAddress))
+	_, mnemonic, err := source.CreateMnemonic("source", English, "password", Secp256k1)
+	require.NoError(t, err)
+	sourceInfo, err := source.Get("source")
+	require.NoError(t, err)
+	funded := ethAddress(sourceInfo.GetPubKey())
+
+	infos, err := kb.RestoreFromMnemonic("wallet", mnemonic, DefaultBIP39Passphrase, Secp256k1, func(addr sdk.AccAddress) (bool, error) {
+		return addr.Equals(funded), nil
+	}, 1)
+	require.NoError(t, err)
+	require.Len(t, infos, 1)
+	info, err = kb.GetByAddress(funded)
+	require.NoError(t, err)
+	require.Equal(t, "wallet-0", info.GetName())
+}
+
+func TestInMemoryGetDerivationContext(t *testing.T) {
+	kb := NewInMemory()
+
+	_, mnemonic, err := kb.CreateMnemonic("default", English, "password", Secp256k1)
+	require.NoError(t, err)
+
+	ctx, err := kb.GetDerivationContext("default")
+	require.NoError(t, err)
+	require.Equal(t, DerivationContext{
+		Name:   "default",
+		Algo:   Secp256k1,
+		HDPath: sdk.GetConfig().GetFullFundraiserPath(),
+	}, ctx)
+
+	hdPath := CreateHDPath(1, 2).String()
+	_, err = kb.CreateAccount("derived", mnemonic, "bip39 passphrase", "password", hdPath, Secp256k1)
+	require.NoError(t, err)
+
+	ctx, err = kb.GetDerivationContext("derived")
+	require.NoError(t, err)
+	require.Equal(t, hdPath, ctx.HDPath)
+	require.True(t, ctx.HasBIP39Passphrase)
+	require.False(t, ctx.Imported)
+
+	armor, err := kb.ExportPrivKey("derived", "", "password")
+	require.NoError(t, err)
+	require.NoError(t, kb.ImportPrivKey("imported", armor, "password"))
+
+	ctx, err = kb.GetDerivationContext("imported")
+	require.NoError(t, err)
+	require.Equal(t, DerivationContext{Name: "imported", Algo: Secp256k1, Imported: true}, ctx)
+
+	_, err = kb.CreateOffline("offline", secp256k1.GenPrivKey().PubKey(), Secp256k1)
+	require.NoError(t, err)
+	_, err = kb.GetDerivationContext("offline")
+	require.Error(t, err)
+}
+
+func TestInMemoryCreateMnemonicWithEntropy(t *testing.T) {
+	entropy := bytes.Repeat([]byte{0x7f}, 32)
+
+	for bits, words := range map[int]int{128: 12, 160: 15, 192: 18, 224: 21, 256: 24} {
+		kb := NewInMemory(WithEntropySource(bytes.NewReader(entropy)))
+		info, mnemonic, err := kb.CreateMnemonicWithEntropy("key", English, "password", bits, Secp256k1)
+		require.NoError(t, err, bits)
+		require.Len(t, strings.Fields(mnemonic), words)
+
+		// the key is deterministic for a given entropy
+		other := NewInMemory(WithEntropySource(bytes.NewReader(entropy)))
+		otherInfo, otherMnemonic, err := other.CreateMnemonicWithEntropy("key", English, "password", bits, Secp256k1)
+		require.NoError(t, err)
+		require.Equal(t, mnemonic, otherMnemonic)
+		require.Equal(t, info.GetPubKey(), otherInfo.GetPubKey())
+	}
+
+	kb := NewInMemory()
+	for _, bits := range []int{0, 96, 129, 288} {
+		_, _, err := kb.CreateMnemonicWithEntropy("key", English, "password", bits, Secp256k1)
+		require.Equal(t, ErrInvalidEntropySize, err, bits)
+	}
+}
+
+func TestPassphrasesEqual(t *testing.T) {
+	require.True(t, passphrasesEqual("", ""))
+	require.True(t, passphrasesEqual("passphrase", "passphrase"))
+	require.False(t, passphrasesEqual("passphrase", "passphrasf"))
+	require.False(t, passphrasesEqual("passphrase", "passphrase "))
+	require.False(t, passphrasesEqual("passphrase", ""))
+}
+
+func TestInMemoryDefaultKey(t *testing.T) {
+	kb := NewInMemory()
+
+	_, err := kb.GetDefault()
+	require.Equal(t, ErrNoDefaultKey, err)
+
+	_, _, err = kb.CreateMnemonic("first", English, "password", Secp256k1)
+	require.NoError(t, err)
+	_, _, err = kb.CreateMnemonic("second", English, "password", Secp256k1)
+	require.NoError(t, err)
+
+	require.Error(t, kb.SetDefault("missing"))
+	_, err = kb.GetDefault()
+	require.Equal(t, ErrNoDefaultKey, err)
+
+	require.NoError(t, kb.SetDefault("first"))
+	info, err := kb.GetDefault()
+	require.NoError(t, err)
+	require.Equal(t, "first", info.GetName())
+
+	// the default is replaced
+	require.NoError(t, kb.SetDefault("second"))
+	info, err = kb.GetDefault()
+	require.NoError(t, err)
+	require.Equal(t, "second", info.GetName())
+
+	// the marker is not listed as a key
+	infos, err := kb.List()
+	require.NoError(t, err)
+	require.Len(t, infos, 2)
+
+	// deleting another key keeps the default
+	require.NoError(t, kb.Delete("first", "", true))
+	info, err = kb.GetDefault()
+	require.NoError(t, err)
+	require.Equal(t, "second", info.GetName())
+
+	require.NoError(t, kb.Delete("second", "", true))
+	_, err = kb.GetDefault()
+	require.Equal(t, ErrNoDefaultKey, err)
+
+	// merging away the default key clears it too
+	_, _, err = kb.CreateMnemonic("orig", English, "password", Secp256k1)
+	require.NoError(t, err)
+	armor, err := kb.ExportPrivKey("orig", "", "pw")
+	require.NoError(t, err)
+	require.NoError(t, kb.ImportPrivKey("dup", armor, "pw"))
+
+	require.NoError(t, kb.SetDefault("dup"))
+	require.NoError(t, kb.MergeDuplicates("orig", []string{"dup"}))
+	_, err = kb.GetDefault()
+	require.Equal(t, ErrNoDefaultKey, err)
+}
+
+func TestKeyringDefaultKeyPersists(t *testing.T) {
+	dir, cleanup := tests.NewTestCaseDir(t)
+	t.Cleanup(cleanup)
+
+	kb, err := NewKeyring("keybasename", BackendTest, dir, nil)
+	require.NoError(t, err)
+	_, _, err = kb.CreateMnemonic("default", English, "password", Secp256k1)
+	require.NoError(t, err)
+	require.NoError(t, kb.SetDefault("default"))
+
+	kb, err = NewKeyring("keybasename", BackendTest, dir, nil)
+	require.NoError(t, err)
+	info, err := kb.GetDefault()
+	require.NoError(t, err)
+	require.Equal(t, "default", info.GetName())
+}
+
+func TestInMemorySignMulti(t *testing.T) {
+	kb := NewInMemory()
+
+	first, _, err := kb.CreateMnemonic("first", English, "password", Secp256k1)
+	require.NoError(t, err)
+	second, _, err := kb.CreateMnemonic("second", English, "password", Secp256k1)
+	require.NoError(t, err)
+	_, err = kb.CreateOffline("offline", secp256k1.GenPrivKey().PubKey(), Secp256k1)
+	require.NoError(t, err)
+
+	requests := []SignRequest{
+		{Name: "first", Msg: []byte("first message")},
+		{Name: "offline", Msg: []byte("offline message")},
+		{Name: "second", Msg: []byte("second message")},
+		{Name: "missing", Msg: []byte("missing message")},
+	}
+	results, err := kb.SignMulti(requests)
+	require.EqualError(t, err, "2 of 4 sign requests failed")
+	require.Len(t, results, len(requests))
+
+	require.NoError(t, results[0].Err)
+	require.Equal(t, first.GetPubKey(), results[0].PubKey)
+	require.True(t, first.GetPubKey().VerifyBytes(requests[0].Msg, results[0].Signature))
+
+	require.NoError(t, results[2].Err)
+	require.Equal(t, second.GetPubKey(), results[2].PubKey)
+	require.True(t, second.GetPubKey().VerifyBytes(requests[2].Msg, results[2].Signature))
+
+	for _, i := range []int{1, 3} {
+		require.Error(t, results[i].Err)
+		require.Nil(t, results[i].Signature)
+	}
+
+	results, err = kb.SignMulti(requests[:1])
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+}
+
+func TestInMemoryBackupRestore(t *testing.T) {
+	dir, cleanup := tests.NewTestCaseDir(t)
+	t.Cleanup(cleanup)
+	path := filepath.Join(dir, "keyring.backup")
+
+	kb := NewInMemory(WithArmorKDFParams(crypto.MinBcryptCost))
+
+	local, _, err := kb.CreateMnemonic("local", English, "password", Secp256k1)
+	require.NoError(t, err)
+	_, err = kb.CreateOffline("offline", secp256k1.GenPrivKey().PubKey(), Secp256k1)
+	require.NoError(t, err)
+	multi := multisig.NewPubKeyMultisigThreshold(1, []tmcrypto.PubKey{local.GetPubKey()})
+	_, err = kb.CreateMulti("multi", multi)
+	require.NoError(t, err)
+
+	kr := kb.(keyringKeybase)
+	ledger := newLedgerInfo("ledger", secp256k1.GenPrivKey().PubKey(), *hd.NewFundraiserParams(0, sdk.CoinType, 0), Secp256k1)
+	require.NoError(t, kr.writeInfo("ledger", ledger))
+	fido2 := newFIDO2Info("fido2", PubKeyFIDO2{RPID: "cosmos", Key: ed25519.GenPrivKey().PubKey().(ed25519.PubKeyEd25519)}, []byte("credential"))
+	require.NoError(t, kr.writeInfo("fido2", fido2))
+	require.NoError(t, kb.SetDefault("local"))
+
+	require.NoError(t, kb.BackupToFile(path, "backup passphrase"))
+
+	// restore into an empty keyring
+	restored := NewInMemory()
+	imported, err := restored.RestoreFromFile(path, "backup passphrase")
+	require.NoError(t, err)
+	require.Equal(t, 5, imported)
+
+	expected, err := kb.List()
+	require.NoError(t, err)
+	infos, err := restored.List()
+	require.NoError(t, err)
+	require.Equal(t, expected, infos)
+
+	def, err := restored.GetDefault()
+	require.NoError(t, err)
+	require.Equal(t, "local", def.GetName())
+
+	// the restored local key can sign
+	msg := []byte("message")
+	sig, pub, err := restored.Sign("local", "", msg)
+	require.NoError(t, err)
+	require.True(t, pub.VerifyBytes(msg, sig))
+
+	info, err := restored.GetByAddress(local.GetAddress())
+	require.NoError(t, err)
+	require.Equal(t, "local", info.GetName())
+
+	// existing keys are skipped
+	partial := NewInMemory()
+	_, err = partial.CreateOffline("local", secp256k1.GenPrivKey().PubKey(), Secp256k1)
+	require.NoError(t, err)
+	imported, err = partial.RestoreFromFile(path, "backup passphrase")
+	require.NoError(t, err)
+	require.Equal(t, 4, imported)
+	info, err = partial.Get("local")
+	require.NoError(t, err)
+	require.Equal(t, TypeOffline, info.GetType())
+
+	// wrong passphrase and corrupted archives are rejected
+	_, err = NewInMemory().RestoreFromFile(path, "wrong passphrase")
+	require.Error(t, err)
+
+	archive, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	blockType, header, sealed, err := tmarmor.DecodeArmor(string(archive))
+	require.NoError(t, err)
+	sealed[len(sealed)/2] ^= 0x01
+	corrupted := tmarmor.EncodeArmor(blockType, header, sealed)
+	require.NoError(t, ioutil.WriteFile(path, []byte(corrupted), 0600))
+	_, err = NewInMemory().RestoreFromFile(path, "backup passphrase")
+	require.Error(t, err)
+}
+
+func TestStealthPubKeyVector(t *testing.T) {
+	privKey := func(hexKey string) secp256k1.PrivKeySecp256k1 {
+		bz, err := hex.DecodeString(hexKey)
+		require.NoError(t, err)
+
+		var priv secp256k1.PrivKeySecp256k1
+		copy(priv[:], bz)
+		return priv
+	}
+
+	scan := privKey("5b36ccf0d13a9bfcff391302f70d6cfc88a74307f544645c4221a8852ffddd08")
+	spend := privKey("9dc16f665a23cecf3bfb5a01bce2033e8925c4915f773d46612b9b6d7db64a7d")
+	ephemeral := privKey("894f11788a397c9d0ec23e82bc52163c6561e104af0e618463d686f87fadcd68")
+
+	ephemeralPub := ephemeral.PubKey().(secp256k1.PubKeySecp256k1)
+	require.Equal(t, "03c4655e9724d96e562c0d1fdfefb3533ab11e1c859526d87b1667ed48d02ed6e2", hex.EncodeToString(ephemeralPub[:]))
+
+	// the sender and the recipient derive the same one-time key
+	sent, err := stealthPubKey(ephemeral, scan.PubKey(), spend.PubKey())
+	require.NoError(t, err)
+	received, err := stealthPubKey(scan, ephemeralPub, spend.PubKey())
+	require.NoError(t, err)
+	require.Equal(t, sent, received)
+
+	require.Equal(t, "03c18ec7fc9606787eefea2931d50092ae7ad75ff4299b31c8bb2bdf682b9b00ba", hex.EncodeToString(sent[:]))
+	require.Equal(t, "7bdb7237b71db0565028e88dc8bae31b5b4886af", hex.EncodeToString(sent.Address()))
+
+	// the one-time key is spendable with b + c
+	oneTime := privKey("ea7db03f4857675662d6dba35f74f7a5a00609dc0e622ddbef61ae1a1edb163d")
+	require.Equal(t, sent, oneTime.PubKey())
+
+	_, err = stealthPubKey(ed25519.GenPrivKey(), scan.PubKey(), spend.PubKey())
+	require.Equal(t, ErrUnsupportedSigningAlgo, err)
+	_, err = stealthPubKey(ephemeral, ed25519.GenPrivKey().PubKey(), spend.PubKey())
+	require.Equal(t, ErrCurveMismatch, err)
+	_, err = stealthPubKey(ephemeral, scan.PubKey(), ed25519.GenPrivKey().PubKey())
+	require.Equal(t, ErrCurveMismatch, err)
+}
+
+func TestInMemoryStealthAddress(t *testing.T) {
+	kb := NewInMemory(WithStealthAddresses())
+
+	scan, _, err := kb.CreateMnemonic("scan", English, "password", Secp256k1)
+	require.NoError(t, err)
+	spend, _, err := kb.CreateMnemonic("spend", English, "password", Secp256k1)
+	require.NoError(t, err)
+	other, _, err := kb.CreateMnemonic("other", English, "password", Secp256k1)
+	require.NoError(t, err)
+
+	addr, ephemeralPub, err := kb.StealthAddress(scan.GetPubKey(), spend.GetPubKey())
+	require.NoError(t, err)
+	require.NotEqual(t, scan.GetAddress(), addr)
+	require.NotEqual(t, spend.GetAddress(), addr)
+
+	found, err := kb.ScanForStealth("scan", spend.GetPubKey(), ephemeralPub, addr)
+	require.NoError(t, err)
+	require.True(t, found)
+
+	// every payment uses a fresh one-time address
+	addr2, ephemeralPub2, err := kb.StealthAddress(scan.GetPubKey(), spend.GetPubKey())
+	require.NoError(t, err)
+	require.NotEqual(t, addr, addr2)
+
+	found, err = kb.ScanForStealth("scan", spend.GetPubKey(), ephemeralPub2, addr)
+	require.NoError(t, err)
+	require.False(t, found)
+
+	// payments to others are not detected
+	found, err = kb.ScanForStealth("other", spend.GetPubKey(), ephemeralPub, addr)
+	require.NoError(t, err)
+	require.False(t, found)
+
+	found, err = kb.ScanForStealth("scan", other.GetPubKey(), ephemeralPub, addr)
+	require.NoError(t, err)
+	require.False(t, found)
+
+	_, _, err = kb.StealthAddress(ed25519.GenPrivKey().PubKey(), spend.GetPubKey())
+	require.Equal(t, ErrCurveMismatch, err)
+
+	_, err = kb.CreateOffline("offline", scan.GetPubKey(), Secp256k1)
+	require.NoError(t, err)
+	_, err = kb.ScanForStealth("offline", spend.GetPubKey(), ephemeralPub, addr)
+	require.Error(t, err)
+
+	// stealth addresses are disabled by default
+	kb = NewInMemory()
+	_, _, err = kb.StealthAddress(scan.GetPubKey(), spend.GetPubKey())
+	require.Equal(t, ErrStealthAddressesDisabled, err)
+	_, err = kb.ScanForStealth("scan", spend.GetPubKey(), ephemeralPub, addr)
+	require.Equal(t, ErrStealthAddressesDisabled, err)
+}
+
+func TestInMemoryCanSatisfyMultisig(t *testing.T) {
+	kb := NewInMemory()
+
+	var pubKeys []tmcrypto.PubKey
+	for _, name := range []string{"k1", "k2", "k3"} {
+		info, _, err := kb.CreateMnemonic(name, English, "password", Secp256k1)
+		require.NoError(t, err)
+		pubKeys = append(pubKeys, info.GetPubKey())
+	}
+	pubKeys = append(pubKeys, secp256k1.GenPrivKey().PubKey())
+
+	_, err := kb.CreateMultisig("multi", 2, pubKeys, false)
+	require.NoError(t, err)
+
+	// more member keys than the threshold
+	ok, available, required, err := kb.CanSatisfyMultisig("multi")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, 3, available)
+	require.Equal(t, 2, required)
+
+	// exactly the threshold
+	require.NoError(t, kb.Delete("k3", "", true))
+	ok, available, required, err = kb.CanSatisfyMultisig("multi")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, 2, available)
+	require.Equal(t, 2, required)
+
+	// fewer member keys than the threshold
+	require.NoError(t, kb.Delete("k2", "", true))
+	ok, available, required, err = kb.CanSatisfyMultisig("multi")
+	require.NoError(t, err)
+	require.False(t, ok)
+	require.Equal(t, 1, available)
+	require.Equal(t, 2, required)
+
+	// member keys which cannot sign are not counted
+	_, err = kb.CreateOffline("k2-offline", pubKeys[1], Secp256k1)
+	require.NoError(t, err)
+	ok, available, _, err = kb.CanSatisfyMultisig("multi")
+	require.NoError(t, err)
+	require.False(t, ok)
+	require.Equal(t, 1, available)
+
+	_, _, _, err = kb.CanSatisfyMultisig("k1")
+	require.Error(t, err)
+	_, _, _, err = kb.CanSatisfyMultisig("missing")
+	require.Error(t, err)
+}
@@ -0,0 +1,79 @@
+package keyring
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	tmcrypto "github.com/tendermint/tendermint/crypto"
+	"github.com/tendermint/tendermint/crypto/multisig"
+)
+
+// SortMultisigPubKeys sorts the member public keys of a multisig key by the
+// bytes of their addresses, the canonical order used by the keys add
+// --multisig command. The same members then always produce the same multisig
+// key, and address, regardless of the order in which they are supplied.
+func SortMultisigPubKeys(pubKeys []tmcrypto.PubKey) {
+	sort.Slice(pubKeys, func(i, j int) bool {
+		return bytes.Compare(pubKeys[i].Address(), pubKeys[j].Address()) < 0
+	})
+}
+
+// CreateMultisig builds a threshold multisig key of the given member public
+// keys and stores it. The members are sorted as defined by SortMultisigPubKeys
+// unless noSort is set, in which case they are taken in the supplied order for
+// compatibility with multisig keys built without sorting.
+func (kb keyringKeybase) CreateMultisig(name string, threshold int, pubKeys []tmcrypto.PubKey, noSort bool) (Info, error) {
+	if threshold <= 0 {
+		return nil, fmt.Errorf("threshold must be a positive integer")
+	}
+	if len(pubKeys) < threshold {
+		return nil, fmt.Errorf("threshold k of n multisignature: %d < %d", len(pubKeys), threshold)
+	}
+
+	pks := make([]tmcrypto.PubKey, len(pubKeys))
+	copy(pks, pubKeys)
+	if !noSort {
+		SortMultisigPubKeys(pks)
+	}
+
+	return kb.CreateMulti(name, multisig.NewPubKeyMultisigThreshold(threshold, pks))
+}
+
+// CanSatisfyMultisig reports whether the keyring alone can meet the threshold
+// of the named multisig key, i.e. whether it holds at least threshold member
+// keys which can sign. It also returns the number of such member keys and the
+// threshold.
+func (kb keyringKeybase) CanSatisfyMultisig(name string) (ok bool, available, required int, err error) {
+	info, err := kb.Get(name)
+	if err != nil {
+		return false, 0, 0, err
+	}
+
+	multiPK, isMulti := info.GetPubKey().(multisig.PubKeyMultisigThreshold)
+	if !isMulti {
+		return false, 0, 0, fmt.Errorf("key %s is not a multisig key", name)
+	}
+
+	infos, err := kb.List()
+	if err != nil {
+		return false, 0, 0, err
+	}
+
+	signable := make(map[string]bool)
+	for _, info := range infos {
+		if kb.capabilities(info).CanSign {
+			signable[string(info.GetPubKey().Bytes())] = true
+		}
+	}
+
+	for _, pub := range multiPK.PubKeys {
+		if signable[string(pub.Bytes())] {
+			available++
+		}
+	}
+
+	required = int(multiPK.K)
+
+	return available >= required, available, required, nil
+}
@@ -1,5 +1,14 @@
 package keyring
 
+import (
+	"io"
+	"time"
+
+	tmcrypto "github.com/tendermint/tendermint/crypto"
+
+	"github.com/cosmos/cosmos-sdk/types"
+)
+
 // KeybaseOption overrides options for the db
 type KeybaseOption func(*kbOptions)
 
@@ -8,8 +17,24 @@ type kbOptions struct {
 	deriveFunc           DeriveKeyFunc
 	supportedAlgos       []SigningAlgo
 	supportedAlgosLedger []SigningAlgo
+	sessionTimeout       time.Duration
+	maxKeys              int
+	exportAudit          bool
+	infoCodec            InfoCodec
+	entropySource        io.Reader
+	fido2Authenticator   FIDO2Authenticator
+	backendAttempts      int
+	backendRetryDelay    time.Duration
+	noPrivExport         bool
+	armorBcryptCost      int
+	signAuditLog         func(name string, msgHash []byte, t time.Time)
+	addressDeriver       AddressDeriver
+	stealthAddresses     bool
 }
 
+// AddressDeriver derives the address of a public key.
+type AddressDeriver func(pub tmcrypto.PubKey) types.AccAddress
+
 // WithKeygenFunc applies an overridden key generation function to generate the private key.
 func WithKeygenFunc(f PrivKeyGenFunc) KeybaseOption {
 	return func(o *kbOptions) {
@@ -37,3 +62,118 @@ func WithSupportedAlgosLedger(algos []SigningAlgo) KeybaseOption {
 		o.supportedAlgosLedger = algos
 	}
 }
+
+// WithSessionTimeout defines how long a keyring session opened via Unlock stays
+// valid before the cached passphrase is discarded.
+func WithSessionTimeout(d time.Duration) KeybaseOption {
+	return func(o *kbOptions) {
+		o.sessionTimeout = d
+	}
+}
+
+// WithMaxKeys limits the number of keys the keyring may hold. Adding a key
+// beyond the limit fails. A value of zero means no limit.
+func WithMaxKeys(n int) KeybaseOption {
+	return func(o *kbOptions) {
+		o.maxKeys = n
+	}
+}
+
+// WithExportAudit enables the export audit log. Every export of a private key
+// is recorded in the keyring and can be retrieved via ExportHistory.
+func WithExportAudit() KeybaseOption {
+	return func(o *kbOptions) {
+		o.exportAudit = true
+	}
+}
+
+// WithInfoCodec sets the codec used to serialize the Info objects stored in the
+// keyring. Info objects which cannot be decoded with the codec are decoded with
+// the default amino codec, so that keys written before switching codecs remain
+// readable.
+func WithInfoCodec(codec InfoCodec) KeybaseOption {
+	return func(o *kbOptions) {
+		o.infoCodec = codec
+	}
+}
+
+// WithEntropySource sets the reader the entropy of new mnemonics is read from
+// instead of the system's secure random source. The reader must provide enough
+// entropy for the requested mnemonic size, i.e. 32 bytes for 24 words.
+func WithEntropySource(r io.Reader) KeybaseOption {
+	return func(o *kbOptions) {
+		o.entropySource = r
+	}
+}
+
+// WithFIDO2Authenticator sets the FIDO2 authenticator used to create and sign
+// with FIDO2 keys. FIDO2 keys are unusable unless an authenticator is set.
+func WithFIDO2Authenticator(authenticator FIDO2Authenticator) KeybaseOption {
+	return func(o *kbOptions) {
+		o.fido2Authenticator = authenticator
+	}
+}
+
+// WithBackendRetry retries keyring backend operations failing with a transient
+// error, e.g. a re-locked OS keychain, up to attempts times in total, waiting
+// delay between attempts. An error is transient if it reports itself as
+// temporary through a Temporary() bool method returning true; any other error,
+// e.g. a wrong passphrase, is returned at once. The passphrase session is
+// locked before each retry so that backends which prompt for a passphrase
+// prompt again.
+func WithBackendRetry(attempts int, delay time.Duration) KeybaseOption {
+	return func(o *kbOptions) {
+		o.backendAttempts = attempts
+		o.backendRetryDelay = delay
+	}
+}
+
+// WithNoPrivExport makes the keyring view-only with respect to private keys:
+// exporting any private key fails with ErrPrivExportDisabled. Signing is not
+// affected.
+func WithNoPrivExport() KeybaseOption {
+	return func(o *kbOptions) {
+		o.noPrivExport = true
+	}
+}
+
+// WithArmorKDFParams sets the bcrypt cost of the key derivation protecting the
+// private keys exported by ExportPrivKey and ExportCompact. It defaults to
+// crypto.BcryptSecurityParameter, which is a safe choice; higher costs make
+// passphrases harder to brute force, lower ones only suit tests. Imports read
+// the cost from the exported key and are not affected.
+func WithArmorKDFParams(bcryptCost int) KeybaseOption {
+	return func(o *kbOptions) {
+		o.armorBcryptCost = bcryptCost
+	}
+}
+
+// WithSignAuditLog sets a hook called after every successful signature with the
+// name of the signing key, the SHA-256 hash of the signed message and the time
+// of signing. The message itself is never passed to the hook.
+func WithSignAuditLog(logger func(name string, msgHash []byte, t time.Time)) KeybaseOption {
+	return func(o *kbOptions) {
+		o.signAuditLog = logger
+	}
+}
+
+// WithAddressDeriver replaces the derivation of key addresses from public
+// keys, which defaults to the address of the public key, e.g. to index keys by
+// Ethereum style addresses. Keys are indexed by the derived address on write
+// and looked up by it in GetByAddress, hence the deriver must not change over
+// the lifetime of a keyring. The derived addresses are also returned by
+// SignableAddresses and GetAddressForPrefix; Info.GetAddress is not affected.
+func WithAddressDeriver(deriver AddressDeriver) KeybaseOption {
+	return func(o *kbOptions) {
+		o.addressDeriver = deriver
+	}
+}
+
+// WithStealthAddresses enables the derivation of stealth addresses via
+// StealthAddress and the detection of stealth payments via ScanForStealth.
+// Stealth addresses are only supported for secp256k1 keys.
+func WithStealthAddresses() KeybaseOption {
+	return func(o *kbOptions) {
+		o.stealthAddresses = true
+	}
+}
@@ -1,6 +1,8 @@
 package keyring
 
 import (
+	"github.com/tendermint/tendermint/crypto"
+
 	sdk "github.com/cosmos/cosmos-sdk/types"
 )
 
@@ -26,6 +28,31 @@ func NewKeyOutput(name, keyType, address, pubkey string) KeyOutput {
 	}
 }
 
+// ValidatorPubKeyEntry defines the consensus public key of a key in the
+// encodings needed for genesis validator entries.
+type ValidatorPubKeyEntry struct {
+	Name       string        `json:"name" yaml:"name"`
+	Address    string        `json:"address" yaml:"address"`
+	PubKey     crypto.PubKey `json:"pub_key" yaml:"pub_key"`
+	ConsPubKey string        `json:"cons_pub_key" yaml:"cons_pub_key"`
+}
+
+// NewValidatorPubKeyEntry creates a ValidatorPubKeyEntry from an Info object.
+// The address and public key are Bech32 encoded with the "cons" prefixes.
+func NewValidatorPubKeyEntry(info Info) (ValidatorPubKeyEntry, error) {
+	consPubKey, err := sdk.Bech32ifyPubKey(sdk.Bech32PubKeyTypeConsPub, info.GetPubKey())
+	if err != nil {
+		return ValidatorPubKeyEntry{}, err
+	}
+
+	return ValidatorPubKeyEntry{
+		Name:       info.GetName(),
+		Address:    sdk.ConsAddress(info.GetPubKey().Address()).String(),
+		PubKey:     info.GetPubKey(),
+		ConsPubKey: consPubKey,
+	}, nil
+}
+
 type multisigPubKeyOutput struct {
 	Address string `json:"address" yaml:"address"`
 	PubKey  string `json:"pubkey" yaml:"pubkey"`
@@ -0,0 +1,99 @@
+package keyring
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// tokenBucket allows up to capacity operations at once and refills at a rate of
+// capacity tokens per interval.
+type tokenBucket struct {
+	capacity float64
+	interval time.Duration
+	tokens   float64
+	last     time.Time
+}
+
+// take consumes a token if one is available after refilling the bucket for the
+// time elapsed since the last call.
+func (b *tokenBucket) take(now time.Time) bool {
+	elapsed := now.Sub(b.last)
+	if elapsed > 0 {
+		b.tokens += b.capacity * float64(elapsed) / float64(b.interval)
+		if b.tokens > b.capacity {
+			b.tokens = b.capacity
+		}
+		b.last = now
+	}
+
+	if b.tokens < 1 {
+		return false
+	}
+
+	b.tokens--
+	return true
+}
+
+// signRateLimiter holds the per key sign rate limits of a keyring. Its state
+// is kept in memory and is shared by all the copies of the keyring.
+type signRateLimiter struct {
+	mtx     sync.Mutex
+	buckets map[string]*tokenBucket
+
+	// now returns the current time; it is overridable for tests
+	now func() time.Time
+}
+
+func newSignRateLimiter() *signRateLimiter {
+	return &signRateLimiter{
+		buckets: make(map[string]*tokenBucket),
+		now:     time.Now,
+	}
+}
+
+// set limits the named key to maxPerInterval signatures per interval, starting
+// with a full bucket. A non positive maxPerInterval removes the limit.
+func (l *signRateLimiter) set(name string, maxPerInterval int, interval time.Duration) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	if maxPerInterval <= 0 || interval <= 0 {
+		delete(l.buckets, name)
+		return
+	}
+
+	l.buckets[name] = &tokenBucket{
+		capacity: float64(maxPerInterval),
+		interval: interval,
+		tokens:   float64(maxPerInterval),
+		last:     l.now(),
+	}
+}
+
+// take consumes a signature of the named key. It returns an error wrapping
+// ErrSignRateLimitExceeded if the key is rate limited and its limit is reached.
+func (l *signRateLimiter) take(name string) error {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	bucket, ok := l.buckets[name]
+	if !ok || bucket.take(l.now()) {
+		return nil
+	}
+
+	return errors.Wrapf(
+		ErrSignRateLimitExceeded, "key %s is limited to %.0f signatures per %s",
+		name, bucket.capacity, bucket.interval,
+	)
+}
+
+// SetSignRateLimit limits the signatures of the named key to maxPerInterval per
+// interval using a token bucket, so that bursts of up to maxPerInterval
+// signatures are allowed. Signing beyond the limit fails with an error wrapping
+// ErrSignRateLimitExceeded. The limit only applies to this process and is not
+// persisted. A non positive maxPerInterval removes the limit.
+func (kb keyringKeybase) SetSignRateLimit(name string, maxPerInterval int, interval time.Duration) {
+	kb.signLimiter.set(name, maxPerInterval, interval)
+}
@@ -0,0 +1,228 @@
+package keyring
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"github.com/99designs/keyring"
+	"github.com/tendermint/crypto/bcrypt"
+)
+
+// DefaultSessionTimeout is the default amount of time an unlocked keyring
+// session remains valid.
+const DefaultSessionTimeout = 5 * time.Minute
+
+// Session describes an unlocked keyring session. While a session is active,
+// backend passphrase prompts are answered from memory instead of prompting the
+// user.
+type Session struct {
+	ExpiresAt time.Time
+}
+
+// passphraseSession caches the keyring passphrase for a bounded amount of time.
+// The cached passphrase is zeroed when the session is locked or expires.
+type passphraseSession struct {
+	mtx       sync.Mutex
+	dir       string
+	timeout   time.Duration
+	pass      []byte
+	expiresAt time.Time
+
+	// generation is incremented whenever the cached passphrase is cleared
+	generation uint64
+
+	// now returns the current time; it is overridable for tests
+	now func() time.Time
+}
+
+func newPassphraseSession(dir string, timeout time.Duration) *passphraseSession {
+	return &passphraseSession{
+		dir:     dir,
+		timeout: timeout,
+		now:     time.Now,
+	}
+}
+
+// unlock verifies the passphrase against the stored keyring passphrase hash, if
+// any, and caches it until the session timeout elapses.
+func (s *passphraseSession) unlock(passphrase string) (Session, error) {
+	keyhash, keyhashStored, err := readKeyhash(s.dir)
+	if err != nil {
+		return Session{}, err
+	}
+
+	if keyhashStored {
+		if err := bcrypt.CompareHashAndPassword(keyhash, []byte(passphrase)); err != nil {
+			return Session{}, ErrIncorrectPassphrase
+		}
+	} else {
+		if err := os.MkdirAll(s.dir, 0700); err != nil {
+			return Session{}, err
+		}
+
+		if err := writeKeyhash(s.dir, passphrase); err != nil {
+			return Session{}, err
+		}
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	s.clear()
+	s.pass = []byte(passphrase)
+	s.expiresAt = s.now().Add(s.timeout)
+
+	return Session{ExpiresAt: s.expiresAt}, nil
+}
+
+// lock clears the cached passphrase.
+func (s *passphraseSession) lock() {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	s.clear()
+}
+
+// passphrase returns the cached passphrase if the session is still active. An
+// expired session is cleared.
+func (s *passphraseSession) passphrase() (string, bool) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if s.pass == nil {
+		return "", false
+	}
+
+	if !s.now().Before(s.expiresAt) {
+		s.clear()
+		return "", false
+	}
+
+	return string(s.pass), true
+}
+
+// currentGeneration returns the generation of the session, clearing it first
+// if expired. A backend opened in an earlier generation may hold a passphrase
+// which has since been locked away.
+func (s *passphraseSession) currentGeneration() uint64 {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if s.pass != nil && !s.now().Before(s.expiresAt) {
+		s.clear()
+	}
+
+	return s.generation
+}
+
+// clear zeroes and drops the cached passphrase. The caller must hold the lock.
+func (s *passphraseSession) clear() {
+	for i := range s.pass {
+		s.pass[i] = 0
+	}
+
+	s.pass = nil
+	s.expiresAt = time.Time{}
+	s.generation++
+}
+
+// wrapPrompt returns a passphrase prompt that is answered from the session
+// while it is active and falls back to the given prompt otherwise.
+func (s *passphraseSession) wrapPrompt(prompt func(string) (string, error)) func(string) (string, error) {
+	return func(msg string) (string, error) {
+		if pass, ok := s.passphrase(); ok {
+			return pass, nil
+		}
+
+		return prompt(msg)
+	}
+}
+
+// sessionKeyring is a keyring backend which is opened anew whenever its session
+// is unlocked, locked or expires. Backends such as the file backend keep the
+// passphrase they prompted for as long as they are open: dropping them drops
+// their copy of the passphrase, so that the next operation prompts for it
+// again unless the session is active.
+type sessionKeyring struct {
+	mtx        sync.Mutex
+	config     keyring.Config
+	session    *passphraseSession
+	db         keyring.Keyring
+	generation uint64
+}
+
+// openSessionKeyring opens the backend of config, whose passphrase prompt must
+// be wrapped by session.
+func openSessionKeyring(config keyring.Config, session *passphraseSession) (keyring.Keyring, error) {
+	sk := &sessionKeyring{config: config, session: session}
+	if _, err := sk.backend(); err != nil {
+		return nil, err
+	}
+
+	return sk, nil
+}
+
+// backend returns the open backend, reopening it if the session changed since
+// it was opened.
+func (sk *sessionKeyring) backend() (keyring.Keyring, error) {
+	sk.mtx.Lock()
+	defer sk.mtx.Unlock()
+
+	generation := sk.session.currentGeneration()
+	if sk.db == nil || generation != sk.generation {
+		db, err := keyring.Open(sk.config)
+		if err != nil {
+			return nil, err
+		}
+
+		sk.db, sk.generation = db, generation
+	}
+
+	return sk.db, nil
+}
+
+func (sk *sessionKeyring) Get(key string) (keyring.Item, error) {
+	db, err := sk.backend()
+	if err != nil {
+		return keyring.Item{}, err
+	}
+
+	return db.Get(key)
+}
+
+func (sk *sessionKeyring) GetMetadata(key string) (keyring.Metadata, error) {
+	db, err := sk.backend()
+	if err != nil {
+		return keyring.Metadata{}, err
+	}
+
+	return db.GetMetadata(key)
+}
+
+func (sk *sessionKeyring) Set(item keyring.Item) error {
+	db, err := sk.backend()
+	if err != nil {
+		return err
+	}
+
+	return db.Set(item)
+}
+
+func (sk *sessionKeyring) Remove(key string) error {
+	db, err := sk.backend()
+	if err != nil {
+		return err
+	}
+
+	return db.Remove(key)
+}
+
+func (sk *sessionKeyring) Keys() ([]string, error) {
+	db, err := sk.backend()
+	if err != nil {
+		return nil, err
+	}
+
+	return db.Keys()
+}
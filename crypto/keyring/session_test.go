@@ -0,0 +1,141 @@
+package keyring
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/cosmos/cosmos-sdk/tests"
+)
+
+func TestPassphraseSessionExpiry(t *testing.T) {
+	dir, cleanup := tests.NewTestCaseDir(t)
+	t.Cleanup(cleanup)
+
+	now := time.Now()
+	s := newPassphraseSession(dir, time.Minute)
+	s.now = func() time.Time { return now }
+
+	prompted := 0
+	prompt := s.wrapPrompt(func(string) (string, error) {
+		prompted++
+		return "prompted", nil
+	})
+
+	// no session, fall back to the prompt
+	pass, err := prompt("")
+	require.NoError(t, err)
+	require.Equal(t, "prompted", pass)
+	require.Equal(t, 1, prompted)
+
+	session, err := s.unlock("password")
+	require.NoError(t, err)
+	require.Equal(t, now.Add(time.Minute), session.ExpiresAt)
+
+	// within the session the prompt is not invoked
+	now = now.Add(30 * time.Second)
+	pass, err = prompt("")
+	require.NoError(t, err)
+	require.Equal(t, "password", pass)
+	require.Equal(t, 1, prompted)
+
+	// once expired, the cached passphrase is wiped
+	cached := s.pass
+	now = now.Add(30 * time.Second)
+	pass, err = prompt("")
+	require.NoError(t, err)
+	require.Equal(t, "prompted", pass)
+	require.Equal(t, 2, prompted)
+	require.Nil(t, s.pass)
+	require.Equal(t, make([]byte, len(cached)), cached)
+
+	// a wrong passphrase cannot open a new session
+	_, err = s.unlock("wrong")
+	require.Equal(t, ErrIncorrectPassphrase, err)
+
+	// locking clears the session early
+	_, err = s.unlock("password")
+	require.NoError(t, err)
+	cached = s.pass
+	s.lock()
+	require.Nil(t, s.pass)
+	require.Equal(t, make([]byte, len(cached)), cached)
+
+	_, ok := s.passphrase()
+	require.False(t, ok)
+}
+
+func TestKeyringSessionUnlock(t *testing.T) {
+	dir, cleanup := tests.NewTestCaseDir(t)
+	t.Cleanup(cleanup)
+
+	// a single passphrase is provided on the input, hence a second prompt
+	// fails
+	kr, err := NewKeyring("cosmos", BackendFile, dir, strings.NewReader("password\n"))
+	require.NoError(t, err)
+
+	_, err = kr.Unlock("password")
+	require.NoError(t, err)
+
+	info, _, err := kr.CreateMnemonic("foo", English, "password", Secp256k1)
+	require.NoError(t, err)
+
+	_, _, err = kr.Sign("foo", "", []byte("msg"))
+	require.NoError(t, err)
+
+	_, err = kr.Get(info.GetName())
+	require.NoError(t, err)
+
+	// the backend prompts again once locked
+	kr.Lock()
+	_, _, err = kr.Sign("foo", "", []byte("msg"))
+	require.NoError(t, err)
+
+	kr.Lock()
+	_, _, err = kr.Sign("foo", "", []byte("msg"))
+	require.Error(t, err)
+
+	// and once the session expires
+	_, err = kr.Unlock("password")
+	require.NoError(t, err)
+	_, _, err = kr.Sign("foo", "", []byte("msg"))
+	require.NoError(t, err)
+
+	now := time.Now().Add(DefaultSessionTimeout)
+	kr.(keyringKeybase).session.now = func() time.Time { return now }
+	_, _, err = kr.Sign("foo", "", []byte("msg"))
+	require.Error(t, err)
+
+	_, err = NewInMemory().Unlock("password")
+	require.Equal(t, ErrSessionNotSupported, err)
+}
+
+func TestKeyringRetryReprompts(t *testing.T) {
+	dir, cleanup := tests.NewTestCaseDir(t)
+	t.Cleanup(cleanup)
+
+	prompts := 0
+	config := newFileBackendKeyringConfig("cosmos", dir, nil)
+	session := newPassphraseSession(config.FileDir, DefaultSessionTimeout)
+	config.FilePasswordFunc = session.wrapPrompt(func(string) (string, error) {
+		prompts++
+		return "password", nil
+	})
+
+	backend, err := openSessionKeyring(config, session)
+	require.NoError(t, err)
+	db := &flakyKeyring{Keyring: backend}
+	kb := newKeyringKeybase(db, session, WithBackendRetry(2, 0))
+
+	_, _, err = kb.CreateMnemonic("key", English, "password", Secp256k1)
+	require.NoError(t, err)
+	require.Equal(t, 1, prompts)
+
+	// the backend is reopened before retrying, hence prompts again
+	db.failures = 1
+	_, err = kb.Get("key")
+	require.NoError(t, err)
+	require.Equal(t, 2, prompts)
+}
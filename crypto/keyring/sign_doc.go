@@ -0,0 +1,63 @@
+package keyring
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/pkg/errors"
+	tmcrypto "github.com/tendermint/tendermint/crypto"
+
+	"github.com/cosmos/cosmos-sdk/types"
+)
+
+// StdSignDoc is the sign document of a standard tx. It mirrors the StdSignDoc
+// of the auth module, which cannot be imported by the keyring, and produces the
+// same sign bytes.
+type StdSignDoc struct {
+	AccountNumber uint64            `json:"account_number" yaml:"account_number"`
+	ChainID       string            `json:"chain_id" yaml:"chain_id"`
+	Fee           json.RawMessage   `json:"fee" yaml:"fee"`
+	Memo          string            `json:"memo" yaml:"memo"`
+	Msgs          []json.RawMessage `json:"msgs" yaml:"msgs"`
+	Sequence      uint64            `json:"sequence" yaml:"sequence"`
+}
+
+// Bytes returns the canonical bytes of the sign document to be signed.
+func (doc StdSignDoc) Bytes() []byte {
+	return types.MustSortJSON(CryptoCdc.MustMarshalJSON(doc))
+}
+
+// ValidateBasic rejects obviously malformed sign documents. Account number and
+// sequence 0 are valid and are not checked.
+func (doc StdSignDoc) ValidateBasic() error {
+	switch {
+	case doc.ChainID == "":
+		return errors.Wrap(ErrInvalidSignDoc, "empty chain-id")
+
+	case strings.TrimSpace(doc.ChainID) != doc.ChainID:
+		return errors.Wrapf(ErrInvalidSignDoc, "chain-id %q has surrounding whitespace", doc.ChainID)
+
+	case len(doc.Msgs) == 0:
+		return errors.Wrap(ErrInvalidSignDoc, "no messages")
+
+	case !json.Valid(doc.Fee):
+		return errors.Wrap(ErrInvalidSignDoc, "invalid fee")
+	}
+
+	for i, msg := range doc.Msgs {
+		if !json.Valid(msg) {
+			return errors.Wrapf(ErrInvalidSignDoc, "invalid message %d", i)
+		}
+	}
+
+	return nil
+}
+
+// SignTx validates the sign document and signs its bytes with the named key.
+func (kb keyringKeybase) SignTx(name string, doc StdSignDoc) ([]byte, tmcrypto.PubKey, error) {
+	if err := doc.ValidateBasic(); err != nil {
+		return nil, nil, err
+	}
+
+	return kb.Sign(name, "", doc.Bytes())
+}
@@ -0,0 +1,46 @@
+package keyring
+
+import (
+	"fmt"
+
+	tmcrypto "github.com/tendermint/tendermint/crypto"
+)
+
+// SignRequest is a request to sign Msg with the key Name.
+type SignRequest struct {
+	Name string
+	Msg  []byte
+}
+
+// SignResult is the result of a SignRequest. Err is set if signing failed, in
+// which case Signature is nil.
+type SignResult struct {
+	Signature []byte
+	PubKey    tmcrypto.PubKey
+	Err       error
+}
+
+// SignMulti signs the message of each request with its key. A failing request
+// does not prevent the others from being signed: the results are returned in
+// the order of the requests, along with an error if any of them failed.
+func (kb keyringKeybase) SignMulti(requests []SignRequest) ([]SignResult, error) {
+	results := make([]SignResult, len(requests))
+
+	var failed int
+	for i, req := range requests {
+		sig, pub, err := kb.Sign(req.Name, "", req.Msg)
+		if err != nil {
+			results[i] = SignResult{Err: err}
+			failed++
+			continue
+		}
+
+		results[i] = SignResult{Signature: sig, PubKey: pub}
+	}
+
+	if failed > 0 {
+		return results, fmt.Errorf("%d of %d sign requests failed", failed, len(requests))
+	}
+
+	return results, nil
+}
@@ -1,5 +1,10 @@
 package keyring
 
+import (
+	"github.com/tendermint/tendermint/crypto/ed25519"
+	"github.com/tendermint/tendermint/crypto/secp256k1"
+)
+
 // SigningAlgo defines an algorithm to derive key-pairs which can be used for cryptographic signing.
 type SigningAlgo string
 
@@ -15,6 +20,12 @@ const (
 	Sr25519 = SigningAlgo("sr25519")
 )
 
+// privKeySizes defines the length in bytes of raw private keys per algorithm.
+var privKeySizes = map[SigningAlgo]int{
+	Secp256k1: len(secp256k1.PrivKeySecp256k1{}),
+	Ed25519:   len(ed25519.PrivKeyEd25519{}),
+}
+
 // IsSupportedAlgorithm returns whether the signing algorithm is in the passed-in list of supported algorithms.
 func IsSupportedAlgorithm(supported []SigningAlgo, algo SigningAlgo) bool {
 	for _, supportedAlgo := range supported {
@@ -0,0 +1,149 @@
+package keyring
+
+import (
+	"crypto/sha256"
+	"math/big"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/pkg/errors"
+	tmcrypto "github.com/tendermint/tendermint/crypto"
+	cryptoAmino "github.com/tendermint/tendermint/crypto/encoding/amino"
+	"github.com/tendermint/tendermint/crypto/secp256k1"
+
+	"github.com/cosmos/cosmos-sdk/types"
+)
+
+// StealthKDFLabel is prepended to the shared point of a stealth address before
+// it is hashed into the tweak of the spend key.
+const StealthKDFLabel = "cosmos-sdk/keyring/stealth:"
+
+// The stealth addresses implement the dual-key scheme on the secp256k1 curve,
+// with generator G and order n. A recipient publishes a scan public key
+// Q = s·G and a spend public key B = b·G. To pay the recipient, the sender
+// picks a random ephemeral key r and computes:
+//
+//	R = r·G
+//	c = SHA-256(StealthKDFLabel || ser(r·Q)) mod n
+//	P = B + c·G
+//
+// where ser is the 33 byte compressed point encoding. The sender pays to the
+// address of P and publishes R. Since r·Q == s·R, the holder of the scan key s
+// recomputes P from R and B alone, hence can detect payments without being
+// able to spend them. The private key of P is b + c mod n.
+
+// StealthAddress derives a one-time address paying the owner of scanPubKey and
+// spendPubKey, along with the ephemeral public key the recipient needs to
+// detect the payment via ScanForStealth. Both keys must be secp256k1 keys.
+// Stealth addresses must be enabled with WithStealthAddresses.
+func (kb keyringKeybase) StealthAddress(
+	scanPubKey, spendPubKey tmcrypto.PubKey,
+) (types.AccAddress, tmcrypto.PubKey, error) {
+	if !kb.base.options.stealthAddresses {
+		return nil, nil, ErrStealthAddressesDisabled
+	}
+
+	ephemeral := secp256k1.GenPrivKey()
+
+	oneTimePub, err := stealthPubKey(ephemeral, scanPubKey, spendPubKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return kb.pubKeyAddress(oneTimePub), ephemeral.PubKey(), nil
+}
+
+// ScanForStealth reports whether oneTimeAddr is the stealth address derived
+// from ephemeralPub for the named local scan key and spendPubKey. Only local
+// secp256k1 scan keys are supported. Stealth addresses must be enabled with
+// WithStealthAddresses.
+func (kb keyringKeybase) ScanForStealth(
+	name string, spendPubKey, ephemeralPub tmcrypto.PubKey, oneTimeAddr types.AccAddress,
+) (bool, error) {
+	if !kb.base.options.stealthAddresses {
+		return false, ErrStealthAddressesDisabled
+	}
+
+	info, err := kb.Get(name)
+	if err != nil {
+		return false, err
+	}
+
+	linfo, ok := info.(localInfo)
+	if !ok {
+		return false, errors.New("stealth payments can only be scanned for with local keys")
+	}
+
+	if linfo.PrivKeyArmor == "" {
+		return false, errors.New("private key not available")
+	}
+
+	priv, err := cryptoAmino.PrivKeyFromBytes([]byte(linfo.PrivKeyArmor))
+	if err != nil {
+		return false, err
+	}
+
+	oneTimePub, err := stealthPubKey(priv, ephemeralPub, spendPubKey)
+	if err != nil {
+		return false, err
+	}
+
+	return kb.pubKeyAddress(oneTimePub).Equals(oneTimeAddr), nil
+}
+
+// stealthPubKey computes the one-time public key B + c·G, where c is derived
+// from the shared point priv·peer. The sender passes the ephemeral key and the
+// scan public key, the recipient the scan key and the ephemeral public key.
+func stealthPubKey(priv tmcrypto.PrivKey, peer, spendPubKey tmcrypto.PubKey) (secp256k1.PubKeySecp256k1, error) {
+	privKey, ok := priv.(secp256k1.PrivKeySecp256k1)
+	if !ok {
+		return secp256k1.PubKeySecp256k1{}, ErrUnsupportedSigningAlgo
+	}
+
+	peerPub, err := parseSecp256k1PubKey(peer)
+	if err != nil {
+		return secp256k1.PubKeySecp256k1{}, err
+	}
+
+	spendPub, err := parseSecp256k1PubKey(spendPubKey)
+	if err != nil {
+		return secp256k1.PubKeySecp256k1{}, err
+	}
+
+	curve := btcec.S256()
+	sx, sy := curve.ScalarMult(peerPub.X, peerPub.Y, privKey[:])
+	shared := btcec.PublicKey{Curve: curve, X: sx, Y: sy}
+
+	h := sha256.New()
+	h.Write([]byte(StealthKDFLabel))
+	h.Write(shared.SerializeCompressed())
+
+	tweak := new(big.Int).SetBytes(h.Sum(nil))
+	tweak.Mod(tweak, curve.N)
+	if tweak.Sign() == 0 {
+		return secp256k1.PubKeySecp256k1{}, errors.New("invalid stealth tweak")
+	}
+
+	tx, ty := curve.ScalarBaseMult(tweak.Bytes())
+	px, py := curve.Add(spendPub.X, spendPub.Y, tx, ty)
+	oneTime := btcec.PublicKey{Curve: curve, X: px, Y: py}
+
+	var pub secp256k1.PubKeySecp256k1
+	copy(pub[:], oneTime.SerializeCompressed())
+
+	return pub, nil
+}
+
+// parseSecp256k1PubKey parses pub as a point of the secp256k1 curve.
+func parseSecp256k1PubKey(pub tmcrypto.PubKey) (*btcec.PublicKey, error) {
+	key, ok := pub.(secp256k1.PubKeySecp256k1)
+	if !ok {
+		return nil, ErrCurveMismatch
+	}
+
+	parsed, err := btcec.ParsePubKey(key[:], btcec.S256())
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid public key")
+	}
+
+	return parsed, nil
+}
@@ -1,6 +1,14 @@
 package keyring
 
-import "github.com/tendermint/tendermint/crypto"
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/tendermint/tendermint/crypto"
+)
 
 // Language is a language to create the BIP 39 mnemonic in.
 // Currently, only english is supported though.
@@ -35,8 +43,75 @@ const (
 	defaultEntropySize = 256
 	addressSuffix      = "address"
 	infoSuffix         = "info"
+	exportAuditSuffix  = "exportaudit"
+	modifiedSuffix     = "modified"
+)
+
+// SignatureEncoding defines the text encoding of signatures returned by
+// SignEncoded.
+type SignatureEncoding string
+
+const (
+	// SignatureEncodingRaw encodes signatures as unpadded standard base64.
+	SignatureEncodingRaw SignatureEncoding = "raw"
+	// SignatureEncodingHex encodes signatures as lower case hex.
+	SignatureEncodingHex SignatureEncoding = "hex"
+	// SignatureEncodingBase64 encodes signatures as padded standard base64.
+	SignatureEncodingBase64 SignatureEncoding = "base64"
 )
 
+// Encode returns the signature encoded with the encoding.
+func (enc SignatureEncoding) Encode(sig []byte) (string, error) {
+	switch enc {
+	case SignatureEncodingRaw:
+		return base64.RawStdEncoding.EncodeToString(sig), nil
+
+	case SignatureEncodingHex:
+		return hex.EncodeToString(sig), nil
+
+	case SignatureEncodingBase64:
+		return base64.StdEncoding.EncodeToString(sig), nil
+
+	default:
+		return "", fmt.Errorf("unsupported signature encoding: %s", enc)
+	}
+}
+
+// fingerprintSize is the number of bytes of the public key hash used as the key
+// fingerprint.
+const fingerprintSize = 8
+
+// KeyFingerprint associates a key name with the fingerprint of its public key.
+type KeyFingerprint struct {
+	Name        string `json:"name"`
+	Fingerprint string `json:"fingerprint"`
+}
+
+// KeyCapabilities describes the operations which are possible with a key given
+// its type and the options of the keyring.
+type KeyCapabilities struct {
+	Name          string `json:"name"`
+	CanSign       bool   `json:"can_sign"`
+	CanExportPriv bool   `json:"can_export_priv"`
+	IsMultisig    bool   `json:"is_multisig"`
+	IsLedger      bool   `json:"is_ledger"`
+}
+
+// PubKeyFingerprint returns the hex encoded first 8 bytes of the SHA-256 hash
+// of the public key bytes. As it only depends on the public key, it identifies
+// a key across keyrings and backends.
+func PubKeyFingerprint(pub crypto.PubKey) string {
+	hash := sha256.Sum256(pub.Bytes())
+	return hex.EncodeToString(hash[:fingerprintSize])
+}
+
+// ExportRecord is an entry of the export audit log of a key. It records that
+// the private key material left the keyring.
+type ExportRecord struct {
+	Name string    `json:"name"`
+	Time time.Time `json:"time"`
+}
+
 // KeyType reflects a human-readable type for key listing.
 type KeyType uint
 
@@ -46,6 +121,7 @@ const (
 	TypeLedger  KeyType = 1
 	TypeOffline KeyType = 2
 	TypeMulti   KeyType = 3
+	TypeFIDO2   KeyType = 4
 )
 
 var keyTypes = map[KeyType]string{
@@ -53,6 +129,7 @@ var keyTypes = map[KeyType]string{
 	TypeLedger:  "ledger",
 	TypeOffline: "offline",
 	TypeMulti:   "multi",
+	TypeFIDO2:   "fido2",
 }
 
 // String implements the stringer interface for KeyType.
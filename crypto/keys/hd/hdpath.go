@@ -171,9 +171,20 @@ func ComputeMastersFromSeed(seed []byte) (secret [32]byte, chainCode [32]byte) {
 // DerivePrivateKeyForPath derives the private key by following the BIP 32/44 path from privKeyBytes,
 // using the given chainCode.
 func DerivePrivateKeyForPath(privKeyBytes [32]byte, chainCode [32]byte, path string) ([32]byte, error) {
+	derivedKey, _, err := DeriveExtendedPrivateKeyForPath(privKeyBytes, chainCode, path)
+	return derivedKey, err
+}
+
+// DeriveExtendedPrivateKeyForPath derives the private key and its chain code by following
+// the BIP 32/44 path from privKeyBytes, using the given chainCode. The returned chain code
+// allows further derivation relative to the derived key.
+func DeriveExtendedPrivateKeyForPath(privKeyBytes [32]byte, chainCode [32]byte, path string) ([32]byte, [32]byte, error) {
 	data := privKeyBytes
 	parts := strings.Split(path, "/")
 	for _, part := range parts {
+		if part == "" {
+			return [32]byte{}, [32]byte{}, errors.New("invalid BIP 32 path: empty path component")
+		}
 		// do we have an apostrophe?
 		harden := part[len(part)-1:] == "'"
 		// harden == private derivation, else public derivation:
@@ -182,20 +193,20 @@ func DerivePrivateKeyForPath(privKeyBytes [32]byte, chainCode [32]byte, path str
 		}
 		idx, err := strconv.Atoi(part)
 		if err != nil {
-			return [32]byte{}, fmt.Errorf("invalid BIP 32 path: %s", err)
+			return [32]byte{}, [32]byte{}, fmt.Errorf("invalid BIP 32 path: %s", err)
 		}
 		if idx < 0 {
-			return [32]byte{}, errors.New("invalid BIP 32 path: index negative ot too large")
+			return [32]byte{}, [32]byte{}, errors.New("invalid BIP 32 path: index negative ot too large")
 		}
 		data, chainCode = derivePrivateKey(data, chainCode, uint32(idx), harden)
 	}
 	var derivedKey [32]byte
 	n := copy(derivedKey[:], data[:])
 	if n != 32 || len(data) != 32 {
-		return [32]byte{}, fmt.Errorf("expected a (secp256k1) key of length 32, got length: %v", len(data))
+		return [32]byte{}, [32]byte{}, fmt.Errorf("expected a (secp256k1) key of length 32, got length: %v", len(data))
 	}
 
-	return derivedKey, nil
+	return derivedKey, chainCode, nil
 }
 
 // derivePrivateKey derives the private key with index and chainCode.
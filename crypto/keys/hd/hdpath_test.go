@@ -188,3 +188,38 @@ func ExampleSomeBIP32TestVecs() {
 	//
 	// c4c11d8c03625515905d7e89d25dfc66126fbc629ecca6db489a1a72fc4bda78
 }
+
+func TestParseExtendedPrivKey(t *testing.T) {
+	// BIP 32 test vector 1: m and m/0'
+	master, masterCh := ComputeMastersFromSeed([]byte{
+		0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f,
+	})
+
+	priv, ch, err := ParseExtendedPrivKey("xprv9s21ZrQH143K3QTDL4LXw2F7HEK3wJUD2nW2nRk4stbPy6cq3jPPqjiChkVvvNKmPGJxWUtg6LnF5kejMRNNU3TGtRBeJgk33yuGBxrMPHi")
+	require.NoError(t, err)
+	require.Equal(t, master, priv)
+	require.Equal(t, masterCh, ch)
+
+	priv, ch, err = ParseExtendedPrivKey("xprv9uHRZZhk6KAJC1avXpDAp4MDc3sQKNxDiPvvkX8Br5ngLNv1TxvUxt4cV1rGL5hj6KCesnDYUhd7oWgT11eZG7XnxHrnYeSvkzY7d2bhkJ7")
+	require.NoError(t, err)
+	require.Equal(t, "edb2e14f9ee77d26dd93b4ecede8d16ed408ce149b6cd80b0715a2d911a0afea", hex.EncodeToString(priv[:]))
+	require.Equal(t, "47fdacbd0f1097043b78c63c20c34ef4ed9a111d980047ad16282c7ae6236141", hex.EncodeToString(ch[:]))
+
+	// testnet keys are accepted
+	priv, _, err = ParseExtendedPrivKey("tprv8ZgxMBicQKsPeDgjzdC36fs6bMjGApWDNLR9erAXMs5skhMv36j9MV5ecvfavji5khqjWaWSFhN3YcCUUdiKH6isR4Pwy3U5y5egddBr16m")
+	require.NoError(t, err)
+	require.Equal(t, master, priv)
+
+	for _, tc := range []struct {
+		xprv string
+		err  string
+	}{
+		{"xpub661MyMwAqRbcFtXgS5sYJABqqG9YLmC4Q1Rdap9gSE8NqtwybGhePY2gYweD1YUMnzkxQw1bm6XhhCCXF5rvDu3SQRW2A1Z5yqnVwyY4cNT", "extended public keys are not supported"},
+		{"xprv9s21ZrQH143K3QTDL4LXw2F7HEK3wJUD2nW2nRk4stbPy6cq3jPPqjiChkVvvNKmPGJxWUtg6LnF5kejMRNNU3TGtRBeJgk33yuGBxrMPHj", "invalid base58check checksum"},
+		{"xprv0s21ZrQH143K3QTDL4LXw2F7HEK3wJUD2nW2nRk4stbPy6cq3jPPqjiChkVvvNKmPGJxWUtg6LnF5kejMRNNU3TGtRBeJgk33yuGBxrMPHi", "invalid base58 character '0'"},
+		{"", "invalid base58check encoding: too short"},
+	} {
+		_, _, err := ParseExtendedPrivKey(tc.xprv)
+		require.EqualError(t, err, tc.err)
+	}
+}
@@ -0,0 +1,97 @@
+package hd
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcec"
+)
+
+// Version bytes of serialized BIP 32 extended keys.
+var (
+	xprvVersion = []byte{0x04, 0x88, 0xAD, 0xE4} // mainnet private
+	tprvVersion = []byte{0x04, 0x35, 0x83, 0x94} // testnet private
+	xpubVersion = []byte{0x04, 0x88, 0xB2, 0x1E} // mainnet public
+	tpubVersion = []byte{0x04, 0x35, 0x87, 0xCF} // testnet public
+)
+
+// extendedKeyLen is the length of a serialized extended key without checksum:
+// version (4) || depth (1) || parent fingerprint (4) || child number (4) ||
+// chain code (32) || key data (33).
+const extendedKeyLen = 78
+
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+// ParseExtendedPrivKey parses a Base58Check serialized BIP 32 extended private
+// key (xprv or tprv) and returns its private key and chain code. Extended
+// public keys are rejected.
+func ParseExtendedPrivKey(xprv string) (privKey [32]byte, chainCode [32]byte, err error) {
+	bz, err := base58CheckDecode(xprv)
+	if err != nil {
+		return privKey, chainCode, err
+	}
+
+	if len(bz) != extendedKeyLen {
+		return privKey, chainCode, fmt.Errorf("invalid extended key length: %d", len(bz))
+	}
+
+	version := bz[:4]
+	switch {
+	case bytes.Equal(version, xprvVersion), bytes.Equal(version, tprvVersion):
+	case bytes.Equal(version, xpubVersion), bytes.Equal(version, tpubVersion):
+		return privKey, chainCode, errors.New("extended public keys are not supported")
+	default:
+		return privKey, chainCode, fmt.Errorf("unsupported extended key version: %X", version)
+	}
+
+	keyData := bz[45:]
+	if keyData[0] != 0 {
+		return privKey, chainCode, errors.New("invalid extended private key data")
+	}
+
+	k := new(big.Int).SetBytes(keyData[1:])
+	if k.Sign() == 0 || k.Cmp(btcec.S256().N) >= 0 {
+		return privKey, chainCode, errors.New("extended private key out of range")
+	}
+
+	copy(chainCode[:], bz[13:45])
+	copy(privKey[:], keyData[1:])
+
+	return privKey, chainCode, nil
+}
+
+// base58CheckDecode decodes s and verifies its 4 bytes double SHA-256 checksum.
+func base58CheckDecode(s string) ([]byte, error) {
+	n := new(big.Int)
+	radix := big.NewInt(58)
+	for _, c := range s {
+		i := strings.IndexRune(base58Alphabet, c)
+		if i < 0 {
+			return nil, fmt.Errorf("invalid base58 character %q", c)
+		}
+
+		n.Mul(n, radix)
+		n.Add(n, big.NewInt(int64(i)))
+	}
+
+	// leading '1's encode leading zero bytes
+	zeros := len(s) - len(strings.TrimLeft(s, "1"))
+	bz := append(make([]byte, zeros), n.Bytes()...)
+
+	if len(bz) < 4 {
+		return nil, errors.New("invalid base58check encoding: too short")
+	}
+
+	payload, checksum := bz[:len(bz)-4], bz[len(bz)-4:]
+	first := sha256.Sum256(payload)
+	second := sha256.Sum256(first[:])
+	if !bytes.Equal(checksum, second[:4]) {
+		return nil, errors.New("invalid base58check checksum")
+	}
+
+	return payload, nil
+}
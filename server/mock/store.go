@@ -99,6 +99,14 @@ func (ms multiStore) SetInterBlockCache(_ sdk.MultiStorePersistentCache) {
 	panic("not implemented")
 }
 
+func (ms multiStore) EarliestVersion() int64 {
+	panic("not implemented")
+}
+
+func (ms multiStore) CacheMultiStoreWithWrapper(_ func(sdk.StoreKey, sdk.KVStore) sdk.KVStore) sdk.CacheMultiStore {
+	panic("not implemented")
+}
+
 var _ sdk.KVStore = kvStore{}
 
 type kvStore struct {
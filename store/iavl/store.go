@@ -163,6 +163,19 @@ func (st *Store) SetPruning(_ types.PruningOptions) {
 	panic("cannot set pruning options on an initialized IAVL store")
 }
 
+// EarliestVersion returns the earliest version of the store which has not been
+// pruned. Besides the latest version, only the versions flushed to disk, i.e.
+// multiples of KeepEvery, may be available.
+func (st *Store) EarliestVersion() int64 {
+	// the tree drops pruned versions from its available versions, which are
+	// sorted in ascending order
+	if versions := st.tree.AvailableVersions(); len(versions) > 0 {
+		return int64(versions[0])
+	}
+
+	return st.tree.Version()
+}
+
 // VersionExists returns whether or not a given version is stored.
 func (st *Store) VersionExists(version int64) bool {
 	return st.tree.VersionExists(version)
@@ -300,6 +313,44 @@ func (st *Store) Query(req abci.RequestQuery) (res abci.ResponseQuery) {
 			_, res.Value = tree.GetVersioned(key, res.Height)
 		}
 
+	case "/key-with-version": // get by key along with the version it was last written at
+		key := req.Data // data holds the key bytes
+
+		res.Key = key
+		if !st.VersionExists(res.Height) {
+			res.Log = iavl.ErrVersionDoesNotExist.Error()
+			break
+		}
+
+		// The leaf node of an existence proof carries the version at which the
+		// key was last written. The proof, if requested, proves the value of the
+		// key, not its encoding along with the version: the version is hashed in
+		// the proven leaf though.
+		value, proof, err := tree.GetVersionedWithProof(key, res.Height)
+		if err != nil {
+			res.Log = err.Error()
+			break
+		}
+		if req.Prove {
+			if value != nil {
+				res.Proof = &merkle.Proof{Ops: []merkle.ProofOp{iavl.NewValueOp(key, proof).ProofOp()}}
+			} else {
+				res.Proof = &merkle.Proof{Ops: []merkle.ProofOp{iavl.NewAbsenceOp(key, proof).ProofOp()}}
+			}
+		}
+		if value == nil {
+			// like for "/key", a missing key results in an empty value
+			break
+		}
+		if proof == nil || len(proof.Leaves) == 0 {
+			return sdkerrors.QueryResult(sdkerrors.Wrapf(sdkerrors.ErrInvalidRequest, "no version metadata available for key %X", key))
+		}
+
+		res.Value = cdc.MustMarshalBinaryBare(types.VersionedValue{
+			Value:   value,
+			Version: proof.Leaves[0].Version,
+		})
+
 	case "/subspace":
 		var KVs []types.KVPair
 
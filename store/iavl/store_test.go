@@ -452,6 +452,12 @@ func testPruning(t *testing.T, numRecent int64, storeEvery int64, snapshotEvery
 				ver, step, numRecent, snapshotEvery, storeEvery)
 		}
 
+		earliest := int64(0)
+		if len(state.stored) > 0 {
+			earliest = state.stored[0]
+		}
+		require.Equal(t, earliest, iavlStore.EarliestVersion(), "earliest version with latest version %d", step)
+
 		nextVersion(iavlStore)
 	}
 }
@@ -592,6 +598,51 @@ func TestIAVLStoreQuery(t *testing.T) {
 	require.Equal(t, v1, qres.Value)
 }
 
+func TestIAVLStoreQueryKeyWithVersion(t *testing.T) {
+	db := dbm.NewMemDB()
+	tree, err := iavl.NewMutableTree(db, cacheSize)
+	require.NoError(t, err)
+
+	iavlStore := UnsafeNewStore(tree, types.PruneNothing)
+
+	k1, v1 := []byte("key1"), []byte("val1")
+	k2, v2 := []byte("key2"), []byte("val2")
+
+	iavlStore.Set(k1, v1)
+	cid1 := iavlStore.Commit()
+
+	iavlStore.Set(k2, v2)
+	cid2 := iavlStore.Commit()
+
+	// k1 was written at the first version and left untouched afterwards
+	query := abci.RequestQuery{Path: "/key-with-version", Data: k1, Height: cid2.Version}
+	qres := iavlStore.Query(query)
+	require.Equal(t, uint32(0), qres.Code)
+
+	var vv types.VersionedValue
+	require.NoError(t, cdc.UnmarshalBinaryBare(qres.Value, &vv))
+	require.Equal(t, v1, vv.Value)
+	require.Equal(t, cid1.Version, vv.Version)
+
+	query.Data = k2
+	qres = iavlStore.Query(query)
+	require.Equal(t, uint32(0), qres.Code)
+	require.NoError(t, cdc.UnmarshalBinaryBare(qres.Value, &vv))
+	require.Equal(t, v2, vv.Value)
+	require.Equal(t, cid2.Version, vv.Version)
+
+	// missing keys result in an empty value, like for "/key"
+	query.Data = []byte("key3")
+	qres = iavlStore.Query(query)
+	require.Equal(t, uint32(0), qres.Code)
+	require.Nil(t, qres.Value)
+
+	query.Prove = true
+	qres = iavlStore.Query(query)
+	require.Equal(t, uint32(0), qres.Code)
+	require.NotNil(t, qres.Proof)
+}
+
 func BenchmarkIAVLIteratorNext(b *testing.B) {
 	db := dbm.NewMemDB()
 	treeSize := 1000
@@ -29,10 +29,11 @@ func (proof *MultiStoreProof) ComputeRootHash() []byte {
 // RequireProof returns whether proof is required for the subpath.
 func RequireProof(subpath string) bool {
 	// XXX: create a better convention.
-	// Currently, only when query subpath is "/key", will proof be included in
-	// response. If there are some changes about proof building in iavlstore.go,
-	// we must change code here to keep consistency with iavlStore#Query.
-	return subpath == "/key"
+	// Currently, only when query subpath is "/key" or "/key-with-version", will
+	// proof be included in response. If there are some changes about proof
+	// building in iavlstore.go, we must change code here to keep consistency with
+	// iavlStore#Query.
+	return subpath == "/key" || subpath == "/key-with-version"
 }
 
 //-----------------------------------------------------------------------------
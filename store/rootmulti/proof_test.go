@@ -176,3 +176,53 @@ func TestVerifyMultiStoreQueryProofAbsence(t *testing.T) {
 	err = prt.VerifyValue(res.Proof, cid.Hash, "/iavlStoreKey/MYABSENTKEY", []byte(""))
 	require.NotNil(t, err)
 }
+
+func TestVerifyMultiStoreQueryKeyWithVersionProof(t *testing.T) {
+	db := dbm.NewMemDB()
+	store := NewStore(db)
+	iavlStoreKey := types.NewKVStoreKey("iavlStoreKey")
+
+	store.MountStoreWithDB(iavlStoreKey, types.StoreTypeIAVL, nil)
+	require.NoError(t, store.LoadVersion(0))
+
+	iavlStore := store.GetCommitStore(iavlStoreKey).(*iavl.Store)
+	iavlStore.Set([]byte("MYKEY"), []byte("MYVALUE"))
+	cid := store.Commit()
+
+	require.True(t, RequireProof("/key-with-version"))
+
+	// Get Proof
+	res := store.Query(abci.RequestQuery{
+		Path:  "/iavlStoreKey/key-with-version",
+		Data:  []byte("MYKEY"),
+		Prove: true,
+	})
+	require.Equal(t, uint32(0), res.Code)
+	require.NotNil(t, res.Proof)
+
+	// Verify proof of the raw value.
+	var vv types.VersionedValue
+	require.NoError(t, cdc.UnmarshalBinaryBare(res.Value, &vv))
+	require.Equal(t, cid.Version, vv.Version)
+
+	prt := DefaultProofRuntime()
+	err := prt.VerifyValue(res.Proof, cid.Hash, "/iavlStoreKey/MYKEY", vv.Value)
+	require.Nil(t, err)
+
+	// Verify (bad) proof.
+	err = prt.VerifyValue(res.Proof, cid.Hash, "/iavlStoreKey/MYKEY", res.Value)
+	require.NotNil(t, err)
+
+	// Get Proof of absence
+	res = store.Query(abci.RequestQuery{
+		Path:  "/iavlStoreKey/key-with-version",
+		Data:  []byte("MYABSENTKEY"),
+		Prove: true,
+	})
+	require.Equal(t, uint32(0), res.Code)
+	require.Nil(t, res.Value)
+	require.NotNil(t, res.Proof)
+
+	err = prt.VerifyAbsence(res.Proof, cid.Hash, "/iavlStoreKey/MYABSENTKEY")
+	require.Nil(t, err)
+}
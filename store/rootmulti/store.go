@@ -127,6 +127,32 @@ func (rs *Store) GetCommitKVStore(key types.StoreKey) types.CommitKVStore {
 	return rs.stores[key]
 }
 
+// EarliestVersion implements CommitMultiStore. It returns the latest of the
+// earliest versions of the mounted IAVL stores.
+func (rs *Store) EarliestVersion() int64 {
+	var earliest int64
+	found := false
+
+	for key, store := range rs.stores {
+		if store.GetStoreType() != types.StoreTypeIAVL {
+			continue
+		}
+
+		// If the store is wrapped with an inter-block cache, we must first unwrap
+		// it to get the underlying IAVL store.
+		version := rs.GetCommitKVStore(key).(*iavl.Store).EarliestVersion()
+		if !found || version > earliest {
+			earliest, found = version, true
+		}
+	}
+
+	if !found {
+		return rs.LastCommitID().Version
+	}
+
+	return earliest
+}
+
 // LoadLatestVersionAndUpgrade implements CommitMultiStore
 func (rs *Store) LoadLatestVersionAndUpgrade(upgrades *types.StoreUpgrades) error {
 	ver := getLatestVersion(rs.db)
@@ -289,17 +315,20 @@ func (rs *Store) LastCommitID() types.CommitID {
 	return rs.lastCommitInfo.CommitID()
 }
 
-// Commit implements Committer/CommitStore.
+// Commit implements Committer/CommitStore. A Commit which panics may be
+// retried: the stores committed by the failed attempt are not committed again
+// and the version is only bumped once all the stores are committed.
 func (rs *Store) Commit() types.CommitID {
 
 	// Commit stores.
 	version := rs.lastCommitInfo.Version + 1
-	rs.lastCommitInfo = commitStores(version, rs.stores)
+	cInfo := commitStores(version, rs.stores)
 
 	// write CommitInfo to disk only if this version was flushed to disk
 	if rs.pruningOpts.FlushVersion(version) {
-		flushCommitInfo(rs.db, version, rs.lastCommitInfo)
+		flushCommitInfo(rs.db, version, cInfo)
 	}
+	rs.lastCommitInfo = cInfo
 
 	// Prepare for next version.
 	commitID := types.CommitID{
@@ -333,6 +362,19 @@ func (rs *Store) CacheMultiStore() types.CacheMultiStore {
 	return cachemulti.NewStore(rs.db, stores, rs.keysByName, rs.traceWriter, rs.traceContext)
 }
 
+// CacheMultiStoreWithWrapper implements CommitMultiStore. The stores passed to
+// wrap may be wrapped in an inter-block cache.
+func (rs *Store) CacheMultiStoreWithWrapper(
+	wrap func(types.StoreKey, types.KVStore) types.KVStore,
+) types.CacheMultiStore {
+	stores := make(map[types.StoreKey]types.CacheWrapper)
+	for k, v := range rs.stores {
+		stores[k] = wrap(k, v)
+	}
+
+	return cachemulti.NewStore(rs.db, stores, rs.keysByName, rs.traceWriter, rs.traceContext)
+}
+
 // CacheMultiStoreWithVersion is analogous to CacheMultiStore except that it
 // attempts to load stores at a given version (height). An error is returned if
 // any store cannot be loaded. This should only be used for querying and
@@ -430,6 +472,13 @@ func (rs *Store) Query(req abci.RequestQuery) abci.ResponseQuery {
 		return sdkerrors.QueryResult(sdkerrors.Wrapf(sdkerrors.ErrUnknownRequest, "store %s (type %T) doesn't support queries", storeName, store))
 	}
 
+	// only IAVL stores keep track of the version at which a key was last written
+	if subpath == "/key-with-version" {
+		if _, ok := store.(*iavl.Store); !ok {
+			return sdkerrors.QueryResult(sdkerrors.Wrapf(sdkerrors.ErrUnknownRequest, "store %s (type %T) doesn't expose version metadata", storeName, store))
+		}
+	}
+
 	// trim the path and make the query
 	req.Path = subpath
 	res := queryable.Query(req)
@@ -636,7 +685,12 @@ func commitStores(version int64, storeMap map[types.StoreKey]types.CommitKVStore
 	storeInfos := make([]storeInfo, 0, len(storeMap))
 
 	for key, store := range storeMap {
-		commitID := store.Commit()
+		// a store committed at version by a failed attempt to commit the
+		// multistore is not committed again
+		commitID := store.LastCommitID()
+		if commitID.Version != version {
+			commitID = store.Commit()
+		}
 
 		if store.GetStoreType() == types.StoreTypeTransient {
 			continue
@@ -114,6 +114,53 @@ func TestHashStableWithEmptyCommit(t *testing.T) {
 	require.Equal(t, hash, cID.Hash)
 }
 
+// failingCommitStore panics on the commit numbered failAt of the stores sharing
+// commits.
+type failingCommitStore struct {
+	types.CommitKVStore
+
+	commits *int
+	failAt  int
+}
+
+func (s failingCommitStore) Commit() types.CommitID {
+	*s.commits++
+	if *s.commits == s.failAt {
+		panic("commit failure")
+	}
+
+	return s.CommitKVStore.Commit()
+}
+
+func TestMultistoreCommitRetry(t *testing.T) {
+	k, v := []byte("wind"), []byte("blows")
+
+	expected := newMultiStoreWithMounts(dbm.NewMemDB(), types.PruneNothing)
+	require.NoError(t, expected.LoadLatestVersion())
+	expected.getStoreByName("store1").(types.KVStore).Set(k, v)
+	expectedID := expected.Commit()
+
+	ms := newMultiStoreWithMounts(dbm.NewMemDB(), types.PruneNothing)
+	require.NoError(t, ms.LoadLatestVersion())
+	ms.getStoreByName("store1").(types.KVStore).Set(k, v)
+
+	// the second store committed fails, after a first one was committed
+	commits := 0
+	for key, store := range ms.stores {
+		ms.stores[key] = failingCommitStore{CommitKVStore: store, commits: &commits, failAt: 2}
+	}
+	require.Panics(t, func() { ms.Commit() })
+	require.Equal(t, int64(0), ms.LastCommitID().Version)
+
+	// the retry commits the remaining stores at the same version
+	commitID := ms.Commit()
+	require.Equal(t, expectedID, commitID)
+	require.Equal(t, len(ms.stores)+1, commits)
+	for _, store := range ms.stores {
+		require.Equal(t, int64(1), store.LastCommitID().Version)
+	}
+}
+
 func TestMultistoreCommitLoad(t *testing.T) {
 	var db dbm.DB = dbm.NewMemDB()
 	store := newMultiStoreWithMounts(db, types.PruneNothing)
@@ -162,6 +162,15 @@ type CommitMultiStore interface {
 	// Set an inter-block (persistent) cache that maintains a mapping from
 	// StoreKeys to CommitKVStores.
 	SetInterBlockCache(MultiStorePersistentCache)
+
+	// EarliestVersion returns the earliest version which is available in all
+	// the versioned stores, i.e. which has not been pruned.
+	EarliestVersion() int64
+
+	// CacheMultiStoreWithWrapper is analogous to CacheMultiStore except that
+	// the mounted stores are passed through wrap before being cache wrapped,
+	// e.g. to observe the writes of the returned cache.
+	CacheMultiStoreWithWrapper(wrap func(StoreKey, KVStore) KVStore) CacheMultiStore
 }
 
 //---------subsp-------------------------------
@@ -338,6 +347,13 @@ func (key *TransientStoreKey) String() string {
 // key-value result for iterator queries
 type KVPair tmkv.Pair
 
+// VersionedValue is the result of a key-with-version query. Version is the
+// store version at which the key was last written.
+type VersionedValue struct {
+	Value   []byte `json:"value"`
+	Version int64  `json:"version"`
+}
+
 //----------------------------------------
 
 // TraceContext contains TraceKVStore context data. It will be written with
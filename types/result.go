@@ -257,6 +257,17 @@ func NewSearchTxsResult(totalCount, count, page, limit int, txs []TxResponse) Se
 	}
 }
 
+// TxTraceResponse defines the response of a tx trace query. It contains the
+// gas and result of the traced execution along with the store operations the
+// tx performed, each encoded as a JSON trace operation.
+type TxTraceResponse struct {
+	GasInfo   GasInfo           `json:"gas_info"`
+	Result    *Result           `json:"result,omitempty"`
+	Error     string            `json:"error,omitempty"`
+	Trace     []json.RawMessage `json:"trace"`
+	Truncated bool              `json:"truncated"`
+}
+
 // ParseABCILogs attempts to parse a stringified ABCI tx log into a slice of
 // ABCIMessageLog types. It returns an error upon JSON decoding failure.
 func ParseABCILogs(logs string) (res ABCIMessageLogs, err error) {
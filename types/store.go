@@ -136,6 +136,9 @@ func InclusiveEndBytes(inclusiveBytes []byte) (exclusiveBytes []byte) {
 // key-value result for iterator queries
 type KVPair = types.KVPair
 
+// value and last-written version result for key-with-version queries
+type VersionedValue = types.VersionedValue
+
 //----------------------------------------
 
 // TraceContext contains TraceKVStore context data. It will be written with
@@ -1,6 +1,7 @@
 package types
 
 import (
+	"encoding/json"
 	"fmt"
 	"testing"
 
@@ -12,6 +13,7 @@ import (
 	yaml "gopkg.in/yaml.v2"
 
 	"github.com/cosmos/cosmos-sdk/codec"
+	"github.com/cosmos/cosmos-sdk/crypto/keyring"
 	sdk "github.com/cosmos/cosmos-sdk/types"
 	sdkerrors "github.com/cosmos/cosmos-sdk/types/errors"
 )
@@ -59,6 +61,21 @@ func TestStdSignBytes(t *testing.T) {
 	}
 }
 
+func TestKeyringStdSignDocBytes(t *testing.T) {
+	fee := NewTestStdFee()
+	msgs := []sdk.Msg{sdk.NewTestMsg(addr)}
+
+	doc := keyring.StdSignDoc{
+		AccountNumber: 3,
+		ChainID:       "1234",
+		Fee:           json.RawMessage(fee.Bytes()),
+		Memo:          "memo",
+		Msgs:          []json.RawMessage{msgs[0].GetSignBytes()},
+		Sequence:      6,
+	}
+	require.Equal(t, StdSignBytes("1234", 3, 6, fee, msgs, "memo"), doc.Bytes())
+}
+
 func TestTxValidateBasic(t *testing.T) {
 	ctx := sdk.NewContext(nil, abci.Header{ChainID: "mychainid"}, false, log.NewNopLogger())
 